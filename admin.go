@@ -0,0 +1,104 @@
+package prestgo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrQueryNotFound is returned when the coordinator does not know the query with the ID
+// given, because it never ran there or has been forgotten since it ended.
+var ErrQueryNotFound = errors.New(DriverName + ": query not found")
+
+// AdminConn is implemented by the connections of the driver, allowing tools built on them to
+// manage queries running on the cluster, including those submitted elsewhere. Callers using
+// database/sql reach it through sql.Conn.
+type AdminConn interface {
+	// KillQuery terminates the query with the given ID.
+	KillQuery(ctx context.Context, queryID string) error
+
+	// DescribeQuery returns the details of the query with the given ID, such as its state,
+	// stages, statistics and failure.
+	DescribeQuery(ctx context.Context, queryID string) (*QueryDetails, error)
+}
+
+var _ AdminConn = &conn{}
+
+// KillQuery asks the coordinator at addr, given as host:port or as a URL such as
+// https://host:port, to terminate the query with the given ID. The driver's own client is
+// used if client is nil. It returns ErrQueryNotFound if the coordinator does not know the
+// query.
+func KillQuery(ctx context.Context, client *http.Client, addr, queryID string) error {
+	if client == nil {
+		client = defaultClient
+	}
+	c := &conn{client: client}
+	return c.killQuery(ctx, addr, queryID)
+}
+
+// KillQuery terminates the query with the given ID. When several coordinators are listed or
+// discovered, each is asked in turn until one knows the query.
+func (c *conn) KillQuery(ctx context.Context, queryID string) error {
+	addrs, err := c.coordinatorAddrs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if err = c.killQuery(ctx, addr, queryID); err != ErrQueryNotFound {
+			break
+		}
+	}
+	return err
+}
+
+// coordinatorAddrs returns the addresses of the connection's coordinators.
+func (c *conn) coordinatorAddrs(ctx context.Context) ([]string, error) {
+	b := c.balancer
+	if b == nil {
+		return []string{c.addr}, nil
+	}
+	if b.srv != "" {
+		if err := b.discover(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return b.addrs(), nil
+}
+
+// killQuery asks the coordinator at addr to terminate the query with the given ID.
+func (c *conn) killQuery(ctx context.Context, addr, queryID string) error {
+	resp, err := c.admin(ctx, "DELETE", addr, "/v1/query/"+url.PathEscape(queryID))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	case http.StatusNotFound, http.StatusGone:
+		return ErrQueryNotFound
+	}
+	return newHTTPError(resp)
+}
+
+// admin sends a request for the resource at path to the coordinator at addr, as the
+// connection's user if it has one.
+func (c *conn) admin(ctx context.Context, method, addr, path string) (*http.Response, error) {
+	base := addr
+	if !strings.Contains(base, "://") {
+		base = "http://" + base
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(base, "/")+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.user != "" {
+		req.Header.Set("X-Presto-User", c.user)
+	}
+	return c.do(req.WithContext(ctx))
+}
@@ -0,0 +1,63 @@
+package prestgo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// killHandler records the queries it is asked to kill, knowing only the query with the ID
+// known.
+func killHandler(known string, killed *[]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			http.Error(w, "unexpected method", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.URL.Path != "/v1/query/"+known {
+			http.NotFound(w, r)
+			return
+		}
+		*killed = append(*killed, r.Header.Get("X-Presto-User")+" "+r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func TestKillQuery(t *testing.T) {
+	var killed []string
+	ts := httptest.NewServer(killHandler("20170301_120000_00001_abcde", &killed))
+	defer ts.Close()
+
+	for _, addr := range []string{ts.Listener.Addr().String(), ts.URL} {
+		if err := KillQuery(context.Background(), nil, addr, "20170301_120000_00001_abcde"); err != nil {
+			t.Errorf("%s: %v", addr, err)
+		}
+	}
+	if len(killed) != 2 {
+		t.Errorf("got %q killed, wanted the query killed twice", killed)
+	}
+	if err := KillQuery(context.Background(), nil, ts.URL, "20170301_120000_00002_abcde"); err != ErrQueryNotFound {
+		t.Errorf("got error %v, wanted %v", err, ErrQueryNotFound)
+	}
+}
+
+func TestConnKillQuery(t *testing.T) {
+	var killed []string
+	other := httptest.NewServer(killHandler("20170301_120000_00009_zzzzz", &killed))
+	defer other.Close()
+	ts := httptest.NewServer(killHandler("20170301_120000_00001_abcde", &killed))
+	defer ts.Close()
+
+	cn, err := ClientOpen(http.DefaultClient, fmt.Sprintf("presto://ops@%s,%s/hive/default", other.Listener.Addr(), ts.Listener.Addr()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cn.(AdminConn).KillQuery(context.Background(), "20170301_120000_00001_abcde"); err != nil {
+		t.Fatal(err)
+	}
+	if len(killed) != 1 || killed[0] != "ops /v1/query/20170301_120000_00001_abcde" {
+		t.Errorf("got %q killed, wanted the query killed by ops", killed)
+	}
+}
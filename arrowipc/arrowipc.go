@@ -0,0 +1,409 @@
+// Package arrowipc writes the results of Presto queries as Apache Arrow IPC streams, the
+// format read by pyarrow, the Arrow libraries of other languages and the tools built on them
+// such as Parquet writers. Each page of results becomes a record batch, built from the
+// columns decoded by the driver for queries run with a context from
+// prestgo.WithColumnBatches, so that results reach data-science pipelines without passing
+// through driver.Value a row at a time.
+//
+//	conn, err := db.Conn(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	defer conn.Close()
+//	n, err := arrowipc.WriteQuery(ctx, conn, w, "SELECT * FROM orders")
+//
+// Columns of Presto types are written as the following Arrow types:
+//
+//	bigint, integer, smallint, tinyint   Int64, Int32, Int16, Int8
+//	double, real                         Float64, Float32
+//	boolean                              Bool
+//	varbinary                            Binary
+//	date                                 Date32
+//	timestamp                            Timestamp in microseconds, without a time zone
+//	array, map, row                      Utf8 holding the value encoded as JSON
+//	other types                          Utf8 holding the value as sent by the server
+//
+// Every field is nullable.
+package arrowipc
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/avct/prestgo"
+)
+
+// ErrNotColumnar is returned for rows that were not returned by the prestgo driver for a
+// query run with a context from prestgo.WithColumnBatches.
+var ErrNotColumnar = errors.New("arrowipc: rows not read column by column")
+
+// Values of the enumerations of the Arrow IPC format.
+const (
+	metadataV5 = 4
+
+	headerSchema      = 1
+	headerRecordBatch = 3
+
+	typeInt       = 2
+	typeFloat     = 3
+	typeBinary    = 4
+	typeUtf8      = 5
+	typeBool      = 6
+	typeDate      = 8
+	typeTimestamp = 10
+
+	precisionSingle = 1
+	precisionDouble = 2
+	dateDay         = 0
+	unitMicrosecond = 2
+)
+
+// endOfStream marks the end of an IPC stream.
+var endOfStream = []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0}
+
+// column describes how the values of a column are written.
+type column struct {
+	name   string
+	typeID uint8
+	typ    table // the Arrow type, a table of the type union
+	width  int   // bytes of each value of fixed width types
+}
+
+// newColumn returns the column written for a column of the given Presto type, as returned
+// by the ColumnTypeDatabaseTypeName method of the driver's rows.
+func newColumn(name, dbType string) column {
+	base := strings.ToLower(dbType)
+	if i := strings.IndexByte(base, '('); i >= 0 {
+		base = base[:i]
+	}
+	c := column{name: name}
+	switch base {
+	case "bigint":
+		c.typeID, c.width = typeInt, 8
+	case "integer":
+		c.typeID, c.width = typeInt, 4
+	case "smallint":
+		c.typeID, c.width = typeInt, 2
+	case "tinyint":
+		c.typeID, c.width = typeInt, 1
+	case "double":
+		c.typeID, c.width, c.typ = typeFloat, 8, table{i16(precisionDouble)}
+	case "real":
+		c.typeID, c.width, c.typ = typeFloat, 4, table{i16(precisionSingle)}
+	case "boolean":
+		c.typeID = typeBool
+	case "varbinary":
+		c.typeID = typeBinary
+	case "date":
+		c.typeID, c.width, c.typ = typeDate, 4, table{i16(dateDay)}
+	case "timestamp":
+		c.typeID, c.width, c.typ = typeTimestamp, 8, table{i16(unitMicrosecond)}
+	default:
+		c.typeID = typeUtf8
+	}
+	if c.typeID == typeInt {
+		c.typ = table{i32(int32(8 * c.width)), boolean(true)}
+	}
+	if c.typ == nil {
+		c.typ = table{}
+	}
+	return c
+}
+
+// WriteQuery runs query on c, which must be a connection of the prestgo driver, and writes
+// its results to w as an Arrow IPC stream. It returns the number of rows written.
+func WriteQuery(ctx context.Context, c *sql.Conn, w io.Writer, query string) (int64, error) {
+	var n int64
+	err := c.Raw(func(dc interface{}) error {
+		cn, ok := dc.(driver.Conn)
+		if !ok {
+			return ErrNotColumnar
+		}
+		st, err := cn.Prepare(query)
+		if err != nil {
+			return err
+		}
+		defer st.Close()
+		q, ok := st.(driver.StmtQueryContext)
+		if !ok {
+			return ErrNotColumnar
+		}
+		rows, err := q.QueryContext(prestgo.WithColumnBatches(ctx), nil)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		n, err = WriteStream(w, rows)
+		return err
+	})
+	return n, err
+}
+
+// WriteStream writes the results of rows to w as an Arrow IPC stream, a record batch for
+// each page of results. rows must be those of a query run by the prestgo driver with a
+// context from prestgo.WithColumnBatches, from which no rows have been read. It returns the
+// number of rows written.
+func WriteStream(w io.Writer, rows driver.Rows) (int64, error) {
+	cr, ok := rows.(prestgo.ColumnarRows)
+	if !ok {
+		return 0, ErrNotColumnar
+	}
+	typer, ok := rows.(driver.RowsColumnTypeDatabaseTypeName)
+	if !ok {
+		return 0, ErrNotColumnar
+	}
+
+	names := rows.Columns()
+	cols := make([]column, len(names))
+	fields := make(vector, len(names))
+	for i, name := range names {
+		cols[i] = newColumn(name, typer.ColumnTypeDatabaseTypeName(i))
+		fields[i] = table{ref(str(name)), boolean(true), u8(cols[i].typeID), ref(cols[i].typ), {}, ref(vector{})}
+	}
+	if err := writeMessage(w, headerSchema, table{i16(0), ref(fields)}, nil); err != nil {
+		return 0, err
+	}
+
+	var n int64
+	for {
+		b, err := cr.NextBatch()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return n, err
+		}
+		header, body, err := recordBatch(cols, b)
+		if err != nil {
+			return n, err
+		}
+		if err := writeMessage(w, headerRecordBatch, header, body); err != nil {
+			return n, err
+		}
+		n += int64(b.Len)
+	}
+	_, err := w.Write(endOfStream)
+	return n, err
+}
+
+// writeMessage writes an encapsulated message with the given header and body to w.
+func writeMessage(w io.Writer, headerType uint8, header table, body []byte) error {
+	meta := finish(table{i16(metadataV5), u8(headerType), ref(header), i64(int64(len(body)))})
+	var prefix [8]byte
+	binary.LittleEndian.PutUint32(prefix[:], 0xffffffff)
+	binary.LittleEndian.PutUint32(prefix[4:], uint32(len(meta)))
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(meta); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+// batchBody accumulates the buffers of a record batch.
+type batchBody struct {
+	data    []byte
+	nodes   []byte // FieldNode structs
+	buffers []byte // Buffer structs
+}
+
+// node records a field of length values of which nulls are null.
+func (b *batchBody) node(length, nulls int) {
+	b.nodes = appendInt64(b.nodes, int64(length))
+	b.nodes = appendInt64(b.nodes, int64(nulls))
+}
+
+// buffer appends p to the body, padded to a multiple of eight bytes as the format requires.
+func (b *batchBody) buffer(p []byte) {
+	b.buffers = appendInt64(b.buffers, int64(len(b.data)))
+	b.buffers = appendInt64(b.buffers, int64(len(p)))
+	b.data = append(b.data, p...)
+	for len(b.data)%8 != 0 {
+		b.data = append(b.data, 0)
+	}
+}
+
+// recordBatch returns the header and body of the record batch holding b.
+func recordBatch(cols []column, b *prestgo.ColumnBatch) (table, []byte, error) {
+	if len(b.Columns) != len(cols) {
+		return nil, nil, fmt.Errorf("arrowipc: batch has %d columns, wanted %d", len(b.Columns), len(cols))
+	}
+	body := &batchBody{}
+	for i, c := range cols {
+		if err := c.write(body, &b.Columns[i], b.Len); err != nil {
+			return nil, nil, fmt.Errorf("arrowipc: column %s: %v", c.name, err)
+		}
+	}
+	header := table{
+		i64(int64(b.Len)),
+		ref(structs{size: 16, data: body.nodes}),
+		ref(structs{size: 16, data: body.buffers}),
+	}
+	return header, body.data, nil
+}
+
+// write appends the buffers holding the n values of v to body.
+func (c column) write(body *batchBody, v *prestgo.ColumnVector, n int) error {
+	valid, nulls := validity(v.Nulls, n)
+	body.node(n, nulls)
+	body.buffer(valid)
+
+	switch c.typeID {
+	case typeInt:
+		if len(v.Int64s) != n {
+			return errors.New("unexpected values")
+		}
+		values := make([]byte, 0, n*c.width)
+		for _, x := range v.Int64s {
+			values = appendUint(values, uint64(x), c.width)
+		}
+		body.buffer(values)
+	case typeFloat:
+		if len(v.Float64s) != n {
+			return errors.New("unexpected values")
+		}
+		values := make([]byte, 0, n*c.width)
+		for _, x := range v.Float64s {
+			if c.width == 4 {
+				values = appendUint(values, uint64(math.Float32bits(float32(x))), 4)
+			} else {
+				values = appendUint(values, math.Float64bits(x), 8)
+			}
+		}
+		body.buffer(values)
+	case typeBool:
+		if len(v.Bools) != n {
+			return errors.New("unexpected values")
+		}
+		values := make([]byte, (n+7)/8)
+		for i, x := range v.Bools {
+			if x {
+				values[i/8] |= 1 << uint(i%8)
+			}
+		}
+		body.buffer(values)
+	case typeDate, typeTimestamp:
+		if len(v.Strings) != n {
+			return errors.New("unexpected values")
+		}
+		values := make([]byte, 0, n*c.width)
+		for i, s := range v.Strings {
+			var x int64
+			if !v.Nulls[i] {
+				t, err := parseTime(s)
+				if err != nil {
+					return err
+				}
+				if c.typeID == typeDate {
+					x = t.Unix() / (24 * 60 * 60)
+				} else {
+					x = t.Unix()*1e6 + int64(t.Nanosecond()/1e3)
+				}
+			}
+			values = appendUint(values, uint64(x), c.width)
+		}
+		body.buffer(values)
+	default:
+		return writeVariable(body, c.typeID, v, n)
+	}
+	return nil
+}
+
+// writeVariable appends the offsets and data buffers of a column of variable width values.
+func writeVariable(body *batchBody, typeID uint8, v *prestgo.ColumnVector, n int) error {
+	offsets := make([]byte, 0, 4*(n+1))
+	offsets = appendUint(offsets, 0, 4)
+	var data []byte
+	for i := 0; i < n; i++ {
+		switch {
+		case v.Nulls[i]:
+		case typeID == typeBinary:
+			if len(v.Strings) != n {
+				return errors.New("unexpected values")
+			}
+			b, err := base64.StdEncoding.DecodeString(v.Strings[i])
+			if err != nil {
+				return err
+			}
+			data = append(data, b...)
+		case v.Strings != nil:
+			data = append(data, v.Strings[i]...)
+		case v.Values != nil:
+			if s, ok := v.Values[i].(string); ok {
+				data = append(data, s...)
+				break
+			}
+			b, err := json.Marshal(v.Values[i])
+			if err != nil {
+				return err
+			}
+			data = append(data, b...)
+		default:
+			return errors.New("unexpected values")
+		}
+		if len(data) > math.MaxInt32 {
+			return errors.New("values too large for a batch")
+		}
+		offsets = appendUint(offsets, uint64(len(data)), 4)
+	}
+	body.buffer(offsets)
+	body.buffer(data)
+	return nil
+}
+
+// validity returns the bitmap marking which of the n values are not null and the number that
+// are. The bitmap is empty when none are null, as the format allows.
+func validity(nulls []bool, n int) ([]byte, int) {
+	count := 0
+	for _, null := range nulls {
+		if null {
+			count++
+		}
+	}
+	if count == 0 {
+		return nil, 0
+	}
+	bitmap := make([]byte, (n+7)/8)
+	for i, null := range nulls {
+		if !null {
+			bitmap[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return bitmap, count
+}
+
+// parseTime parses a date or timestamp sent by the server, which gives timestamps with up to
+// twelve fractional digits.
+func parseTime(s string) (time.Time, error) {
+	if len(s) == len("2006-01-02") {
+		return time.Parse("2006-01-02", s)
+	}
+	if i := strings.IndexByte(s, '.'); i >= 0 && len(s)-i-1 > 9 {
+		s = s[:i+10]
+	}
+	return time.Parse("2006-01-02 15:04:05.999999999", s)
+}
+
+func appendInt64(b []byte, v int64) []byte {
+	return appendUint(b, uint64(v), 8)
+}
+
+// appendUint appends the size least significant bytes of v to b, little endian.
+func appendUint(b []byte, v uint64, size int) []byte {
+	for i := 0; i < size; i++ {
+		b = append(b, byte(v>>(8*uint(i))))
+	}
+	return b
+}
@@ -0,0 +1,383 @@
+package arrowipc
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/avct/prestgo"
+)
+
+const columns = `"columns": [
+  { "name": "id", "type": "bigint", "typeSignature": { "rawType": "bigint", "arguments": [] } },
+  { "name": "score", "type": "real", "typeSignature": { "rawType": "real", "arguments": [] } },
+  { "name": "ok", "type": "boolean", "typeSignature": { "rawType": "boolean", "arguments": [] } },
+  { "name": "name", "type": "varchar(10)", "typeSignature": { "rawType": "varchar", "arguments": [ { "kind": "LONG_LITERAL", "value": 10 } ] } },
+  { "name": "bin", "type": "varbinary", "typeSignature": { "rawType": "varbinary", "arguments": [] } },
+  { "name": "day", "type": "date", "typeSignature": { "rawType": "date", "arguments": [] } },
+  { "name": "at", "type": "timestamp", "typeSignature": { "rawType": "timestamp", "arguments": [] } },
+  { "name": "tags", "type": "array(varchar)", "typeSignature": { "rawType": "array", "arguments": [ { "kind": "TYPE", "value": { "rawType": "varchar", "arguments": [] } } ] } }
+],`
+
+// pagesServer serves a query with two pages of results, only the first carrying columns.
+var pagesServer = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/v1/statement":
+		fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%s/v1/query/abcd/1", "stats": {"state": "QUEUED"}}`, r.Host)
+	case "/v1/query/abcd/1":
+		fmt.Fprintf(w, `{
+		  "id": "abcd",
+		  "nextUri": "http://%s/v1/query/abcd/2",
+		  %s
+		  "data": [
+		    [ 9007199254740993, 1.5, true, "a", "aGk=", "2017-03-01", "2017-03-01 10:00:00.123", [ "x", "y" ] ],
+		    [ null, null, null, null, null, null, null, null ]
+		  ],
+		  "stats": {"state": "RUNNING"}
+		}`, r.Host, columns)
+	case "/v1/query/abcd/2":
+		fmt.Fprint(w, `{
+		  "id": "abcd",
+		  "data": [ [ -1, "-Infinity", false, "é", "", "1969-12-31", "1969-12-31 23:59:59.500000000000", [] ] ],
+		  "stats": {"state": "FINISHED"}
+		}`)
+	default:
+		http.NotFound(w, r)
+	}
+})
+
+// writePages returns the stream written by WriteQuery for the results served by pagesServer.
+func writePages(t *testing.T) []byte {
+	ts := httptest.NewServer(pagesServer)
+	defer ts.Close()
+
+	db, err := sql.Open(prestgo.DriverName, "presto://"+ts.Listener.Addr().String()+"/hive/default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var buf bytes.Buffer
+	n, err := WriteQuery(ctx, c, &buf, "SELECT * FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("got %d rows, wanted 3", n)
+	}
+	return buf.Bytes()
+}
+
+func TestWriteQuery(t *testing.T) {
+	msgs := readStream(t, writePages(t))
+	if len(msgs) != 3 {
+		t.Fatalf("got %d messages, wanted a schema and 2 record batches", len(msgs))
+	}
+
+	schema := msgs[0]
+	if typ := schema.header.uint(1, 1); typ != headerSchema {
+		t.Fatalf("got message type %d, wanted schema", typ)
+	}
+	var names []string
+	var types []uint64
+	fields := schema.header.table(2)
+	for _, f := range fields.vector(1) {
+		names = append(names, f.str(0))
+		types = append(types, f.uint(2, 1))
+	}
+	if expected := []string{"id", "score", "ok", "name", "bin", "day", "at", "tags"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("got fields %q, wanted %q", names, expected)
+	}
+	expectedTypes := []uint64{typeInt, typeFloat, typeBool, typeUtf8, typeBinary, typeDate, typeTimestamp, typeUtf8}
+	if !reflect.DeepEqual(types, expectedTypes) {
+		t.Errorf("got field types %v, wanted %v", types, expectedTypes)
+	}
+
+	first, second := msgs[1], msgs[2]
+	if length := first.batch().uint(0, 8); length != 2 {
+		t.Errorf("got %d rows in the first batch, wanted 2", length)
+	}
+	// Each column has a validity bitmap and a buffer of values, with one of offsets before
+	// those of variable width
+	if nulls := first.nullCounts(); !reflect.DeepEqual(nulls, []int64{1, 1, 1, 1, 1, 1, 1, 1}) {
+		t.Errorf("got null counts %v, wanted one per column", nulls)
+	}
+	if id := int64(binary.LittleEndian.Uint64(first.buffer(1))); id != 9007199254740993 {
+		t.Errorf("got id %d, wanted 9007199254740993", id)
+	}
+
+	if nulls := second.nullCounts(); !reflect.DeepEqual(nulls, make([]int64, 8)) {
+		t.Errorf("got null counts %v, wanted none", nulls)
+	}
+	if id := int64(binary.LittleEndian.Uint64(second.buffer(1))); id != -1 {
+		t.Errorf("got id %d, wanted -1", id)
+	}
+	if score := math.Float32frombits(binary.LittleEndian.Uint32(second.buffer(3))); !math.IsInf(float64(score), -1) {
+		t.Errorf("got score %v, wanted -Inf", score)
+	}
+	if name := string(second.buffer(8)[:len("é")]); name != "é" {
+		t.Errorf("got name %q, wanted é", name)
+	}
+	if day := int32(binary.LittleEndian.Uint32(second.buffer(13))); day != -1 {
+		t.Errorf("got day %d, wanted -1", day)
+	}
+	if at := int64(binary.LittleEndian.Uint64(second.buffer(15))); at != -500000 {
+		t.Errorf("got timestamp %d, wanted -500000", at)
+	}
+	if tags := string(first.buffer(18)[:len(`["x","y"]`)]); tags != `["x","y"]` {
+		t.Errorf("got tags %s, wanted the array as JSON", tags)
+	}
+}
+
+// TestWriteQueryReference compares the stream written for pagesServer with testdata/pages.arrow,
+// the same values written by the Arrow Go library. The flatbuffers of the two may be laid out
+// differently, so the metadata is compared field by field, but the bodies of the record
+// batches, with the padding of each buffer, must match byte for byte.
+func TestWriteQueryReference(t *testing.T) {
+	ref, err := ioutil.ReadFile("testdata/pages.arrow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := readStream(t, ref)
+	got := readStream(t, writePages(t))
+	if len(got) != len(expected) {
+		t.Fatalf("got %d messages, wanted %d", len(got), len(expected))
+	}
+
+	for i, m := range got {
+		if typ, want := m.header.uint(1, 1), expected[i].header.uint(1, 1); typ != want {
+			t.Fatalf("message %d: got type %d, wanted %d", i, typ, want)
+		}
+	}
+	gotFields, expectedFields := got[0].header.table(2).vector(1), expected[0].header.table(2).vector(1)
+	if len(gotFields) != len(expectedFields) {
+		t.Fatalf("got %d fields, wanted %d", len(gotFields), len(expectedFields))
+	}
+	for i, f := range gotFields {
+		if g, e := describeField(f), describeField(expectedFields[i]); g != e {
+			t.Errorf("field %d: got %s, wanted %s", i, g, e)
+		}
+	}
+
+	for i := 1; i < len(got); i++ {
+		g, e := got[i], expected[i]
+		if length, want := g.batch().uint(0, 8), e.batch().uint(0, 8); length != want {
+			t.Errorf("batch %d: got length %d, wanted %d", i, length, want)
+		}
+		// The FieldNode and Buffer structs hold 64 bit integers, so must be aligned to eight
+		// bytes, as the metadata that holds them is in the stream
+		for slot := 1; slot <= 2; slot++ {
+			if start, _ := g.batch().vectorStart(slot); start%8 != 0 {
+				t.Errorf("batch %d: got vector of structs in slot %d at %d, wanted it aligned to 8 bytes", i, slot, start)
+			}
+		}
+		if nodes, want := g.structs(1, 16), e.structs(1, 16); !bytes.Equal(nodes, want) {
+			t.Errorf("batch %d: got field nodes %x, wanted %x", i, nodes, want)
+		}
+		// The Arrow Go library records validity bitmaps with their padding, so only the
+		// offsets of the buffers are compared
+		offsets, want := g.bufferOffsets(), e.bufferOffsets()
+		if !reflect.DeepEqual(offsets, want) {
+			t.Errorf("batch %d: got buffer offsets %v, wanted %v", i, offsets, want)
+		}
+		if !bytes.Equal(g.body, e.body) {
+			t.Errorf("batch %d: got body\n%x\nwanted\n%x", i, g.body, e.body)
+		}
+	}
+}
+
+// describeField returns the name, nullability and type of a Field table.
+func describeField(f fbTable) string {
+	typ := f.table(3)
+	var params string
+	switch f.uint(2, 1) {
+	case typeInt:
+		params = fmt.Sprintf("bitWidth=%d signed=%d", typ.uint(0, 4), typ.uint(1, 1))
+	case typeFloat, typeDate:
+		params = fmt.Sprintf("precision/unit=%d", typ.uint(0, 2))
+	case typeTimestamp:
+		params = fmt.Sprintf("unit=%d timezone=%v", typ.uint(0, 2), typ.field(1) != 0)
+	}
+	return fmt.Sprintf("%s nullable=%d type=%d %s", f.str(0), f.uint(1, 1), f.uint(2, 1), params)
+}
+
+func TestWriteStreamNotColumnar(t *testing.T) {
+	if _, err := WriteStream(ioutil.Discard, nil); err != ErrNotColumnar {
+		t.Errorf("got error %v, wanted ErrNotColumnar", err)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	testCases := []struct {
+		s        string
+		expected int64 // microseconds since the epoch
+	}{
+		{s: "1970-01-02", expected: 86400e6},
+		{s: "2017-03-01 10:00:00.123", expected: 1488362400123000},
+		{s: "2017-03-01 10:00:00", expected: 1488362400000000},
+		{s: "2017-03-01 10:00:00.123456789012", expected: 1488362400123456},
+	}
+
+	for _, tc := range testCases {
+		ts, err := parseTime(tc.s)
+		if err != nil {
+			t.Errorf("%s: %v", tc.s, err)
+			continue
+		}
+		if got := ts.Unix()*1e6 + int64(ts.Nanosecond()/1e3); got != tc.expected {
+			t.Errorf("%s: got %d, wanted %d", tc.s, got, tc.expected)
+		}
+	}
+}
+
+// message is an encapsulated message read from a stream.
+type message struct {
+	header fbTable // the Message table
+	body   []byte
+}
+
+// readStream splits an IPC stream into its messages.
+func readStream(t *testing.T, b []byte) []message {
+	var msgs []message
+	for {
+		if len(b) < 8 || binary.LittleEndian.Uint32(b) != 0xffffffff {
+			t.Fatalf("missing continuation marker")
+		}
+		size := int(binary.LittleEndian.Uint32(b[4:]))
+		if size == 0 {
+			if len(b) != 8 {
+				t.Errorf("got %d bytes after the end of the stream", len(b)-8)
+			}
+			return msgs
+		}
+		if size%8 != 0 {
+			t.Errorf("got metadata of %d bytes, wanted a multiple of 8", size)
+		}
+		meta := b[8 : 8+size]
+		m := message{header: fbTable{buf: meta, pos: int(binary.LittleEndian.Uint32(meta))}}
+		if v := m.header.uint(0, 2); v != metadataV5 {
+			t.Errorf("got metadata version %d, wanted V5", v)
+		}
+		bodyLen := int(m.header.uint(3, 8))
+		m.body = b[8+size : 8+size+bodyLen]
+		msgs = append(msgs, m)
+		b = b[8+size+bodyLen:]
+	}
+}
+
+// batch returns the RecordBatch of a message.
+func (m message) batch() fbTable {
+	return m.header.table(2)
+}
+
+// nullCounts returns the null counts of the fields of a record batch.
+func (m message) nullCounts() []int64 {
+	b := m.batch()
+	start, n := b.vectorStart(1)
+	counts := make([]int64, n)
+	for i := range counts {
+		counts[i] = int64(binary.LittleEndian.Uint64(b.buf[start+16*i+8:]))
+	}
+	return counts
+}
+
+// structs returns the encoded structs, each of size bytes, of the vector in slot of a record
+// batch.
+func (m message) structs(slot, size int) []byte {
+	b := m.batch()
+	start, n := b.vectorStart(slot)
+	return b.buf[start : start+size*n]
+}
+
+// bufferOffsets returns the offsets in the body of the buffers of a record batch.
+func (m message) bufferOffsets() []uint64 {
+	data := m.structs(2, 16)
+	offsets := make([]uint64, len(data)/16)
+	for i := range offsets {
+		offsets[i] = binary.LittleEndian.Uint64(data[16*i:])
+	}
+	return offsets
+}
+
+// buffer returns buffer i of the body of a record batch.
+func (m message) buffer(i int) []byte {
+	b := m.batch()
+	start, _ := b.vectorStart(2)
+	offset := binary.LittleEndian.Uint64(b.buf[start+16*i:])
+	length := binary.LittleEndian.Uint64(b.buf[start+16*i+8:])
+	return m.body[offset : offset+length]
+}
+
+// fbTable reads a flatbuffer table at pos in buf.
+type fbTable struct {
+	buf []byte
+	pos int
+}
+
+// field returns the position of the field in slot, or 0 if it is absent.
+func (t fbTable) field(slot int) int {
+	vt := t.pos - int(int32(binary.LittleEndian.Uint32(t.buf[t.pos:])))
+	if size := int(binary.LittleEndian.Uint16(t.buf[vt:])); 4+2*slot >= size {
+		return 0
+	}
+	off := int(binary.LittleEndian.Uint16(t.buf[vt+4+2*slot:]))
+	if off == 0 {
+		return 0
+	}
+	return t.pos + off
+}
+
+func (t fbTable) uint(slot, size int) uint64 {
+	p := t.field(slot)
+	if p == 0 {
+		return 0
+	}
+	var v [8]byte
+	copy(v[:], t.buf[p:p+size])
+	return binary.LittleEndian.Uint64(v[:])
+}
+
+// deref returns the position of the object referred to by the offset at p.
+func (t fbTable) deref(p int) int {
+	return p + int(binary.LittleEndian.Uint32(t.buf[p:]))
+}
+
+func (t fbTable) table(slot int) fbTable {
+	return fbTable{buf: t.buf, pos: t.deref(t.field(slot))}
+}
+
+func (t fbTable) str(slot int) string {
+	p := t.deref(t.field(slot))
+	n := int(binary.LittleEndian.Uint32(t.buf[p:]))
+	return string(t.buf[p+4 : p+4+n])
+}
+
+// vectorStart returns the position of the first element of the vector in slot and its length.
+func (t fbTable) vectorStart(slot int) (int, int) {
+	p := t.deref(t.field(slot))
+	return p + 4, int(binary.LittleEndian.Uint32(t.buf[p:]))
+}
+
+// vector returns the tables of the vector in slot.
+func (t fbTable) vector(slot int) []fbTable {
+	start, n := t.vectorStart(slot)
+	tables := make([]fbTable, n)
+	for i := range tables {
+		tables[i] = fbTable{buf: t.buf, pos: t.deref(start + 4*i)}
+	}
+	return tables
+}
@@ -0,0 +1,161 @@
+package arrowipc
+
+import "encoding/binary"
+
+// The metadata of Arrow IPC messages is encoded as flatbuffers. The few tables needed are
+// laid out here by hand, so that the package needs nothing outside the standard library.
+
+// object is a flatbuffer table, string or vector.
+type object interface{}
+
+// table is a flatbuffer table whose field i is stored in slot i. Absent fields are zero.
+type table []field
+
+// field is a field of a table, either a scalar of size bytes or an offset to ref.
+type field struct {
+	size int
+	v    uint64
+	ref  object
+}
+
+// str is a flatbuffer string.
+type str string
+
+// structs is a vector of structs, each of size bytes and already encoded in data.
+type structs struct {
+	size int
+	data []byte
+}
+
+// vector is a vector of tables.
+type vector []object
+
+func u8(v uint8) field   { return field{size: 1, v: uint64(v)} }
+func i16(v int16) field  { return field{size: 2, v: uint64(uint16(v))} }
+func i32(v int32) field  { return field{size: 4, v: uint64(uint32(v))} }
+func i64(v int64) field  { return field{size: 8, v: uint64(v)} }
+func ref(o object) field { return field{ref: o} }
+
+func boolean(v bool) field {
+	if v {
+		return u8(1)
+	}
+	return u8(0)
+}
+
+// builder lays out a flatbuffer front to back. Each object is written before those it refers
+// to, so that the unsigned offsets to them are always positive.
+type builder struct {
+	buf []byte
+}
+
+// finish returns the flatbuffer holding root, padded to a multiple of eight bytes.
+func finish(root table) []byte {
+	b := &builder{buf: make([]byte, 4, 256)}
+	b.patch(0, b.write(root))
+	b.pad(8)
+	return b.buf
+}
+
+func (b *builder) pad(align int) {
+	for len(b.buf)%align != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+func (b *builder) put(size int, v uint64) {
+	var t [8]byte
+	binary.LittleEndian.PutUint64(t[:], v)
+	b.buf = append(b.buf, t[:size]...)
+}
+
+// patch sets the offset at pos to refer to the object at target.
+func (b *builder) patch(pos, target int) {
+	binary.LittleEndian.PutUint32(b.buf[pos:], uint32(target-pos))
+}
+
+// write appends o and returns its position.
+func (b *builder) write(o object) int {
+	switch o := o.(type) {
+	case table:
+		return b.writeTable(o)
+	case str:
+		b.pad(4)
+		pos := len(b.buf)
+		b.put(4, uint64(len(o)))
+		b.buf = append(b.buf, o...)
+		b.buf = append(b.buf, 0)
+		return pos
+	case structs:
+		// The structs follow the length and are aligned to the largest of their fields,
+		// which is eight bytes for those written here
+		for (len(b.buf)+4)%8 != 0 {
+			b.buf = append(b.buf, 0)
+		}
+		pos := len(b.buf)
+		b.put(4, uint64(len(o.data)/o.size))
+		b.buf = append(b.buf, o.data...)
+		return pos
+	case vector:
+		b.pad(4)
+		pos := len(b.buf)
+		b.put(4, uint64(len(o)))
+		slots := len(b.buf)
+		for range o {
+			b.put(4, 0)
+		}
+		for i, e := range o {
+			b.patch(slots+4*i, b.write(e))
+		}
+		return pos
+	}
+	panic("arrowipc: unexpected flatbuffer object")
+}
+
+// writeTable appends the vtable of t followed by t, then the objects t refers to.
+func (b *builder) writeTable(t table) int {
+	// The fields follow the offset to the vtable in slot order, each aligned to its size
+	offsets := make([]int, len(t))
+	size := 4
+	for i, f := range t {
+		n := f.size
+		if f.ref != nil {
+			n = 4
+		}
+		if n == 0 {
+			continue
+		}
+		for size%n != 0 {
+			size++
+		}
+		offsets[i] = size
+		size += n
+	}
+
+	b.pad(2)
+	vt := len(b.buf)
+	b.put(2, uint64(4+2*len(t)))
+	b.put(2, uint64(size))
+	for _, off := range offsets {
+		b.put(2, uint64(off))
+	}
+
+	// Aligning the table to eight bytes aligns its fields
+	b.pad(8)
+	pos := len(b.buf)
+	b.buf = append(b.buf, make([]byte, size)...)
+	binary.LittleEndian.PutUint32(b.buf[pos:], uint32(int32(pos-vt)))
+	for i, f := range t {
+		if f.size > 0 {
+			var v [8]byte
+			binary.LittleEndian.PutUint64(v[:], f.v)
+			copy(b.buf[pos+offsets[i]:], v[:f.size])
+		}
+	}
+	for i, f := range t {
+		if f.ref != nil {
+			b.patch(pos+offsets[i], b.write(f.ref))
+		}
+	}
+	return pos
+}
@@ -0,0 +1,62 @@
+// Command gen writes pages.arrow, the values served by pagesServer written as an Arrow IPC
+// stream by the Arrow Go library, which the stream written by the package is compared with.
+// It is run from a module requiring github.com/apache/arrow/go/v15 v15.0.2:
+//
+//	go run ./gen > pages.arrow
+package main
+
+import (
+	"math"
+	"os"
+
+	"github.com/apache/arrow/go/v15/arrow"
+	"github.com/apache/arrow/go/v15/arrow/array"
+	"github.com/apache/arrow/go/v15/arrow/ipc"
+	"github.com/apache/arrow/go/v15/arrow/memory"
+)
+
+func main() {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+		{Name: "score", Type: arrow.PrimitiveTypes.Float32, Nullable: true},
+		{Name: "ok", Type: arrow.FixedWidthTypes.Boolean, Nullable: true},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "bin", Type: arrow.BinaryTypes.Binary, Nullable: true},
+		{Name: "day", Type: arrow.FixedWidthTypes.Date32, Nullable: true},
+		{Name: "at", Type: &arrow.TimestampType{Unit: arrow.Microsecond}, Nullable: true},
+		{Name: "tags", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+	w := ipc.NewWriter(os.Stdout, ipc.WithSchema(schema))
+	b := array.NewRecordBuilder(memory.NewGoAllocator(), schema)
+	f := b.Fields()
+
+	f[0].(*array.Int64Builder).Append(9007199254740993)
+	f[1].(*array.Float32Builder).Append(1.5)
+	f[2].(*array.BooleanBuilder).Append(true)
+	f[3].(*array.StringBuilder).Append("a")
+	f[4].(*array.BinaryBuilder).Append([]byte("hi"))
+	f[5].(*array.Date32Builder).Append(17226)
+	f[6].(*array.TimestampBuilder).Append(1488362400123000)
+	f[7].(*array.StringBuilder).Append(`["x","y"]`)
+	for _, fb := range f {
+		fb.AppendNull()
+	}
+	if err := w.Write(b.NewRecord()); err != nil {
+		panic(err)
+	}
+
+	f[0].(*array.Int64Builder).Append(-1)
+	f[1].(*array.Float32Builder).Append(float32(math.Inf(-1)))
+	f[2].(*array.BooleanBuilder).Append(false)
+	f[3].(*array.StringBuilder).Append("é")
+	f[4].(*array.BinaryBuilder).Append([]byte{})
+	f[5].(*array.Date32Builder).Append(-1)
+	f[6].(*array.TimestampBuilder).Append(-500000)
+	f[7].(*array.StringBuilder).Append("[]")
+	if err := w.Write(b.NewRecord()); err != nil {
+		panic(err)
+	}
+	if err := w.Close(); err != nil {
+		panic(err)
+	}
+}
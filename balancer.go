@@ -0,0 +1,176 @@
+package prestgo
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policies for distributing statements among the coordinators of a data source name that
+// lists several.
+const (
+	balanceRoundRobin       = iota // Each coordinator in turn.
+	balanceLeastOutstanding        // The coordinator running the fewest of the driver's queries.
+)
+
+// coordinatorDownTime is how long a coordinator that could not be connected to is passed
+// over, unless no other coordinator is available.
+const coordinatorDownTime = 10 * time.Second
+
+// coordinator is one of the coordinators statements are distributed among.
+type coordinator struct {
+	addr        string
+	outstanding int       // queries submitted to the coordinator that have not yet ended
+	downUntil   time.Time // when to try the coordinator again after failing to connect
+}
+
+// balancer distributes new statements among a set of coordinators. Connections to the same
+// coordinators with the same policy share a balancer, so that the statements of all the
+// connections in a pool are spread evenly.
+type balancer struct {
+	mu     sync.Mutex
+	policy int
+	coords []*coordinator
+	next   int // position of the coordinator to try first for the next statement
+
+	// srv is the name of the SRV records listing the coordinators, if they are discovered
+	// rather than listed in the data source name.
+	srv        string
+	refreshed  time.Time // when the SRV records were last looked up
+	refreshing bool      // whether the SRV records are being looked up in the background
+}
+
+var (
+	balancersMu sync.Mutex
+	balancers   = make(map[string]*balancer)
+)
+
+// balancerFor returns the balancer for the coordinators at addrs using policy.
+func balancerFor(addrs []string, policy int) *balancer {
+	return registerBalancer(strings.Join(addrs, ","), policy, func(b *balancer) {
+		for _, addr := range addrs {
+			b.coords = append(b.coords, &coordinator{addr: addr})
+		}
+	})
+}
+
+// registerBalancer returns the balancer registered for the coordinators identified by key
+// using policy, creating it with init if there is none.
+func registerBalancer(key string, policy int, init func(*balancer)) *balancer {
+	if policy == balanceLeastOutstanding {
+		key += ";least_outstanding"
+	}
+
+	balancersMu.Lock()
+	defer balancersMu.Unlock()
+	if b, ok := balancers[key]; ok {
+		return b
+	}
+	b := &balancer{policy: policy}
+	init(b)
+	balancers[key] = b
+	return b
+}
+
+// pick chooses the coordinator to submit a new statement to from those not in exclude,
+// counting the query as outstanding on it until it is released. Coordinators recently
+// marked down are only chosen if all the others are excluded. Ties between coordinators with
+// equally few outstanding queries are broken in turn. It returns nil if every coordinator
+// is excluded.
+func (b *balancer) pick(exclude []*coordinator) *coordinator {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	first := b.next % len(b.coords)
+	b.next++
+	now := time.Now()
+	c := b.choose(first, func(cand *coordinator) bool {
+		return !excluded(cand, exclude) && !now.Before(cand.downUntil)
+	})
+	if c == nil {
+		c = b.choose(first, func(cand *coordinator) bool {
+			return !excluded(cand, exclude)
+		})
+	}
+	if c != nil {
+		c.outstanding++
+	}
+	return c
+}
+
+// choose applies the balancer's policy to the coordinators accepted by ok, starting from the
+// one at position first.
+func (b *balancer) choose(first int, ok func(*coordinator) bool) *coordinator {
+	n := len(b.coords)
+	var c *coordinator
+	for i := 0; i < n; i++ {
+		cand := b.coords[(first+i)%n]
+		if !ok(cand) {
+			continue
+		}
+		if c == nil {
+			c = cand
+			if b.policy == balanceRoundRobin {
+				break
+			}
+		} else if cand.outstanding < c.outstanding {
+			c = cand
+		}
+	}
+	return c
+}
+
+func excluded(c *coordinator, exclude []*coordinator) bool {
+	for _, e := range exclude {
+		if c == e {
+			return true
+		}
+	}
+	return false
+}
+
+// markDown records that c could not be connected to, so that it is passed over for a while.
+func (b *balancer) markDown(c *coordinator) {
+	b.mu.Lock()
+	c.downUntil = time.Now().Add(coordinatorDownTime)
+	b.mu.Unlock()
+}
+
+// addrs returns the addresses of the balancer's coordinators.
+func (b *balancer) addrs() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	addrs := make([]string, len(b.coords))
+	for i, c := range b.coords {
+		addrs[i] = c.addr
+	}
+	return addrs
+}
+
+// release records that a query submitted to c has ended.
+func (b *balancer) release(c *coordinator) {
+	b.mu.Lock()
+	c.outstanding--
+	b.mu.Unlock()
+}
+
+// splitHosts separates the hosts after the first from a data source name listing several
+// coordinators, such as presto://a:8080,b:8080/hive, since a list of hosts cannot be parsed
+// as the host of a URL. It returns the name with only the first host and the others.
+func splitHosts(ds string) (string, []string) {
+	i := strings.Index(ds, "://")
+	if i < 0 {
+		return ds, nil
+	}
+	start := i + len("://")
+	end := len(ds)
+	if j := strings.IndexAny(ds[start:], "/?#"); j >= 0 {
+		end = start + j
+	}
+	start += strings.LastIndex(ds[start:end], "@") + 1
+
+	hosts := strings.Split(ds[start:end], ",")
+	if len(hosts) == 1 {
+		return ds, nil
+	}
+	return ds[:start] + hosts[0] + ds[end:], hosts[1:]
+}
@@ -0,0 +1,148 @@
+package prestgo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestSplitHosts(t *testing.T) {
+	testCases := []struct {
+		ds     string
+		first  string
+		others []string
+	}{
+		{ds: "presto://example:8080/hive", first: "presto://example:8080/hive"},
+		{ds: "presto://a:8080,b:9000/hive", first: "presto://a:8080/hive", others: []string{"b:9000"}},
+		{ds: "presto://user:p@ss@a,b,c?source=x", first: "presto://user:p@ss@a?source=x", others: []string{"b", "c"}},
+		{ds: "", first: ""},
+	}
+
+	for _, tc := range testCases {
+		first, others := splitHosts(tc.ds)
+		if first != tc.first || !reflect.DeepEqual(others, tc.others) {
+			t.Errorf("%s: got %q, %q, wanted %q, %q", tc.ds, first, others, tc.first, tc.others)
+		}
+	}
+}
+
+func TestBalancerPick(t *testing.T) {
+	b := &balancer{policy: balanceRoundRobin, coords: []*coordinator{{addr: "a"}, {addr: "b"}, {addr: "c"}}}
+	var got []string
+	for i := 0; i < 4; i++ {
+		got = append(got, b.pick(nil).addr)
+	}
+	if expected := []string{"a", "b", "c", "a"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("round robin: got %q, wanted %q", got, expected)
+	}
+
+	b = &balancer{policy: balanceLeastOutstanding, coords: []*coordinator{{addr: "a"}, {addr: "b"}, {addr: "c"}}}
+	b.pick(nil)
+	second := b.pick(nil)
+	b.pick(nil)
+	b.release(second)
+	// a is tried first, but b has fewer queries outstanding
+	if got := b.pick(nil).addr; got != "b" {
+		t.Errorf("least outstanding: got %q, wanted %q", got, "b")
+	}
+	// All have as many outstanding, so b is chosen in turn
+	if got := b.pick(nil).addr; got != "b" {
+		t.Errorf("least outstanding: got %q, wanted %q", got, "b")
+	}
+
+	b = &balancer{policy: balanceRoundRobin, coords: []*coordinator{{addr: "a"}, {addr: "b"}}}
+	b.markDown(b.coords[0])
+	got = nil
+	for i := 0; i < 2; i++ {
+		got = append(got, b.pick(nil).addr)
+	}
+	if expected := []string{"b", "b"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("marked down: got %q, wanted %q", got, expected)
+	}
+	// A coordinator marked down is still used when no other is available
+	if got := b.pick(b.coords[1:]); got == nil || got.addr != "a" {
+		t.Errorf("marked down: got %v, wanted a", got)
+	}
+}
+
+func TestClientOpenMultipleCoordinators(t *testing.T) {
+	counts := make([]int, 2)
+	servers := make([]*httptest.Server, 2)
+	for i := range servers {
+		i := i
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v1/statement" {
+				counts[i]++
+			}
+			statementHandler(oneRowColResponse).ServeHTTP(w, r)
+		}))
+		defer servers[i].Close()
+	}
+
+	ds := fmt.Sprintf("presto://%s,%s/hive/default", servers[0].Listener.Addr(), servers[1].Listener.Addr())
+	for i := 0; i < 4; i++ {
+		cn, err := ClientOpen(http.DefaultClient, ds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		st, _ := cn.Prepare("SELECT 1")
+		r, err := st.(*stmt).QueryContext(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+	}
+
+	if !reflect.DeepEqual(counts, []int{2, 2}) {
+		t.Errorf("got statements %v, wanted them spread evenly", counts)
+	}
+
+	if _, err := ClientOpen(http.DefaultClient, ds+"?load_balance=random"); err == nil {
+		t.Error("got no error for unsupported load_balance, wanted one")
+	}
+}
+
+func TestStmtFailover(t *testing.T) {
+	live := httptest.NewServer(statementHandler(oneRowColResponse))
+	defer live.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	deadAddr := dead.Listener.Addr().String()
+	dead.Close()
+
+	l := &recordingLogger{}
+	cn, err := ClientOpen(http.DefaultClient, fmt.Sprintf("presto://%s,%s/hive/default", deadAddr, live.Listener.Addr()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := cn.(*conn)
+	c.logger = l
+	for i := 0; i < 2; i++ {
+		st, _ := c.Prepare("SELECT 1")
+		r, err := st.(*stmt).QueryContext(context.Background(), nil)
+		if err != nil {
+			t.Fatalf("query %d: %v", i, err)
+		}
+		r.Close()
+	}
+	if len(l.messages) != 1 {
+		t.Errorf("got messages %q, wanted one failover", l.messages)
+	}
+	for _, co := range c.balancer.coords {
+		if co.outstanding != 0 {
+			t.Errorf("%s: got %d queries outstanding, wanted 0", co.addr, co.outstanding)
+		}
+	}
+
+	// With no coordinator reachable the error is returned
+	cn, err = ClientOpen(http.DefaultClient, fmt.Sprintf("presto://%s,%s/hive/default", deadAddr, deadAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, _ := cn.Prepare("SELECT 1")
+	if _, err := st.(*stmt).QueryContext(context.Background(), nil); !isDialError(err) {
+		t.Errorf("got error %v, wanted a failure to connect", err)
+	}
+}
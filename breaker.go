@@ -0,0 +1,72 @@
+package prestgo
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// circuitBreakerDefaultCooldown is how long new statements are failed once the circuit
+// breaker has opened, unless changed with the circuit_breaker_cooldown data source option.
+const circuitBreakerDefaultCooldown = 30 * time.Second
+
+// circuitBreaker fails new statements without contacting the coordinators once requests to
+// them have failed a number of times in a row, so that an application does not pile up
+// statements waiting on a cluster that is down. After the cooldown a single statement is let
+// through to test the coordinators again, the breaker closing once a request succeeds.
+// Connections to the same coordinators with the same settings share a breaker.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int           // consecutive failures that open the breaker
+	cooldown  time.Duration // time new statements are failed once open
+	failures  int           // consecutive failures so far
+	openUntil time.Time     // when the next statement may be let through while open
+}
+
+var (
+	breakersMu sync.Mutex
+	breakers   = make(map[string]*circuitBreaker)
+)
+
+// breakerFor returns the circuit breaker for the coordinators identified by key.
+func breakerFor(key string, threshold int, cooldown time.Duration) *circuitBreaker {
+	key = fmt.Sprintf("%s;%d;%v", key, threshold, cooldown)
+
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	if cb, ok := breakers[key]; ok {
+		return cb
+	}
+	cb := &circuitBreaker{threshold: threshold, cooldown: cooldown}
+	breakers[key] = cb
+	return cb
+}
+
+// allow reports whether a new statement may be submitted at now. While the breaker is open
+// one statement is allowed each time the cooldown ends.
+func (cb *circuitBreaker) allow(now time.Time) bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.failures < cb.threshold {
+		return true
+	}
+	if now.Before(cb.openUntil) {
+		return false
+	}
+	cb.openUntil = now.Add(cb.cooldown)
+	return true
+}
+
+// record notes the outcome of a request to the coordinators made at now.
+func (cb *circuitBreaker) record(failed bool, now time.Time) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if !failed {
+		cb.failures = 0
+		return
+	}
+	cb.failures++
+	if cb.failures == cb.threshold {
+		cb.openUntil = now.Add(cb.cooldown)
+	}
+}
@@ -0,0 +1,70 @@
+package prestgo
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	cb := &circuitBreaker{threshold: 2, cooldown: time.Minute}
+
+	cb.record(true, now)
+	if !cb.allow(now) {
+		t.Error("one failure: got statement refused, wanted it allowed")
+	}
+	cb.record(true, now)
+	if cb.allow(now.Add(time.Second)) {
+		t.Error("open: got statement allowed, wanted it refused")
+	}
+
+	// A single statement is let through once the cooldown ends
+	if !cb.allow(now.Add(time.Minute)) {
+		t.Error("after cooldown: got statement refused, wanted it allowed")
+	}
+	if cb.allow(now.Add(time.Minute + time.Second)) {
+		t.Error("after cooldown: got second statement allowed, wanted it refused")
+	}
+
+	cb.record(false, now.Add(time.Minute+time.Second))
+	if !cb.allow(now.Add(time.Minute + time.Second)) {
+		t.Error("after success: got statement refused, wanted it allowed")
+	}
+}
+
+func TestStmtCircuitBreaker(t *testing.T) {
+	var statements int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		statements++
+		http.Error(w, "broken", http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	cn, err := ClientOpen(http.DefaultClient, "presto://"+ts.Listener.Addr().String()+"/hive/default?circuit_breaker_threshold=2&circuit_breaker_cooldown=1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		st, _ := cn.Prepare("SELECT 1")
+		_, err := st.(*stmt).QueryContext(context.Background(), nil)
+		if i < 2 {
+			if _, ok := err.(*HTTPError); !ok {
+				t.Errorf("query %d: got error %v, wanted HTTPError", i, err)
+			}
+		} else if err != ErrCircuitOpen {
+			t.Errorf("query %d: got error %v, wanted %v", i, err, ErrCircuitOpen)
+		}
+	}
+	if statements != 2 {
+		t.Errorf("got %d statements sent, wanted 2", statements)
+	}
+
+	for _, opt := range []string{"circuit_breaker_threshold=0", "circuit_breaker_threshold=2&circuit_breaker_cooldown=soon"} {
+		if _, err := ClientOpen(http.DefaultClient, "presto://"+ts.Listener.Addr().String()+"/hive/default?"+opt); err == nil {
+			t.Errorf("%s: got no error, wanted one", opt)
+		}
+	}
+}
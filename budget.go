@@ -0,0 +1,89 @@
+package prestgo
+
+import (
+	"io"
+	"sync"
+)
+
+// maxBudgetRead limits the bytes reserved for a single read of a response body, so that a
+// large read by the JSON decoder does not wait for more of the budget than it will use.
+const maxBudgetRead = 32 << 10
+
+// pageBudget limits the bytes of result pages buffered for a query. Bytes are reserved as
+// a response body is read and held until the page is released by the consumer, so reading
+// a page in the background waits while the pages already buffered use the whole budget.
+type pageBudget struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int64
+	used   int64
+	closed bool
+}
+
+// newPageBudget returns a budget of limit bytes, or nil if limit is zero, meaning that the
+// bytes buffered are not limited.
+func newPageBudget(limit int64) *pageBudget {
+	if limit <= 0 {
+		return nil
+	}
+	b := &pageBudget{limit: limit}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// acquire reserves n bytes for a reader already holding held bytes, waiting until they are
+// available. A reservation is always granted when no other reader holds any of the budget,
+// so a page larger than the whole budget can still be read once the pages before it have
+// been released.
+func (b *pageBudget) acquire(n, held int64) {
+	b.mu.Lock()
+	for !b.closed && b.used > held && b.used+n > b.limit {
+		b.cond.Wait()
+	}
+	b.used += n
+	b.mu.Unlock()
+}
+
+// release returns n bytes to the budget.
+func (b *pageBudget) release(n int64) {
+	if n == 0 {
+		return
+	}
+	b.mu.Lock()
+	b.used -= n
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// close stops the budget from limiting reads, freeing any reader waiting on it.
+func (b *pageBudget) close() {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// budgetReader reads from r, counting the bytes read and reserving them from the budget b. The reservation
+// is held until released by the owner of the data decoded from r. If b is nil the bytes
+// read are only counted.
+type budgetReader struct {
+	r io.Reader
+	b *pageBudget
+	n int64 // bytes read and reserved
+}
+
+func (br *budgetReader) Read(p []byte) (int, error) {
+	if br.b == nil {
+		n, err := br.r.Read(p)
+		br.n += int64(n)
+		return n, err
+	}
+	if len(p) > maxBudgetRead {
+		p = p[:maxBudgetRead]
+	}
+	br.b.acquire(int64(len(p)), br.n)
+	n, err := br.r.Read(p)
+	br.b.release(int64(len(p) - n))
+	br.n += int64(n)
+	return n, err
+}
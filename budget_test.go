@@ -0,0 +1,68 @@
+package prestgo
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPageBudget(t *testing.T) {
+	b := newPageBudget(100)
+
+	// A reservation larger than the budget is granted when nothing else is held
+	b.acquire(150, 0)
+
+	acquired := make(chan struct{})
+	go func() {
+		b.acquire(10, 0)
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquired beyond the budget")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// The reader holding the budget may continue past it
+	b.acquire(50, 150)
+	b.release(200)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("not acquired after release")
+	}
+
+	// Closing frees waiting readers
+	b.acquire(90, 0)
+	done := make(chan struct{})
+	go func() {
+		b.acquire(50, 0)
+		close(done)
+	}()
+	b.close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("not acquired after close")
+	}
+}
+
+func TestNewPageBudgetUnlimited(t *testing.T) {
+	if b := newPageBudget(0); b != nil {
+		t.Errorf("got %+v, wanted nil", b)
+	}
+}
+
+func TestBudgetReader(t *testing.T) {
+	b := newPageBudget(1 << 20)
+	br := &budgetReader{r: strings.NewReader(strings.Repeat("x", 100000)), b: b}
+	data, err := ioutil.ReadAll(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 100000 || br.n != 100000 || b.used != 100000 {
+		t.Errorf("got %d bytes read, %d counted and %d reserved, wanted 100000", len(data), br.n, b.used)
+	}
+}
@@ -0,0 +1,108 @@
+package prestgo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// cancelTimeout limits how long closing a connection waits for the server to acknowledge
+// the cancellation of each query still running on it.
+const cancelTimeout = 5 * time.Second
+
+// ErrConnClosed is returned when reading the results of a query that was canceled because
+// its connection was closed. It wraps context.Canceled, so the query is reported to Metrics
+// as canceled.
+var ErrConnClosed = fmt.Errorf("%s: connection closed: %w", DriverName, context.Canceled)
+
+// track registers q as running on the connection, so that closing the connection cancels
+// it. It returns false if the connection has been closed.
+func (c *conn) track(q *queryRun) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	if c.active == nil {
+		c.active = make(map[*queryRun]struct{})
+	}
+	c.active[q] = struct{}{}
+	return true
+}
+
+// untrack removes q from the queries running on the connection once it has ended.
+func (c *conn) untrack(q *queryRun) {
+	c.mu.Lock()
+	delete(c.active, q)
+	c.mu.Unlock()
+}
+
+// Close closes the connection. Queries still running on it are canceled on the server and
+// their requests and polling stopped, reading their results returning ErrConnClosed, so that
+// closing a connection during shutdown does not leave work running on the cluster. Close
+// returns once the server has acknowledged the cancellations, including those of queries
+// whose rows were closed early, or cancelTimeout has passed.
+func (c *conn) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	active := c.active
+	c.active = nil
+	c.mu.Unlock()
+
+	for q := range active {
+		if uri := q.abort(); uri != "" {
+			c.cancelOnServer(uri)
+		}
+	}
+	c.canceling.Wait()
+	return nil
+}
+
+// cancelOnServer asks the server in the background to cancel the query whose next results
+// are at uri, waiting up to cancelTimeout for it to acknowledge.
+func (c *conn) cancelOnServer(uri string) {
+	c.canceling.Add(1)
+	go func() {
+		defer c.canceling.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), cancelTimeout)
+		defer cancel()
+		req, err := http.NewRequest("DELETE", uri, nil)
+		if err != nil {
+			return
+		}
+		resp, err := c.client.Do(req.WithContext(ctx))
+		if err != nil {
+			logf(c.logger, LogWarn, "%s: canceling query at %s failed: %v", DriverName, uri, err)
+			return
+		}
+		resp.Body.Close()
+	}()
+}
+
+// setNextURI records the URI from which the next results of the query are requested, for
+// canceling the query on the server.
+func (q *queryRun) setNextURI(uri string) {
+	q.mu.Lock()
+	q.nextURI = uri
+	q.mu.Unlock()
+}
+
+// aborted reports whether the query was canceled by closing its connection.
+func (q *queryRun) aborted() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closed
+}
+
+// abort stops the requests and polling of the query, returning the URI at which it can be
+// canceled on the server, or "" if it has not been accepted or has no more results to
+// produce.
+func (q *queryRun) abort() string {
+	q.mu.Lock()
+	q.closed = true
+	uri := q.nextURI
+	q.mu.Unlock()
+	q.cancel()
+	return uri
+}
@@ -0,0 +1,153 @@
+package prestgo
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConnCloseCancelsQueries(t *testing.T) {
+	deleted := make(chan string, 1)
+	ts := httptest.NewServer(statementHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" {
+			deleted <- r.URL.Path
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		// The query runs without producing data until it is canceled
+		fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%s/v1/query/abcd/1", "stats": {"state": "RUNNING"}}`, r.Host)
+	})))
+	defer ts.Close()
+
+	cn, err := ClientOpen(http.DefaultClient, "presto://"+ts.Listener.Addr().String()+"/hive/default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, _ := cn.Prepare("SELECT 1")
+	r, err := st.(*stmt).QueryContext(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- r.Next(make([]driver.Value, 1))
+	}()
+	time.Sleep(100 * time.Millisecond)
+	if err := cn.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-result:
+		if err != ErrConnClosed {
+			t.Errorf("got error %v, wanted %v", err, ErrConnClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reading results was not stopped by closing the connection")
+	}
+	select {
+	case path := <-deleted:
+		if path != "/v1/query/abcd/1" {
+			t.Errorf("got DELETE of %s, wanted /v1/query/abcd/1", path)
+		}
+	default:
+		t.Error("query was not canceled on the server")
+	}
+	r.Close()
+
+	if _, err := st.(*stmt).QueryContext(context.Background(), nil); err != driver.ErrBadConn {
+		t.Errorf("query after close: got error %v, wanted %v", err, driver.ErrBadConn)
+	}
+}
+
+func TestRowsCloseCancelsQuery(t *testing.T) {
+	deleted := make(chan string, 1)
+	ts := httptest.NewServer(statementHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" {
+			deleted <- r.URL.Path
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		multiPageResponse.ServeHTTP(w, r)
+	})))
+	defer ts.Close()
+
+	cn, err := ClientOpen(http.DefaultClient, "presto://"+ts.Listener.Addr().String()+"/hive/default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, _ := cn.Prepare("SELECT 1")
+	r, err := st.(*stmt).QueryContext(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Next(make([]driver.Value, len(r.Columns()))); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	// Closing the connection waits for the cancellation to be acknowledged
+	cn.Close()
+
+	select {
+	case <-deleted:
+	default:
+		t.Error("query was not canceled on the server")
+	}
+}
+
+func TestContextCancelCancelsQuery(t *testing.T) {
+	deleted := make(chan string, 1)
+	ts := httptest.NewServer(statementHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" {
+			deleted <- r.URL.Path
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		// The query runs without producing data until it is canceled
+		fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%s/v1/query/abcd/1", "stats": {"state": "RUNNING"}}`, r.Host)
+	})))
+	defer ts.Close()
+
+	cn, err := ClientOpen(http.DefaultClient, "presto://"+ts.Listener.Addr().String()+"/hive/default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cn.Close()
+	st, _ := cn.Prepare("SELECT 1")
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := st.(*stmt).QueryContext(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- r.Next(make([]driver.Value, 1))
+	}()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-result:
+		if err != context.Canceled {
+			t.Errorf("got error %v, wanted %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reading results was not stopped by canceling the context")
+	}
+	r.Close()
+
+	select {
+	case path := <-deleted:
+		if path != "/v1/query/abcd/1" {
+			t.Errorf("got DELETE of %s, wanted /v1/query/abcd/1", path)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("query was not canceled on the server")
+	}
+}
@@ -0,0 +1,70 @@
+package prestgo
+
+import "net/http"
+
+// CatalogConn is implemented by the connections of the driver, allowing the catalog and
+// schema used by the statements run on a connection to be changed after it is opened, so
+// that jobs working across several schemas do not need a pool of connections for each.
+// Callers using database/sql reach it through sql.Conn. Running a USE statement on the
+// connection changes them in the same way.
+type CatalogConn interface {
+	// Catalog returns the catalog used by statements run on the connection.
+	Catalog() string
+
+	// Schema returns the schema used by statements run on the connection.
+	Schema() string
+
+	// SetCatalog sets the catalog used by statements run from now on.
+	SetCatalog(catalog string)
+
+	// SetSchema sets the schema used by statements run from now on.
+	SetSchema(schema string)
+}
+
+var _ CatalogConn = &conn{}
+
+func (c *conn) Catalog() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.catalog
+}
+
+func (c *conn) Schema() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.schema
+}
+
+func (c *conn) SetCatalog(catalog string) {
+	c.mu.Lock()
+	c.catalog = catalog
+	c.mu.Unlock()
+}
+
+func (c *conn) SetSchema(schema string) {
+	c.mu.Lock()
+	c.schema = schema
+	c.mu.Unlock()
+}
+
+// applySetHeaders makes the changes to the catalog and schema that the server asks for in
+// the headers of a response, as it does when a USE statement completes.
+func (c *conn) applySetHeaders(h http.Header) {
+	if catalog, ok := setHeader(h, "Catalog"); ok {
+		c.SetCatalog(catalog)
+	}
+	if schema, ok := setHeader(h, "Schema"); ok {
+		c.SetSchema(schema)
+	}
+}
+
+// setHeader returns the value of the X-Presto-Set- or X-Trino-Set- header for name, and
+// whether either was present.
+func setHeader(h http.Header, name string) (string, bool) {
+	for _, prefix := range []string{"X-Presto-Set-", "X-Trino-Set-"} {
+		if v, ok := h[prefix+name]; ok && len(v) > 0 {
+			return v[0], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,69 @@
+package prestgo
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConnSetCatalog(t *testing.T) {
+	var catalog, schema string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/statement" {
+			catalog, schema = r.Header.Get("X-Presto-Catalog"), r.Header.Get("X-Presto-Schema")
+		}
+		statementHandler(oneRowColResponse).ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	cn, err := ClientOpen(http.DefaultClient, "presto://"+ts.Listener.Addr().String()+"/hive/default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc := cn.(CatalogConn)
+	cc.SetCatalog("tree")
+	cc.SetSchema("birch")
+	if cc.Catalog() != "tree" || cc.Schema() != "birch" {
+		t.Errorf("got %s.%s, wanted tree.birch", cc.Catalog(), cc.Schema())
+	}
+
+	st, _ := cn.Prepare("SELECT 1")
+	r, err := st.(*stmt).QueryContext(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if catalog != "tree" || schema != "birch" {
+		t.Errorf("got headers for %s.%s, wanted tree.birch", catalog, schema)
+	}
+}
+
+func TestConnUse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/query/abcd/1" {
+			// The server asks for the change once the USE statement completes
+			w.Header().Set("X-Presto-Set-Catalog", "tree")
+			w.Header().Set("X-Presto-Set-Schema", "birch")
+		}
+		statementHandler(oneRowColResponse).ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	cn, err := ClientOpen(http.DefaultClient, "presto://"+ts.Listener.Addr().String()+"/hive/default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, _ := cn.Prepare("USE tree.birch")
+	r, err := st.(*stmt).QueryContext(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Columns()
+	r.Close()
+
+	cc := cn.(CatalogConn)
+	if cc.Catalog() != "tree" || cc.Schema() != "birch" {
+		t.Errorf("got %s.%s, wanted tree.birch", cc.Catalog(), cc.Schema())
+	}
+}
@@ -0,0 +1,122 @@
+package prestgo
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultMaxIdleConnsPerHost is the number of idle connections kept to each server by
+	// the default client. Each query polls for results on a connection of its own, so the
+	// net/http default of two would close and reopen connections under concurrent use.
+	defaultMaxIdleConnsPerHost = 32
+
+	// defaultResponseHeaderTimeout limits how long the default client waits for a server to
+	// begin responding. Presto answers requests for results within seconds, even while a
+	// query is still running, so a longer wait indicates an unresponsive server.
+	defaultResponseHeaderTimeout = time.Minute
+)
+
+// defaultClient is the HTTP client used when the caller does not supply one.
+var defaultClient = &http.Client{Transport: newDefaultTransport()}
+
+// DialFunc connects to the address of a coordinator, in the same way as the DialContext
+// field of http.Transport.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// newDialClient returns a client configured like the default client that connects to
+// coordinators with dial.
+func newDialClient(dial DialFunc) *http.Client {
+	tr := newDefaultTransport()
+	tr.DialContext = dial
+	return &http.Client{Transport: tr}
+}
+
+// proxyDirect is the value of the proxy data source option that connects to coordinators
+// directly, ignoring the proxy set by the environment.
+const proxyDirect = "direct"
+
+// clientKey identifies the client used for the data source options that need one of their
+// own.
+type clientKey struct {
+	unixSocket string
+	proxy      string
+}
+
+var (
+	clientsMu sync.Mutex
+	clients   = make(map[clientKey]*http.Client)
+)
+
+// clientFor returns the client connecting to coordinators through the Unix socket at
+// unixSocket, given either as a file name or as a unix:// URL, and the HTTP proxy at proxy,
+// or directly if proxy is proxyDirect. Either may be empty to connect as the default client
+// does. Connections with the same options share a client, so that they share its idle
+// connections.
+func clientFor(unixSocket, proxy string) (*http.Client, error) {
+	key := clientKey{unixSocket: strings.TrimPrefix(unixSocket, "unix://"), proxy: proxy}
+	if key == (clientKey{}) {
+		return defaultClient, nil
+	}
+
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if c, ok := clients[key]; ok {
+		return c, nil
+	}
+	tr := newDefaultTransport()
+	if key.unixSocket != "" {
+		var d net.Dialer
+		tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return d.DialContext(ctx, "unix", key.unixSocket)
+		}
+	}
+	switch proxy {
+	case "":
+	case proxyDirect:
+		tr.Proxy = nil
+	default:
+		u, err := url.Parse(proxy)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("%s: unsupported proxy %q", DriverName, proxy)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("%s: unsupported proxy %q", DriverName, proxy)
+		}
+		tr.Proxy = http.ProxyURL(u)
+	}
+	c := &http.Client{Transport: tr}
+	clients[key] = c
+	return c, nil
+}
+
+// newDefaultTransport returns a transport suited to the many short requests a driver makes
+// while polling for results, otherwise configured like http.DefaultTransport. HTTP/2 is
+// negotiated with servers reached over TLS, so that the requests of concurrent queries
+// share a connection rather than each holding one open through proxies. Servers accepting
+// HTTP/2 without TLS (h2c) need a client from golang.org/x/net/http2 supplied with
+// ClientOpen or a Connector.
+func newDefaultTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   defaultMaxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: defaultResponseHeaderTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
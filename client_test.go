@@ -0,0 +1,217 @@
+package prestgo
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql/driver"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDefaultClient(t *testing.T) {
+	tr, ok := defaultClient.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("got transport %T, wanted *http.Transport", defaultClient.Transport)
+	}
+	if tr.MaxIdleConnsPerHost != defaultMaxIdleConnsPerHost || tr.ResponseHeaderTimeout != defaultResponseHeaderTimeout {
+		t.Errorf("got %d idle connections per host and response header timeout %v", tr.MaxIdleConnsPerHost, tr.ResponseHeaderTimeout)
+	}
+	if tr.DisableKeepAlives || tr.IdleConnTimeout == 0 || tr.Proxy == nil || !tr.ForceAttemptHTTP2 {
+		t.Errorf("got transport %+v", tr)
+	}
+}
+
+func TestOpenClient(t *testing.T) {
+	custom := &http.Client{}
+
+	cn, err := Open("presto://example/tree/birch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := cn.(*conn).client; c != defaultClient {
+		t.Errorf("Open: got client %p, wanted the default client", c)
+	}
+
+	cn, err = ClientOpen(custom, "presto://example/tree/birch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := cn.(*conn).client; c != custom {
+		t.Errorf("ClientOpen: got client %p, wanted the supplied client", c)
+	}
+
+	cn, err = ClientOpen(nil, "presto://example/tree/birch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := cn.(*conn).client; c != defaultClient {
+		t.Errorf("ClientOpen with nil: got client %p, wanted the default client", c)
+	}
+
+	connector, err := NewConnector("presto://example/tree/birch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cn, err = connector.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := cn.(*conn).client; c != defaultClient {
+		t.Errorf("Connector: got client %p, wanted the default client", c)
+	}
+	connector.Client = custom
+	cn, err = connector.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := cn.(*conn).client; c != custom {
+		t.Errorf("Connector with client: got client %p, wanted the supplied client", c)
+	}
+}
+
+func TestDefaultTransportHTTP2(t *testing.T) {
+	protos := make(chan int, 10)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protos <- r.ProtoMajor
+		oneRowColResponse(w, r)
+	}))
+	ts.TLS = &tls.Config{NextProtos: []string{"h2", "http/1.1"}}
+	ts.StartTLS()
+	defer ts.Close()
+
+	// The default transport, trusting the test server's certificate
+	tr := newDefaultTransport()
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+	tr.TLSClientConfig = &tls.Config{RootCAs: pool}
+	defer tr.CloseIdleConnections()
+
+	r := &rows{
+		conn: &conn{
+			client: &http.Client{Transport: tr},
+		},
+		nextURI: ts.URL + "/v1/query/abcd/1",
+	}
+
+	values := make([]driver.Value, 1)
+	if err := r.Next(values); err != nil {
+		t.Fatal(err)
+	}
+	if proto := <-protos; proto != 2 {
+		t.Errorf("got HTTP/%d, wanted HTTP/2", proto)
+	}
+}
+
+func TestClientOpenUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prestgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "presto.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("unix sockets not supported: %v", err)
+	}
+	ts := httptest.NewUnstartedServer(statementHandler(oneRowColResponse))
+	ts.Listener = l
+	ts.Start()
+	defer ts.Close()
+
+	for _, socket := range []string{path, "unix://" + path} {
+		cn, err := Open("presto://coordinator/hive/default?unix_socket=" + url.QueryEscape(socket))
+		if err != nil {
+			t.Fatal(err)
+		}
+		st, _ := cn.Prepare("SELECT 1")
+		r, err := st.(*stmt).QueryContext(context.Background(), nil)
+		if err != nil {
+			t.Fatalf("%s: %v", socket, err)
+		}
+		r.Close()
+	}
+	c1, _ := clientFor(path, "")
+	c2, _ := clientFor("unix://"+path, "")
+	if c1 != c2 {
+		t.Error("got a client for each form of the socket path, wanted them shared")
+	}
+}
+
+func TestConnectorDialContext(t *testing.T) {
+	ts := httptest.NewServer(statementHandler(oneRowColResponse))
+	defer ts.Close()
+
+	var dialed []string
+	c, err := NewConnector("presto://coordinator.internal:8080/hive/default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		var d net.Dialer
+		return d.DialContext(ctx, network, ts.Listener.Addr().String())
+	}
+	cn, err := c.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, _ := cn.Prepare("SELECT 1")
+	r, err := st.(*stmt).QueryContext(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if len(dialed) == 0 || dialed[0] != "coordinator.internal:8080" {
+		t.Errorf("got dials of %q, wanted coordinator.internal:8080", dialed)
+	}
+
+	c.Client = http.DefaultClient
+	if _, err := c.Connect(context.Background()); err == nil {
+		t.Error("got no error with both Client and DialContext set, wanted one")
+	}
+}
+
+func TestClientOpenProxy(t *testing.T) {
+	var hosts []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.URL.Host)
+		statementHandler(oneRowColResponse).ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+
+	cn, err := Open("presto://coordinator.test:8080/hive/default?proxy=" + url.QueryEscape(proxy.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, _ := cn.Prepare("SELECT 1")
+	r, err := st.(*stmt).QueryContext(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Columns()
+	r.Close()
+	if len(hosts) < 2 || hosts[0] != "coordinator.test:8080" {
+		t.Errorf("got requests through the proxy for %q, wanted the statement and its results", hosts)
+	}
+
+	c, err := clientFor("", proxyDirect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr := c.Transport.(*http.Transport); tr.Proxy != nil {
+		t.Error("direct: got a proxy, wanted none")
+	}
+
+	for _, p := range []string{"proxy.test:3128", "ftp://proxy.test", "%zz"} {
+		if _, err := Open("presto://coordinator.test/hive/default?proxy=" + url.QueryEscape(p)); err == nil {
+			t.Errorf("%s: got no error, wanted one", p)
+		}
+	}
+}
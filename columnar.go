@@ -0,0 +1,428 @@
+package prestgo
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// ErrNotColumnar is returned by NextBatch for the rows of a query that was not run with a
+// context from WithColumnBatches.
+var ErrNotColumnar = errors.New(DriverName + ": query not columnar")
+
+// WithColumnBatches returns a copy of ctx that causes queries run with it to decode each page
+// of results column by column in a single pass, holding the values of columns of scalar
+// types in slices of their Go type rather than boxing each in an interface. The rows may then
+// be read a page at a time with NextBatch, skipping the per-row driver.Value path, as well
+// as a row at a time with Next.
+func WithColumnBatches(ctx context.Context) context.Context {
+	return context.WithValue(ctx, columnarKey, true)
+}
+
+func isColumnar(ctx context.Context) bool {
+	columnar, _ := ctx.Value(columnarKey).(bool)
+	return columnar
+}
+
+// ColumnBatch holds rows of the results of a query column by column.
+type ColumnBatch struct {
+	Len     int            // Number of rows in the batch.
+	Columns []ColumnVector // Values of each column, in the order of the result's columns.
+}
+
+// ColumnVector holds the values of a column of a ColumnBatch. Values of the integer types are
+// held in Int64s, those of double and real in Float64s and those of boolean in Bools. Values
+// of the types the server sends as text, such as varchar, decimal, date and timestamp, are
+// held in Strings in the form the server sent them, varbinary values being base64 encoded.
+// Values of other types, such as arrays, maps and rows, are held in Values, converted as
+// they are by Next, as are the values of any type for which a converter has been
+// registered with RegisterConverter and of every type when the raw_values data source
+// option is set. Only one of these slices is set. Nulls reports which values are NULL,
+// the value held for them being the zero value.
+type ColumnVector struct {
+	Name     string // Name of the column.
+	Type     string // Presto type of the column, e.g. "bigint" or "array(varchar)".
+	Nulls    []bool
+	Int64s   []int64
+	Float64s []float64
+	Bools    []bool
+	Strings  []string
+	Values   []driver.Value
+}
+
+// ColumnarRows is implemented by the driver.Rows returned by the driver, allowing callers
+// with access to them to read the results of a query run with a context from
+// WithColumnBatches a page at a time.
+type ColumnarRows interface {
+	// NextBatch returns the rows of the page of results last received that have not been
+	// read, or those of the next page once all have been, column by column. It returns
+	// io.EOF once all the results have been read. A batch is not changed by later calls.
+	NextBatch() (*ColumnBatch, error)
+}
+
+var _ ColumnarRows = &rows{}
+
+// NextBatch returns the rows not yet read from the current or next page of results.
+func (r *rows) NextBatch() (*ColumnBatch, error) {
+	if !r.columnar {
+		return nil, ErrNotColumnar
+	}
+	if r.maxRows > 0 && r.rownum >= r.maxRows {
+		return nil, r.stopAtMaxRows()
+	}
+	if r.rowindex >= r.pageLen() {
+		if r.nextURI == "" {
+			r.finish(io.EOF)
+			return nil, io.EOF
+		}
+		if err := r.fetch(); err != nil {
+			return nil, err
+		}
+	}
+
+	from, to := r.rowindex, r.pageLen()
+	if r.maxRows > 0 && to-from > r.maxRows-r.rownum {
+		to = from + r.maxRows - r.rownum
+	}
+	b := &ColumnBatch{Len: to - from, Columns: make([]ColumnVector, len(r.types))}
+	for i, conv := range r.types {
+		vec, row, err := r.cols.columns[i].vector(from, to, conv)
+		if err != nil {
+			return nil, newConversionError(r.columns[i], r.coltypes[i], r.rownum+row-from, r.cols.columns[i].value(row), err)
+		}
+		vec.Name, vec.Type = r.columns[i], r.rawColumns[i].Type
+		b.Columns[i] = vec
+	}
+	r.rowindex = to
+	r.rownum += b.Len
+	return b, nil
+}
+
+// nextColumnar reads the next row of a page decoded column by column into dest.
+func (r *rows) nextColumnar(dest []driver.Value) error {
+	for i, conv := range r.types {
+		v := r.cols.columns[i].value(r.rowindex)
+		val, err := conv.ConvertValue(v)
+		if err != nil {
+			return newConversionError(r.columns[i], r.coltypes[i], r.rownum, v, err)
+		}
+		dest[i] = val
+	}
+	r.rowindex++
+	r.rownum++
+	return nil
+}
+
+// pageLen returns the number of rows in the current page.
+func (r *rows) pageLen() int {
+	if r.cols != nil {
+		return r.cols.rows
+	}
+	return len(r.data)
+}
+
+// vectorKind identifies how the values of a column are stored in a columnVector.
+type vectorKind int
+
+const (
+	vectorValues vectorKind = iota // values decoded as for a row, boxed in interfaces
+	vectorInts
+	vectorFloats
+	vectorBools
+	vectorStrings
+)
+
+// vectorKinds gives the storage used for columns of scalar types. Types sent as JSON
+// strings are kept as their text, conversion being left to the consumer.
+var vectorKinds = map[string]vectorKind{
+	BigInt:                vectorInts,
+	Integer:               vectorInts,
+	Smallint:              vectorInts,
+	Tinyint:               vectorInts,
+	Double:                vectorFloats,
+	Real:                  vectorFloats,
+	Boolean:               vectorBools,
+	VarChar:               vectorStrings,
+	Char:                  vectorStrings,
+	VarBinary:             vectorStrings,
+	JSON:                  vectorStrings,
+	Decimal:               vectorStrings,
+	Date:                  vectorStrings,
+	Time:                  vectorStrings,
+	TimeWithTimezone:      vectorStrings,
+	Timestamp:             vectorStrings,
+	TimestampWithTimezone: vectorStrings,
+	UUID:                  vectorStrings,
+	IPAddress:             vectorStrings,
+}
+
+// columnVector holds the values of one column of a page. Only the slice for the column's
+// kind is used; nulls records which values are null, the stored value then being zero.
+type columnVector struct {
+	typ    prestoType
+	kind   vectorKind
+	nulls  []bool
+	ints   []int64
+	floats []float64
+	bools  []bool
+	strs   []string
+	values []interface{}
+}
+
+// columnarPage holds a page of results column by column, each column decoded into a slice
+// of its own type. This avoids boxing every value of scalar columns in an interface and
+// keeps the values of a column together for consumers that process a column at a time.
+type columnarPage struct {
+	rows    int
+	columns []*columnVector
+}
+
+// decodeColumnarResponse reads a page of query results from r, decoding the data array
+// into a columnarPage held in cols using the types given by the response's columns, or by
+// columns for a page sent without them, and the conversions of opts. If lazyStats is set
+// only the state of the query is decoded from its stats.
+func decodeColumnarResponse(r io.Reader, lazyStats bool, columns []queryColumn, opts converterOptions) (*queryResponse, error) {
+	var pending []json.RawMessage
+	deferred := false
+	qresp, err := decodeResponse(r, lazyStats, nil, func(dec *json.Decoder, qresp *queryResponse) error {
+		cols := qresp.Columns
+		if cols == nil {
+			cols = columns
+		}
+		if cols == nil {
+			// The types of the columns are needed to decode the data, so its rows are kept
+			// until the columns have been read
+			deferred = true
+			for dec.More() {
+				var row json.RawMessage
+				if err := dec.Decode(&row); err != nil {
+					return err
+				}
+				pending = append(pending, row)
+			}
+			return expectDelim(dec, ']')
+		}
+		var err error
+		qresp.cols, err = decodeColumnarData(dec, cols, opts)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if deferred {
+		page := newColumnarPage(qresp.Columns, opts)
+		for _, row := range pending {
+			dec := json.NewDecoder(bytes.NewReader(row))
+			dec.UseNumber()
+			if err := page.decodeRow(dec); err != nil {
+				return nil, err
+			}
+		}
+		qresp.cols = page
+	}
+	return qresp, nil
+}
+
+// decodeColumnarData decodes a data array from dec, a value at a time, into a columnarPage
+// with the given columns, the opening bracket of the array having already been read.
+func decodeColumnarData(dec *json.Decoder, columns []queryColumn, opts converterOptions) (*columnarPage, error) {
+	page := newColumnarPage(columns, opts)
+	if err := page.decodeRows(dec); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// newColumnarPage returns an empty page with the given columns, whose values are to be
+// converted as opts gives.
+func newColumnarPage(columns []queryColumn, opts converterOptions) *columnarPage {
+	page := &columnarPage{columns: make([]*columnVector, len(columns))}
+	for i, col := range columns {
+		typ := parseColumnType(col)
+		page.columns[i] = &columnVector{typ: typ, kind: columnKind(typ, opts)}
+	}
+	return page
+}
+
+// columnKind returns the storage used for a column of type typ. Values that are returned as
+// their text or converted by a registered converter are kept as they were decoded, so that
+// the text and the value given to the converter are exactly those the server sent.
+func columnKind(typ prestoType, opts converterOptions) vectorKind {
+	if opts.rawValues {
+		return vectorValues
+	}
+	if _, ok := registeredConverter(typ.name); ok {
+		return vectorValues
+	}
+	return vectorKinds[typ.name]
+}
+
+// decodeRows appends the rows of an array to the page, reading up to and including its
+// closing bracket.
+func (p *columnarPage) decodeRows(dec *json.Decoder) error {
+	for dec.More() {
+		if err := p.decodeRow(dec); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, ']')
+}
+
+// decodeRow appends a row read from dec to the page.
+func (p *columnarPage) decodeRow(dec *json.Decoder) error {
+	if err := expectDelim(dec, '['); err != nil {
+		return err
+	}
+	for i, vec := range p.columns {
+		if !dec.More() {
+			return fmt.Errorf("%s: row %d has %d values, wanted %d", DriverName, p.rows, i, len(p.columns))
+		}
+		if err := vec.decode(dec); err != nil {
+			return fmt.Errorf("%s: row %d: %v", DriverName, p.rows, err)
+		}
+	}
+	if err := expectDelim(dec, ']'); err != nil {
+		return err
+	}
+	p.rows++
+	return nil
+}
+
+// decode reads the next value of the column from dec.
+func (v *columnVector) decode(dec *json.Decoder) error {
+	if v.kind == vectorValues {
+		var val interface{}
+		if err := dec.Decode(&val); err != nil {
+			return err
+		}
+		v.nulls = append(v.nulls, val == nil)
+		v.values = append(v.values, val)
+		return nil
+	}
+
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	v.nulls = append(v.nulls, tok == nil)
+
+	switch v.kind {
+	case vectorInts:
+		var n int64
+		if tok != nil {
+			num, ok := tok.(json.Number)
+			if !ok {
+				return fmt.Errorf("unexpected %v for %s value", tok, v.typ.name)
+			}
+			if n, err = strconv.ParseInt(string(num), 10, 64); err != nil {
+				return err
+			}
+		}
+		v.ints = append(v.ints, n)
+	case vectorFloats:
+		var f float64
+		switch t := tok.(type) {
+		case nil:
+		case json.Number:
+			if f, err = strconv.ParseFloat(string(t), 64); err != nil {
+				return err
+			}
+		case string:
+			// Non-finite values are sent as strings
+			switch t {
+			case "NaN":
+				f = math.NaN()
+			case "Infinity":
+				f = math.Inf(1)
+			case "-Infinity":
+				f = math.Inf(-1)
+			default:
+				return fmt.Errorf("unexpected %q for %s value", t, v.typ.name)
+			}
+		default:
+			return fmt.Errorf("unexpected %v for %s value", tok, v.typ.name)
+		}
+		v.floats = append(v.floats, f)
+	case vectorBools:
+		var b bool
+		if tok != nil {
+			var ok bool
+			if b, ok = tok.(bool); !ok {
+				return fmt.Errorf("unexpected %v for %s value", tok, v.typ.name)
+			}
+		}
+		v.bools = append(v.bools, b)
+	case vectorStrings:
+		var s string
+		if tok != nil {
+			var ok bool
+			if s, ok = tok.(string); !ok {
+				return fmt.Errorf("unexpected %v for %s value", tok, v.typ.name)
+			}
+		}
+		v.strs = append(v.strs, s)
+	}
+	return nil
+}
+
+// vector returns the values of the column from row from up to row to, converting values not
+// held in a slice of their Go type with conv. If conversion fails the row that failed is
+// returned with the error.
+func (v *columnVector) vector(from, to int, conv driver.ValueConverter) (ColumnVector, int, error) {
+	vec := ColumnVector{Nulls: v.nulls[from:to:to]}
+	switch v.kind {
+	case vectorInts:
+		vec.Int64s = v.ints[from:to:to]
+	case vectorFloats:
+		vec.Float64s = v.floats[from:to:to]
+	case vectorBools:
+		vec.Bools = v.bools[from:to:to]
+	case vectorStrings:
+		vec.Strings = v.strs[from:to:to]
+	default:
+		vec.Values = make([]driver.Value, to-from)
+		for i := from; i < to; i++ {
+			val, err := conv.ConvertValue(v.values[i])
+			if err != nil {
+				return vec, i, err
+			}
+			vec.Values[i-from] = val
+		}
+	}
+	return vec, 0, nil
+}
+
+// value returns the value of the column at row i in the form it would take when decoded as
+// part of a row, so that it can be passed to the column's converter.
+func (v *columnVector) value(i int) interface{} {
+	if v.nulls[i] {
+		return nil
+	}
+	switch v.kind {
+	case vectorInts:
+		return json.Number(strconv.FormatInt(v.ints[i], 10))
+	case vectorFloats:
+		f := v.floats[i]
+		switch {
+		case math.IsNaN(f):
+			return "NaN"
+		case math.IsInf(f, 1):
+			return "Infinity"
+		case math.IsInf(f, -1):
+			return "-Infinity"
+		}
+		return json.Number(strconv.FormatFloat(f, 'g', -1, 64))
+	case vectorBools:
+		return v.bools[i]
+	case vectorStrings:
+		return v.strs[i]
+	}
+	return v.values[i]
+}
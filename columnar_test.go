@@ -0,0 +1,340 @@
+package prestgo
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var columnarBody = `{
+  "id": "abcd",
+  "columns": [
+    { "name": "id", "type": "bigint", "typeSignature": { "rawType": "bigint", "arguments": [] } },
+    { "name": "score", "type": "double", "typeSignature": { "rawType": "double", "arguments": [] } },
+    { "name": "ok", "type": "boolean", "typeSignature": { "rawType": "boolean", "arguments": [] } },
+    { "name": "name", "type": "varchar", "typeSignature": { "rawType": "varchar", "arguments": [] } },
+    { "name": "at", "type": "timestamp", "typeSignature": { "rawType": "timestamp", "arguments": [] } },
+    { "name": "tags", "type": "array(varchar)", "typeSignature": { "rawType": "array", "arguments": [ { "kind": "TYPE", "value": { "rawType": "varchar", "arguments": [] } } ] } }
+  ],
+  "data": [
+    [ 9007199254740993, 1.5, true, "a", "2017-03-01 10:00:00.000", [ "x", "y" ] ],
+    [ null, "NaN", null, null, null, null ],
+    [ -1, "-Infinity", false, "", "2017-03-02 10:00:00.000", [] ]
+  ],
+  "stats": { "state": "FINISHED" }
+}`
+
+func TestDecodeColumnarResponse(t *testing.T) {
+	qresp, err := decodeColumnarResponse(strings.NewReader(columnarBody), false, nil, converterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if qresp.ID != "abcd" || qresp.Stats.State != QueryStateFinished || qresp.Data != nil {
+		t.Errorf("got response %+v", qresp)
+	}
+	page := qresp.cols
+	if page.rows != 3 || len(page.columns) != 6 {
+		t.Fatalf("got %d rows of %d columns, wanted 3 of 6", page.rows, len(page.columns))
+	}
+
+	cols := page.columns
+	if !reflect.DeepEqual(cols[0].ints, []int64{9007199254740993, 0, -1}) {
+		t.Errorf("got bigint values %v", cols[0].ints)
+	}
+	if f := cols[1].floats; f[0] != 1.5 || !math.IsNaN(f[1]) || !math.IsInf(f[2], -1) {
+		t.Errorf("got double values %v", f)
+	}
+	if !reflect.DeepEqual(cols[2].bools, []bool{true, false, false}) {
+		t.Errorf("got boolean values %v", cols[2].bools)
+	}
+	if !reflect.DeepEqual(cols[3].strs, []string{"a", "", ""}) {
+		t.Errorf("got varchar values %v", cols[3].strs)
+	}
+	if !reflect.DeepEqual(cols[5].values, []interface{}{[]interface{}{"x", "y"}, nil, []interface{}{}}) {
+		t.Errorf("got array values %v", cols[5].values)
+	}
+	for i, col := range cols {
+		nulls := []bool{false, true, false}
+		if i == 1 {
+			nulls = []bool{false, false, false}
+		}
+		if !reflect.DeepEqual(col.nulls, nulls) {
+			t.Errorf("column %d: got nulls %v", i, col.nulls)
+		}
+	}
+
+	// Values converted from the columnar page match those of the row decoding
+	rowResp, err := decodeQueryResponse(strings.NewReader(columnarBody), false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rowResp.release()
+	opts := converterOptions{unknownTypes: unknownTypesError}
+	for i, col := range cols {
+		conv, err := newConverter(col.typ, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for row := 0; row < page.rows; row++ {
+			got, err := conv.ConvertValue(col.value(row))
+			if err != nil {
+				t.Errorf("column %d row %d: unexpected error %v", i, row, err)
+				continue
+			}
+			expected, _ := conv.ConvertValue(rowResp.Data[row][i])
+			if f, ok := expected.(float64); ok && math.IsNaN(f) {
+				if g, ok := got.(float64); !ok || !math.IsNaN(g) {
+					t.Errorf("column %d row %d: got %#v, wanted NaN", i, row, got)
+				}
+				continue
+			}
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("column %d row %d: got %#v, wanted %#v", i, row, got, expected)
+			}
+		}
+	}
+}
+
+func TestDecodeColumnarResponseErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		body string
+		err  bool
+		rows int
+	}{
+		{
+			name: "data before columns",
+			body: `{"data": [ [ 1 ], [ 2 ] ], "columns": [ { "name": "n", "type": "bigint" } ]}`,
+			rows: 2,
+		},
+		{
+			name: "null data",
+			body: `{"columns": [ { "name": "n", "type": "bigint" } ], "data": null}`,
+		},
+		{
+			name: "wrong type",
+			body: `{"columns": [ { "name": "n", "type": "bigint" } ], "data": [ [ "x" ] ]}`,
+			err:  true,
+		},
+		{
+			name: "out of range",
+			body: `{"columns": [ { "name": "n", "type": "bigint" } ], "data": [ [ 1e30 ] ]}`,
+			err:  true,
+		},
+		{
+			name: "short row",
+			body: `{"columns": [ { "name": "n", "type": "bigint" }, { "name": "m", "type": "bigint" } ], "data": [ [ 1 ] ]}`,
+			err:  true,
+		},
+		{
+			name: "long row",
+			body: `{"columns": [ { "name": "n", "type": "bigint" } ], "data": [ [ 1, 2 ] ]}`,
+			err:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		qresp, err := decodeColumnarResponse(strings.NewReader(tc.body), false, nil, converterOptions{})
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: got no error, wanted one", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+			continue
+		}
+		if rows := qresp.rowCount(); rows != tc.rows {
+			t.Errorf("%s: got %d rows, wanted %d", tc.name, rows, tc.rows)
+		}
+	}
+}
+
+func TestRowsNextBatch(t *testing.T) {
+	testCases := []struct {
+		max       int
+		expected  [][]int64
+		truncated bool
+	}{
+		{max: 0, expected: [][]int64{{1, 2}, {3, 4}, {5, 6}}},
+		{max: 3, expected: [][]int64{{1, 2}, {3}}, truncated: true},
+	}
+
+	for _, tc := range testCases {
+		// Only the first page carries the columns
+		ts := resumableServer(t, false)
+		cn := &conn{client: http.DefaultClient, addr: ts.Listener.Addr().String()}
+		s := &stmt{conn: cn, query: "SELECT col0 FROM t"}
+		ctx := WithMaxRows(WithColumnBatches(context.Background()), tc.max)
+		r, err := s.QueryContext(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got [][]int64
+		for {
+			b, err := r.(ColumnarRows).NextBatch()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%d: %v", tc.max, err)
+			}
+			col := b.Columns[0]
+			if col.Name != "col0" || col.Type != "bigint" || len(col.Int64s) != b.Len || len(col.Nulls) != b.Len {
+				t.Errorf("%d: got column %+v in batch of %d rows", tc.max, col, b.Len)
+			}
+			got = append(got, col.Int64s)
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%d: got batches %v, wanted %v", tc.max, got, tc.expected)
+		}
+		if truncated := r.(TruncatedRows).Truncated(); truncated != tc.truncated {
+			t.Errorf("%d: got truncated=%v, wanted %v", tc.max, truncated, tc.truncated)
+		}
+		r.Close()
+		ts.Close()
+	}
+}
+
+func TestRowsNextColumnar(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/statement" {
+			fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%s/v1/query/abcd/1", "stats": {"state": "QUEUED"}}`, r.Host)
+			return
+		}
+		fmt.Fprint(w, columnarBody)
+	}))
+	defer ts.Close()
+
+	// Rows read with Next from a columnar page match those read from a page of rows
+	read := func(ctx context.Context) [][]driver.Value {
+		cn := &conn{client: http.DefaultClient, addr: ts.Listener.Addr().String()}
+		s := &stmt{conn: cn, query: "SELECT * FROM t"}
+		r, err := s.QueryContext(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		var rows [][]driver.Value
+		for {
+			values := make([]driver.Value, len(r.Columns()))
+			if err := r.Next(values); err == io.EOF {
+				return rows
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			rows = append(rows, values)
+		}
+	}
+	got := read(WithColumnBatches(context.Background()))
+	expected := read(context.Background())
+	if len(got) != 3 || len(expected) != 3 {
+		t.Fatalf("got %d rows, wanted %d", len(got), len(expected))
+	}
+	for i := range got {
+		// NaN is not equal to itself
+		if f, ok := got[i][1].(float64); ok && math.IsNaN(f) {
+			got[i][1], expected[i][1] = nil, nil
+		}
+		if !reflect.DeepEqual(got[i], expected[i]) {
+			t.Errorf("row %d: got %#v, wanted %#v", i, got[i], expected[i])
+		}
+	}
+}
+
+func TestNextBatchNotColumnar(t *testing.T) {
+	r := &rows{conn: &conn{client: http.DefaultClient}, nextURI: "http://example/v1/query/abcd/1"}
+	if _, err := r.NextBatch(); err != ErrNotColumnar {
+		t.Errorf("got error %v, wanted ErrNotColumnar", err)
+	}
+}
+
+func TestColumnarConverters(t *testing.T) {
+	body := `{
+  "id": "abcd",
+  "columns": [
+    { "name": "id", "type": "bigint", "typeSignature": { "rawType": "bigint", "arguments": [] } },
+    { "name": "score", "type": "double", "typeSignature": { "rawType": "double", "arguments": [] } }
+  ],
+  "data": [ [ 1, 1.0E10 ], [ 2, 3.140 ], [ null, "NaN" ] ],
+  "stats": { "state": "FINISHED" }
+}`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/statement" {
+			fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%s/v1/query/abcd/1", "stats": {"state": "QUEUED"}}`, r.Host)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	defer ts.Close()
+
+	query := func(opts converterOptions) driver.Rows {
+		cn := &conn{client: http.DefaultClient, addr: ts.Listener.Addr().String(), conv: opts}
+		s := &stmt{conn: cn, query: "SELECT id, score FROM t"}
+		r, err := s.QueryContext(WithColumnBatches(context.Background()), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	readNext := func(opts converterOptions) [][]driver.Value {
+		r := query(opts)
+		defer r.Close()
+		var rows [][]driver.Value
+		for {
+			values := make([]driver.Value, len(r.Columns()))
+			if err := r.Next(values); err == io.EOF {
+				return rows
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			rows = append(rows, values)
+		}
+	}
+	readBatch := func(opts converterOptions) []ColumnVector {
+		r := query(opts)
+		defer r.Close()
+		b, err := r.(ColumnarRows).NextBatch()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b.Columns
+	}
+
+	// The server's text is returned for numbers with raw_values
+	raw := converterOptions{rawValues: true}
+	expected := [][]driver.Value{{"1", "1.0E10"}, {"2", "3.140"}, {nil, "NaN"}}
+	if got := readNext(raw); !reflect.DeepEqual(got, expected) {
+		t.Errorf("raw_values: got rows %#v, wanted %#v", got, expected)
+	}
+	cols := readBatch(raw)
+	if expected := []driver.Value{"1.0E10", "3.140", "NaN"}; !reflect.DeepEqual(cols[1].Values, expected) || cols[1].Float64s != nil {
+		t.Errorf("raw_values: got column %+v, wanted values %#v", cols[1], expected)
+	}
+
+	// Converters registered for scalar types are used
+	RegisterConverter("double", valueConverterFunc(func(v interface{}) (driver.Value, error) {
+		return fmt.Sprintf("double %v", v), nil
+	}))
+	defer RegisterConverter("double", nil)
+	expected = [][]driver.Value{{int64(1), "double 1.0E10"}, {int64(2), "double 3.140"}, {nil, "double NaN"}}
+	if got := readNext(converterOptions{}); !reflect.DeepEqual(got, expected) {
+		t.Errorf("registered converter: got rows %#v, wanted %#v", got, expected)
+	}
+	cols = readBatch(converterOptions{})
+	if expected := []driver.Value{"double 1.0E10", "double 3.140", "double NaN"}; !reflect.DeepEqual(cols[1].Values, expected) {
+		t.Errorf("registered converter: got column %+v, wanted values %#v", cols[1], expected)
+	}
+	if expected := []int64{1, 2, 0}; !reflect.DeepEqual(cols[0].Int64s, expected) {
+		t.Errorf("registered converter: got column %+v, wanted ints %v", cols[0], expected)
+	}
+}
@@ -0,0 +1,102 @@
+package prestgo
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	decompressorsMu sync.RWMutex
+	decompressors   = map[string]func(r io.Reader) (io.ReadCloser, error){
+		"gzip": newGzipReader,
+	}
+)
+
+// RegisterDecompressor registers fn as the decoder for response bodies sent with the named
+// Content-Encoding, such as "zstd", and asks servers to use the encoding in preference to
+// gzip, which the driver always accepts. This allows compression schemes outside the
+// standard library to be supported without the driver depending on them, for example with
+// github.com/klauspost/compress/zstd:
+//
+//	prestgo.RegisterDecompressor("zstd", func(r io.Reader) (io.ReadCloser, error) {
+//		d, err := zstd.NewReader(r)
+//		if err != nil {
+//			return nil, err
+//		}
+//		return d.IOReadCloser(), nil
+//	})
+//
+// Registering a nil fn removes the encoding, except for gzip whose decoder is restored.
+func RegisterDecompressor(encoding string, fn func(r io.Reader) (io.ReadCloser, error)) {
+	encoding = strings.ToLower(encoding)
+	decompressorsMu.Lock()
+	defer decompressorsMu.Unlock()
+	switch {
+	case fn != nil:
+		decompressors[encoding] = fn
+	case encoding == "gzip":
+		decompressors[encoding] = newGzipReader
+	default:
+		delete(decompressors, encoding)
+	}
+}
+
+// acceptEncoding returns the value of the Accept-Encoding header listing the registered
+// encodings, with gzip last so that servers prefer the others.
+func acceptEncoding() string {
+	decompressorsMu.RLock()
+	defer decompressorsMu.RUnlock()
+	encodings := make([]string, 0, len(decompressors))
+	for enc := range decompressors {
+		if enc != "gzip" {
+			encodings = append(encodings, enc)
+		}
+	}
+	sort.Strings(encodings)
+	return strings.Join(append(encodings, "gzip"), ", ")
+}
+
+// decompressBody replaces the body of a response sent with a registered Content-Encoding
+// with one that decompresses it on the fly.
+func decompressBody(resp *http.Response) error {
+	enc := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if enc == "" || enc == "identity" {
+		return nil
+	}
+	decompressorsMu.RLock()
+	fn, ok := decompressors[enc]
+	decompressorsMu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	zr, err := fn(resp.Body)
+	if err != nil {
+		return err
+	}
+	resp.Body = &decompressedBody{ReadCloser: zr, body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+func newGzipReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// decompressedBody reads a decompressed response body, closing the underlying body when done.
+type decompressedBody struct {
+	io.ReadCloser
+	body io.ReadCloser
+}
+
+func (b *decompressedBody) Close() error {
+	b.ReadCloser.Close()
+	return b.body.Close()
+}
@@ -0,0 +1,135 @@
+package prestgo
+
+import (
+	"bytes"
+	"compress/flate"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+)
+
+func newFlateReader(r io.Reader) (io.ReadCloser, error) {
+	return flate.NewReader(r), nil
+}
+
+func TestAcceptEncoding(t *testing.T) {
+	if v := acceptEncoding(); v != "gzip" {
+		t.Errorf("got %q, wanted gzip", v)
+	}
+
+	RegisterDecompressor("zstd", newFlateReader)
+	RegisterDecompressor("Deflate", newFlateReader)
+	if v := acceptEncoding(); v != "deflate, zstd, gzip" {
+		t.Errorf("got %q, wanted registered encodings before gzip", v)
+	}
+
+	RegisterDecompressor("zstd", nil)
+	RegisterDecompressor("deflate", nil)
+	RegisterDecompressor("gzip", nil)
+	if v := acceptEncoding(); v != "gzip" {
+		t.Errorf("got %q after removal, wanted gzip", v)
+	}
+}
+
+func TestRowsFetchRegisteredEncoding(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "x-flate, gzip" {
+			http.Error(w, "x-flate not accepted", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Encoding", "x-flate")
+		zw, _ := flate.NewWriter(w, flate.DefaultCompression)
+		defer zw.Close()
+		oneRowColResponse(&gzipResponseWriter{ResponseWriter: w, w: zw}, r)
+	}))
+	defer ts.Close()
+
+	RegisterDecompressor("x-flate", newFlateReader)
+	defer RegisterDecompressor("x-flate", nil)
+
+	r := &rows{
+		conn: &conn{
+			client: http.DefaultClient,
+		},
+		nextURI: ts.URL + "/v1/query/abcd/1",
+	}
+
+	values := make([]driver.Value, 1)
+	if err := r.Next(values); err != nil {
+		t.Fatal(err.Error())
+	}
+	if values[0] != "c0r0" {
+		t.Errorf("got %v, wanted %v", values[0], "c0r0")
+	}
+}
+
+// zstdPage is a page of 20 rows, "zstd row 0" to "zstd row 19", of a varchar column,
+// compressed by the zstd command at level 19.
+const zstdPage = "" +
+	"\x28\xb5\x2f\xfd\x64\xdb\x00\x65\x05\x00\x62\x88\x1c\x19\x40\x77" +
+	"\x0e\x1a\x3b\x4a\x93\x90\x1c\x18\x1a\x5e\x24\xcd\xc0\x8d\x00\x80" +
+	"\xe2\x8a\xe9\x38\x86\x61\x40\x65\xf9\x85\x71\xa2\x07\x7a\x1a\xb2" +
+	"\xb3\xf7\x49\x6b\x7d\x82\x1c\x46\x41\x0c\x42\x10\x24\xc8\x61\x14" +
+	"\xc4\x20\x04\xb4\x1e\x98\x21\x87\xa7\xcd\xde\xf8\xa9\x73\xdb\x4f" +
+	"\x5a\xcb\xb2\xe6\x6b\x6d\xdf\x85\x5b\x0a\x1b\x9f\xc4\x5f\xee\x7b" +
+	"\x65\x11\x6e\xac\xc2\x0d\x76\x62\x06\x94\x5b\x5b\xdf\x93\xd3\x54" +
+	"\xee\xdd\xed\xd3\xb8\xea\x93\xde\x56\x54\x7f\x2a\xb7\xd9\xc9\x1e" +
+	"\xa8\x20\x6e\x50\x92\x16\x32\x6d\x07\x50\x93\xdc\x74\x10\x20\x26" +
+	"\x92\x48\xa2\xd6\xc6\x76\xa9\xb2\x3d\xaa\x51\x62\x5b\x4f\xdc\x34" +
+	"\x84\x89\x23\xcf\xf8\x52\xec\xb7\xdb\x62\x57\xc1\xff\x6d\x06\xfe" +
+	"\xa8\x82\x3e\x86\xe5\xa7\x4b\x11\x3f\x19"
+
+// zstdCommand decompresses r with the zstd command, standing in for a zstd library
+// registered by a user of the driver.
+func zstdCommand(r io.Reader) (io.ReadCloser, error) {
+	cmd := exec.Command("zstd", "-dc")
+	cmd.Stdin = r
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(out)), nil
+}
+
+func TestRowsFetchZstd(t *testing.T) {
+	if _, err := exec.LookPath("zstd"); err != nil {
+		t.Skip("zstd command not found")
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "zstd, gzip" {
+			http.Error(w, "zstd not accepted", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Encoding", "zstd")
+		io.WriteString(w, zstdPage)
+	}))
+	defer ts.Close()
+
+	RegisterDecompressor("zstd", zstdCommand)
+	defer RegisterDecompressor("zstd", nil)
+
+	r := &rows{
+		conn: &conn{
+			client: http.DefaultClient,
+		},
+		nextURI: ts.URL + "/v1/query/abcd/1",
+	}
+
+	values := make([]driver.Value, 1)
+	for i := 0; i < 20; i++ {
+		if err := r.Next(values); err != nil {
+			t.Fatal(err)
+		}
+		if expected := fmt.Sprintf("zstd row %d", i); values[0] != expected {
+			t.Errorf("got %v, wanted %v", values[0], expected)
+		}
+	}
+	if err := r.Next(values); err != io.EOF {
+		t.Errorf("got %v, wanted io.EOF after the last row", err)
+	}
+}
@@ -1,16 +1,24 @@
 package prestgo
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math"
+	"math/rand"
+	"net"
 	"net/http"
 	"net/url"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -26,6 +34,29 @@ const (
 
 	TimestampFormat = "2006-01-02 15:04:05.000"
 	DateFormat      = "2006-01-02"
+	TimeFormat      = "15:04:05.000"
+)
+
+// Layouts used to parse temporal values. When parsing, Go accepts fractional seconds of any
+// precision following the seconds field, as sent for types such as timestamp(6).
+const (
+	timestampLayout = "2006-01-02 15:04:05"
+	timeLayout      = "15:04:05"
+)
+
+// Intervals between polls of a query that has not yet produced data. The interval starts
+// small so that short queries return promptly and doubles on each poll up to the maximum,
+// which may be changed with the poll_max_interval data source option.
+const (
+	pollInitialInterval    = 50 * time.Millisecond
+	pollDefaultMaxInterval = time.Second
+)
+
+// Limits applied by the StandardRetryPolicy when its fields are zero.
+const (
+	retryMaxAttempts  = 5
+	retryMaxElapsed   = 30 * time.Second
+	retryDefaultDelay = time.Second
 )
 
 var (
@@ -33,10 +64,22 @@ var (
 	ErrNotSupported = errors.New(DriverName + ": not supported")
 
 	// ErrQueryFailed indicates that a network or server failure prevented the driver obtaining a query result.
+	// An HTTPError giving the details of the failure wraps it.
 	ErrQueryFailed = errors.New(DriverName + ": query failed")
 
+	// ErrCircuitOpen is returned for new statements while the circuit breaker enabled by the
+	// circuit_breaker_threshold data source option is open after repeated failures.
+	ErrCircuitOpen = errors.New(DriverName + ": circuit breaker open")
+
 	// ErrQueryCanceled indicates that a query was canceled before results could be retrieved.
+	// A CanceledByServerError giving the server's reason wraps it. When the caller cancels a
+	// query through its context the context's error is returned instead.
 	ErrQueryCanceled = errors.New(DriverName + ": query canceled")
+
+	// ErrClusterBusy indicates that a query was canceled after waiting in the cluster's queue
+	// for longer than the max_queued_wait data source option allows. A ClusterBusyError
+	// giving the time waited wraps it.
+	ErrClusterBusy = errors.New(DriverName + ": cluster busy")
 )
 
 func init() {
@@ -50,40 +93,396 @@ func (*drv) Open(name string) (driver.Conn, error) {
 }
 
 // Open creates a connection to the specified data source name which should be
-// of the form "presto://hostname:port/catalog/schema?source=x&session=y". http.DefaultClient will
-// be used for communicating with the Presto server.
+// of the form "presto://hostname:port/catalog/schema?source=x&session=y". A client shared by
+// the driver, with keep-alives, idle connection limits and timeouts suited to polling for
+// query results, will be used for communicating with the Presto server.
 func Open(name string) (driver.Conn, error) {
-	return ClientOpen(http.DefaultClient, name)
+	return ClientOpen(nil, name)
 }
 
 // ClientOpen creates a connection to the specified data source name using the supplied
-// HTTP client. The data source name should be of the form
-// "presto://hostname:port/catalog/schema?source=x&session=y".
+// HTTP client, or the driver's own client if it is nil. The data source name should be of
+// the form "presto://hostname:port/catalog/schema?source=x&session=y".
 func ClientOpen(client *http.Client, name string) (driver.Conn, error) {
+	cn, err := newConn(client, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := cn.opened(context.Background()); err != nil {
+		return nil, err
+	}
+	return cn, nil
+}
 
+// newConn creates a connection to the specified data source name using the supplied HTTP client.
+func newConn(client *http.Client, name string) (*conn, error) {
 	conf := make(config)
-	conf.parseDataSource(name)
+	if err := conf.parseDataSource(name); err != nil {
+		return nil, fmt.Errorf("%s: invalid data source name: %v", DriverName, err)
+	}
 
+	if client == nil {
+		var err error
+		if client, err = clientFor(conf["unix_socket"], conf["proxy"]); err != nil {
+			return nil, err
+		}
+	}
+
+	var addrs []string
+	if conf["addr"] != "" {
+		addrs = strings.Split(conf["addr"], ",")
+	}
 	cn := &conn{
 		client:  client,
-		addr:    conf["addr"],
 		catalog: conf["catalog"],
 		schema:  conf["schema"],
 		user:    conf["user"],
 		source:  conf["source"],
-		session:  conf["session"],
+		session: conf["session"],
+	}
+	if v := conf["client_tags"]; v != "" {
+		cn.clientTags = strings.Split(v, ",")
+	}
+
+	policy := balanceRoundRobin
+	switch conf["load_balance"] {
+	case "", "round_robin":
+	case "least_outstanding":
+		policy = balanceLeastOutstanding
+	default:
+		return nil, fmt.Errorf("%s: unsupported load_balance %q", DriverName, conf["load_balance"])
+	}
+	switch {
+	case conf["srv"] != "":
+		cn.balancer = srvBalancerFor(conf["srv"], policy)
+	case len(addrs) > 0:
+		cn.addr = addrs[0]
+		if len(addrs) > 1 {
+			cn.balancer = balancerFor(addrs, policy)
+		}
+	default:
+		return nil, fmt.Errorf("%s: no coordinator in data source name", DriverName)
+	}
+
+	if tz := conf["time_zone"]; tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("%s: unsupported time_zone %q: %v", DriverName, tz, err)
+		}
+		cn.timeZone = tz
+		cn.conv.location = loc
+	}
+
+	switch conf["row_format"] {
+	case "", "json":
+	case "map":
+		cn.conv.rowsAsMaps = true
+	default:
+		return nil, fmt.Errorf("%s: unsupported row_format %q", DriverName, conf["row_format"])
+	}
+
+	switch conf["uuid_format"] {
+	case "", "string":
+	case "bytes":
+		cn.conv.uuidsAsBytes = true
+	default:
+		return nil, fmt.Errorf("%s: unsupported uuid_format %q", DriverName, conf["uuid_format"])
+	}
+
+	switch conf["ipaddress_format"] {
+	case "", "string":
+	case "ip":
+		cn.conv.ipAddressesAsIPs = true
+	default:
+		return nil, fmt.Errorf("%s: unsupported ipaddress_format %q", DriverName, conf["ipaddress_format"])
+	}
+
+	switch conf["decimal_format"] {
+	case "", "string":
+	case "rat":
+		cn.conv.decimalsAsRats = true
+	default:
+		return nil, fmt.Errorf("%s: unsupported decimal_format %q", DriverName, conf["decimal_format"])
+	}
+
+	switch conf["unknown_types"] {
+	case "", "string":
+	case "log":
+		cn.conv.unknownTypes = unknownTypesLog
+	case "error":
+		cn.conv.unknownTypes = unknownTypesError
+	default:
+		return nil, fmt.Errorf("%s: unsupported unknown_types %q", DriverName, conf["unknown_types"])
+	}
+
+	switch conf["json_format"] {
+	case "", "string":
+	case "raw":
+		cn.conv.jsonAsRawMessage = true
+	default:
+		return nil, fmt.Errorf("%s: unsupported json_format %q", DriverName, conf["json_format"])
+	}
+
+	if v := conf["trim_char"]; v != "" {
+		trim, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: unsupported trim_char %q", DriverName, v)
+		}
+		cn.conv.trimChar = trim
+	}
+
+	if v := conf["raw_values"]; v != "" {
+		raw, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: unsupported raw_values %q", DriverName, v)
+		}
+		cn.conv.rawValues = raw
+	}
+
+	if v := conf["multi_statement"]; v != "" {
+		multi, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: unsupported multi_statement %q", DriverName, v)
+		}
+		cn.multiStatement = multi
+	}
+
+	if v := conf["skip_stats"]; v != "" {
+		skip, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: unsupported skip_stats %q", DriverName, v)
+		}
+		cn.skipStats = skip
+	}
+
+	if v := conf["retry_queries"]; v != "" {
+		retry, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: unsupported retry_queries %q", DriverName, v)
+		}
+		cn.retryQueries = retry
+	}
+
+	if v := conf["spooled"]; v != "" {
+		spooled, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: unsupported spooled %q", DriverName, v)
+		}
+		cn.spooled = spooled
+	}
+
+	if v := conf["spooled_downloads"]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("%s: unsupported spooled_downloads %q", DriverName, v)
+		}
+		cn.spooledDownloads = n
+	}
+
+	if v := conf["wire_log"]; v != "" {
+		wire, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: unsupported wire_log %q", DriverName, v)
+		}
+		cn.wireLog = wire
+	}
+
+	if v := conf["poll_max_interval"]; v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%s: unsupported poll_max_interval %q", DriverName, v)
+		}
+		cn.pollMaxInterval = d
+	}
+
+	if v := conf["slow_query_threshold"]; v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%s: unsupported slow_query_threshold %q", DriverName, v)
+		}
+		cn.slowQueryThreshold = d
+	}
+
+	if v := conf["slow_query_redact"]; v != "" {
+		redact, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: unsupported slow_query_redact %q", DriverName, v)
+		}
+		cn.slowQueryRedact = redact
+	}
+
+	if v := conf["max_buffered_bytes"]; v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("%s: unsupported max_buffered_bytes %q", DriverName, v)
+		}
+		cn.maxBufferedBytes = n
+	}
+
+	if v := conf["max_queued_wait"]; v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%s: unsupported max_queued_wait %q", DriverName, v)
+		}
+		cn.maxQueuedWait = d
+	}
+
+	if v := conf["keepalive"]; v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%s: unsupported keepalive %q", DriverName, v)
+		}
+		cn.keepAlive = d
+	}
+
+	if v := conf["circuit_breaker_threshold"]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("%s: unsupported circuit_breaker_threshold %q", DriverName, v)
+		}
+		cooldown := circuitBreakerDefaultCooldown
+		if v := conf["circuit_breaker_cooldown"]; v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("%s: unsupported circuit_breaker_cooldown %q", DriverName, v)
+			}
+			cooldown = d
+		}
+		key := conf["addr"]
+		if conf["srv"] != "" {
+			key = srvScheme + ":" + conf["srv"]
+		}
+		cn.breaker = breakerFor(key, n, cooldown)
+	}
+
+	switch conf["health_check"] {
+	case "", "none":
+	case "open":
+		cn.healthCheck = healthCheckOpen
+	case "first_use":
+		cn.healthCheck = healthCheckFirstUse
+	default:
+		return nil, fmt.Errorf("%s: unsupported health_check %q", DriverName, conf["health_check"])
 	}
+
+	switch conf["timetz_format"] {
+	case "", "time":
+	case "string":
+		cn.conv.timeWithTimezoneAsString = true
+	default:
+		return nil, fmt.Errorf("%s: unsupported timetz_format %q", DriverName, conf["timetz_format"])
+	}
+
 	return cn, nil
 }
 
+// opened completes the opening of a new connection, checking the health of its coordinator
+// if that is to be done when the connection is opened.
+func (c *conn) opened(ctx context.Context) error {
+	if c.healthCheck != healthCheckOpen {
+		return nil
+	}
+	return c.checkHealth(ctx)
+}
+
+// conn is a connection to a Presto cluster. The protocol is stateless, each statement
+// being submitted in a request of its own, so a conn may run statements from several
+// goroutines at once and be closed while they run. The settings fixed when the conn is
+// opened are read without locking; the state that changes afterwards is guarded by mu.
+// The rows of each query are read by one goroutine at a time, as database/sql does.
 type conn struct {
-	client  *http.Client
-	addr    string
+	client   *http.Client
+	addr     string
+	user     string
+	source   string
+	timeZone string
+	conv     converterOptions
+
+	// clientTags are sent with each query for resource groups to select it by, unless
+	// overridden by WithClientTags.
+	clientTags []string
+
+	// pollMaxInterval is the longest interval between polls of a query that has not yet
+	// produced data. When zero, pollDefaultMaxInterval is used.
+	pollMaxInterval time.Duration
+
+	// maxBufferedBytes limits the bytes of result pages buffered for each query. When zero,
+	// the next page is always fetched while the current one is read.
+	maxBufferedBytes int64
+
+	// maxQueuedWait is how long a query may remain queued before it is canceled. When
+	// zero, queries wait in the queue for as long as the server keeps them.
+	maxQueuedWait time.Duration
+
+	// keepAlive is the interval at which the request for the next page of results is
+	// repeated while the consumer is not reading them. When zero, it is not repeated.
+	keepAlive time.Duration
+
+	// spooled asks the server to send results under the spooled protocol, in segments that
+	// may be left in storage to be downloaded, up to spooledDownloads at once. When
+	// spooledDownloads is zero, spooledDefaultDownloads are downloaded at once.
+	spooled          bool
+	spooledDownloads int
+
+	// skipStats limits the stats decoded from each page of results to the query's state.
+	skipStats bool
+
+	// multiStatement causes the text of a query to be split into statements at semicolons,
+	// each returning a result set of its own.
+	multiStatement bool
+
+	// logger receives the diagnostic messages of the connection. When nil, they are
+	// discarded.
+	logger Logger
+
+	// wireLog causes every HTTP exchange with the server to be logged at LogDebug.
+	wireLog bool
+
+	// metrics receives measurements of the queries run on the connection, if not nil.
+	metrics Metrics
+
+	// slowQueryThreshold is the time after which a query is logged as slow once it ends.
+	// When zero, slow queries are not logged.
+	slowQueryThreshold time.Duration
+
+	// slowQueryRedact causes literals to be removed from the text of slow queries logged.
+	slowQueryRedact bool
+
+	// hooks are called before and after each query run on the connection, if not nil.
+	hooks QueryHooks
+
+	// healthCheck is when the health of the coordinator is checked.
+	healthCheck int
+
+	// retryPolicy decides whether failed requests are retried. When nil,
+	// defaultRetryPolicy is used.
+	retryPolicy RetryPolicy
+
+	// retryQueries causes the retry policy to be asked whether read-only queries that fail
+	// transiently before returning rows are submitted again.
+	retryQueries bool
+
+	// breaker fails new statements after repeated failures of requests to the
+	// coordinators, if not nil.
+	breaker *circuitBreaker
+
+	mu      sync.Mutex
 	catalog string
 	schema  string
-	user    string
-	source  string
 	session string
+	active  map[*queryRun]struct{} // queries running on the connection
+	closed  bool
+
+	// healthChecked is set once the check made before the first statement has succeeded.
+	healthChecked bool
+
+	// canceling counts the requests canceling queries on the server that are in progress.
+	canceling sync.WaitGroup
+
+	// balancer distributes statements among the coordinators when several are listed in
+	// the data source name, in which case addr is the first of them, or when they are
+	// discovered from SRV records, in which case addr is empty.
+	balancer *balancer
 }
 
 var _ driver.Conn = &conn{}
@@ -96,14 +495,123 @@ func (c *conn) Prepare(query string) (driver.Stmt, error) {
 	return st, nil
 }
 
-func (c *conn) Close() error {
-	return nil
-}
-
 func (c *conn) Begin() (driver.Tx, error) {
 	return nil, ErrNotSupported
 }
 
+// do sends an HTTP request to the server, retrying it as long as the connection's retry
+// policy decides. Responses are requested compressed with gzip or any registered encoding
+// and transparently decompressed. Changes to the catalog and schema requested by the
+// server, as when a USE statement completes, are applied to the connection. When wire
+// logging is enabled each exchange is logged as its body is closed. The outcome is recorded
+// by the connection's circuit breaker, if any.
+func (c *conn) do(req *http.Request) (*http.Response, error) {
+	resp, err := c.send(req)
+	if cb := c.breaker; cb != nil {
+		if err == nil {
+			cb.record(resp.StatusCode >= 500, time.Now())
+		} else if req.Context().Err() == nil {
+			// The caller giving up says nothing of the coordinator's health
+			cb.record(true, time.Now())
+		}
+	}
+	return resp, err
+}
+
+// send sends an HTTP request to the server for do, retrying it while the retry policy
+// decides.
+func (c *conn) send(req *http.Request) (*http.Response, error) {
+	req.Header.Set("Accept-Encoding", acceptEncoding())
+
+	policy := c.retryPolicy
+	if policy == nil {
+		policy = defaultRetryPolicy
+	}
+	kind := requestKind(req)
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		sent := time.Now()
+		resp, err := c.client.Do(req)
+		if c.wireLog {
+			if err != nil {
+				logWireError(c.logger, req, sent, err)
+			} else {
+				logWireResponse(c.logger, req, resp, sent)
+			}
+		}
+		if err != nil {
+			if ctxErr := req.Context().Err(); ctxErr != nil {
+				// Report the caller's cancellation as itself rather than as a transport failure
+				return nil, ctxErr
+			}
+		}
+
+		retry := false
+		var delay time.Duration
+		if err != nil || resp.StatusCode != http.StatusOK {
+			a := RetryAttempt{Kind: kind, Attempt: attempt, Elapsed: time.Since(start), Err: err}
+			if resp != nil {
+				a.StatusCode = resp.StatusCode
+				a.Header = resp.Header
+			}
+			delay, retry = policy.Retry(a)
+		}
+		if !retry {
+			if err != nil {
+				return nil, err
+			}
+			if err := decompressBody(resp); err != nil {
+				resp.Body.Close()
+				return nil, err
+			}
+			c.applySetHeaders(resp.Header)
+			if fn := responseHeaderFunc(req.Context()); fn != nil {
+				fn(protocolHeaders(resp.Header))
+			}
+			return resp, nil
+		}
+
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+// retryAfter interprets the value of a Retry-After header, which may be either a number of
+// seconds or an HTTP date, returning retryDefaultDelay if it is missing or malformed.
+func retryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return retryDefaultDelay
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d
+		}
+		return 0
+	}
+	return retryDefaultDelay
+}
+
 type stmt struct {
 	conn  *conn
 	query string
@@ -120,31 +628,240 @@ func (s *stmt) NumInput() int {
 }
 
 func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
-	return nil, ErrNotSupported
+	named := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return s.exec(context.Background(), named)
+}
+
+var _ driver.StmtExecContext = &stmt{}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.exec(ctx, args)
 }
 
 func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	named := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return s.runScript(context.Background(), named)
+}
+
+var _ driver.StmtQueryContext = &stmt{}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.runScript(ctx, args)
+}
+
+// queryRun records how a query was run, for reporting when it ends.
+type queryRun struct {
+	ctx     context.Context // context returned by the BeforeQuery hook
+	query   string          // text submitted to the server
+	args    []driver.NamedValue
+	start   time.Time
+	timer   *queryTimer
+	fetches *fetchRecorder
+
+	// coordinator is the coordinator chosen by the balancer to run the query, if any.
+	coordinator *coordinator
+
+	cancel  context.CancelFunc // stops the query's requests when its connection is closed
+	mu      sync.Mutex
+	nextURI string // URI of the query's next results, for canceling it on the server
+	closed  bool   // whether the query was canceled by closing its connection
+
+	// attempts counts the times the query was retried after failing, or was declined.
+	attempts int
+}
+
+// run submits the statement to the server, returning rows that fetch its results using ctx.
+func (s *stmt) run(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if s.conn.healthCheck == healthCheckFirstUse {
+		if err := s.conn.checkHealthOnce(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	query := s.query
+	if h := s.conn.hooks; h != nil {
+		var err error
+		if ctx, query, err = h.BeforeQuery(ctx, query, args); err != nil {
+			return nil, err
+		}
+	}
+
+	if fn := warningFunc(ctx); fn != nil {
+		ctx = WithWarnings(ctx, uniqueWarnings(fn))
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithCancel(ctx)
+	q := &queryRun{
+		ctx:     ctx,
+		query:   query,
+		args:    args,
+		start:   start,
+		timer:   newQueryTimer(start),
+		fetches: &fetchRecorder{},
+		cancel:  cancel,
+	}
+	if !s.conn.track(q) {
+		cancel()
+		return nil, driver.ErrBadConn
+	}
+	if m := s.conn.metrics; m != nil {
+		m.QueryStarted()
+	}
 	// TODO: support query argument substitution
 	if len(args) > 0 {
+		s.conn.endQuery(q, "", 0, nil, ErrNotSupported)
 		return nil, ErrNotSupported
 	}
-	queryURL := fmt.Sprintf("http://%s/v1/statement", s.conn.addr)
-
-	req, err := http.NewRequest("POST", queryURL, strings.NewReader(s.query))
+	rows, err := s.submit(q)
+	for err != nil && s.conn.retryQuery(q, err) {
+		rows, err = s.submit(q)
+	}
 	if err != nil {
-		return nil, err
+		var queryID string
+		if e, ok := err.(*Error); ok {
+			queryID = e.QueryID
+		}
+		s.conn.endQuery(q, queryID, 0, nil, err)
+	}
+	return rows, err
+}
+
+// endQuery reports the end of the query q that returned the given number of rows to the
+// connection's metrics, its hooks and, if it took too long, its slow query log. stats
+// returns the statistics last reported by the server, if any were received. err is io.EOF
+// if all the results were read and context.Canceled if the rows were closed first.
+func (c *conn) endQuery(q *queryRun, queryID string, rows int64, stats func() QueryStats, err error) {
+	d := time.Since(q.start)
+	if q.coordinator != nil {
+		c.balancer.release(q.coordinator)
+	}
+	if m := c.metrics; m != nil {
+		if err == io.EOF {
+			m.QueryFinished(rows)
+		} else {
+			reportQueryError(m, err)
+		}
+	}
+	if c.slowQueryThreshold > 0 && d >= c.slowQueryThreshold {
+		c.logSlowQuery(q.query, queryID, d, rows, err)
 	}
+	if h := c.hooks; h != nil {
+		ev := QueryEvent{
+			Query:    q.query,
+			Args:     q.args,
+			QueryID:  queryID,
+			Duration: d,
+			Timing:   q.timer.timing(time.Now()),
+			Fetches:  q.fetches.stats(),
+			Rows:     rows,
+			Err:      err,
+		}
+		if stats != nil {
+			ev.Stats = stats()
+		}
+		if err == io.EOF {
+			ev.Err = nil
+		}
+		h.AfterQuery(q.ctx, ev)
+	}
+	c.untrack(q)
+	q.cancel()
+}
+
+// post sends the statement of q to a coordinator. When several coordinators are listed, one
+// that cannot be connected to is passed over for the next, until all have been tried, and
+// avoided by later statements for a while. Other failures are not retried, since the
+// coordinator may already have started the query. While the connection's circuit breaker is
+// open ErrCircuitOpen is returned without contacting any coordinator.
+func (s *stmt) post(q *queryRun) (*http.Response, error) {
+	if cb := s.conn.breaker; cb != nil && !cb.allow(time.Now()) {
+		return nil, ErrCircuitOpen
+	}
+
+	b := s.conn.balancer
+	if b == nil {
+		return s.conn.do(s.newRequest(q.ctx, s.conn.addr, q.query))
+	}
+
+	if b.srv != "" {
+		if err := b.discover(q.ctx); err != nil {
+			return nil, err
+		}
+	}
+	q.coordinator = b.pick(nil)
+	var tried []*coordinator
+	for {
+		resp, err := s.conn.do(s.newRequest(q.ctx, q.coordinator.addr, q.query))
+		if err == nil || !isDialError(err) {
+			return resp, err
+		}
+		b.markDown(q.coordinator)
+		tried = append(tried, q.coordinator)
+		next := b.pick(tried)
+		if next == nil {
+			return nil, err
+		}
+		logf(s.conn.logger, LogWarn, "%s: failing over from coordinator %s to %s: %v", DriverName, q.coordinator.addr, next.addr, err)
+		b.release(q.coordinator)
+		q.coordinator = next
+	}
+}
+
+// newRequest returns a request submitting query to the coordinator at addr.
+func (s *stmt) newRequest(ctx context.Context, addr, query string) *http.Request {
+	queryURL := fmt.Sprintf("http://%s/v1/statement", addr)
+	req, _ := http.NewRequest("POST", queryURL, strings.NewReader(query))
+	req = req.WithContext(ctx)
+	s.conn.mu.Lock()
+	catalog, schema, session := s.conn.catalog, s.conn.schema, s.conn.session
+	s.conn.mu.Unlock()
 	req.Header.Add("X-Presto-User", s.conn.user)
-	req.Header.Add("X-Presto-Catalog", s.conn.catalog)
-	req.Header.Add("X-Presto-Schema", s.conn.schema)
-	if s.conn.source != "" {
-		req.Header.Add("X-Presto-Source", s.conn.source)
+	req.Header.Add("X-Presto-Catalog", catalog)
+	req.Header.Add("X-Presto-Schema", schema)
+	source := s.conn.source
+	if v := querySource(ctx); v != "" {
+		source = v
 	}
-	if s.conn.session != "" {
-		req.Header.Add("X-Presto-Session", s.conn.session)
+	if source != "" {
+		req.Header.Add("X-Presto-Source", source)
 	}
+	tags, ok := clientTags(ctx)
+	if !ok {
+		tags = s.conn.clientTags
+	}
+	if len(tags) > 0 {
+		req.Header.Add("X-Presto-Client-Tags", strings.Join(tags, ","))
+	}
+	if session != "" {
+		req.Header.Add("X-Presto-Session", session)
+	}
+	if s.conn.timeZone != "" {
+		req.Header.Add("X-Presto-Time-Zone", s.conn.timeZone)
+	}
+	if s.conn.spooled {
+		req.Header.Add("X-Presto-Query-Data-Encoding", dataEncodings())
+	}
+	return req
+}
 
-	resp, err := s.conn.client.Do(req)
+// isDialError reports whether err is a failure to connect to the server, in which case the
+// request cannot have reached it.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// submit sends the statement of q to the server and reads its first response.
+func (s *stmt) submit(q *queryRun) (driver.Rows, error) {
+	ctx := q.ctx
+	resp, err := s.post(q)
 	if err != nil {
 		return nil, err
 	}
@@ -152,7 +869,7 @@ func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
 
 	// Presto doesn't use the http response code, parse errors come back as 200
 	if resp.StatusCode != 200 {
-		return nil, ErrQueryFailed
+		return nil, newHTTPError(resp)
 	}
 
 	var sresp stmtResponse
@@ -160,16 +877,38 @@ func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
 	if err != nil {
 		return nil, err
 	}
+	q.timer.observe(sresp.Stats.State, time.Now())
+	q.setNextURI(sresp.NextURI)
+	reportWarnings(ctx, sresp.Warnings)
+	if fn := queryInfoFunc(ctx); fn != nil && sresp.ID != "" {
+		fn(QueryInfo{ID: sresp.ID, InfoURI: sresp.InfoURI})
+	}
 
-	if sresp.Stats.State == "FAILED" {
+	if sresp.Stats.State == QueryStateFailed {
+		if sresp.Error == nil {
+			return nil, ErrQueryFailed
+		}
+		sresp.Error.QueryID, sresp.Error.InfoURI = sresp.ID, sresp.InfoURI
+		sresp.Error.addStats(sresp.Stats)
 		return nil, sresp.Error
 	}
 
-	time.Sleep(500 * time.Millisecond)
+	if fn := progressFunc(ctx); fn != nil {
+		fn(newQueryProgress(sresp.ID, sresp.Stats))
+	}
 
 	r := &rows{
-		conn:    s.conn,
-		nextURI: sresp.NextURI,
+		conn:      s.conn,
+		ctx:       ctx,
+		run:       q,
+		queryID:   sresp.ID,
+		infoURI:   sresp.InfoURI,
+		nextURI:   sresp.NextURI,
+		budget:    newPageBudget(s.conn.maxBufferedBytes),
+		stats:     sresp.Stats,
+		resumable: isResumable(ctx),
+		maxRows:   maxRows(ctx),
+		columnar:  isColumnar(ctx),
 	}
 
 	return r, nil
@@ -177,121 +916,514 @@ func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
 
 type rows struct {
 	conn     *conn
+	ctx      context.Context
+	run      *queryRun
+	queryID  string
+	infoURI  string
 	nextURI  string
-	fetched  bool
+	fetched  bool // whether the columns have been prepared from the first page
+	draining bool // whether the results are read only to be discarded, needing no converters
 	rowindex int
+	rownum   int // index of the next row within the whole result
 	columns  []string
+	coltypes []prestoType
 	types    []driver.ValueConverter
 	data     []queryData
+	page     *pageBuffer        // holds data, when it may be returned to the pool
+	budget   *pageBudget        // limits the bytes of pages buffered, nil when unlimited
+	size     int64              // bytes of the budget held by data
+	prefetch chan pageResult    // receives the page following data, when one is being fetched
+	pending  chan earlyResponse // receives the response to the request for nextURI, when sent ahead of time
+	spare    *queryResponse     // response whose data has been taken, for the next page to be decoded into
+	cancel   context.CancelFunc
+	done     bool            // whether the end of the query has been reported
+	stats    stmtStats       // statistics sent with the page last received
+	rawStats json.RawMessage // holds stats when only the state was decoded
+
+	// resumable stops pages being fetched ahead of the consumer, so that the position
+	// reached can be resumed from pageURI, the URI the current page was requested from.
+	resumable  bool
+	pageURI    string
+	skip       int           // rows of the next page received to skip, when resuming
+	rawColumns []queryColumn // columns as sent by the server, for resuming
+
+	maxRows   int  // rows to return before canceling the query, if more than zero
+	truncated bool // whether the query was canceled with rows left after maxRows
+
+	// columnar causes pages to be decoded column by column into cols rather than into data.
+	columnar bool
+	cols     *columnarPage
+
+	updateType  string // kind of statement run, e.g. INSERT, as reported by the server
+	updateCount int64  // rows changed by the statement, as last reported by the server
+	counted     bool   // whether the server has reported updateCount
 }
 
 var _ driver.Rows = &rows{}
 
+// pageResult is the outcome of fetching a page of results in the background.
+type pageResult struct {
+	resp    *queryResponse
+	next    chan earlyResponse // receives the response to the request for the page after resp, if sent
+	reports reports            // callback arguments from the responses received, to be reported to the consumer
+	err     error
+}
+
+// earlyResponse is the response to a request for a page sent before the consumer wanted it.
+type earlyResponse struct {
+	resp    *http.Response // nil if the request failed
+	reports reports
+}
+
+// close releases the resources held by a result that will not be used.
+func (res *pageResult) close(r *rows) {
+	if res.resp != nil {
+		r.discard(res.resp)
+	}
+	closeEarly(res.next)
+}
+
+// closeEarly closes the response received on ch, if any.
+func closeEarly(ch chan earlyResponse) {
+	if ch == nil {
+		return
+	}
+	if e := <-ch; e.resp != nil {
+		e.resp.Body.Close()
+	}
+}
+
 func (r *rows) fetch() error {
-	// TODO: timeout
-	for {
-		qresp, gotData, err := r.waitForData()
+	err := r.fetchNext()
+	for err != nil && err != io.EOF && !r.fetched && r.run != nil && r.conn.retryQuery(r.run, err) {
+		// The query failed before returning any rows, so it can be run again
+		if err = r.resubmit(); err == nil {
+			err = r.fetchNext()
+		}
+	}
+	if err != nil {
+		switch {
+		case r.run != nil && r.run.aborted():
+			err = ErrConnClosed
+		case r.context().Err() != nil && r.run != nil && r.nextURI != "" && !r.resumable:
+			// The caller gave up on the query through its context, so it is canceled
+			// rather than left running on the cluster until the server times it out
+			r.conn.cancelOnServer(r.nextURI)
+		}
+		r.finish(err)
+	}
+	return err
+}
+
+// fetchNext replaces the current page of rows with the next page of results.
+func (r *rows) fetchNext() error {
+	// The current page has been read, making room for the next
+	r.releasePage()
+
+	var qresp *queryResponse
+	if r.prefetch != nil {
+		res := <-r.prefetch
+		r.prefetch = nil
+		res.reports.replay(r.context())
+		if res.err != nil {
+			return res.err
+		}
+		qresp, r.pending = res.resp, res.next
+	} else {
+		var err error
+		qresp, err = r.fetchPage(r.context(), r.nextURI, r.queryID, r.infoURI, nil, r.spare)
+		r.spare = nil
 		if err != nil {
 			return err
 		}
-		if !gotData {
-			time.Sleep(800 * time.Millisecond) // TODO: make this interval configurable
+	}
+
+	if qresp.ID != "" {
+		r.queryID, r.infoURI = qresp.ID, qresp.InfoURI
+	}
+	if qresp.UpdateType != "" {
+		r.updateType = qresp.UpdateType
+	}
+	if qresp.UpdateCount != nil {
+		r.updateCount, r.counted = *qresp.UpdateCount, true
+	}
+	r.rowindex, r.skip = r.skip, 0
+	r.pageURI = qresp.uri
+	r.data, r.page, r.cols, r.size = qresp.Data, qresp.page, qresp.cols, qresp.size
+	r.stats, r.rawStats = qresp.Stats, qresp.rawStats
+
+	// Note: qresp.Stats.State will be FINISHED when last page is retrieved
+	r.nextURI = qresp.NextURI
+	if r.run != nil {
+		r.run.setNextURI(r.nextURI)
+	}
+
+	if !r.fetched {
+		if err := r.prepareColumns(qresp.Columns); err != nil {
+			return err
+		}
+	}
+
+	empty := qresp.rowCount() == 0
+	qresp.recycle()
+	r.spare = qresp
+	if empty {
+		return io.EOF
+	}
+
+	if r.nextURI != "" && !r.resumable && !r.draining {
+		r.startPrefetch()
+	}
+	return nil
+}
+
+// prepareColumns resolves the names, types and converters of the result's columns from
+// the first page received. Later pages are converted with the same converters. No
+// converters are made for results being drained, whose values are never converted, so a
+// column of a type that cannot be converted does not fail the statement.
+func (r *rows) prepareColumns(cols []queryColumn) error {
+	columns := make([]string, len(cols))
+	coltypes := make([]prestoType, len(cols))
+	types := make([]driver.ValueConverter, len(cols))
+	for i, col := range cols {
+		columns[i] = col.Name
+		coltypes[i] = parseColumnType(col)
+		if r.draining {
 			continue
 		}
+		conv, err := newConverter(coltypes[i], r.conn.conv)
+		if err != nil {
+			if e, ok := err.(*UnsupportedTypeError); ok {
+				e.Column = col.Name
+			}
+			return err
+		}
+		types[i] = conv
+	}
+	// The columns of a response are reused for the next page decoded into it, so keep a
+	// copy of those sent by the server for resuming
+	r.columns, r.coltypes, r.types = columns, coltypes, types
+	r.rawColumns = append([]queryColumn(nil), cols...)
+	r.fetched = true
+	return nil
+}
 
-		r.rowindex = 0
-		r.data = qresp.Data
-
-		// Note: qresp.Stats.State will be FINISHED when last page is retrieved
-		r.nextURI = qresp.NextURI
-
-		if !r.fetched {
-			r.columns = make([]string, len(qresp.Columns))
-			r.types = make([]driver.ValueConverter, len(qresp.Columns))
-			for i, col := range qresp.Columns {
-				r.columns[i] = col.Name
-				switch {
-				case strings.HasPrefix(col.Type, Row):
-					// If the column is an unflattened struct, interpret as a string.
-					r.types[i] = rowConverter{Type: col.Type}
-				case strings.HasPrefix(col.Type, VarChar), strings.HasPrefix(col.Type, Char):
-					r.types[i] = stringConverter
-				case col.Type == JSON:
-					// use string for json
-					r.types[i] = stringConverter
-				case col.Type == BigInt, col.Type == Integer, col.Type == Smallint, col.Type == Tinyint:
-					r.types[i] = bigIntConverter
-				case col.Type == Boolean:
-					r.types[i] = boolConverter
-				case col.Type == Double, col.Type == Real:
-					r.types[i] = doubleConverter
-				case strings.HasPrefix(col.Type, Decimal):
-					// use string converter for this so that we keep our preciseness
-					r.types[i] = stringConverter
-				case col.Type == Date:
-					r.types[i] = dateConverter
-				case col.Type == Time:
-					// use string here, having no date makes timestamps weird
-					r.types[i] = stringConverter
-				case col.Type == TimeWithTimezone:
-					// use string here, having no date makes timestamps weird
-					r.types[i] = stringConverter
-				case col.Type == Timestamp:
-					r.types[i] = timestampConverter
-				case col.Type == TimestampWithTimezone:
-					r.types[i] = timestampWithTimezoneConverter
-				default:
-					r.types[i] = stringConverter
-					fmt.Println(fmt.Sprintf("unsupported column type: %s", col.Type))
-				}
+// releasePage returns the buffer holding the current page of rows to the pool and its
+// bytes to the budget.
+func (r *rows) releasePage() {
+	if r.page != nil {
+		r.page.release()
+		r.data, r.page = nil, nil
+	}
+	r.cols = nil
+	if r.budget != nil {
+		r.budget.release(r.size)
+	}
+	r.size = 0
+}
+
+// discard releases the resources held by a response whose data will not be read.
+func (r *rows) discard(qresp *queryResponse) {
+	qresp.release()
+	if r.budget != nil {
+		r.budget.release(qresp.size)
+	}
+	qresp.size = 0
+}
+
+// finish reports the end of the query run by a statement, unless already reported. err is
+// io.EOF if all the results were read.
+func (r *rows) finish(err error) {
+	if r.done || r.run == nil {
+		return
+	}
+	r.done = true
+	r.conn.endQuery(r.run, r.queryID, int64(r.rownum), r.Stats, err)
+}
+
+// context returns the context the query is run with.
+func (r *rows) context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// startPrefetch begins fetching the page at nextURI in the background so that it is ready, or
+// closer to it, by the time the consumer has read the rows of the current page. Once that
+// page has been read, the request for the page after it is sent straight away, so that the
+// server prepares it while the consumer is still busy with the pages before.
+func (r *rows) startPrefetch() {
+	ctx := r.context()
+	if r.cancel == nil {
+		ctx, r.cancel = context.WithCancel(ctx)
+		r.ctx = ctx
+	}
+
+	ch := make(chan pageResult, 1)
+	r.prefetch = ch
+	uri, queryID, infoURI, pending, spare := r.nextURI, r.queryID, r.infoURI, r.pending, r.spare
+	r.pending, r.spare = nil, nil
+	go func() {
+		var res pageResult
+		var early *http.Response
+		if pending != nil {
+			e := <-pending
+			early, res.reports = e.resp, e.reports
+		}
+		// Callbacks are called when the consumer receives the page, so that they are always
+		// called from the goroutine reading the results
+		res.resp, res.err = r.fetchPage(res.reports.capture(ctx), uri, queryID, infoURI, early, spare)
+		if res.err != nil || res.resp.rowCount() == 0 || res.resp.NextURI == "" {
+			ch <- res
+			return
+		}
+
+		// Deliver the page before requesting the next, which the server may hold open
+		// until it has data
+		next := make(chan earlyResponse, 1)
+		if r.conn.keepAlive > 0 {
+			// Sending blocks until the consumer wants the page, keeping the query alive
+			// meanwhile
+			next = make(chan earlyResponse)
+		}
+		res.next = next
+		ch <- res
+		var e earlyResponse
+		// A failure is left to be reported when the page is requested again
+		e.resp, _ = r.get(e.reports.capture(ctx), res.resp.NextURI)
+		if e.resp == nil || r.conn.keepAlive <= 0 {
+			next <- e
+			return
+		}
+		r.holdEarly(ctx, res.resp.NextURI, e, next)
+	}()
+}
+
+// holdEarly sends e, the response to the request for uri, on next once the consumer wants
+// it. A consumer that stops reading for longer than the server waits for the client would
+// have its query expired, so until then the request is repeated at every keepAlive
+// interval. The server returns the same page for a repeated request, so the latest
+// response replaces e and no more than one page is held back for the query.
+func (r *rows) holdEarly(ctx context.Context, uri string, e earlyResponse, next chan<- earlyResponse) {
+	ticker := time.NewTicker(r.conn.keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case next <- e:
+			return
+		case <-ctx.Done():
+			// The rows have been closed, which receives e to release it
+			next <- e
+			return
+		case <-ticker.C:
+			var t earlyResponse
+			resp, err := r.get(t.reports.capture(ctx), uri)
+			if err != nil {
+				// A failure is left to be reported when the page is requested
+				continue
+			}
+			if resp.StatusCode != 200 {
+				resp.Body.Close()
+				continue
 			}
-			r.fetched = true
+			e.resp.Body.Close()
+			t.resp = resp
+			e = t
+		}
+	}
+}
+
+// fetchPage requests the page of results at uri, polling until the query produces data or
+// finishes. If the request for uri has already been sent, pending is its response. Pages
+// are decoded into reuse if it is not nil. It does not modify r, so may be called from a
+// background goroutine.
+func (r *rows) fetchPage(ctx context.Context, uri, queryID, infoURI string, pending *http.Response, reuse *queryResponse) (*queryResponse, error) {
+	polls := 0
+	for {
+		qresp, gotData, err := r.waitForData(ctx, uri, queryID, infoURI, pending, reuse)
+		pending = nil
+		if err != nil {
+			return nil, err
+		}
+		if gotData {
+			qresp.uri = uri
+			return qresp, nil
 		}
+		if qresp.ID != "" {
+			queryID, infoURI = qresp.ID, qresp.InfoURI
+		}
+		if err := r.checkQueuedWait(qresp, queryID); err != nil {
+			r.discard(qresp)
+			return nil, err
+		}
+		r.discard(qresp)
+		reuse = qresp
 
-		if len(qresp.Data) == 0 {
-			return io.EOF
+		uri = qresp.NextURI
+		if err := wait(ctx, pollDelay(polls, r.conn.pollMaxInterval)); err != nil {
+			return nil, err
 		}
+		polls++
+	}
+}
 
+// checkQueuedWait cancels the query and returns a ClusterBusyError if qresp shows it still
+// queued after the time allowed by maxQueuedWait.
+func (r *rows) checkQueuedWait(qresp *queryResponse, queryID string) error {
+	limit := r.conn.maxQueuedWait
+	if limit <= 0 || r.run == nil || !isQueued(qresp.Stats) {
+		return nil
+	}
+	waited := time.Since(r.run.start)
+	if waited < limit {
 		return nil
 	}
+	if qresp.NextURI != "" {
+		r.conn.cancelOnServer(qresp.NextURI)
+	}
+	return &ClusterBusyError{QueryID: queryID, Waited: waited}
 }
 
-func (r *rows) waitForData() (*queryResponse, bool, error) {
-	nextReq, err := http.NewRequest("GET", r.nextURI, nil)
-	if err != nil {
-		return nil, false, err
+// wait pauses for d, returning early with the context's error if ctx is done.
+func wait(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
+}
+
+// pollDelay returns how long to wait before the next poll of a query that has already been
+// polled the given number of times without producing data. The delay grows exponentially
+// up to max, which defaults to pollDefaultMaxInterval when zero, and is jittered so that
+// many queries started together do not poll in lockstep.
+func pollDelay(polls int, max time.Duration) time.Duration {
+	if max <= 0 {
+		max = pollDefaultMaxInterval
+	}
+	d := pollInitialInterval
+	for i := 0; i < polls && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	// Full jitter over the upper half of the interval
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
 
-	nextResp, err := r.conn.client.Do(nextReq)
+// get sends a request for the page of results at uri.
+func (r *rows) get(ctx context.Context, uri string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", uri, nil)
 	if err != nil {
-		return nil, false, err
+		return nil, err
+	}
+	return r.conn.do(req.WithContext(ctx))
+}
+
+// waitForData requests the page of results at uri, or reads nextResp if the request has
+// already been sent, decoding it into reuse if that is not nil. It reports whether the
+// response holds data or ends the query, rather than asking for the query to be polled
+// again at its NextURI.
+func (r *rows) waitForData(ctx context.Context, uri, queryID, infoURI string, nextResp *http.Response, reuse *queryResponse) (*queryResponse, bool, error) {
+	start := time.Now()
+	var wait time.Duration // time until the server responded, when the request is sent here
+	if nextResp == nil {
+		var err error
+		if nextResp, err = r.get(ctx, uri); err != nil {
+			return nil, false, err
+		}
+		wait = time.Since(start)
 	}
 
 	if nextResp.StatusCode != 200 {
+		err := newHTTPError(nextResp)
+		err.QueryID, err.InfoURI = queryID, infoURI
 		nextResp.Body.Close()
-		return nil, false, ErrQueryFailed
+		return nil, false, err
 	}
 
-	var qresp queryResponse
-	err = json.NewDecoder(nextResp.Body).Decode(&qresp)
+	br := &budgetReader{r: nextResp.Body, b: r.budget}
+	var qresp *queryResponse
+	var err error
+	if r.columnar {
+		qresp, err = decodeColumnarResponse(br, r.conn.skipStats, r.rawColumns, r.conn.conv)
+	} else {
+		qresp, err = decodeQueryResponse(br, r.conn.skipStats, reuse)
+	}
 	nextResp.Body.Close()
+	if r.budget != nil {
+		if err != nil {
+			r.budget.release(br.n)
+		} else {
+			qresp.size = br.n
+		}
+	}
 	if err != nil {
 		return nil, false, err
 	}
+	received := br.n
+	if qresp.spooled != nil {
+		n, err := r.loadSegments(ctx, qresp)
+		if err != nil {
+			r.discard(qresp)
+			return nil, false, err
+		}
+		received += n
+	}
+	latency := time.Since(start)
+	if m := r.conn.metrics; m != nil {
+		m.PageFetched(latency, received, qresp.rowCount())
+	}
+
+	if qresp.ID != "" {
+		queryID, infoURI = qresp.ID, qresp.InfoURI
+	}
+	if r.run != nil {
+		r.run.timer.observe(qresp.Stats.State, time.Now())
+		r.run.fetches.record(wait, latency-wait, received, qresp.rowCount())
+	}
+	reportWarnings(ctx, qresp.Warnings)
+	if fn := progressFunc(ctx); fn != nil {
+		qresp.decodeStats()
+		fn(newQueryProgress(queryID, qresp.Stats))
+	}
 
 	switch qresp.Stats.State {
 	case QueryStateFailed:
+		r.discard(qresp)
+		if qresp.Error == nil {
+			return nil, false, ErrQueryFailed
+		}
+		qresp.Error.QueryID, qresp.Error.InfoURI = queryID, infoURI
+		qresp.decodeStats()
+		qresp.Error.addStats(qresp.Stats)
+		if serverCancellations[qresp.Error.ErrorName] {
+			return nil, false, &CanceledByServerError{QueryID: queryID, Reason: qresp.Error.Message, Err: qresp.Error}
+		}
 		return nil, false, qresp.Error
 	case QueryStateCanceled:
-		return nil, false, ErrQueryCanceled
-	case QueryStatePlanning, QueryStateQueued, QueryStateRunning, QueryStateStarting:
-		if len(qresp.Data) == 0 {
-			r.nextURI = qresp.NextURI
-			return nil, false, nil
+		r.discard(qresp)
+		e := &CanceledByServerError{QueryID: queryID}
+		if qresp.Error != nil {
+			qresp.Error.QueryID, qresp.Error.InfoURI = queryID, infoURI
+			e.Reason, e.Err = qresp.Error.Message, qresp.Error
+		}
+		return nil, false, e
+	default:
+		// A query waiting for resources or dispatch is still queued, so keep polling
+		// through every state short of the end of the query, unless the rows changed by a
+		// statement being drained are known
+		if phase, ok := queryPhases[qresp.Stats.State]; ok && phase != phaseEnded && qresp.rowCount() == 0 && !(r.draining && qresp.UpdateCount != nil) {
+			return qresp, false, nil
 		}
 	}
 
-	return &qresp, true, nil
+	return qresp, true, nil
 }
 
 func (r *rows) Columns() []string {
@@ -303,13 +1435,84 @@ func (r *rows) Columns() []string {
 	return r.columns
 }
 
+var _ driver.RowsColumnTypeScanType = &rows{}
+
+// ColumnTypeScanType returns the Go type of the values returned for the column at index.
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	return scanType(r.coltypes[index], r.conn.conv)
+}
+
+var _ driver.RowsColumnTypeDatabaseTypeName = &rows{}
+
+// ColumnTypeDatabaseTypeName returns the upper cased Presto type of the column at index,
+// e.g. "VARCHAR" or "ARRAY(BIGINT)".
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	return r.coltypes[index].databaseTypeName()
+}
+
+var _ driver.RowsColumnTypeNullable = &rows{}
+
+// ColumnTypeNullable reports that the column at index may contain NULL, which is true of
+// every column in a Presto result.
+func (r *rows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	return true, true
+}
+
+var _ driver.RowsColumnTypePrecisionScale = &rows{}
+
+// ColumnTypePrecisionScale returns the precision and scale of a decimal column, or the
+// fractional second precision of a time or timestamp column.
+func (r *rows) ColumnTypePrecisionScale(index int) (precision, scale int64, ok bool) {
+	return r.coltypes[index].precisionScale()
+}
+
+var _ driver.RowsColumnTypeLength = &rows{}
+
+// ColumnTypeLength returns the declared length of a varchar, char or varbinary column, or
+// math.MaxInt64 when the length is unbounded.
+func (r *rows) ColumnTypeLength(index int) (length int64, ok bool) {
+	return r.coltypes[index].length()
+}
+
 func (r *rows) Close() error {
+	if r.cancel != nil {
+		// Stop any page being prefetched
+		r.cancel()
+	}
+	if r.prefetch != nil || r.pending != nil {
+		// Release whatever the background requests return once they see the cancellation
+		go func(prefetch chan pageResult, pending chan earlyResponse) {
+			closeEarly(pending)
+			if prefetch != nil {
+				res := <-prefetch
+				res.close(r)
+			}
+		}(r.prefetch, r.pending)
+		r.prefetch, r.pending = nil, nil
+	}
+	r.releasePage()
+	if r.budget != nil {
+		r.budget.close()
+	}
+	if !r.done && r.run != nil && r.nextURI != "" && !r.resumable {
+		// Closing the rows before reading all the results abandons the query, which is
+		// canceled rather than left running on the cluster until the server times it out
+		r.conn.cancelOnServer(r.nextURI)
+	}
+	r.finish(context.Canceled)
 	return nil
 }
 
+// Next converts the values of the next row into dest. Values are converted only as each row
+// is read, so rows of a page that are never read, such as those left when the caller stops
+// early, are never converted.
 func (r *rows) Next(dest []driver.Value) error {
-	if !r.fetched || r.rowindex >= len(r.data) {
+	if r.maxRows > 0 && r.rownum >= r.maxRows {
+		return r.stopAtMaxRows()
+	}
+	if r.rowindex >= r.pageLen() {
 		if r.nextURI == "" {
+			r.finish(io.EOF)
 			return io.EOF
 		}
 		if err := r.fetch(); err != nil {
@@ -317,22 +1520,32 @@ func (r *rows) Next(dest []driver.Value) error {
 		}
 	}
 
+	if r.cols != nil {
+		return r.nextColumnar(dest)
+	}
+	row := r.data[r.rowindex]
 	for i, v := range r.types {
-		val, err := v.ConvertValue(r.data[r.rowindex][i])
+		val, err := v.ConvertValue(row[i])
 		if err != nil {
-			return err // TODO: more context in error
+			return newConversionError(r.columns[i], r.coltypes[i], r.rownum, row[i], err)
 		}
 		dest[i] = val
 	}
 	r.rowindex++
+	r.rownum++
 	return nil
 }
 
 type config map[string]string
 
 func (c config) parseDataSource(ds string) error {
+	ds, others := splitHosts(ds)
 	u, err := url.Parse(ds)
 	if err != nil {
+		if ue, ok := err.(*url.Error); ok {
+			// The URL quoted by the error may hold a password
+			err = ue.Err
+		}
 		return err
 	}
 
@@ -342,16 +1555,24 @@ func (c config) parseDataSource(ds string) error {
 		c["user"] = DefaultUsername
 	}
 
-	if strings.IndexRune(u.Host, ':') == -1 {
-		c["addr"] = u.Host + ":" + DefaultPort
+	if u.Scheme == srvScheme {
+		// The coordinators are discovered from the SRV records named by the host
+		c["srv"] = u.Hostname()
 	} else {
-		c["addr"] = u.Host
+		// Several coordinators are listed in addr separated by commas
+		addrs := make([]string, 0, 1+len(others))
+		for _, host := range append([]string{u.Host}, others...) {
+			if strings.IndexRune(host, ':') == -1 {
+				host += ":" + DefaultPort
+			}
+			addrs = append(addrs, host)
+		}
+		c["addr"] = strings.Join(addrs, ",")
 	}
 
 	c["catalog"] = DefaultCatalog
 	c["schema"] = DefaultSchema
 
-
 	pathSegments := strings.FieldsFunc(u.Path, func(c rune) bool { return c == '/' })
 	if len(pathSegments) > 0 {
 		c["catalog"] = pathSegments[0]
@@ -374,19 +1595,23 @@ func (fn valueConverterFunc) ConvertValue(v interface{}) (driver.Value, error) {
 }
 
 /** Stripe's (Data Platform) custom row converter
- * Hack: We introduce a custom class that converts unflattened structs in Presto into a JSON string.
+ * Converts unflattened structs in Presto into a JSON object string keyed by the field names
+ * declared in the column type, e.g. {"_id":"dp_9uVcPMp305RgYo","created":1484119972.0129445,"open":false}
  */
 type rowConverter struct {
-	Type string
+	typ      prestoType
+	location *time.Location // session time zone of timestamp fields, if not UTC
 }
 
 func (rc rowConverter) ConvertValue(v interface{}) (driver.Value, error) {
 	if v == nil {
 		return nil, nil
 	}
-	// TODO: Write a custom parser to combine "rc.Type" and "v" into something like:
-	// {_id="dp_9uVcPMp305RgYo",created=1484119972.0129445,open=false,...}
-	return v, nil
+	var buf bytes.Buffer
+	if err := encodeValueJSON(&buf, rc.typ, v, rc.location); err != nil {
+		return nil, err
+	}
+	return buf.String(), nil
 }
 
 var stringConverter = valueConverterFunc(func(val interface{}) (driver.Value, error) {
@@ -404,26 +1629,34 @@ var boolConverter = valueConverterFunc(func(val interface{}) (driver.Value, erro
 })
 
 // bigIntConverter converts a value from the underlying json response into an int64.
-// The Go JSON decoder uses float64 for generic numeric values
+// Data pages are decoded into json.Number so that values above 2^53 are kept exactly.
 var bigIntConverter = valueConverterFunc(func(val interface{}) (driver.Value, error) {
 	if val == nil {
 		return nil, nil
 	}
 
-	if vv, ok := val.(float64); ok {
+	switch vv := val.(type) {
+	case json.Number:
+		if n, err := strconv.ParseInt(string(vv), 10, 64); err == nil {
+			return n, nil
+		}
+	case float64:
 		return int64(vv), nil
 	}
 	return nil, fmt.Errorf("%s: failed to convert %v (%T) into type int64", DriverName, val, val)
 })
 
-// doubleConverter converts a value from the underlying json response into an int64.
-// The Go JSON decoder uses float64 for generic numeric values
+// doubleConverter converts a value from the underlying json response into a float64.
 var doubleConverter = valueConverterFunc(func(val interface{}) (driver.Value, error) {
 	if val == nil {
 		return nil, nil
 	}
 
 	switch vv := val.(type) {
+	case json.Number:
+		if f, err := vv.Float64(); err == nil {
+			return f, nil
+		}
 	case float64:
 		return vv, nil
 	case string:
@@ -440,52 +1673,61 @@ var doubleConverter = valueConverterFunc(func(val interface{}) (driver.Value, er
 	return nil, fmt.Errorf("%s: failed to convert %v (%T) into type float64", DriverName, val, val)
 })
 
-// dateConverter converts a value from the underlying json response into a time.Time.
-var dateConverter = valueConverterFunc(func(val interface{}) (driver.Value, error) {
-	if val == nil {
-		return nil, nil
-	}
-	if vv, ok := val.(string); ok {
-		// BUG: should parse using session time zone.
-		if ts, err := time.ParseInLocation(DateFormat, vv, time.UTC); err == nil {
-			return ts, nil
+// dateConverter converts a value from the underlying json response into a time.Time in UTC.
+var dateConverter = dateConverterIn(time.UTC)
+
+// dateConverterIn returns a converter from a value in the underlying json response into a
+// time.Time at midnight in loc, which should be the session time zone.
+func dateConverterIn(loc *time.Location) valueConverterFunc {
+	return func(val interface{}) (driver.Value, error) {
+		if val == nil {
+			return nil, nil
+		}
+		if vv, ok := val.(string); ok {
+			if ts, err := time.ParseInLocation(DateFormat, vv, loc); err == nil {
+				return ts, nil
+			}
 		}
+		return nil, fmt.Errorf("%s: failed to convert %v (%T) into type time.Time", DriverName, val, val)
 	}
-	return nil, fmt.Errorf("%s: failed to convert %v (%T) into type time.Time", DriverName, val, val)
-})
+}
 
-// timestampConverter converts a value from the underlying json response into a time.Time.
-var timestampConverter = valueConverterFunc(func(val interface{}) (driver.Value, error) {
-	if val == nil {
-		return nil, nil
-	}
-	if vv, ok := val.(string); ok {
-		// BUG: should parse using session time zone.
-		if ts, err := time.ParseInLocation(TimestampFormat, vv, time.UTC); err == nil {
-			return ts, nil
+// timestampConverter converts a value from the underlying json response into a time.Time in UTC.
+var timestampConverter = timestampConverterIn(time.UTC)
+
+// timestampConverterIn returns a converter from a value in the underlying json response into
+// a time.Time in loc, which should be the session time zone. Any number of fractional second
+// digits is accepted, preserving up to nanosecond precision.
+func timestampConverterIn(loc *time.Location) valueConverterFunc {
+	return func(val interface{}) (driver.Value, error) {
+		if val == nil {
+			return nil, nil
 		}
+		if vv, ok := val.(string); ok {
+			if ts, err := time.ParseInLocation(timestampLayout, vv, loc); err == nil {
+				return ts, nil
+			}
+		}
+		return nil, fmt.Errorf("%s: failed to convert %v (%T) into type time.Time", DriverName, val, val)
 	}
-	return nil, fmt.Errorf("%s: failed to convert %v (%T) into type time.Time", DriverName, val, val)
-})
+}
 
 // timestampWithTimezoneConverter converts a value from the underlying json response into a time.Time including timezone.
+// The zone may be given as a name such as "Europe/London" or an offset such as "+01:00".
 var timestampWithTimezoneConverter = valueConverterFunc(func(val interface{}) (driver.Value, error) {
 	if val == nil {
 		return nil, nil
 	}
 	if vv, ok := val.(string); ok {
-		if len(vv) <= len(TimestampFormat) {
-			return timestampConverter(val)
-		}
-		tzOffset := strings.LastIndex(vv, " ")
-		if tzOffset == -1 {
-			return timestampConverter(val)
+		parts := strings.SplitN(strings.TrimSpace(vv), " ", 3)
+		if len(parts) < 3 {
+			return timestampConverter(strings.TrimSpace(vv))
 		}
-		tz, err := time.LoadLocation(strings.TrimSpace(vv[tzOffset:]))
+		tz, err := parseZone(parts[2])
 		if err != nil {
 			return nil, err
 		}
-		ts, err := time.ParseInLocation(TimestampFormat, vv[:tzOffset], tz)
+		ts, err := time.ParseInLocation(timestampLayout, parts[0]+" "+parts[1], tz)
 		if err != nil {
 			return nil, err
 		}
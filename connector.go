@@ -0,0 +1,109 @@
+package prestgo
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Connector creates connections to a Presto server for use with sql.OpenDB. It allows
+// settings that cannot be expressed in a data source name to be supplied.
+type Connector struct {
+	// Client is the HTTP client used for communicating with the Presto server. If nil, the
+	// client used by Open is used.
+	Client *http.Client
+
+	// Location is the time zone in which values of date and timestamp columns are
+	// materialized, in the same way as the loc parameter of the MySQL driver. It takes
+	// precedence over the time_zone parameter of the data source name, which continues to set
+	// the session time zone used by the server. If nil, values are materialized in the
+	// session time zone or UTC if none is set.
+	Location *time.Location
+
+	// Logger receives the diagnostic messages of the connections made by the Connector, such
+	// as the unsupported column types logged when the unknown_types=log parameter is set. If
+	// nil, the messages are discarded.
+	Logger Logger
+
+	// Metrics receives measurements of the queries run on the connections made by the
+	// Connector. If nil, no measurements are made.
+	Metrics Metrics
+
+	// Hooks are called before and after every query run on the connections made by the
+	// Connector. If nil, queries are run as they are.
+	Hooks QueryHooks
+
+	// RetryPolicy decides whether failed requests to the server made by the connections of
+	// the Connector are retried. If nil, a StandardRetryPolicy with its default limits is used.
+	RetryPolicy RetryPolicy
+
+	// DialContext, if not nil, is used to connect to the coordinators, such as through an
+	// SSH tunnel, a service mesh or a local proxy, by a client otherwise configured like the
+	// one used by Open. It takes precedence over the unix_socket parameter of the data source
+	// name and cannot be combined with Client.
+	DialContext DialFunc
+
+	name string
+
+	dialOnce   sync.Once
+	dialClient *http.Client
+}
+
+// NewConnector returns a Connector for the specified data source name, which has the same
+// form as that accepted by Open.
+func NewConnector(name string) (*Connector, error) {
+	if _, err := newConn(nil, name); err != nil {
+		return nil, err
+	}
+	return &Connector{name: name}, nil
+}
+
+var _ driver.Connector = &Connector{}
+
+// Connect returns a new connection to the Presto server.
+func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
+	client := c.Client
+	if c.DialContext != nil {
+		if client != nil {
+			return nil, fmt.Errorf("%s: Connector cannot have both Client and DialContext set", DriverName)
+		}
+		// The connections made by the Connector share a client and its idle connections
+		c.dialOnce.Do(func() {
+			c.dialClient = newDialClient(c.DialContext)
+		})
+		client = c.dialClient
+	}
+
+	cn, err := newConn(client, c.name)
+	if err != nil {
+		return nil, err
+	}
+	if c.Location != nil {
+		cn.conv.location = c.Location
+	}
+	if c.Logger != nil {
+		cn.logger = c.Logger
+		cn.conv.logger = c.Logger
+	}
+	cn.metrics = c.Metrics
+	cn.hooks = c.Hooks
+	cn.retryPolicy = c.RetryPolicy
+	if err := cn.opened(ctx); err != nil {
+		return nil, err
+	}
+	return cn, nil
+}
+
+// Driver returns the prestgo driver.
+func (c *Connector) Driver() driver.Driver {
+	return &drv{}
+}
+
+var _ driver.DriverContext = &drv{}
+
+func (*drv) OpenConnector(name string) (driver.Connector, error) {
+	return NewConnector(name)
+}
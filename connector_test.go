@@ -0,0 +1,49 @@
+package prestgo
+
+import (
+	"context"
+	"database/sql"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConnectorLocation(t *testing.T) {
+	ts := httptest.NewServer(timestampResponse)
+	defer ts.Close()
+
+	c, err := NewConnector("presto://" + ts.Listener.Addr().String() + "/hive/default?time_zone=America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Location = time.Local
+
+	cn, err := c.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc := cn.(*conn).conv.location; loc != time.Local {
+		t.Errorf("got location %v, wanted %v", loc, time.Local)
+	}
+	if tz := cn.(*conn).timeZone; tz != "America/Los_Angeles" {
+		t.Errorf("got session time zone %q, wanted %q", tz, "America/Los_Angeles")
+	}
+
+	db := sql.OpenDB(c)
+	defer db.Close()
+
+	var got time.Time
+	var date time.Time
+	if err := db.QueryRow("SELECT TIMESTAMP '2017-03-01 10:00:00', DATE '2017-03-01'").Scan(&got, &date); err != nil {
+		t.Fatal(err)
+	}
+	if expected := time.Date(2017, 3, 1, 10, 0, 0, 0, time.Local); !got.Equal(expected) {
+		t.Errorf("got %v, wanted %v", got, expected)
+	}
+}
+
+func TestNewConnectorInvalid(t *testing.T) {
+	if _, err := NewConnector("presto://example/hive/default?row_format=xml"); err == nil {
+		t.Error("got no error, wanted one")
+	}
+}
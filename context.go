@@ -0,0 +1,227 @@
+package prestgo
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+type contextKey int
+
+const (
+	responseHeaderKey contextKey = iota
+	progressKey
+	queryInfoKey
+	warningKey
+	resumableKey
+	maxRowsKey
+	columnarKey
+	sourceKey
+	clientTagsKey
+)
+
+// WithResponseHeaders returns a copy of ctx that causes queries run with it to call fn with
+// the protocol headers of every response received from the server. These are the headers
+// prefixed with X-Presto- or X-Trino-, such as X-Presto-Set-Session, X-Presto-Clear-Session
+// and X-Presto-Started-Transaction-Id. fn is called from the goroutine that is reading the
+// query results.
+func WithResponseHeaders(ctx context.Context, fn func(http.Header)) context.Context {
+	return context.WithValue(ctx, responseHeaderKey, fn)
+}
+
+func responseHeaderFunc(ctx context.Context) func(http.Header) {
+	fn, _ := ctx.Value(responseHeaderKey).(func(http.Header))
+	return fn
+}
+
+// WithSource returns a copy of ctx that causes queries run with it to report source to the
+// server as their source, in place of the one given by the source data source option. This
+// lets a pool of connections shared by several reports or jobs attribute each query to the
+// one that ran it.
+func WithSource(ctx context.Context, source string) context.Context {
+	return context.WithValue(ctx, sourceKey, source)
+}
+
+func querySource(ctx context.Context) string {
+	source, _ := ctx.Value(sourceKey).(string)
+	return source
+}
+
+// WithClientTags returns a copy of ctx that causes queries run with it to be sent with the
+// given client tags, in place of those given by the client_tags data source option. Resource
+// groups can select queries by their tags. Tags must not contain commas. Calling it with no
+// tags sends queries without any.
+func WithClientTags(ctx context.Context, tags ...string) context.Context {
+	return context.WithValue(ctx, clientTagsKey, tags)
+}
+
+func clientTags(ctx context.Context) ([]string, bool) {
+	tags, ok := ctx.Value(clientTagsKey).([]string)
+	return tags, ok
+}
+
+// WithQueryInfo returns a copy of ctx that causes queries run with it to call fn with the
+// identity of the query as soon as the server has accepted it, before its results are
+// read. This allows the ID of a query to be logged, or the query to be inspected or killed,
+// while it is still running. fn is called from the goroutine running the query, including
+// for queries that the server fails straight away.
+func WithQueryInfo(ctx context.Context, fn func(QueryInfo)) context.Context {
+	return context.WithValue(ctx, queryInfoKey, fn)
+}
+
+func queryInfoFunc(ctx context.Context) func(QueryInfo) {
+	fn, _ := ctx.Value(queryInfoKey).(func(QueryInfo))
+	return fn
+}
+
+// QueryProgress describes the progress of a running query, as reported by the server each
+// time it is polled.
+type QueryProgress struct {
+	QueryID string // ID the server assigned to the query.
+	QueryStats
+
+	// PercentComplete is the percentage of the query's splits that have completed, or 100
+	// once the query has finished. It is only an estimate, since more splits may be added
+	// as the query runs.
+	PercentComplete float64
+
+	// Queued reports whether the query is waiting in its resource group's queue for the
+	// cluster to admit it, and Planning whether it has been admitted and is being planned or
+	// its tasks started. While either is set the results are held up by the cluster rather
+	// than by running the query. QueuedTime gives how long the query has been queued.
+	Queued   bool
+	Planning bool
+}
+
+// WithProgress returns a copy of ctx that causes queries run with it to call fn with the
+// progress of the query on every response received from the server, including those to the
+// polls made while the query is queued or runs without producing results, so that users can
+// be told whether they are waiting on the cluster or on the query. fn is called from the
+// goroutine that is reading the query results, so progress received while a page is
+// fetched in the background is reported when the consumer reaches that page.
+func WithProgress(ctx context.Context, fn func(QueryProgress)) context.Context {
+	return context.WithValue(ctx, progressKey, fn)
+}
+
+func progressFunc(ctx context.Context) func(QueryProgress) {
+	fn, _ := ctx.Value(progressKey).(func(QueryProgress))
+	return fn
+}
+
+// newQueryProgress returns the progress of the query with the given ID and stats.
+func newQueryProgress(queryID string, s stmtStats) QueryProgress {
+	p := QueryProgress{QueryID: queryID, QueryStats: newQueryStats(s)}
+	p.Queued = isQueued(s)
+	p.Planning = !p.Queued && queryPhases[s.State] == phasePlanning
+	switch {
+	case s.State == QueryStateFinished:
+		p.PercentComplete = 100
+	case s.TotalSplits > 0:
+		p.PercentComplete = 100 * float64(s.CompletedSplits) / float64(s.TotalSplits)
+	}
+	return p
+}
+
+// Warning is a warning raised by the server about a query, such as the use of a deprecated
+// function or a setting that will soon change.
+type Warning struct {
+	Code    int    // Numeric code of the warning.
+	Name    string // Name of the warning, e.g. DEPRECATED_FUNCTION.
+	Message string // Description of the warning.
+}
+
+// WithWarnings returns a copy of ctx that causes queries run with it to call fn with each
+// warning raised by the server, as soon as the response carrying it is received, so that
+// interactive tools can show warnings before all the results have been read. Each warning is
+// reported once however many responses repeat it. fn is called from the goroutine that is
+// reading the query results.
+func WithWarnings(ctx context.Context, fn func(Warning)) context.Context {
+	return context.WithValue(ctx, warningKey, fn)
+}
+
+func warningFunc(ctx context.Context) func(Warning) {
+	fn, _ := ctx.Value(warningKey).(func(Warning))
+	return fn
+}
+
+// reportWarnings calls the warning callback of ctx, if any, with the warnings in ws.
+func reportWarnings(ctx context.Context, ws []queryWarning) {
+	fn := warningFunc(ctx)
+	if fn == nil {
+		return
+	}
+	for _, w := range ws {
+		fn(Warning{Code: w.WarningCode.Code, Name: w.WarningCode.Name, Message: w.Message})
+	}
+}
+
+// uniqueWarnings returns a function that calls fn with each warning the first time it is
+// passed it. The server repeats warnings in every response once they have been raised.
+func uniqueWarnings(fn func(Warning)) func(Warning) {
+	seen := make(map[Warning]bool)
+	return func(w Warning) {
+		if !seen[w] {
+			seen[w] = true
+			fn(w)
+		}
+	}
+}
+
+// reports holds the arguments of the callbacks set on a context, captured from responses
+// received in the background so that the callbacks can be called later from the goroutine
+// reading the query results.
+type reports struct {
+	headers  []http.Header
+	progress []QueryProgress
+	warnings []Warning
+}
+
+// capture returns a copy of ctx whose callbacks record their arguments in rep.
+func (rep *reports) capture(ctx context.Context) context.Context {
+	if responseHeaderFunc(ctx) != nil {
+		ctx = WithResponseHeaders(ctx, func(h http.Header) {
+			rep.headers = append(rep.headers, h)
+		})
+	}
+	if progressFunc(ctx) != nil {
+		ctx = WithProgress(ctx, func(p QueryProgress) {
+			rep.progress = append(rep.progress, p)
+		})
+	}
+	if warningFunc(ctx) != nil {
+		ctx = WithWarnings(ctx, func(w Warning) {
+			rep.warnings = append(rep.warnings, w)
+		})
+	}
+	return ctx
+}
+
+// replay calls the callbacks of ctx with the arguments captured in rep.
+func (rep *reports) replay(ctx context.Context) {
+	if fn := responseHeaderFunc(ctx); fn != nil {
+		for _, h := range rep.headers {
+			fn(h)
+		}
+	}
+	if fn := progressFunc(ctx); fn != nil {
+		for _, p := range rep.progress {
+			fn(p)
+		}
+	}
+	if fn := warningFunc(ctx); fn != nil {
+		for _, w := range rep.warnings {
+			fn(w)
+		}
+	}
+}
+
+// protocolHeaders returns the Presto protocol headers contained in h.
+func protocolHeaders(h http.Header) http.Header {
+	ph := make(http.Header)
+	for k, v := range h {
+		if strings.HasPrefix(k, "X-Presto-") || strings.HasPrefix(k, "X-Trino-") {
+			ph[k] = v
+		}
+	}
+	return ph
+}
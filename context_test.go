@@ -0,0 +1,341 @@
+package prestgo
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var setSessionResponse = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/v1/statement":
+		w.Header().Set("X-Presto-Set-Session", "query_max_run_time=1h")
+		w.Header().Set("X-Unrelated", "ignored")
+		fmt.Fprintln(w, fmt.Sprintf(`{
+		  "id": "abcd",
+		  "infoUri": "http://%[1]s/v1/query/abcd",
+		  "nextUri": "http://%[1]s/v1/query/abcd/1",
+		  "stats": {"state": "QUEUED"}
+		}`, r.Host))
+	default:
+		oneRowColResponse(w, r)
+	}
+})
+
+func TestWithResponseHeaders(t *testing.T) {
+	ts := httptest.NewServer(setSessionResponse)
+	defer ts.Close()
+
+	var headers []http.Header
+	ctx := WithResponseHeaders(context.Background(), func(h http.Header) {
+		headers = append(headers, h)
+	})
+
+	s := &stmt{
+		conn: &conn{
+			client: http.DefaultClient,
+			addr:   ts.Listener.Addr().String(),
+		},
+		query: "SET SESSION query_max_run_time = '1h'",
+	}
+	r, err := s.QueryContext(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make([]driver.Value, 1)
+	if err := r.Next(values); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(headers) != 2 {
+		t.Fatalf("got %d headers, wanted %d", len(headers), 2)
+	}
+	if got := headers[0].Get("X-Presto-Set-Session"); got != "query_max_run_time=1h" {
+		t.Errorf("got X-Presto-Set-Session %q, wanted %q", got, "query_max_run_time=1h")
+	}
+	if got := headers[0].Get("X-Unrelated"); got != "" {
+		t.Errorf("got X-Unrelated %q, wanted it to be filtered", got)
+	}
+}
+
+var progressResponse = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	const columns = `"columns": [{ "name": "col0", "type": "varchar", "typeSignature": { "rawType": "varchar", "arguments": [] } }]`
+	switch r.URL.Path {
+	case "/v1/statement":
+		fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%[1]s/v1/query/abcd/1", "stats": {"state": "QUEUED"}}`, r.Host)
+	case "/v1/query/abcd/1":
+		fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%[1]s/v1/query/abcd/2", "stats": {"state": "RUNNING", "totalSplits": 4, "completedSplits": 1}}`, r.Host)
+	case "/v1/query/abcd/2":
+		fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%[1]s/v1/query/abcd/3", %[2]s, "data": [["c0r0"]], "stats": {"state": "RUNNING", "totalSplits": 4, "completedSplits": 3}}`, r.Host, columns)
+	case "/v1/query/abcd/3":
+		fmt.Fprintf(w, `{"id": "abcd", %s, "data": [["c0r1"]], "stats": {"state": "FINISHED", "totalSplits": 4, "completedSplits": 4}}`, columns)
+	default:
+		http.NotFound(w, r)
+	}
+})
+
+func TestWithProgress(t *testing.T) {
+	ts := httptest.NewServer(progressResponse)
+	defer ts.Close()
+
+	for _, skipStats := range []bool{false, true} {
+		var progress []QueryProgress
+		ctx := WithProgress(context.Background(), func(p QueryProgress) {
+			progress = append(progress, p)
+		})
+
+		s := &stmt{
+			conn: &conn{
+				client:    http.DefaultClient,
+				addr:      ts.Listener.Addr().String(),
+				skipStats: skipStats,
+			},
+			query: "SELECT col0 FROM t",
+		}
+		r, err := s.QueryContext(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values := make([]driver.Value, 1)
+		for {
+			if err := r.Next(values); err != nil {
+				break
+			}
+		}
+		r.Close()
+
+		expected := []struct {
+			state   string
+			percent float64
+		}{
+			{state: QueryStateQueued, percent: 0},
+			{state: QueryStateRunning, percent: 25},
+			{state: QueryStateRunning, percent: 75},
+			{state: QueryStateFinished, percent: 100},
+		}
+		if len(progress) != len(expected) {
+			t.Fatalf("skip_stats=%v: got %d progress reports, wanted %d", skipStats, len(progress), len(expected))
+		}
+		for i, e := range expected {
+			p := progress[i]
+			if p.QueryID != "abcd" || p.State != e.state || p.PercentComplete != e.percent {
+				t.Errorf("skip_stats=%v: report %d: got %s %s %v%%, wanted abcd %s %v%%", skipStats, i, p.QueryID, p.State, p.PercentComplete, e.state, e.percent)
+			}
+		}
+		if progress[1].TotalSplits != 4 || progress[1].CompletedSplits != 1 {
+			t.Errorf("skip_stats=%v: got %d of %d splits completed, wanted 1 of 4", skipStats, progress[1].CompletedSplits, progress[1].TotalSplits)
+		}
+	}
+}
+
+func TestWithProgressWaiting(t *testing.T) {
+	states := []string{"WAITING_FOR_RESOURCES", QueryStateQueued, QueryStatePlanning, QueryStateStarting, QueryStateRunning}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		const columns = `"columns": [{ "name": "col0", "type": "varchar", "typeSignature": { "rawType": "varchar", "arguments": [] } }]`
+		if r.URL.Path == "/v1/statement" {
+			fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%s/v1/query/abcd/0", "stats": {"state": "QUEUED", "queued": true}}`, r.Host)
+			return
+		}
+		var i int
+		fmt.Sscanf(r.URL.Path, "/v1/query/abcd/%d", &i)
+		if i < len(states) {
+			fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%s/v1/query/abcd/%d", "stats": {"state": %q, "queuedTimeMillis": %d}}`, r.Host, i+1, states[i], 100*i)
+			return
+		}
+		fmt.Fprintf(w, `{"id": "abcd", %s, "data": [["c0r0"]], "stats": {"state": "FINISHED"}}`, columns)
+	}))
+	defer ts.Close()
+
+	var progress []QueryProgress
+	ctx := WithProgress(context.Background(), func(p QueryProgress) {
+		progress = append(progress, p)
+	})
+	s := &stmt{
+		conn:  &conn{client: http.DefaultClient, addr: ts.Listener.Addr().String()},
+		query: "SELECT col0 FROM t",
+	}
+	r, err := s.QueryContext(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for r.Next(make([]driver.Value, 1)) == nil {
+	}
+	r.Close()
+
+	var got []string
+	for _, p := range progress {
+		switch {
+		case p.Queued:
+			got = append(got, "queued")
+		case p.Planning:
+			got = append(got, "planning")
+		default:
+			got = append(got, "running")
+		}
+	}
+	expected := []string{"queued", "queued", "queued", "planning", "planning", "running", "running"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %q, wanted %q", got, expected)
+	}
+	if len(progress) > 2 && progress[2].QueuedTime != 100*time.Millisecond {
+		t.Errorf("got queued time %v, wanted 100ms", progress[2].QueuedTime)
+	}
+}
+
+func TestWithQueryInfo(t *testing.T) {
+	testCases := []struct {
+		handler http.Handler
+		err     bool
+	}{
+		{handler: setSessionResponse},
+		{
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, `{"id": "abcd", "infoUri": "http://%s/v1/query/abcd", "stats": {"state": "FAILED"}, "error": {"message": "line 1:1: mismatched input"}}`, r.Host)
+			}),
+			err: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		ts := httptest.NewServer(tc.handler)
+
+		expected := QueryInfo{ID: "abcd", InfoURI: ts.URL + "/v1/query/abcd"}
+		var infos []QueryInfo
+		ctx := WithQueryInfo(context.Background(), func(info QueryInfo) {
+			infos = append(infos, info)
+		})
+
+		s := &stmt{
+			conn: &conn{
+				client: http.DefaultClient,
+				addr:   ts.Listener.Addr().String(),
+			},
+			query: "SELECT col0 FROM t",
+		}
+		r, err := s.QueryContext(ctx, nil)
+		if (err != nil) != tc.err {
+			t.Errorf("got error %v, wanted error=%v", err, tc.err)
+		}
+		if len(infos) != 1 || infos[0] != expected {
+			t.Errorf("got query infos %+v, wanted %+v", infos, expected)
+		}
+		if r != nil {
+			if info := r.(InfoRows).QueryInfo(); info != expected {
+				t.Errorf("got rows query info %+v, wanted %+v", info, expected)
+			}
+			r.Close()
+		}
+		ts.Close()
+	}
+}
+
+var warningsResponse = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	const columns = `"columns": [{ "name": "col0", "type": "varchar", "typeSignature": { "rawType": "varchar", "arguments": [] } }]`
+	const deprecated = `{"warningCode": {"code": 1, "name": "DEPRECATED_FUNCTION"}, "message": "approx_set is deprecated"}`
+	const parser = `{"warningCode": {"code": 2, "name": "PARSER_WARNING"}, "message": "reserved word"}`
+	switch r.URL.Path {
+	case "/v1/statement":
+		fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%[1]s/v1/query/abcd/1", "stats": {"state": "QUEUED"}, "warnings": [%[2]s]}`, r.Host, deprecated)
+	case "/v1/query/abcd/1":
+		fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%[1]s/v1/query/abcd/2", %[2]s, "data": [["c0r0"]], "stats": {"state": "RUNNING"}, "warnings": [%[3]s]}`, r.Host, columns, deprecated)
+	case "/v1/query/abcd/2":
+		fmt.Fprintf(w, `{"id": "abcd", %s, "data": [["c0r1"]], "stats": {"state": "FINISHED"}, "warnings": [%s, %s]}`, columns, deprecated, parser)
+	default:
+		http.NotFound(w, r)
+	}
+})
+
+func TestWithWarnings(t *testing.T) {
+	ts := httptest.NewServer(warningsResponse)
+	defer ts.Close()
+
+	var warnings []Warning
+	ctx := WithWarnings(context.Background(), func(w Warning) {
+		warnings = append(warnings, w)
+	})
+
+	s := &stmt{
+		conn: &conn{
+			client: http.DefaultClient,
+			addr:   ts.Listener.Addr().String(),
+		},
+		query: "SELECT col0 FROM t",
+	}
+	r, err := s.QueryContext(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	expected := []Warning{{Code: 1, Name: "DEPRECATED_FUNCTION", Message: "approx_set is deprecated"}}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("got warnings %+v before reading, wanted %+v", warnings, expected)
+	}
+
+	values := make([]driver.Value, 1)
+	for r.Next(values) == nil {
+	}
+	expected = append(expected, Warning{Code: 2, Name: "PARSER_WARNING", Message: "reserved word"})
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("got warnings %+v, wanted %+v", warnings, expected)
+	}
+}
+
+func TestWithSourceAndClientTags(t *testing.T) {
+	testCases := []struct {
+		name   string
+		conn   *conn
+		ctx    context.Context
+		source string
+		tags   string
+	}{
+		{
+			name: "none",
+			conn: &conn{},
+			ctx:  context.Background(),
+		},
+		{
+			name:   "data source",
+			conn:   &conn{source: "reports", clientTags: []string{"etl", "nightly"}},
+			ctx:    context.Background(),
+			source: "reports",
+			tags:   "etl,nightly",
+		},
+		{
+			name:   "overridden",
+			conn:   &conn{source: "reports", clientTags: []string{"etl", "nightly"}},
+			ctx:    WithClientTags(WithSource(context.Background(), "revenue-dashboard"), "dashboard"),
+			source: "revenue-dashboard",
+			tags:   "dashboard",
+		},
+		{
+			name:   "tags cleared",
+			conn:   &conn{source: "reports", clientTags: []string{"etl"}},
+			ctx:    WithClientTags(context.Background()),
+			source: "reports",
+		},
+		{
+			name:   "context only",
+			conn:   &conn{},
+			ctx:    WithClientTags(WithSource(context.Background(), "job-42"), "batch", "low"),
+			source: "job-42",
+			tags:   "batch,low",
+		},
+	}
+
+	for _, tc := range testCases {
+		s := &stmt{conn: tc.conn, query: "SELECT 1"}
+		req := s.newRequest(tc.ctx, "example", s.query)
+		if source := req.Header.Get("X-Presto-Source"); source != tc.source {
+			t.Errorf("%s: got source %q, wanted %q", tc.name, source, tc.source)
+		}
+		if tags := req.Header.Get("X-Presto-Client-Tags"); tags != tc.tags {
+			t.Errorf("%s: got client tags %q, wanted %q", tc.name, tags, tc.tags)
+		}
+	}
+}
@@ -0,0 +1,693 @@
+package prestgo
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// converterOptions holds the connection settings that alter how values are converted.
+type converterOptions struct {
+	// rowsAsMaps causes row values to be converted into map[string]interface{} rather than
+	// JSON strings.
+	rowsAsMaps bool
+
+	// uuidsAsBytes causes uuid values to be converted into [16]byte rather than strings.
+	uuidsAsBytes bool
+
+	// ipAddressesAsIPs causes ipaddress values to be converted into net.IP rather than strings.
+	ipAddressesAsIPs bool
+
+	// decimalsAsRats causes decimal values to be converted into *big.Rat rather than strings.
+	decimalsAsRats bool
+
+	// timeWithTimezoneAsString causes time with time zone values to be returned as the
+	// strings sent by the server rather than converted into time.Time.
+	timeWithTimezoneAsString bool
+
+	// jsonAsRawMessage causes json values to be converted into json.RawMessage rather than
+	// strings.
+	jsonAsRawMessage bool
+
+	// trimChar causes the trailing pad spaces of char values to be removed.
+	trimChar bool
+
+	// rawValues bypasses all other conversion so that every value is returned as a string
+	// holding its text from the json response.
+	rawValues bool
+
+	// location is the time zone in which date and timestamp values are materialized. When
+	// nil, UTC is used.
+	location *time.Location
+
+	// unknownTypes determines how values of types the driver does not support are handled.
+	unknownTypes unknownTypesPolicy
+
+	// logger receives the types logged when unknownTypes is unknownTypesLog. When nil, they
+	// are discarded.
+	logger Logger
+}
+
+// unknownTypesPolicy determines how values of types the driver does not support are handled.
+type unknownTypesPolicy int
+
+const (
+	unknownTypesString unknownTypesPolicy = iota // Silently return values as strings.
+	unknownTypesLog                              // Return values as strings and log the type.
+	unknownTypesError                            // Fail the query with an UnsupportedTypeError.
+)
+
+var (
+	convertersMu sync.RWMutex
+	converters   = make(map[string]driver.ValueConverter)
+)
+
+// RegisterConverter registers c as the converter for values of the Presto type named
+// typeName, such as "decimal" or "geometry", replacing the driver's own conversion for that
+// type. Parameters are not part of the name, so a converter registered for "decimal" is used
+// for all decimal(p,s) columns, including those nested within arrays, maps and rows.
+//
+// The converter is passed the value decoded from the JSON response sent by the server, which
+// is nil, a bool, a string, a json.Number, a []interface{} or a map[string]interface{}.
+// Registering a nil converter restores the driver's conversion for the type. Converters
+// apply to queries whose results are fetched after registration.
+func RegisterConverter(typeName string, c driver.ValueConverter) {
+	convertersMu.Lock()
+	defer convertersMu.Unlock()
+	if c == nil {
+		delete(converters, strings.ToLower(typeName))
+		return
+	}
+	converters[strings.ToLower(typeName)] = c
+}
+
+// registeredConverter returns the converter registered for the named type, if any.
+func registeredConverter(name string) (driver.ValueConverter, bool) {
+	convertersMu.RLock()
+	defer convertersMu.RUnlock()
+	c, ok := converters[name]
+	return c, ok
+}
+
+// nested returns the options used for the elements of an array or map. Rows nested within
+// a container are always converted into maps so that structured values are never reduced to
+// opaque JSON strings part way down.
+func (o converterOptions) nested() converterOptions {
+	o.rowsAsMaps = true
+	return o
+}
+
+// newConverter returns a converter for values of the given Presto type. Types the driver
+// does not support are handled according to opts.unknownTypes.
+func newConverter(typ prestoType, opts converterOptions) (driver.ValueConverter, error) {
+	if opts.rawValues {
+		return rawValueConverter, nil
+	}
+	if c, ok := registeredConverter(typ.name); ok {
+		return c, nil
+	}
+
+	switch typ.name {
+	case Array:
+		if len(typ.args) == 1 {
+			elem, err := newConverter(typ.args[0], opts.nested())
+			if err != nil {
+				return nil, err
+			}
+			return arrayConverter{elem: elem}, nil
+		}
+	case Map:
+		if len(typ.args) == 2 {
+			value, err := newConverter(typ.args[1], opts.nested())
+			if err != nil {
+				return nil, err
+			}
+			return mapConverter{value: value}, nil
+		}
+	case Row:
+		if opts.rowsAsMaps {
+			rc := rowMapConverter{names: make([]string, len(typ.args)), fields: make([]driver.ValueConverter, len(typ.args))}
+			for i, ft := range typ.args {
+				fc, err := newConverter(ft, opts)
+				if err != nil {
+					return nil, err
+				}
+				rc.names[i] = typ.fieldName(i)
+				rc.fields[i] = fc
+			}
+			return rc, nil
+		}
+		// If the column is an unflattened struct, interpret as a JSON string.
+		return rowConverter{typ: typ, location: opts.location}, nil
+	case Char:
+		if opts.trimChar {
+			return trimmedCharConverter, nil
+		}
+		return stringConverter, nil
+	case VarChar:
+		return stringConverter, nil
+	case JSON:
+		if opts.jsonAsRawMessage {
+			return rawJSONConverter, nil
+		}
+		// use string for json
+		return stringConverter, nil
+	case BigInt, Integer, Smallint, Tinyint:
+		return bigIntConverter, nil
+	case Boolean:
+		return boolConverter, nil
+	case Double, Real:
+		return doubleConverter, nil
+	case Decimal:
+		if opts.decimalsAsRats {
+			return decimalConverter, nil
+		}
+		// use string converter for this so that we keep our preciseness
+		return stringConverter, nil
+	case UUID:
+		if opts.uuidsAsBytes {
+			return uuidBytesConverter, nil
+		}
+		return uuidConverter, nil
+	case IPAddress:
+		if opts.ipAddressesAsIPs {
+			return ipConverter, nil
+		}
+		return ipAddressConverter, nil
+	case IntervalDayToSecond:
+		return intervalDayToSecondConverter, nil
+	case IntervalYearToMonth:
+		return intervalYearToMonthConverter, nil
+	case strings.ToLower(HyperLogLog), strings.ToLower(P4HyperLogLog), strings.ToLower(SetDigest), QDigest, TDigest:
+		return sketchConverter, nil
+	case Date:
+		if opts.location != nil {
+			return dateConverterIn(opts.location), nil
+		}
+		return dateConverter, nil
+	case Time:
+		// use string here, having no date makes timestamps weird
+		return stringConverter, nil
+	case TimeWithTimezone:
+		if opts.timeWithTimezoneAsString {
+			return stringConverter, nil
+		}
+		return timeWithTimezoneConverter, nil
+	case Timestamp:
+		if opts.location != nil {
+			return timestampConverterIn(opts.location), nil
+		}
+		return timestampConverter, nil
+	case TimestampWithTimezone:
+		return timestampWithTimezoneConverter, nil
+	}
+
+	switch opts.unknownTypes {
+	case unknownTypesLog:
+		logf(opts.logger, LogWarn, "%s: unsupported column type: %s", DriverName, typ)
+	case unknownTypesError:
+		return nil, &UnsupportedTypeError{Type: typ.String()}
+	}
+	return stringConverter, nil
+}
+
+var (
+	scanTypeInterface = reflect.TypeOf((*interface{})(nil)).Elem()
+	scanTypeString    = reflect.TypeOf("")
+	scanTypeInt64     = reflect.TypeOf(int64(0))
+	scanTypeFloat64   = reflect.TypeOf(float64(0))
+	scanTypeBool      = reflect.TypeOf(false)
+	scanTypeBytes     = reflect.TypeOf([]byte(nil))
+	scanTypeTime      = reflect.TypeOf(time.Time{})
+)
+
+// scanType returns the Go type of the values produced by the converter newConverter returns
+// for typ, and must be kept in step with it.
+func scanType(typ prestoType, opts converterOptions) reflect.Type {
+	if opts.rawValues {
+		return scanTypeString
+	}
+	if _, ok := registeredConverter(typ.name); ok {
+		return scanTypeInterface
+	}
+
+	switch typ.name {
+	case Array:
+		return reflect.TypeOf([]interface{}(nil))
+	case Map:
+		return reflect.TypeOf(map[string]interface{}(nil))
+	case Row:
+		if opts.rowsAsMaps {
+			return reflect.TypeOf(map[string]interface{}(nil))
+		}
+		return scanTypeString
+	case JSON:
+		if opts.jsonAsRawMessage {
+			return reflect.TypeOf(json.RawMessage(nil))
+		}
+		return scanTypeString
+	case BigInt, Integer, Smallint, Tinyint, IntervalYearToMonth:
+		return scanTypeInt64
+	case Boolean:
+		return scanTypeBool
+	case Double, Real:
+		return scanTypeFloat64
+	case Decimal:
+		if opts.decimalsAsRats {
+			return reflect.TypeOf((*big.Rat)(nil))
+		}
+		return scanTypeString
+	case UUID:
+		if opts.uuidsAsBytes {
+			return reflect.TypeOf([16]byte{})
+		}
+		return scanTypeString
+	case IPAddress:
+		if opts.ipAddressesAsIPs {
+			return reflect.TypeOf(net.IP(nil))
+		}
+		return scanTypeString
+	case IntervalDayToSecond:
+		return reflect.TypeOf(time.Duration(0))
+	case strings.ToLower(HyperLogLog), strings.ToLower(P4HyperLogLog), strings.ToLower(SetDigest), QDigest, TDigest:
+		return scanTypeBytes
+	case Date, Timestamp, TimestampWithTimezone:
+		return scanTypeTime
+	case TimeWithTimezone:
+		if opts.timeWithTimezoneAsString {
+			return scanTypeString
+		}
+		return scanTypeTime
+	}
+	return scanTypeString
+}
+
+// arrayConverter converts a value from the underlying json response into a []interface{},
+// converting each element according to the array's element type.
+type arrayConverter struct {
+	elem driver.ValueConverter
+}
+
+func (ac arrayConverter) ConvertValue(v interface{}) (driver.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	vs, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: failed to convert %v (%T) into type []interface{}", DriverName, v, v)
+	}
+	arr := make([]interface{}, len(vs))
+	for i, ev := range vs {
+		cv, err := ac.elem.ConvertValue(ev)
+		if err != nil {
+			return nil, err
+		}
+		arr[i] = cv
+	}
+	return arr, nil
+}
+
+// mapConverter converts a value from the underlying json response into a
+// map[string]interface{}, converting each value according to the map's value type. Keys are
+// kept in the textual form the server uses for them in the json response.
+type mapConverter struct {
+	value driver.ValueConverter
+}
+
+func (mc mapConverter) ConvertValue(v interface{}) (driver.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	vs, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: failed to convert %v (%T) into type map[string]interface{}", DriverName, v, v)
+	}
+	m := make(map[string]interface{}, len(vs))
+	for k, ev := range vs {
+		cv, err := mc.value.ConvertValue(ev)
+		if err != nil {
+			return nil, err
+		}
+		m[k] = cv
+	}
+	return m, nil
+}
+
+// rowMapConverter converts a row value from the underlying json response into a
+// map[string]interface{} keyed by field name, converting each field according to its type.
+type rowMapConverter struct {
+	names  []string
+	fields []driver.ValueConverter
+}
+
+func (rc rowMapConverter) ConvertValue(v interface{}) (driver.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	vs, ok := v.([]interface{})
+	if !ok || len(vs) != len(rc.fields) {
+		return nil, fmt.Errorf("%s: failed to convert %v (%T) into type map[string]interface{}", DriverName, v, v)
+	}
+	m := make(map[string]interface{}, len(vs))
+	for i, fv := range vs {
+		cv, err := rc.fields[i].ConvertValue(fv)
+		if err != nil {
+			return nil, err
+		}
+		m[rc.names[i]] = cv
+	}
+	return m, nil
+}
+
+// encodeValueJSON writes v, a value of the Presto type typ taken from the json response, to
+// buf as JSON. Rows are written as objects keyed by field name and map keys are sorted so
+// that equal values always produce the same output. When loc is not nil, the session time
+// zone, timestamps are followed by the zone as values of timestamp with time zone are, so
+// that they are not read back as UTC.
+func encodeValueJSON(buf *bytes.Buffer, typ prestoType, v interface{}, loc *time.Location) error {
+	if v == nil {
+		buf.WriteString("null")
+		return nil
+	}
+
+	switch typ.name {
+	case Row:
+		vs, ok := v.([]interface{})
+		if !ok || len(vs) != len(typ.args) {
+			return fmt.Errorf("%s: failed to convert %v (%T) into type %s", DriverName, v, v, typ)
+		}
+		buf.WriteByte('{')
+		for i, ft := range typ.args {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			name, _ := json.Marshal(typ.fieldName(i))
+			buf.Write(name)
+			buf.WriteByte(':')
+			if err := encodeValueJSON(buf, ft, vs[i], loc); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+
+	case Array:
+		vs, ok := v.([]interface{})
+		if !ok || len(typ.args) != 1 {
+			return fmt.Errorf("%s: failed to convert %v (%T) into type %s", DriverName, v, v, typ)
+		}
+		buf.WriteByte('[')
+		for i, ev := range vs {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeValueJSON(buf, typ.args[0], ev, loc); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+
+	case Map:
+		vs, ok := v.(map[string]interface{})
+		if !ok || len(typ.args) != 2 {
+			return fmt.Errorf("%s: failed to convert %v (%T) into type %s", DriverName, v, v, typ)
+		}
+		keys := make([]string, 0, len(vs))
+		for k := range vs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			name, _ := json.Marshal(k)
+			buf.Write(name)
+			buf.WriteByte(':')
+			if err := encodeValueJSON(buf, typ.args[1], vs[k], loc); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+
+	case Timestamp:
+		if ts, ok := v.(string); ok && loc != nil {
+			v = ts + " " + zoneText(loc, ts)
+		}
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	buf.Write(b)
+	return nil
+}
+
+// rawValueConverter converts a value from the underlying json response into a string
+// without interpreting it. Strings are returned as they are and all other values, including
+// arrays, maps and rows, as their json text.
+var rawValueConverter = valueConverterFunc(func(val interface{}) (driver.Value, error) {
+	if val == nil {
+		return nil, nil
+	}
+	if vv, ok := val.(string); ok {
+		return vv, nil
+	}
+	b, err := json.Marshal(val)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to convert %v (%T) into type string: %v", DriverName, val, val, err)
+	}
+	return string(b), nil
+})
+
+// uuidConverter converts a value from the underlying json response into a uuid string in
+// canonical lower case form.
+var uuidConverter = valueConverterFunc(func(val interface{}) (driver.Value, error) {
+	if val == nil {
+		return nil, nil
+	}
+	u, err := parseUUID(val)
+	if err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16]), nil
+})
+
+// uuidBytesConverter converts a value from the underlying json response into a [16]byte.
+var uuidBytesConverter = valueConverterFunc(func(val interface{}) (driver.Value, error) {
+	if val == nil {
+		return nil, nil
+	}
+	u, err := parseUUID(val)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+})
+
+func parseUUID(val interface{}) ([16]byte, error) {
+	var u [16]byte
+	vv, ok := val.(string)
+	if ok {
+		b, err := hex.DecodeString(strings.Replace(vv, "-", "", -1))
+		if err == nil && len(b) == len(u) {
+			copy(u[:], b)
+			return u, nil
+		}
+	}
+	return u, fmt.Errorf("%s: failed to convert %v (%T) into type uuid", DriverName, val, val)
+}
+
+// ipAddressConverter converts a value from the underlying json response into a normalized IP
+// address string. IPv4-mapped IPv6 addresses are returned in their dotted IPv4 form.
+var ipAddressConverter = valueConverterFunc(func(val interface{}) (driver.Value, error) {
+	if val == nil {
+		return nil, nil
+	}
+	ip, err := parseIP(val)
+	if err != nil {
+		return nil, err
+	}
+	return ip.String(), nil
+})
+
+// ipConverter converts a value from the underlying json response into a net.IP.
+var ipConverter = valueConverterFunc(func(val interface{}) (driver.Value, error) {
+	if val == nil {
+		return nil, nil
+	}
+	ip, err := parseIP(val)
+	if err != nil {
+		return nil, err
+	}
+	return ip, nil
+})
+
+// parseIP parses an ipaddress value, returning a 4 byte net.IP for IPv4 and IPv4-mapped
+// IPv6 addresses and a 16 byte net.IP otherwise.
+func parseIP(val interface{}) (net.IP, error) {
+	if vv, ok := val.(string); ok {
+		if ip := net.ParseIP(vv); ip != nil {
+			if ip4 := ip.To4(); ip4 != nil {
+				return ip4, nil
+			}
+			return ip, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: failed to convert %v (%T) into type net.IP", DriverName, val, val)
+}
+
+// intervalDayToSecondConverter converts a value from the underlying json response, such as
+// "-2 03:04:05.678", into a time.Duration.
+var intervalDayToSecondConverter = valueConverterFunc(func(val interface{}) (driver.Value, error) {
+	if val == nil {
+		return nil, nil
+	}
+	if vv, ok := val.(string); ok {
+		neg := strings.HasPrefix(vv, "-")
+		var days, hours, mins int64
+		var secs float64
+		if _, err := fmt.Sscanf(strings.TrimPrefix(vv, "-"), "%d %d:%d:%f", &days, &hours, &mins, &secs); err == nil {
+			d := time.Duration(days)*24*time.Hour + time.Duration(hours)*time.Hour + time.Duration(mins)*time.Minute +
+				time.Duration(secs*1000+0.5)*time.Millisecond
+			if neg {
+				d = -d
+			}
+			return d, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: failed to convert %v (%T) into type time.Duration", DriverName, val, val)
+})
+
+// intervalYearToMonthConverter converts a value from the underlying json response, such as
+// "1-2", into an int64 number of months.
+var intervalYearToMonthConverter = valueConverterFunc(func(val interface{}) (driver.Value, error) {
+	if val == nil {
+		return nil, nil
+	}
+	if vv, ok := val.(string); ok {
+		neg := strings.HasPrefix(vv, "-")
+		var years, months int64
+		if _, err := fmt.Sscanf(strings.TrimPrefix(vv, "-"), "%d-%d", &years, &months); err == nil {
+			n := years*12 + months
+			if neg {
+				n = -n
+			}
+			return n, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: failed to convert %v (%T) into type int64", DriverName, val, val)
+})
+
+// decimalConverter converts a value from the underlying json response into a *big.Rat, which
+// holds it exactly.
+var decimalConverter = valueConverterFunc(func(val interface{}) (driver.Value, error) {
+	if val == nil {
+		return nil, nil
+	}
+	if vv, ok := val.(string); ok {
+		if r, ok := new(big.Rat).SetString(vv); ok {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: failed to convert %v (%T) into type *big.Rat", DriverName, val, val)
+})
+
+// timeWithTimezoneConverter converts a value from the underlying json response, such as
+// "01:02:03.456 +05:30" or "01:02:03.456 America/Los_Angeles", into a time.Time on
+// January 1st of year 0 in the value's time zone.
+var timeWithTimezoneConverter = valueConverterFunc(func(val interface{}) (driver.Value, error) {
+	if val == nil {
+		return nil, nil
+	}
+	if vv, ok := val.(string); ok {
+		if sp := strings.LastIndex(vv, " "); sp != -1 {
+			loc, err := parseZone(vv[sp+1:])
+			if err != nil {
+				return nil, err
+			}
+			if t, err := time.ParseInLocation(timeLayout, vv[:sp], loc); err == nil {
+				return t, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%s: failed to convert %v (%T) into type time.Time", DriverName, val, val)
+})
+
+// zoneText returns the name of loc, or if parseZone could not read it back, the offset from
+// UTC in loc of the timestamp ts.
+func zoneText(loc *time.Location, ts string) string {
+	if name := loc.String(); name != "" {
+		if _, err := parseZone(name); err == nil {
+			return name
+		}
+	}
+	t, _ := time.ParseInLocation(timestampLayout, ts, loc)
+	return t.Format("-07:00")
+}
+
+// parseZone returns the location for a time zone given as either an offset such as "+05:30"
+// or a zone name such as "America/Los_Angeles".
+func parseZone(zone string) (*time.Location, error) {
+	if strings.HasPrefix(zone, "+") || strings.HasPrefix(zone, "-") {
+		t, err := time.Parse("-07:00", zone)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid time zone offset %q", DriverName, zone)
+		}
+		_, offset := t.Zone()
+		return time.FixedZone(zone, offset), nil
+	}
+	return time.LoadLocation(zone)
+}
+
+// rawJSONConverter converts a value from the underlying json response, which holds the JSON
+// text of a json column, into a json.RawMessage.
+var rawJSONConverter = valueConverterFunc(func(val interface{}) (driver.Value, error) {
+	if val == nil {
+		return nil, nil
+	}
+	if vv, ok := val.(string); ok {
+		return json.RawMessage(vv), nil
+	}
+	return nil, fmt.Errorf("%s: failed to convert %v (%T) into type json.RawMessage", DriverName, val, val)
+})
+
+// trimmedCharConverter converts a value from the underlying json response into a string
+// without the trailing spaces that pad char values to their declared length.
+var trimmedCharConverter = valueConverterFunc(func(val interface{}) (driver.Value, error) {
+	if val == nil {
+		return nil, nil
+	}
+	if vv, ok := val.(string); ok {
+		return strings.TrimRight(vv, " "), nil
+	}
+	return nil, fmt.Errorf("%s: failed to convert %v (%T) into type string", DriverName, val, val)
+})
+
+// sketchConverter converts a value from the underlying json response, which holds the base64
+// encoded serialization of a sketch such as a HyperLogLog, into a []byte.
+var sketchConverter = valueConverterFunc(func(val interface{}) (driver.Value, error) {
+	if val == nil {
+		return nil, nil
+	}
+	if vv, ok := val.(string); ok {
+		if b, err := base64.StdEncoding.DecodeString(vv); err == nil {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: failed to convert %v (%T) into type []byte", DriverName, val, val)
+})
@@ -0,0 +1,847 @@
+package prestgo
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArrayConverter(t *testing.T) {
+	testCases := []struct {
+		typ      string
+		val      interface{}
+		expected driver.Value
+		err      bool
+	}{
+		{
+			typ:      "array(bigint)",
+			val:      []interface{}{1.0, 2.0, nil},
+			expected: []interface{}{int64(1), int64(2), nil},
+		},
+		{
+			typ:      "array(varchar)",
+			val:      []interface{}{"a", "b"},
+			expected: []interface{}{"a", "b"},
+		},
+		{
+			typ:      "array(timestamp)",
+			val:      []interface{}{"2015-04-23 10:00:08.123"},
+			expected: []interface{}{time.Date(2015, 04, 23, 10, 0, 8, int(123*time.Millisecond), time.UTC)},
+		},
+		{
+			typ:      "array(array(double))",
+			val:      []interface{}{[]interface{}{0.5}, []interface{}{}},
+			expected: []interface{}{[]interface{}{0.5}, []interface{}{}},
+		},
+		{
+			typ: "array(row(x bigint, y array(varchar)))",
+			val: []interface{}{[]interface{}{1.0, []interface{}{"a", nil}}, nil},
+			expected: []interface{}{
+				map[string]interface{}{"x": int64(1), "y": []interface{}{"a", nil}},
+				nil,
+			},
+		},
+		{
+			typ: "array(map(varchar, array(row(at timestamp))))",
+			val: []interface{}{map[string]interface{}{"k": []interface{}{[]interface{}{"2017-03-02 10:00:00.000"}}}},
+			expected: []interface{}{
+				map[string]interface{}{"k": []interface{}{map[string]interface{}{"at": time.Date(2017, 3, 2, 10, 0, 0, 0, time.UTC)}}},
+			},
+		},
+		{
+			typ:      "array(bigint)",
+			val:      nil,
+			expected: nil,
+		},
+		{
+			typ: "array(bigint)",
+			val: "[1, 2]",
+			err: true,
+		},
+		{
+			typ: "array(bigint)",
+			val: []interface{}{"one"},
+			err: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		v, err := convertValue(parseTypeName(tc.typ), converterOptions{}, tc.val)
+
+		if tc.err == (err == nil) {
+			t.Errorf("%s %v: got error %v, wanted %v", tc.typ, tc.val, err, tc.err)
+		}
+
+		if !reflect.DeepEqual(v, tc.expected) {
+			t.Errorf("%s %v: got %#v, wanted %#v", tc.typ, tc.val, v, tc.expected)
+		}
+	}
+}
+
+func TestMapConverter(t *testing.T) {
+	testCases := []struct {
+		typ      string
+		val      interface{}
+		expected driver.Value
+		err      bool
+	}{
+		{
+			typ:      "map(varchar, bigint)",
+			val:      map[string]interface{}{"a": 1.0, "b": nil},
+			expected: map[string]interface{}{"a": int64(1), "b": nil},
+		},
+		{
+			typ:      "map(bigint, array(varchar))",
+			val:      map[string]interface{}{"1": []interface{}{"x"}},
+			expected: map[string]interface{}{"1": []interface{}{"x"}},
+		},
+		{
+			typ:      "map(varchar, date)",
+			val:      map[string]interface{}{"d": "2017-03-01"},
+			expected: map[string]interface{}{"d": time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			typ:      "map(varchar, row(x bigint, y double))",
+			val:      map[string]interface{}{"a": []interface{}{1.0, 0.5}},
+			expected: map[string]interface{}{"a": map[string]interface{}{"x": int64(1), "y": 0.5}},
+		},
+		{
+			typ:      "map(varchar, bigint)",
+			val:      nil,
+			expected: nil,
+		},
+		{
+			typ: "map(varchar, bigint)",
+			val: []interface{}{"a", 1.0},
+			err: true,
+		},
+		{
+			typ: "map(varchar, bigint)",
+			val: map[string]interface{}{"a": "one"},
+			err: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		v, err := convertValue(parseTypeName(tc.typ), converterOptions{}, tc.val)
+
+		if tc.err == (err == nil) {
+			t.Errorf("%s %v: got error %v, wanted %v", tc.typ, tc.val, err, tc.err)
+		}
+
+		if !reflect.DeepEqual(v, tc.expected) {
+			t.Errorf("%s %v: got %#v, wanted %#v", tc.typ, tc.val, v, tc.expected)
+		}
+	}
+}
+
+func TestRowConverter(t *testing.T) {
+	testCases := []struct {
+		typ      string
+		val      interface{}
+		expected driver.Value
+		err      bool
+	}{
+		{
+			typ:      "row(_id varchar, created double, open boolean)",
+			val:      []interface{}{"dp_9uVcPMp305RgYo", 1484119972.0129445, false},
+			expected: `{"_id":"dp_9uVcPMp305RgYo","created":1484119972.0129445,"open":false}`,
+		},
+		{
+			typ:      "row(id bigint, tags array(varchar), owner row(name varchar, age bigint))",
+			val:      []interface{}{1.0, []interface{}{"a", "b"}, []interface{}{"ian", nil}},
+			expected: `{"id":1,"tags":["a","b"],"owner":{"name":"ian","age":null}}`,
+		},
+		{
+			typ:      "row(attrs map(varchar, row(x bigint)))",
+			val:      []interface{}{map[string]interface{}{"b": []interface{}{2.0}, "a": []interface{}{1.0}}},
+			expected: `{"attrs":{"a":{"x":1},"b":{"x":2}}}`,
+		},
+		{
+			typ:      "row(a bigint)",
+			val:      nil,
+			expected: nil,
+		},
+		{
+			typ: "row(a bigint, b bigint)",
+			val: []interface{}{1.0},
+			err: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		v, err := convertValue(parseTypeName(tc.typ), converterOptions{}, tc.val)
+
+		if tc.err == (err == nil) {
+			t.Errorf("%s %v: got error %v, wanted %v", tc.typ, tc.val, err, tc.err)
+		}
+
+		if !reflect.DeepEqual(v, tc.expected) {
+			t.Errorf("%s %v: got %#v, wanted %#v", tc.typ, tc.val, v, tc.expected)
+		}
+	}
+}
+
+func TestRowMapConverter(t *testing.T) {
+	testCases := []struct {
+		typ      string
+		val      interface{}
+		expected driver.Value
+		err      bool
+	}{
+		{
+			typ:      "row(_id varchar, created double, open boolean)",
+			val:      []interface{}{"dp_9uVcPMp305RgYo", 1484119972.0129445, false},
+			expected: map[string]interface{}{"_id": "dp_9uVcPMp305RgYo", "created": 1484119972.0129445, "open": false},
+		},
+		{
+			typ: "row(id bigint, owner row(name varchar, joined date), logins array(row(at timestamp)))",
+			val: []interface{}{1.0, []interface{}{"ian", "2017-03-01"}, []interface{}{[]interface{}{"2017-03-02 10:00:00.000"}}},
+			expected: map[string]interface{}{
+				"id":     int64(1),
+				"owner":  map[string]interface{}{"name": "ian", "joined": time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)},
+				"logins": []interface{}{map[string]interface{}{"at": time.Date(2017, 3, 2, 10, 0, 0, 0, time.UTC)}},
+			},
+		},
+		{
+			typ:      "row(a bigint)",
+			val:      nil,
+			expected: nil,
+		},
+		{
+			typ: "row(a bigint, b bigint)",
+			val: []interface{}{1.0},
+			err: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		v, err := convertValue(parseTypeName(tc.typ), converterOptions{rowsAsMaps: true}, tc.val)
+
+		if tc.err == (err == nil) {
+			t.Errorf("%s %v: got error %v, wanted %v", tc.typ, tc.val, err, tc.err)
+		}
+
+		if !reflect.DeepEqual(v, tc.expected) {
+			t.Errorf("%s %v: got %#v, wanted %#v", tc.typ, tc.val, v, tc.expected)
+		}
+	}
+}
+
+func TestUUIDConverter(t *testing.T) {
+	testCases := []struct {
+		val      interface{}
+		opts     converterOptions
+		expected driver.Value
+		err      bool
+	}{
+		{
+			val:      "12151fd2-7586-11e9-8f9e-2a86e4085a59",
+			expected: "12151fd2-7586-11e9-8f9e-2a86e4085a59",
+		},
+		{
+			val:      "12151FD2-7586-11E9-8F9E-2A86E4085A59",
+			expected: "12151fd2-7586-11e9-8f9e-2a86e4085a59",
+		},
+		{
+			val:      "12151fd2-7586-11e9-8f9e-2a86e4085a59",
+			opts:     converterOptions{uuidsAsBytes: true},
+			expected: [16]byte{0x12, 0x15, 0x1f, 0xd2, 0x75, 0x86, 0x11, 0xe9, 0x8f, 0x9e, 0x2a, 0x86, 0xe4, 0x08, 0x5a, 0x59},
+		},
+		{
+			val:      nil,
+			expected: nil,
+		},
+		{
+			val: "12151fd2",
+			err: true,
+		},
+		{
+			val: 12.0,
+			err: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		v, err := convertValue(parseTypeName(UUID), tc.opts, tc.val)
+
+		if tc.err == (err == nil) {
+			t.Errorf("%v: got error %v, wanted %v", tc.val, err, tc.err)
+		}
+
+		if !reflect.DeepEqual(v, tc.expected) {
+			t.Errorf("%v: got %#v, wanted %#v", tc.val, v, tc.expected)
+		}
+	}
+}
+
+func TestIPAddressConverter(t *testing.T) {
+	testCases := []struct {
+		val      interface{}
+		opts     converterOptions
+		expected driver.Value
+		err      bool
+	}{
+		{
+			val:      "10.0.0.1",
+			expected: "10.0.0.1",
+		},
+		{
+			val:      "::ffff:10.0.0.1",
+			expected: "10.0.0.1",
+		},
+		{
+			val:      "2001:0db8:0000:0000:0000:ff00:0042:8329",
+			expected: "2001:db8::ff00:42:8329",
+		},
+		{
+			val:      "::ffff:10.0.0.1",
+			opts:     converterOptions{ipAddressesAsIPs: true},
+			expected: net.IP{10, 0, 0, 1},
+		},
+		{
+			val:      "2001:db8::1",
+			opts:     converterOptions{ipAddressesAsIPs: true},
+			expected: net.ParseIP("2001:db8::1"),
+		},
+		{
+			val:      nil,
+			expected: nil,
+		},
+		{
+			val: "10.0.0",
+			err: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		v, err := convertValue(parseTypeName(IPAddress), tc.opts, tc.val)
+
+		if tc.err == (err == nil) {
+			t.Errorf("%v: got error %v, wanted %v", tc.val, err, tc.err)
+		}
+
+		if !reflect.DeepEqual(v, tc.expected) {
+			t.Errorf("%v: got %#v, wanted %#v", tc.val, v, tc.expected)
+		}
+	}
+}
+
+func TestIntervalConverters(t *testing.T) {
+	testCases := []struct {
+		typ      string
+		val      interface{}
+		expected driver.Value
+		err      bool
+	}{
+		{
+			typ:      IntervalDayToSecond,
+			val:      "2 03:04:05.678",
+			expected: 51*time.Hour + 4*time.Minute + 5678*time.Millisecond,
+		},
+		{
+			typ:      IntervalDayToSecond,
+			val:      "-0 00:00:01.500",
+			expected: -1500 * time.Millisecond,
+		},
+		{
+			typ:      IntervalDayToSecond,
+			val:      nil,
+			expected: nil,
+		},
+		{
+			typ: IntervalDayToSecond,
+			val: "2 days",
+			err: true,
+		},
+		{
+			typ:      IntervalYearToMonth,
+			val:      "1-2",
+			expected: int64(14),
+		},
+		{
+			typ:      IntervalYearToMonth,
+			val:      "-0-3",
+			expected: int64(-3),
+		},
+		{
+			typ: IntervalYearToMonth,
+			val: 14.0,
+			err: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		v, err := convertValue(parseTypeName(tc.typ), converterOptions{}, tc.val)
+
+		if tc.err == (err == nil) {
+			t.Errorf("%s %v: got error %v, wanted %v", tc.typ, tc.val, err, tc.err)
+		}
+
+		if !reflect.DeepEqual(v, tc.expected) {
+			t.Errorf("%s %v: got %#v, wanted %#v", tc.typ, tc.val, v, tc.expected)
+		}
+	}
+}
+
+func TestDecimalConverter(t *testing.T) {
+	testCases := []struct {
+		val      interface{}
+		opts     converterOptions
+		expected driver.Value
+		err      bool
+	}{
+		{
+			val:      "1234567890123456789.01",
+			expected: "1234567890123456789.01",
+		},
+		{
+			val:      "1234567890123456789.01",
+			opts:     converterOptions{decimalsAsRats: true},
+			expected: mustRat("123456789012345678901/100"),
+		},
+		{
+			val:      "-0.5",
+			opts:     converterOptions{decimalsAsRats: true},
+			expected: big.NewRat(-1, 2),
+		},
+		{
+			val:      nil,
+			opts:     converterOptions{decimalsAsRats: true},
+			expected: nil,
+		},
+		{
+			val:  "one",
+			opts: converterOptions{decimalsAsRats: true},
+			err:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		v, err := convertValue(parseTypeName("decimal(21,2)"), tc.opts, tc.val)
+
+		if tc.err == (err == nil) {
+			t.Errorf("%v: got error %v, wanted %v", tc.val, err, tc.err)
+		}
+
+		if r, ok := tc.expected.(*big.Rat); ok {
+			if vr, ok := v.(*big.Rat); !ok || vr.Cmp(r) != 0 {
+				t.Errorf("%v: got %#v, wanted %v", tc.val, v, r)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(v, tc.expected) {
+			t.Errorf("%v: got %#v, wanted %#v", tc.val, v, tc.expected)
+		}
+	}
+}
+
+func mustRat(s string) *big.Rat {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		panic("invalid rat: " + s)
+	}
+	return r
+}
+
+func TestTimeWithTimezoneConverter(t *testing.T) {
+	losAngeles, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		val      interface{}
+		opts     converterOptions
+		expected driver.Value
+		err      bool
+	}{
+		{
+			val:      "01:02:03.456 +05:30",
+			expected: time.Date(0, 1, 1, 1, 2, 3, int(456*time.Millisecond), time.FixedZone("+05:30", 5*3600+30*60)),
+		},
+		{
+			val:      "01:02:03.123456789 +05:30",
+			expected: time.Date(0, 1, 1, 1, 2, 3, 123456789, time.FixedZone("+05:30", 5*3600+30*60)),
+		},
+		{
+			val:      "23:59:59.000 -08:00",
+			expected: time.Date(0, 1, 1, 23, 59, 59, 0, time.FixedZone("-08:00", -8*3600)),
+		},
+		{
+			val:      "01:02:03.456 America/Los_Angeles",
+			expected: time.Date(0, 1, 1, 1, 2, 3, int(456*time.Millisecond), losAngeles),
+		},
+		{
+			val:      "01:02:03.456 +05:30",
+			opts:     converterOptions{timeWithTimezoneAsString: true},
+			expected: "01:02:03.456 +05:30",
+		},
+		{
+			val:      nil,
+			expected: nil,
+		},
+		{
+			val: "01:02:03.456",
+			err: true,
+		},
+		{
+			val: "01:02:03.456 Nowhere",
+			err: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		v, err := convertValue(parseTypeName(TimeWithTimezone), tc.opts, tc.val)
+
+		if tc.err == (err == nil) {
+			t.Errorf("%v: got error %v, wanted %v", tc.val, err, tc.err)
+		}
+
+		if vt, ok := v.(time.Time); ok {
+			et, ok := tc.expected.(time.Time)
+			_, voff := vt.Zone()
+			_, eoff := et.Zone()
+			if !ok || !vt.Equal(et) || voff != eoff {
+				t.Errorf("%v: got %v, wanted %v", tc.val, v, tc.expected)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(v, tc.expected) {
+			t.Errorf("%v: got %#v, wanted %#v", tc.val, v, tc.expected)
+		}
+	}
+}
+
+func TestJSONConverter(t *testing.T) {
+	testCases := []struct {
+		val      interface{}
+		opts     converterOptions
+		expected driver.Value
+		err      bool
+	}{
+		{
+			val:      `{"a":[1,2]}`,
+			expected: `{"a":[1,2]}`,
+		},
+		{
+			val:      `{"a":[1,2]}`,
+			opts:     converterOptions{jsonAsRawMessage: true},
+			expected: json.RawMessage(`{"a":[1,2]}`),
+		},
+		{
+			val:      nil,
+			opts:     converterOptions{jsonAsRawMessage: true},
+			expected: nil,
+		},
+		{
+			val:  12.0,
+			opts: converterOptions{jsonAsRawMessage: true},
+			err:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		v, err := convertValue(parseTypeName(JSON), tc.opts, tc.val)
+
+		if tc.err == (err == nil) {
+			t.Errorf("%v: got error %v, wanted %v", tc.val, err, tc.err)
+		}
+
+		if !reflect.DeepEqual(v, tc.expected) {
+			t.Errorf("%v: got %#v, wanted %#v", tc.val, v, tc.expected)
+		}
+	}
+}
+
+func TestCharConverter(t *testing.T) {
+	testCases := []struct {
+		val      interface{}
+		opts     converterOptions
+		expected driver.Value
+	}{
+		{
+			val:      "ab   ",
+			expected: "ab   ",
+		},
+		{
+			val:      "ab   ",
+			opts:     converterOptions{trimChar: true},
+			expected: "ab",
+		},
+		{
+			val:      "  ",
+			opts:     converterOptions{trimChar: true},
+			expected: "",
+		},
+		{
+			val:      nil,
+			opts:     converterOptions{trimChar: true},
+			expected: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		v, err := convertValue(parseTypeName("char(5)"), tc.opts, tc.val)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tc.val, err)
+		}
+		if v != tc.expected {
+			t.Errorf("%q: got %#v, wanted %#v", tc.val, v, tc.expected)
+		}
+	}
+}
+
+func TestRawValueConverter(t *testing.T) {
+	testCases := []struct {
+		typ      string
+		val      interface{}
+		expected driver.Value
+	}{
+		{typ: "varchar", val: "a", expected: "a"},
+		{typ: "bigint", val: json.Number("9007199254740993"), expected: "9007199254740993"},
+		{typ: "double", val: json.Number("1.5e300"), expected: "1.5e300"},
+		{typ: "boolean", val: true, expected: "true"},
+		{typ: "timestamp", val: "2017-03-01 10:00:00.000", expected: "2017-03-01 10:00:00.000"},
+		{typ: "array(row(x bigint))", val: []interface{}{[]interface{}{json.Number("1")}}, expected: "[[1]]"},
+		{typ: "map(varchar, double)", val: map[string]interface{}{"a": "NaN"}, expected: `{"a":"NaN"}`},
+		{typ: "geometry", val: "POINT (1 2)", expected: "POINT (1 2)"},
+		{typ: "bigint", val: nil, expected: nil},
+	}
+
+	RegisterConverter("geometry", valueConverterFunc(func(v interface{}) (driver.Value, error) {
+		return nil, errors.New("registered converter used")
+	}))
+	defer RegisterConverter("geometry", nil)
+
+	opts := converterOptions{rawValues: true, unknownTypes: unknownTypesError, rowsAsMaps: true}
+	for _, tc := range testCases {
+		v, err := convertValue(parseTypeName(tc.typ), opts, tc.val)
+		if err != nil {
+			t.Errorf("%s %v: unexpected error %v", tc.typ, tc.val, err)
+		}
+		if v != tc.expected {
+			t.Errorf("%s %v: got %#v, wanted %#v", tc.typ, tc.val, v, tc.expected)
+		}
+	}
+}
+
+func TestSketchConverter(t *testing.T) {
+	testCases := []struct {
+		typ      typeSignature
+		val      interface{}
+		expected driver.Value
+		err      bool
+	}{
+		{
+			typ:      typeSignature{RawType: HyperLogLog},
+			val:      "AgwBAIADhS4=",
+			expected: []byte{0x02, 0x0c, 0x01, 0x00, 0x80, 0x03, 0x85, 0x2e},
+		},
+		{
+			typ:      typeSignature{RawType: P4HyperLogLog},
+			val:      "AQID",
+			expected: []byte{1, 2, 3},
+		},
+		{
+			typ:      typeSignature{RawType: SetDigest},
+			val:      nil,
+			expected: nil,
+		},
+		{
+			typ:      typeSignature{RawType: QDigest, Arguments: []typeSignatureArg{{Kind: "TYPE", Value: json.RawMessage(`{"rawType":"bigint","arguments":[]}`)}}},
+			val:      "AAAA",
+			expected: []byte{0, 0, 0},
+		},
+		{
+			typ:      typeSignature{RawType: TDigest, Arguments: []typeSignatureArg{{Kind: "TYPE", Value: json.RawMessage(`{"rawType":"double","arguments":[]}`)}}},
+			val:      "AQID",
+			expected: []byte{1, 2, 3},
+		},
+		{
+			typ: typeSignature{RawType: HyperLogLog},
+			val: "not base64!",
+			err: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		typ, err := parseTypeSignature(tc.typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := convertValue(typ, converterOptions{}, tc.val)
+
+		if tc.err == (err == nil) {
+			t.Errorf("%s %v: got error %v, wanted %v", tc.typ.RawType, tc.val, err, tc.err)
+		}
+
+		if !reflect.DeepEqual(v, tc.expected) {
+			t.Errorf("%s %v: got %#v, wanted %#v", tc.typ.RawType, tc.val, v, tc.expected)
+		}
+	}
+}
+
+// convertValue converts v using a converter for typ.
+func convertValue(typ prestoType, opts converterOptions, v interface{}) (driver.Value, error) {
+	c, err := newConverter(typ, opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.ConvertValue(v)
+}
+
+func TestUnknownTypes(t *testing.T) {
+	testCases := []struct {
+		typ      string
+		opts     converterOptions
+		expected driver.Value
+		err      bool
+	}{
+		{
+			typ:      "geometry",
+			expected: "POINT (1 2)",
+		},
+		{
+			typ:      "geometry",
+			opts:     converterOptions{unknownTypes: unknownTypesLog},
+			expected: "POINT (1 2)",
+		},
+		{
+			typ:  "geometry",
+			opts: converterOptions{unknownTypes: unknownTypesError},
+			err:  true,
+		},
+		{
+			typ:  "array(geometry)",
+			opts: converterOptions{unknownTypes: unknownTypesError},
+			err:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		c, err := newConverter(parseTypeName(tc.typ), tc.opts)
+		if tc.err {
+			if e, ok := err.(*UnsupportedTypeError); !ok || e.Type != "geometry" {
+				t.Errorf("%s: got error %#v, wanted an *UnsupportedTypeError for geometry", tc.typ, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tc.typ, err)
+			continue
+		}
+		v, err := c.ConvertValue("POINT (1 2)")
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tc.typ, err)
+		}
+		if v != tc.expected {
+			t.Errorf("%s: got %#v, wanted %#v", tc.typ, v, tc.expected)
+		}
+	}
+}
+
+func TestRegisterConverter(t *testing.T) {
+	upper := valueConverterFunc(func(v interface{}) (driver.Value, error) {
+		if v == nil {
+			return nil, nil
+		}
+		return strings.ToUpper(v.(string)), nil
+	})
+
+	RegisterConverter("Geometry", upper)
+	defer RegisterConverter("geometry", nil)
+
+	v, err := convertValue(parseTypeName("array(geometry)"), converterOptions{unknownTypes: unknownTypesError}, []interface{}{"point (1 2)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []interface{}{"POINT (1 2)"}; !reflect.DeepEqual(v, expected) {
+		t.Errorf("got %#v, wanted %#v", v, expected)
+	}
+
+	RegisterConverter("varchar", upper)
+	v, err = convertValue(parseTypeName("varchar(10)"), converterOptions{}, "abc")
+	RegisterConverter("varchar", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "ABC" {
+		t.Errorf("got %#v, wanted %#v", v, "ABC")
+	}
+
+	v, err = convertValue(parseTypeName("varchar(10)"), converterOptions{}, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "abc" {
+		t.Errorf("got %#v after unregistering, wanted %#v", v, "abc")
+	}
+}
+
+func TestScanType(t *testing.T) {
+	testCases := []struct {
+		typ      string
+		opts     converterOptions
+		expected reflect.Type
+	}{
+		{typ: "varchar(10)", expected: reflect.TypeOf("")},
+		{typ: "bigint", expected: reflect.TypeOf(int64(0))},
+		{typ: "integer", expected: reflect.TypeOf(int64(0))},
+		{typ: "double", expected: reflect.TypeOf(float64(0))},
+		{typ: "boolean", expected: reflect.TypeOf(false)},
+		{typ: "timestamp(6) with time zone", expected: reflect.TypeOf(time.Time{})},
+		{typ: "date", expected: reflect.TypeOf(time.Time{})},
+		{typ: "time", expected: reflect.TypeOf("")},
+		{typ: "decimal(10,2)", expected: reflect.TypeOf("")},
+		{typ: "decimal(10,2)", opts: converterOptions{decimalsAsRats: true}, expected: reflect.TypeOf(&big.Rat{})},
+		{typ: "array(bigint)", expected: reflect.TypeOf([]interface{}{})},
+		{typ: "map(varchar, bigint)", expected: reflect.TypeOf(map[string]interface{}{})},
+		{typ: "row(a bigint)", expected: reflect.TypeOf("")},
+		{typ: "row(a bigint)", opts: converterOptions{rowsAsMaps: true}, expected: reflect.TypeOf(map[string]interface{}{})},
+		{typ: "interval day to second", expected: reflect.TypeOf(time.Duration(0))},
+		{typ: "uuid", opts: converterOptions{uuidsAsBytes: true}, expected: reflect.TypeOf([16]byte{})},
+		{typ: "geometry", expected: reflect.TypeOf("")},
+	}
+
+	for _, tc := range testCases {
+		typ := parseTypeName(tc.typ)
+		st := scanType(typ, tc.opts)
+		if st != tc.expected {
+			t.Errorf("%s: got %v, wanted %v", tc.typ, st, tc.expected)
+		}
+
+		// The scan type must match the values actually produced
+		c, err := newConverter(typ, tc.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v, err := c.ConvertValue(sampleValues[typ.name]); err == nil && reflect.TypeOf(v) != st {
+			t.Errorf("%s: converter produced %T, scan type is %v", tc.typ, v, st)
+		}
+	}
+}
+
+var sampleValues = map[string]interface{}{
+	"varchar":                  "a",
+	"bigint":                   json.Number("1"),
+	"integer":                  json.Number("1"),
+	"double":                   json.Number("1.5"),
+	"boolean":                  true,
+	"timestamp with time zone": "2017-03-01 10:00:00.000 UTC",
+	"date":                     "2017-03-01",
+	"time":                     "10:00:00.000",
+	"decimal":                  "1.50",
+	"array":                    []interface{}{json.Number("1")},
+	"map":                      map[string]interface{}{"a": json.Number("1")},
+	"row":                      []interface{}{json.Number("1")},
+	"interval day to second":   "0 00:00:01.000",
+	"uuid":                     "12151fd2-7586-11e9-8f9e-2a86e4085a59",
+	"geometry":                 "POINT (1 2)",
+}
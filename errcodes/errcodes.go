@@ -0,0 +1,206 @@
+// Package errcodes defines the standard error codes and names that Presto and Trino report
+// in the errorCode and errorName fields of a failed query, as listed by the servers'
+// StandardErrorCode enumeration. Codes specific to a connector are not included.
+//
+//	var perr *prestgo.Error
+//	if errors.As(err, &perr) {
+//		switch perr.ErrorCode {
+//		case errcodes.SyntaxError:
+//			...
+//		case errcodes.ExceededLocalMemoryLimit, errcodes.ExceededGlobalMemoryLimit:
+//			...
+//		}
+//	}
+package errcodes
+
+// Error types, reported in the errorType field of a failed query.
+const (
+	UserError             = "USER_ERROR"
+	InternalError         = "INTERNAL_ERROR"
+	InsufficientResources = "INSUFFICIENT_RESOURCES"
+	External              = "EXTERNAL"
+)
+
+// Codes of errors of type USER_ERROR.
+const (
+	GenericUserError            = 0
+	SyntaxError                 = 1
+	AbandonedQuery              = 2
+	UserCanceled                = 3
+	PermissionDenied            = 4
+	NotFound                    = 5
+	FunctionNotFound            = 6
+	InvalidFunctionArgument     = 7
+	DivisionByZero              = 8
+	InvalidCastArgument         = 9
+	OperatorNotFound            = 10
+	InvalidView                 = 11
+	AlreadyExists               = 12
+	NotSupported                = 13
+	InvalidSessionProperty      = 14
+	InvalidWindowFrame          = 15
+	ConstraintViolation         = 16
+	TransactionConflict         = 17
+	InvalidTableProperty        = 18
+	NumericValueOutOfRange      = 19
+	UnknownTransaction          = 20
+	NotInTransaction            = 21
+	TransactionAlreadyAborted   = 22
+	ReadOnlyViolation           = 23
+	MultipleStatements          = 24
+	IncompatibleClient          = 25
+	SubqueryMultipleRows        = 26
+	ProcedureNotFound           = 27
+	InvalidProcedureArgument    = 28
+	QueryRejected               = 29
+	AmbiguousFunctionCall       = 30
+	InvalidSchemaProperty       = 31
+	SchemaNotEmpty              = 32
+	QueryTextTooLarge           = 33
+	UnsupportedSubquery         = 34
+	ExceededFunctionMemoryLimit = 35
+	AdministrativelyKilled      = 36
+	InvalidColumnProperty       = 37
+	QueryHasTooManyStages       = 38
+	InvalidSpatialPartitioning  = 39
+	InvalidAnalyzeProperty      = 40
+)
+
+// Codes of errors of type INTERNAL_ERROR.
+const (
+	GenericInternalError            = 0x10000
+	TooManyRequestsFailed           = 0x10001
+	PageTooLarge                    = 0x10002
+	PageTransportError              = 0x10003
+	PageTransportTimeout            = 0x10004
+	NoNodesAvailable                = 0x10005
+	RemoteTaskError                 = 0x10006
+	CompilerError                   = 0x10007
+	RemoteTaskMismatch              = 0x10008
+	ServerShuttingDown              = 0x10009
+	FunctionImplementationMissing   = 0x1000a
+	RemoteBufferCloseFailed         = 0x1000b
+	ServerStartingUp                = 0x1000c
+	FunctionImplementationError     = 0x1000d
+	InvalidProcedureDefinition      = 0x1000e
+	ProcedureCallFailed             = 0x1000f
+	AmbiguousFunctionImplementation = 0x10010
+	AbandonedTask                   = 0x10011
+	CorruptSerializedIdentity       = 0x10012
+	CorruptPage                     = 0x10013
+	OptimizerTimeout                = 0x10014
+	OutOfSpillSpace                 = 0x10015
+	RemoteHostGone                  = 0x10016
+)
+
+// Codes of errors of type INSUFFICIENT_RESOURCES.
+const (
+	GenericInsufficientResources = 0x20000
+	ExceededGlobalMemoryLimit    = 0x20001
+	QueryQueueFull               = 0x20002
+	ExceededTimeLimit            = 0x20003
+	ClusterOutOfMemory           = 0x20004
+	ExceededCPULimit             = 0x20005
+	ExceededSpillLimit           = 0x20006
+	ExceededLocalMemoryLimit     = 0x20007
+)
+
+// ExceededMemoryLimit is the former name of ExceededGlobalMemoryLimit, reported by older
+// servers as EXCEEDED_MEMORY_LIMIT.
+const ExceededMemoryLimit = ExceededGlobalMemoryLimit
+
+// names maps each code to its name.
+var names = map[int]string{
+	GenericUserError:                "GENERIC_USER_ERROR",
+	SyntaxError:                     "SYNTAX_ERROR",
+	AbandonedQuery:                  "ABANDONED_QUERY",
+	UserCanceled:                    "USER_CANCELED",
+	PermissionDenied:                "PERMISSION_DENIED",
+	NotFound:                        "NOT_FOUND",
+	FunctionNotFound:                "FUNCTION_NOT_FOUND",
+	InvalidFunctionArgument:         "INVALID_FUNCTION_ARGUMENT",
+	DivisionByZero:                  "DIVISION_BY_ZERO",
+	InvalidCastArgument:             "INVALID_CAST_ARGUMENT",
+	OperatorNotFound:                "OPERATOR_NOT_FOUND",
+	InvalidView:                     "INVALID_VIEW",
+	AlreadyExists:                   "ALREADY_EXISTS",
+	NotSupported:                    "NOT_SUPPORTED",
+	InvalidSessionProperty:          "INVALID_SESSION_PROPERTY",
+	InvalidWindowFrame:              "INVALID_WINDOW_FRAME",
+	ConstraintViolation:             "CONSTRAINT_VIOLATION",
+	TransactionConflict:             "TRANSACTION_CONFLICT",
+	InvalidTableProperty:            "INVALID_TABLE_PROPERTY",
+	NumericValueOutOfRange:          "NUMERIC_VALUE_OUT_OF_RANGE",
+	UnknownTransaction:              "UNKNOWN_TRANSACTION",
+	NotInTransaction:                "NOT_IN_TRANSACTION",
+	TransactionAlreadyAborted:       "TRANSACTION_ALREADY_ABORTED",
+	ReadOnlyViolation:               "READ_ONLY_VIOLATION",
+	MultipleStatements:              "MULTIPLE_STATEMENTS",
+	IncompatibleClient:              "INCOMPATIBLE_CLIENT",
+	SubqueryMultipleRows:            "SUBQUERY_MULTIPLE_ROWS",
+	ProcedureNotFound:               "PROCEDURE_NOT_FOUND",
+	InvalidProcedureArgument:        "INVALID_PROCEDURE_ARGUMENT",
+	QueryRejected:                   "QUERY_REJECTED",
+	AmbiguousFunctionCall:           "AMBIGUOUS_FUNCTION_CALL",
+	InvalidSchemaProperty:           "INVALID_SCHEMA_PROPERTY",
+	SchemaNotEmpty:                  "SCHEMA_NOT_EMPTY",
+	QueryTextTooLarge:               "QUERY_TEXT_TOO_LARGE",
+	UnsupportedSubquery:             "UNSUPPORTED_SUBQUERY",
+	ExceededFunctionMemoryLimit:     "EXCEEDED_FUNCTION_MEMORY_LIMIT",
+	AdministrativelyKilled:          "ADMINISTRATIVELY_KILLED",
+	InvalidColumnProperty:           "INVALID_COLUMN_PROPERTY",
+	QueryHasTooManyStages:           "QUERY_HAS_TOO_MANY_STAGES",
+	InvalidSpatialPartitioning:      "INVALID_SPATIAL_PARTITIONING",
+	InvalidAnalyzeProperty:          "INVALID_ANALYZE_PROPERTY",
+	GenericInternalError:            "GENERIC_INTERNAL_ERROR",
+	TooManyRequestsFailed:           "TOO_MANY_REQUESTS_FAILED",
+	PageTooLarge:                    "PAGE_TOO_LARGE",
+	PageTransportError:              "PAGE_TRANSPORT_ERROR",
+	PageTransportTimeout:            "PAGE_TRANSPORT_TIMEOUT",
+	NoNodesAvailable:                "NO_NODES_AVAILABLE",
+	RemoteTaskError:                 "REMOTE_TASK_ERROR",
+	CompilerError:                   "COMPILER_ERROR",
+	RemoteTaskMismatch:              "REMOTE_TASK_MISMATCH",
+	ServerShuttingDown:              "SERVER_SHUTTING_DOWN",
+	FunctionImplementationMissing:   "FUNCTION_IMPLEMENTATION_MISSING",
+	RemoteBufferCloseFailed:         "REMOTE_BUFFER_CLOSE_FAILED",
+	ServerStartingUp:                "SERVER_STARTING_UP",
+	FunctionImplementationError:     "FUNCTION_IMPLEMENTATION_ERROR",
+	InvalidProcedureDefinition:      "INVALID_PROCEDURE_DEFINITION",
+	ProcedureCallFailed:             "PROCEDURE_CALL_FAILED",
+	AmbiguousFunctionImplementation: "AMBIGUOUS_FUNCTION_IMPLEMENTATION",
+	AbandonedTask:                   "ABANDONED_TASK",
+	CorruptSerializedIdentity:       "CORRUPT_SERIALIZED_IDENTITY",
+	CorruptPage:                     "CORRUPT_PAGE",
+	OptimizerTimeout:                "OPTIMIZER_TIMEOUT",
+	OutOfSpillSpace:                 "OUT_OF_SPILL_SPACE",
+	RemoteHostGone:                  "REMOTE_HOST_GONE",
+	GenericInsufficientResources:    "GENERIC_INSUFFICIENT_RESOURCES",
+	ExceededGlobalMemoryLimit:       "EXCEEDED_GLOBAL_MEMORY_LIMIT",
+	QueryQueueFull:                  "QUERY_QUEUE_FULL",
+	ExceededTimeLimit:               "EXCEEDED_TIME_LIMIT",
+	ClusterOutOfMemory:              "CLUSTER_OUT_OF_MEMORY",
+	ExceededCPULimit:                "EXCEEDED_CPU_LIMIT",
+	ExceededSpillLimit:              "EXCEEDED_SPILL_LIMIT",
+	ExceededLocalMemoryLimit:        "EXCEEDED_LOCAL_MEMORY_LIMIT",
+}
+
+// Name returns the name of the error code, such as "SYNTAX_ERROR", or an empty string if the
+// code is not a standard one.
+func Name(code int) string {
+	return names[code]
+}
+
+// Code returns the error code with the given name, such as "SYNTAX_ERROR", and whether the
+// name is a standard one.
+func Code(name string) (int, bool) {
+	if name == "EXCEEDED_MEMORY_LIMIT" {
+		return ExceededMemoryLimit, true
+	}
+	for code, n := range names {
+		if n == name {
+			return code, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,38 @@
+package errcodes
+
+import "testing"
+
+func TestName(t *testing.T) {
+	testCases := []struct {
+		code int
+		name string
+	}{
+		{code: SyntaxError, name: "SYNTAX_ERROR"},
+		{code: 1, name: "SYNTAX_ERROR"},
+		{code: PermissionDenied, name: "PERMISSION_DENIED"},
+		{code: 65545, name: "SERVER_SHUTTING_DOWN"},
+		{code: 131079, name: "EXCEEDED_LOCAL_MEMORY_LIMIT"},
+		{code: 0x1000000, name: ""},
+	}
+
+	for _, tc := range testCases {
+		if name := Name(tc.code); name != tc.name {
+			t.Errorf("%d: got %q, wanted %q", tc.code, name, tc.name)
+		}
+	}
+}
+
+func TestCode(t *testing.T) {
+	for code, name := range names {
+		if c, ok := Code(name); !ok || c != code {
+			t.Errorf("%s: got %d, %v, wanted %d, true", name, c, ok, code)
+		}
+	}
+
+	if c, ok := Code("EXCEEDED_MEMORY_LIMIT"); !ok || c != ExceededGlobalMemoryLimit {
+		t.Errorf("EXCEEDED_MEMORY_LIMIT: got %d, %v, wanted %d, true", c, ok, ExceededGlobalMemoryLimit)
+	}
+	if _, ok := Code("HIVE_METASTORE_ERROR"); ok {
+		t.Error("HIVE_METASTORE_ERROR: got a standard code")
+	}
+}
@@ -0,0 +1,468 @@
+package prestgo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxErrorBodyLen is the maximum number of bytes of a response body kept in an HTTPError.
+const maxErrorBodyLen = 512
+
+// HTTPError is returned when the server responds to a request with a status other than
+// 200 OK, which indicates a failure outside of the query itself, such as an overloaded
+// coordinator or a misbehaving proxy.
+type HTTPError struct {
+	StatusCode int    // HTTP status code of the response.
+	URL        string // URL of the request, without any credentials.
+	Message    string // Message taken from a JSON error payload, if the body contained one.
+	Body       string // Leading portion of the response body.
+	QueryID    string // ID of the query being fetched, if it had been submitted.
+	InfoURI    string // URI of the query's information page, if it had been submitted.
+}
+
+func (e *HTTPError) Error() string {
+	msg := fmt.Sprintf("%s: query failed: http status %d", DriverName, e.StatusCode)
+	if e.URL != "" {
+		msg += " from " + e.URL
+	}
+	switch {
+	case e.Message != "":
+		msg += ": " + e.Message
+	case e.Body != "":
+		msg += ": " + e.Body
+	}
+	return msg + queryRef(e.QueryID, e.InfoURI)
+}
+
+// queryRef describes the query an error relates to, for appending to an error message.
+func queryRef(id, infoURI string) string {
+	switch {
+	case id == "":
+		return ""
+	case infoURI == "":
+		return " (query " + id + ")"
+	}
+	return " (query " + id + ", " + infoURI + ")"
+}
+
+// Unwrap returns ErrQueryFailed so that errors.Is(err, ErrQueryFailed) reports true for an
+// HTTPError.
+func (e *HTTPError) Unwrap() error {
+	return ErrQueryFailed
+}
+
+// newHTTPError reads the body of an unsuccessful response into an HTTPError.
+func newHTTPError(resp *http.Response) *HTTPError {
+	e := &HTTPError{StatusCode: resp.StatusCode}
+	if resp.Request != nil && resp.Request.URL != nil {
+		u := *resp.Request.URL
+		u.User = nil
+		e.URL = u.String()
+	}
+
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodyLen+1))
+	var payload struct {
+		Message string          `json:"message"`
+		Error   json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &payload) == nil {
+		e.Message = payload.Message
+		if e.Message == "" && len(payload.Error) > 0 {
+			var nested struct {
+				Message string `json:"message"`
+			}
+			if json.Unmarshal(payload.Error, &e.Message) != nil && json.Unmarshal(payload.Error, &nested) == nil {
+				e.Message = nested.Message
+			}
+		}
+	}
+
+	if len(body) > maxErrorBodyLen {
+		body = append(body[:maxErrorBodyLen], "..."...)
+	}
+	e.Body = strings.TrimSpace(string(body))
+	return e
+}
+
+// Error is returned when Presto reports that a query failed, whether the failure occurred
+// when the query was submitted or while its results were being fetched.
+type Error struct {
+	Message       string         `json:"message"`       // Description of the failure.
+	ErrorCode     int            `json:"errorCode"`     // Numeric error code, e.g. 1 for SYNTAX_ERROR.
+	ErrorName     string         `json:"errorName"`     // Name of the error code, e.g. "SYNTAX_ERROR".
+	ErrorType     string         `json:"errorType"`     // Category of the error: USER_ERROR, INTERNAL_ERROR, INSUFFICIENT_RESOURCES or EXTERNAL.
+	ErrorLocation *ErrorLocation `json:"errorLocation"` // Position in the query text the failure relates to, if any.
+	FailureInfo   *FailureInfo   `json:"failureInfo"`   // Details of the exception raised by the server, if any.
+	QueryID       string         `json:"-"`             // ID the server assigned to the query.
+	InfoURI       string         `json:"-"`             // URI of the query's information page on the coordinator.
+
+	// Resources used by the query when it failed, as reported in the query's statistics.
+	PeakMemoryBytes int64         `json:"-"`
+	CPUTime         time.Duration `json:"-"`
+	ElapsedTime     time.Duration `json:"-"`
+
+	// Hint suggests how to avoid a failure caused by exceeding a resource limit, such as the
+	// session property that raises the limit.
+	Hint string `json:"-"`
+}
+
+func (e *Error) Error() string {
+	name := e.ErrorName
+	if name == "" && e.FailureInfo != nil {
+		name = e.FailureInfo.Type
+	}
+	msg := e.Message
+	if e.Hint != "" {
+		msg += "; " + e.Hint
+	}
+	if name == "" {
+		return fmt.Sprintf("%s: query failed: %s%s", DriverName, msg, queryRef(e.QueryID, e.InfoURI))
+	}
+	return fmt.Sprintf("%s: query failed: %s: %s%s", DriverName, name, msg, queryRef(e.QueryID, e.InfoURI))
+}
+
+// limitProperties maps the errorName of a failure caused by exceeding a resource limit to
+// the session property that sets the limit.
+var limitProperties = map[string]string{
+	"EXCEEDED_LOCAL_MEMORY_LIMIT":  "query_max_memory_per_node",
+	"EXCEEDED_GLOBAL_MEMORY_LIMIT": "query_max_memory",
+	"EXCEEDED_MEMORY_LIMIT":        "query_max_memory",
+	"EXCEEDED_TIME_LIMIT":          "query_max_execution_time",
+	"EXCEEDED_CPU_LIMIT":           "query_max_cpu_time",
+}
+
+// addStats records the resources used by the query, taken from the statistics in the response
+// reporting the failure, and derives a hint for failures caused by exceeding a resource limit.
+func (e *Error) addStats(stats stmtStats) {
+	e.PeakMemoryBytes = stats.PeakMemoryBytes
+	e.CPUTime = time.Duration(stats.CPUTimeMillis) * time.Millisecond
+	e.ElapsedTime = time.Duration(stats.ElapsedMillis) * time.Millisecond
+
+	var usage string
+	switch e.ErrorName {
+	case "EXCEEDED_LOCAL_MEMORY_LIMIT", "EXCEEDED_GLOBAL_MEMORY_LIMIT", "EXCEEDED_MEMORY_LIMIT":
+		if e.PeakMemoryBytes > 0 {
+			usage = "peak memory " + formatBytes(e.PeakMemoryBytes) + ", "
+		}
+	case "EXCEEDED_TIME_LIMIT":
+		if e.ElapsedTime > 0 {
+			usage = "elapsed time " + e.ElapsedTime.String() + ", "
+		}
+	case "EXCEEDED_CPU_LIMIT":
+		if e.CPUTime > 0 {
+			usage = "CPU time " + e.CPUTime.String() + ", "
+		}
+	case "CLUSTER_OUT_OF_MEMORY":
+		e.Hint = "the cluster ran out of memory, retry when it is less busy or reduce the memory the query needs"
+		return
+	}
+	if prop, ok := limitProperties[e.ErrorName]; ok {
+		e.Hint = usage + "raise the " + prop + " session property to allow more"
+	}
+}
+
+// formatBytes formats a number of bytes the way Presto formats data sizes, e.g. "1.5GB".
+func formatBytes(n int64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB", "PB"}
+	size, unit := float64(n), 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return strconv.FormatInt(n, 10) + units[0]
+	}
+	return strconv.FormatFloat(size, 'f', 2, 64) + units[unit]
+}
+
+// Is reports whether the error belongs to the category target, one of the ErrUserError family
+// of error types or one of the more specific causes such as ErrSyntax, so that callers can
+// use errors.Is to branch on the cause of a failure. A query that exceeded the server's time
+// limit also matches context.DeadlineExceeded, like one that exceeded the caller's deadline.
+func (e *Error) Is(target error) bool {
+	if target == errorTypes[e.ErrorType] && target != nil {
+		return true
+	}
+	if target == context.DeadlineExceeded && e.ErrorName == "EXCEEDED_TIME_LIMIT" {
+		return true
+	}
+	for _, name := range errorCauses[target] {
+		if e.ErrorName == name {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// ErrUserError matches query failures caused by the query or the user running it.
+	ErrUserError = errors.New(DriverName + ": user error")
+
+	// ErrInternalError matches query failures caused by a fault in the server.
+	ErrInternalError = errors.New(DriverName + ": internal error")
+
+	// ErrInsufficientResources matches query failures caused by the server running out of
+	// resources such as memory or time.
+	ErrInsufficientResources = errors.New(DriverName + ": insufficient resources")
+
+	// ErrExternal matches query failures caused by a system outside the server, such as a
+	// connector's data source.
+	ErrExternal = errors.New(DriverName + ": external error")
+
+	// ErrSyntax matches query failures caused by a syntax error in the query text.
+	ErrSyntax = errors.New(DriverName + ": syntax error")
+
+	// ErrPermissionDenied matches query failures caused by the user lacking a privilege.
+	ErrPermissionDenied = errors.New(DriverName + ": permission denied")
+
+	// ErrExceededMemoryLimit matches query failures caused by a query exceeding a memory limit.
+	ErrExceededMemoryLimit = errors.New(DriverName + ": exceeded memory limit")
+
+	// ErrCatalogNotFound matches query failures caused by a reference to a missing catalog.
+	ErrCatalogNotFound = errors.New(DriverName + ": catalog not found")
+
+	// ErrSchemaNotFound matches query failures caused by a reference to a missing schema.
+	ErrSchemaNotFound = errors.New(DriverName + ": schema not found")
+
+	// ErrTableNotFound matches query failures caused by a reference to a missing table.
+	ErrTableNotFound = errors.New(DriverName + ": table not found")
+
+	// ErrColumnNotFound matches query failures caused by a reference to a missing column.
+	ErrColumnNotFound = errors.New(DriverName + ": column not found")
+)
+
+// errorTypes maps the errorType of a failure to the error matching its category.
+var errorTypes = map[string]error{
+	"USER_ERROR":             ErrUserError,
+	"INTERNAL_ERROR":         ErrInternalError,
+	"INSUFFICIENT_RESOURCES": ErrInsufficientResources,
+	"EXTERNAL":               ErrExternal,
+}
+
+// errorCauses lists the errorName values, from both Presto and Trino, that are matched by
+// each cause.
+var errorCauses = map[error][]string{
+	ErrSyntax:              {"SYNTAX_ERROR"},
+	ErrPermissionDenied:    {"PERMISSION_DENIED"},
+	ErrExceededMemoryLimit: {"EXCEEDED_MEMORY_LIMIT", "EXCEEDED_LOCAL_MEMORY_LIMIT", "EXCEEDED_GLOBAL_MEMORY_LIMIT"},
+	ErrCatalogNotFound:     {"CATALOG_NOT_FOUND", "MISSING_CATALOG_NAME"},
+	ErrSchemaNotFound:      {"SCHEMA_NOT_FOUND", "MISSING_SCHEMA_NAME"},
+	ErrTableNotFound:       {"TABLE_NOT_FOUND", "MISSING_TABLE"},
+	ErrColumnNotFound:      {"COLUMN_NOT_FOUND", "MISSING_COLUMN_NAME", "MISSING_ATTRIBUTE"},
+}
+
+// retryableErrorNames are the errorName values of failures caused by a transient condition
+// in the cluster, after which the same query may succeed if it is run again.
+var retryableErrorNames = map[string]bool{
+	"SERVER_SHUTTING_DOWN":       true,
+	"SERVER_STARTING_UP":         true,
+	"NO_NODES_AVAILABLE":         true,
+	"REMOTE_HOST_GONE":           true,
+	"REMOTE_TASK_ERROR":          true,
+	"REMOTE_TASK_MISMATCH":       true,
+	"TOO_MANY_REQUESTS_FAILED":   true,
+	"PAGE_TRANSPORT_ERROR":       true,
+	"PAGE_TRANSPORT_TIMEOUT":     true,
+	"CLUSTER_OUT_OF_MEMORY":      true,
+	"QUERY_QUEUE_FULL":           true,
+	"ADMINISTRATIVELY_PREEMPTED": true,
+}
+
+// IsRetryable reports whether err, or an error it wraps, was caused by a transient failure
+// such as a busy coordinator, a lost worker or a network timeout, after which running the
+// query again may succeed. Failures of the query itself, such as syntax errors or missing
+// privileges, are not retryable.
+func IsRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		// The caller gave up, which a retry would not change
+		return false
+	}
+
+	var perr *Error
+	if errors.As(err, &perr) {
+		return retryableErrorNames[perr.ErrorName]
+	}
+
+	var herr *HTTPError
+	if errors.As(err, &herr) {
+		switch herr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	var nerr net.Error
+	if errors.As(err, &nerr) {
+		return nerr.Timeout()
+	}
+
+	return false
+}
+
+// CanceledByServerError is returned when the server canceled or killed a query that the
+// caller had not canceled, for example because an administrator killed it. It matches
+// ErrQueryCanceled with errors.Is.
+type CanceledByServerError struct {
+	QueryID string // ID the server assigned to the query.
+	Reason  string // Reason given by the server, if any.
+	Err     *Error // Failure reported by the server, if any.
+}
+
+func (e *CanceledByServerError) Error() string {
+	msg := DriverName + ": query canceled by server"
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg + queryRef(e.QueryID, "")
+}
+
+// Is reports whether target is ErrQueryCanceled.
+func (e *CanceledByServerError) Is(target error) bool {
+	return target == ErrQueryCanceled
+}
+
+// Unwrap returns the failure reported by the server, if any.
+func (e *CanceledByServerError) Unwrap() error {
+	if e.Err == nil {
+		return nil
+	}
+	return e.Err
+}
+
+// ClusterBusyError is returned when a query was canceled because it was still queued once
+// the time allowed by the max_queued_wait data source option had passed. It matches
+// ErrClusterBusy with errors.Is.
+type ClusterBusyError struct {
+	QueryID string        // ID the server assigned to the query.
+	Waited  time.Duration // Time from submitting the query until it was canceled.
+}
+
+func (e *ClusterBusyError) Error() string {
+	return fmt.Sprintf("%s: cluster busy, query still queued after %v%s", DriverName, e.Waited.Round(time.Millisecond), queryRef(e.QueryID, ""))
+}
+
+// Is reports whether target is ErrClusterBusy.
+func (e *ClusterBusyError) Is(target error) bool {
+	return target == ErrClusterBusy
+}
+
+// serverCancellations are the errorName values of failures reported when a query was
+// canceled or killed from outside the client.
+var serverCancellations = map[string]bool{
+	"USER_CANCELED":              true,
+	"ADMINISTRATIVELY_KILLED":    true,
+	"ADMINISTRATIVELY_PREEMPTED": true,
+}
+
+// Unwrap returns the exception raised by the server, if any, so that errors.As can be used to
+// find a FailureInfo in the cause chain.
+func (e *Error) Unwrap() error {
+	if e.FailureInfo == nil {
+		return nil
+	}
+	return e.FailureInfo
+}
+
+// Causes returns the chain of exceptions that led to the failure, starting with the one
+// reported by the server and ending with the root cause.
+func (e *Error) Causes() []*FailureInfo {
+	var causes []*FailureInfo
+	for f := e.FailureInfo; f != nil; f = f.Cause {
+		causes = append(causes, f)
+	}
+	return causes
+}
+
+// ErrorLocation is a position in the text of a query.
+type ErrorLocation struct {
+	LineNumber   int `json:"lineNumber"`
+	ColumnNumber int `json:"columnNumber"`
+}
+
+// FailureInfo describes the exception raised by the server when a query failed, along with
+// the exceptions that caused it.
+type FailureInfo struct {
+	Type          string         `json:"type"`          // Class name of the exception.
+	Message       string         `json:"message"`       // Message of the exception.
+	Cause         *FailureInfo   `json:"cause"`         // Exception that caused this one, if any.
+	Suppressed    []*FailureInfo `json:"suppressed"`    // Exceptions suppressed while handling this one.
+	Stack         []string       `json:"stack"`         // Stack trace of the exception.
+	ErrorLocation *ErrorLocation `json:"errorLocation"` // Position in the query text the exception relates to, if any.
+}
+
+func (f *FailureInfo) Error() string {
+	if f.Message == "" {
+		return f.Type
+	}
+	return f.Type + ": " + f.Message
+}
+
+// Unwrap returns the exception that caused this one, if any.
+func (f *FailureInfo) Unwrap() error {
+	if f.Cause == nil {
+		return nil
+	}
+	return f.Cause
+}
+
+// UnsupportedTypeError is returned when a query result contains a column of a type the driver
+// cannot convert and the unknown_types=error data source option is set.
+type UnsupportedTypeError struct {
+	Column string // Name of the result column.
+	Type   string // The unsupported type, which may be nested within the column type.
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return fmt.Sprintf("%s: unsupported type %s for column %s", DriverName, e.Type, e.Column)
+}
+
+// maxErrorValueLen is the maximum number of bytes of a value kept in a ConversionError.
+const maxErrorValueLen = 64
+
+// ConversionError is returned by Rows.Next when a value in the query result cannot be
+// converted into its Go representation.
+type ConversionError struct {
+	Column string // Name of the result column.
+	Type   string // Declared type of the column, e.g. "array(bigint)".
+	Row    int    // Zero based index of the row within the query result.
+	Value  string // Leading portion of the value as sent by the server.
+	Err    error  // The error returned by the converter.
+}
+
+func (e *ConversionError) Error() string {
+	return fmt.Sprintf("%s: cannot convert value %s in column %s of type %s at row %d: %s",
+		DriverName, e.Value, e.Column, e.Type, e.Row, strings.TrimPrefix(e.Err.Error(), DriverName+": "))
+}
+
+// Unwrap returns the error returned by the converter.
+func (e *ConversionError) Unwrap() error {
+	return e.Err
+}
+
+// newConversionError returns a ConversionError for the failure to convert v.
+func newConversionError(column string, typ prestoType, row int, v interface{}, err error) *ConversionError {
+	sample, jerr := json.Marshal(v)
+	if jerr != nil {
+		sample = []byte(fmt.Sprintf("%v", v))
+	}
+	if len(sample) > maxErrorValueLen {
+		sample = append(sample[:maxErrorValueLen], "..."...)
+	}
+	return &ConversionError{
+		Column: column,
+		Type:   typ.String(),
+		Row:    row,
+		Value:  string(sample),
+		Err:    err,
+	}
+}
@@ -0,0 +1,596 @@
+package prestgo
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPError(t *testing.T) {
+	testCases := []struct {
+		status  int
+		body    string
+		message string
+		excerpt string
+	}{
+		{
+			status:  http.StatusInternalServerError,
+			body:    `{"message": "coordinator is shutting down"}`,
+			message: "coordinator is shutting down",
+			excerpt: `{"message": "coordinator is shutting down"}`,
+		},
+		{
+			status:  http.StatusBadRequest,
+			body:    `{"error": "unknown user"}`,
+			message: "unknown user",
+			excerpt: `{"error": "unknown user"}`,
+		},
+		{
+			status:  http.StatusBadRequest,
+			body:    `{"error": {"message": "bad header"}}`,
+			message: "bad header",
+			excerpt: `{"error": {"message": "bad header"}}`,
+		},
+		{
+			status:  http.StatusBadGateway,
+			body:    "<html>Bad Gateway</html>\n",
+			message: "",
+			excerpt: "<html>Bad Gateway</html>",
+		},
+		{
+			status:  http.StatusBadGateway,
+			body:    strings.Repeat("x", maxErrorBodyLen+100),
+			message: "",
+			excerpt: strings.Repeat("x", maxErrorBodyLen) + "...",
+		},
+	}
+
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		w.WriteHeader(tc.status)
+		w.WriteString(tc.body)
+
+		e := newHTTPError(w.Result())
+		if e.StatusCode != tc.status {
+			t.Errorf("%q: got status %d, wanted %d", tc.body, e.StatusCode, tc.status)
+		}
+		if e.Message != tc.message {
+			t.Errorf("%q: got message %q, wanted %q", tc.body, e.Message, tc.message)
+		}
+		if e.Body != tc.excerpt {
+			t.Errorf("%q: got body %q, wanted %q", tc.body, e.Body, tc.excerpt)
+		}
+	}
+}
+
+func TestRowsFetchHTTPError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upstream connect error", http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	r := &rows{
+		conn: &conn{
+			client: http.DefaultClient,
+		},
+		queryID: "abcd",
+		nextURI: strings.Replace(ts.URL, "http://", "http://name:pwd@", 1) + "/v1/query/abcd/1",
+	}
+
+	err := r.fetch()
+	if !errors.Is(err, ErrQueryFailed) {
+		t.Errorf("errors.Is(%v, ErrQueryFailed) = false, wanted true", err)
+	}
+	e, ok := err.(*HTTPError)
+	if !ok {
+		t.Fatalf("got error %#v, wanted an *HTTPError", err)
+	}
+	if e.StatusCode != http.StatusBadGateway {
+		t.Errorf("got status %d, wanted %d", e.StatusCode, http.StatusBadGateway)
+	}
+	if want := ts.URL + "/v1/query/abcd/1"; e.URL != want {
+		t.Errorf("got url %q, wanted %q", e.URL, want)
+	}
+	if e.QueryID != "abcd" {
+		t.Errorf("got query id %q, wanted abcd", e.QueryID)
+	}
+	if want := "prestgo: query failed: http status 502 from " + ts.URL + "/v1/query/abcd/1: upstream connect error (query abcd)"; e.Error() != want {
+		t.Errorf("got %q, wanted %q", e.Error(), want)
+	}
+}
+
+var badValueResponse = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	columns := `"columns": [
+	  { "name": "col0", "type": "varchar", "typeSignature": { "rawType": "varchar", "arguments": [] } },
+	  { "name": "col1", "type": "array(bigint)", "typeSignature": { "rawType": "array", "arguments": [ { "kind": "TYPE", "value": { "rawType": "bigint", "arguments": [] } } ] } }
+	]`
+	switch r.URL.Path {
+	case "/v1/query/abcd/1":
+		fmt.Fprintf(w, `{ "id": "abcd", "nextUri": "http://%s/v1/query/abcd/2", %s, "data": [ [ "c0r0", [1] ] ] }`, r.Host, columns)
+	case "/v1/query/abcd/2":
+		fmt.Fprintf(w, `{ "id": "abcd", %s, "data": [ [ "c0r1", [2] ], [ "c0r2", ["%s"] ] ] }`, columns, strings.Repeat("x", 100))
+	default:
+		http.NotFound(w, r)
+	}
+})
+
+func TestRowsNextConversionError(t *testing.T) {
+	ts := httptest.NewServer(badValueResponse)
+	defer ts.Close()
+
+	r := &rows{
+		conn: &conn{
+			client: http.DefaultClient,
+		},
+		nextURI: ts.URL + "/v1/query/abcd/1",
+	}
+
+	values := make([]driver.Value, 2)
+	var err error
+	for err == nil {
+		err = r.Next(values)
+	}
+
+	e, ok := err.(*ConversionError)
+	if !ok {
+		t.Fatalf("got error %#v, wanted a *ConversionError", err)
+	}
+	if e.Column != "col1" || e.Type != "array(bigint)" || e.Row != 2 {
+		t.Errorf("got column %q, type %q, row %d, wanted col1, array(bigint), 2", e.Column, e.Type, e.Row)
+	}
+	if expected := `["` + strings.Repeat("x", maxErrorValueLen-2) + "..."; e.Value != expected {
+		t.Errorf("got value %q, wanted %q", e.Value, expected)
+	}
+	if e.Err == nil || e.Unwrap() != e.Err {
+		t.Errorf("got underlying error %v", e.Err)
+	}
+	if msg := err.Error(); !strings.HasPrefix(msg, "prestgo: cannot convert value [\"xxx") || !strings.Contains(msg, "in column col1 of type array(bigint) at row 2: failed to convert") {
+		t.Errorf("got message %q", msg)
+	}
+}
+
+var queryErrorResponse = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/v1/statement":
+		body, _ := ioutil.ReadAll(r.Body)
+		if strings.HasPrefix(string(body), "SELEC ") {
+			fmt.Fprintf(w, `{
+			  "id": "abcd",
+			  "infoUri": "http://%[1]s/v1/query/abcd",
+			  "stats": {"state": "FAILED"},
+			  "error": {
+			    "message": "line 1:1: mismatched input 'SELEC'",
+			    "errorCode": 1,
+			    "errorName": "SYNTAX_ERROR",
+			    "errorType": "USER_ERROR",
+			    "errorLocation": {"lineNumber": 1, "columnNumber": 1},
+			    "failureInfo": {"type": "com.facebook.presto.sql.parser.ParsingException", "message": "line 1:1: mismatched input 'SELEC'"}
+			  }
+			}`, r.Host)
+			return
+		}
+		fmt.Fprintf(w, `{
+		  "id": "abcd",
+		  "infoUri": "http://%[1]s/v1/query/abcd",
+		  "nextUri": "http://%[1]s/v1/query/abcd/1",
+		  "stats": {"state": "QUEUED"}
+		}`, r.Host)
+	case "/v1/query/abcd/1":
+		fmt.Fprintf(w, `{
+		  "id": "abcd",
+		  "infoUri": "http://%[1]s/v1/query/abcd",
+		  "stats": {"state": "FAILED", "peakMemoryBytes": 1181116006, "cpuTimeMillis": 5000, "elapsedTimeMillis": 2500},
+		  "error": {
+		    "message": "Query exceeded per-node user memory limit of 1GB",
+		    "errorCode": 131079,
+		    "errorName": "EXCEEDED_LOCAL_MEMORY_LIMIT",
+		    "errorType": "INSUFFICIENT_RESOURCES",
+		    "failureInfo": {"type": "com.facebook.presto.ExceededMemoryLimitException", "message": "Query exceeded per-node user memory limit of 1GB"}
+		  }
+		}`, r.Host)
+	default:
+		http.NotFound(w, r)
+	}
+})
+
+func TestQueryError(t *testing.T) {
+	ts := httptest.NewServer(queryErrorResponse)
+	defer ts.Close()
+
+	testCases := []struct {
+		query    string
+		expected *Error
+		message  string
+	}{
+		{
+			query: "SELEC 1",
+			expected: &Error{
+				Message:       "line 1:1: mismatched input 'SELEC'",
+				ErrorCode:     1,
+				ErrorName:     "SYNTAX_ERROR",
+				ErrorType:     "USER_ERROR",
+				ErrorLocation: &ErrorLocation{LineNumber: 1, ColumnNumber: 1},
+				FailureInfo:   &FailureInfo{Type: "com.facebook.presto.sql.parser.ParsingException", Message: "line 1:1: mismatched input 'SELEC'"},
+				QueryID:       "abcd",
+				InfoURI:       ts.URL + "/v1/query/abcd",
+			},
+			message: "prestgo: query failed: SYNTAX_ERROR: line 1:1: mismatched input 'SELEC' (query abcd, " + ts.URL + "/v1/query/abcd)",
+		},
+		{
+			query: "SELECT * FROM big",
+			expected: &Error{
+				Message:     "Query exceeded per-node user memory limit of 1GB",
+				ErrorCode:   131079,
+				ErrorName:   "EXCEEDED_LOCAL_MEMORY_LIMIT",
+				ErrorType:   "INSUFFICIENT_RESOURCES",
+				FailureInfo: &FailureInfo{Type: "com.facebook.presto.ExceededMemoryLimitException", Message: "Query exceeded per-node user memory limit of 1GB"},
+				QueryID:     "abcd",
+				InfoURI:     ts.URL + "/v1/query/abcd",
+
+				PeakMemoryBytes: 1181116006,
+				CPUTime:         5 * time.Second,
+				ElapsedTime:     2500 * time.Millisecond,
+				Hint:            "peak memory 1.10GB, raise the query_max_memory_per_node session property to allow more",
+			},
+			message: "prestgo: query failed: EXCEEDED_LOCAL_MEMORY_LIMIT: Query exceeded per-node user memory limit of 1GB; peak memory 1.10GB, raise the query_max_memory_per_node session property to allow more (query abcd, " + ts.URL + "/v1/query/abcd)",
+		},
+	}
+
+	// Failures carry the query's stats even when they are not otherwise decoded
+	for _, params := range []string{"", "?skip_stats=true"} {
+		cn, err := ClientOpen(http.DefaultClient, "presto://"+ts.Listener.Addr().String()+"/hive/default"+params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tc := range testCases {
+			st, err := cn.Prepare(tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err := st.Query(nil)
+			if err == nil {
+				err = r.Next(make([]driver.Value, 1))
+			}
+
+			e, ok := err.(*Error)
+			if !ok {
+				t.Errorf("%s%s: got error %#v, wanted a *Error", tc.query, params, err)
+				continue
+			}
+			if !reflect.DeepEqual(e, tc.expected) {
+				t.Errorf("%s%s: got %#v, wanted %#v", tc.query, params, e, tc.expected)
+			}
+			if e.Error() != tc.message {
+				t.Errorf("%s%s: got message %q, wanted %q", tc.query, params, e.Error(), tc.message)
+			}
+		}
+	}
+}
+
+func TestErrorIs(t *testing.T) {
+	testCases := []struct {
+		err      *Error
+		matches  []error
+		excludes []error
+	}{
+		{
+			err:      &Error{ErrorName: "SYNTAX_ERROR", ErrorType: "USER_ERROR"},
+			matches:  []error{ErrSyntax, ErrUserError},
+			excludes: []error{ErrPermissionDenied, ErrInternalError, ErrQueryFailed},
+		},
+		{
+			err:      &Error{ErrorName: "EXCEEDED_LOCAL_MEMORY_LIMIT", ErrorType: "INSUFFICIENT_RESOURCES"},
+			matches:  []error{ErrExceededMemoryLimit, ErrInsufficientResources},
+			excludes: []error{ErrUserError, ErrSyntax},
+		},
+		{
+			err:      &Error{ErrorName: "TABLE_NOT_FOUND", ErrorType: "USER_ERROR"},
+			matches:  []error{ErrTableNotFound, ErrUserError},
+			excludes: []error{ErrSchemaNotFound, ErrColumnNotFound},
+		},
+		{
+			err:      &Error{ErrorName: "MISSING_TABLE", ErrorType: "USER_ERROR"},
+			matches:  []error{ErrTableNotFound},
+			excludes: []error{ErrCatalogNotFound},
+		},
+		{
+			err:      &Error{ErrorName: "GENERIC_INTERNAL_ERROR", ErrorType: "INTERNAL_ERROR"},
+			matches:  []error{ErrInternalError},
+			excludes: []error{ErrExternal, ErrUserError},
+		},
+		{
+			err:      &Error{Message: "no code"},
+			excludes: []error{ErrUserError, ErrInternalError, ErrSyntax, nil},
+		},
+	}
+
+	for _, tc := range testCases {
+		// Wrapped to check that the error is found in a chain
+		err := fmt.Errorf("running report: %w", tc.err)
+		for _, target := range tc.matches {
+			if !errors.Is(err, target) {
+				t.Errorf("%s: errors.Is(%v) = false, wanted true", tc.err.ErrorName, target)
+			}
+		}
+		for _, target := range tc.excludes {
+			if errors.Is(err, target) {
+				t.Errorf("%s: errors.Is(%v) = true, wanted false", tc.err.ErrorName, target)
+			}
+		}
+
+		var e *Error
+		if !errors.As(err, &e) || e != tc.err {
+			t.Errorf("%s: errors.As did not find the *Error", tc.err.ErrorName)
+		}
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryable(t *testing.T) {
+	testCases := []struct {
+		err       error
+		retryable bool
+	}{
+		{err: &Error{ErrorName: "SERVER_SHUTTING_DOWN", ErrorType: "INTERNAL_ERROR"}, retryable: true},
+		{err: &Error{ErrorName: "REMOTE_HOST_GONE", ErrorType: "INTERNAL_ERROR"}, retryable: true},
+		{err: &Error{ErrorName: "PAGE_TRANSPORT_TIMEOUT", ErrorType: "INTERNAL_ERROR"}, retryable: true},
+		{err: &Error{ErrorName: "QUERY_QUEUE_FULL", ErrorType: "INSUFFICIENT_RESOURCES"}, retryable: true},
+		{err: fmt.Errorf("report: %w", &Error{ErrorName: "NO_NODES_AVAILABLE"}), retryable: true},
+		{err: &Error{ErrorName: "SYNTAX_ERROR", ErrorType: "USER_ERROR"}, retryable: false},
+		{err: &Error{ErrorName: "PERMISSION_DENIED", ErrorType: "USER_ERROR"}, retryable: false},
+		{err: &Error{ErrorName: "EXCEEDED_LOCAL_MEMORY_LIMIT", ErrorType: "INSUFFICIENT_RESOURCES"}, retryable: false},
+		{err: &HTTPError{StatusCode: http.StatusServiceUnavailable}, retryable: true},
+		{err: &HTTPError{StatusCode: http.StatusBadGateway}, retryable: true},
+		{err: &HTTPError{StatusCode: http.StatusUnauthorized}, retryable: false},
+		{err: &url.Error{Op: "Get", URL: "http://example", Err: timeoutError{}}, retryable: true},
+		{err: &url.Error{Op: "Get", URL: "http://example", Err: context.DeadlineExceeded}, retryable: false},
+		{err: context.Canceled, retryable: false},
+		{err: &ConversionError{Err: errors.New("bad value")}, retryable: false},
+		{err: nil, retryable: false},
+	}
+
+	for _, tc := range testCases {
+		if IsRetryable(tc.err) != tc.retryable {
+			t.Errorf("%v: got retryable %v, wanted %v", tc.err, !tc.retryable, tc.retryable)
+		}
+	}
+}
+
+func TestRowsFetchCanceledByServer(t *testing.T) {
+	testCases := []struct {
+		body    string
+		reason  string
+		message string
+	}{
+		{
+			body:    `{"id": "abcd", "stats": {"state": "CANCELED"}}`,
+			message: "prestgo: query canceled by server (query abcd)",
+		},
+		{
+			body:    `{"id": "abcd", "stats": {"state": "FAILED"}, "error": {"message": "Query killed. Message: too slow", "errorName": "ADMINISTRATIVELY_KILLED", "errorType": "USER_ERROR"}}`,
+			reason:  "Query killed. Message: too slow",
+			message: "prestgo: query canceled by server: Query killed. Message: too slow (query abcd)",
+		},
+	}
+
+	for _, tc := range testCases {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, tc.body)
+		}))
+
+		r := &rows{
+			conn: &conn{
+				client: http.DefaultClient,
+			},
+			nextURI: ts.URL + "/v1/query/abcd/1",
+		}
+		err := r.fetch()
+		ts.Close()
+
+		e, ok := err.(*CanceledByServerError)
+		if !ok {
+			t.Errorf("%s: got error %#v, wanted a *CanceledByServerError", tc.body, err)
+			continue
+		}
+		if e.Reason != tc.reason || e.QueryID != "abcd" {
+			t.Errorf("%s: got reason %q, query %q", tc.body, e.Reason, e.QueryID)
+		}
+		if e.Error() != tc.message {
+			t.Errorf("%s: got message %q, wanted %q", tc.body, e.Error(), tc.message)
+		}
+		if !errors.Is(err, ErrQueryCanceled) {
+			t.Errorf("%s: errors.Is(err, ErrQueryCanceled) = false, wanted true", tc.body)
+		}
+		if errors.Is(err, context.Canceled) {
+			t.Errorf("%s: errors.Is(err, context.Canceled) = true, wanted false", tc.body)
+		}
+	}
+}
+
+func TestRowsFetchCanceledByClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	r := &rows{
+		conn: &conn{
+			client: http.DefaultClient,
+		},
+		ctx:     ctx,
+		nextURI: ts.URL + "/v1/query/abcd/1",
+	}
+
+	if err := r.fetch(); err != context.Canceled {
+		t.Errorf("got error %#v, wanted context.Canceled", err)
+	}
+}
+
+func TestDeadlineExceeded(t *testing.T) {
+	serverLimit := &Error{Message: "Query exceeded maximum time limit of 1.00m", ErrorName: "EXCEEDED_TIME_LIMIT", ErrorType: "INSUFFICIENT_RESOURCES"}
+	if !errors.Is(serverLimit, context.DeadlineExceeded) {
+		t.Errorf("errors.Is(%v, context.DeadlineExceeded) = false, wanted true", serverLimit)
+	}
+	if other := (&Error{ErrorName: "EXCEEDED_CPU_LIMIT"}); errors.Is(other, context.DeadlineExceeded) {
+		t.Errorf("errors.Is(%v, context.DeadlineExceeded) = true, wanted false", other)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	r := &rows{
+		conn: &conn{
+			client: http.DefaultClient,
+		},
+		ctx:     ctx,
+		nextURI: ts.URL + "/v1/query/abcd/1",
+	}
+	if err := r.fetch(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %#v, wanted context.DeadlineExceeded", err)
+	}
+}
+
+func TestErrorCauses(t *testing.T) {
+	body := `{
+	  "message": "Error opening Hive split",
+	  "errorName": "HIVE_CANNOT_OPEN_SPLIT",
+	  "errorType": "EXTERNAL",
+	  "failureInfo": {
+	    "type": "com.facebook.presto.spi.PrestoException",
+	    "message": "Error opening Hive split",
+	    "stack": ["com.facebook.presto.hive.HivePageSourceProvider.createPageSource(HivePageSourceProvider.java:123)"],
+	    "suppressed": [{"type": "java.io.IOException", "message": "close failed", "suppressed": [], "stack": []}],
+	    "cause": {
+	      "type": "java.io.FileNotFoundException",
+	      "message": "File does not exist: /warehouse/t/part-0",
+	      "suppressed": [],
+	      "stack": [],
+	      "cause": {"type": "java.net.ConnectException", "message": "Connection refused", "suppressed": [], "stack": []}
+	    }
+	  }
+	}`
+
+	var e *Error
+	if err := json.Unmarshal([]byte(body), &e); err != nil {
+		t.Fatal(err)
+	}
+
+	causes := e.Causes()
+	types := make([]string, len(causes))
+	for i, c := range causes {
+		types[i] = c.Type
+	}
+	expected := []string{"com.facebook.presto.spi.PrestoException", "java.io.FileNotFoundException", "java.net.ConnectException"}
+	if !reflect.DeepEqual(types, expected) {
+		t.Errorf("got causes %q, wanted %q", types, expected)
+	}
+	if len(causes[0].Stack) != 1 || len(causes[0].Suppressed) != 1 || causes[0].Suppressed[0].Message != "close failed" {
+		t.Errorf("got stack %q and suppressed %#v", causes[0].Stack, causes[0].Suppressed)
+	}
+
+	var f *FailureInfo
+	if !errors.As(e, &f) || f != causes[0] {
+		t.Errorf("errors.As did not find the failure info")
+	}
+
+	root := causes[len(causes)-1]
+	var err error = e
+	for next := errors.Unwrap(err); next != nil; next = errors.Unwrap(err) {
+		err = next
+	}
+	if err != root {
+		t.Errorf("got root cause %v, wanted %v", err, root)
+	}
+	if want := "java.net.ConnectException: Connection refused"; root.Error() != want {
+		t.Errorf("got message %q, wanted %q", root.Error(), want)
+	}
+
+	if (&Error{}).Causes() != nil || (&Error{}).Unwrap() != nil {
+		t.Error("got causes for an error without failure info")
+	}
+}
+
+func TestErrorAddStats(t *testing.T) {
+	testCases := []struct {
+		name  string
+		stats stmtStats
+		hint  string
+	}{
+		{
+			name:  "EXCEEDED_GLOBAL_MEMORY_LIMIT",
+			stats: stmtStats{PeakMemoryBytes: 20 << 30},
+			hint:  "peak memory 20.00GB, raise the query_max_memory session property to allow more",
+		},
+		{
+			name:  "EXCEEDED_TIME_LIMIT",
+			stats: stmtStats{ElapsedMillis: 61500},
+			hint:  "elapsed time 1m1.5s, raise the query_max_execution_time session property to allow more",
+		},
+		{
+			name:  "EXCEEDED_CPU_LIMIT",
+			stats: stmtStats{CPUTimeMillis: 3600000},
+			hint:  "CPU time 1h0m0s, raise the query_max_cpu_time session property to allow more",
+		},
+		{
+			name: "EXCEEDED_LOCAL_MEMORY_LIMIT",
+			hint: "raise the query_max_memory_per_node session property to allow more",
+		},
+		{
+			name: "CLUSTER_OUT_OF_MEMORY",
+			hint: "the cluster ran out of memory, retry when it is less busy or reduce the memory the query needs",
+		},
+		{
+			name:  "SYNTAX_ERROR",
+			stats: stmtStats{PeakMemoryBytes: 100},
+			hint:  "",
+		},
+	}
+
+	for _, tc := range testCases {
+		e := &Error{ErrorName: tc.name}
+		e.addStats(tc.stats)
+		if e.Hint != tc.hint {
+			t.Errorf("%s: got hint %q, wanted %q", tc.name, e.Hint, tc.hint)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	testCases := []struct {
+		n        int64
+		expected string
+	}{
+		{n: 0, expected: "0B"},
+		{n: 1023, expected: "1023B"},
+		{n: 1536, expected: "1.50kB"},
+		{n: 1 << 30, expected: "1.00GB"},
+		{n: 3 << 50, expected: "3.00PB"},
+	}
+
+	for _, tc := range testCases {
+		if s := formatBytes(tc.n); s != tc.expected {
+			t.Errorf("%d: got %q, wanted %q", tc.n, s, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package prestgo
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+)
+
+// exec runs the statement to completion, reading its results without converting them. When
+// the connection splits statements each of those in the text is run in turn, stopping at the
+// first that fails.
+func (s *stmt) exec(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	stmts := []string{s.query}
+	if s.conn.multiStatement {
+		if split := splitStatements(s.query); len(split) > 0 {
+			stmts = split
+		}
+	}
+
+	res := &result{}
+	for i, query := range stmts {
+		if i > 0 {
+			args = nil
+		}
+		st := &stmt{conn: s.conn, query: query}
+		r, err := st.run(ctx, args)
+		if err != nil {
+			return nil, err
+		}
+		rs := r.(*rows)
+		err = rs.drain()
+		rs.Close()
+		if err != nil {
+			return nil, err
+		}
+		res.rowsAffected += rs.updateCount
+		res.updateType = rs.updateType
+	}
+	return res, nil
+}
+
+// drain reads the results without converting them until the outcome of the statement is
+// known. Statements such as CREATE TABLE send no columns or data, only the pages that lead
+// to their final state, so these are followed until the server reports the end. Once the
+// statement has finished or reported the rows it changed, or is a read-only query whose
+// rows would only be discarded, the rest of its results are not read and the query is
+// canceled, so that the connection is not kept busy downloading them.
+func (r *rows) drain() error {
+	if r.done {
+		return nil
+	}
+	r.draining = true
+	for r.nextURI != "" && !r.settled() {
+		if err := r.fetch(); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	if r.nextURI != "" && r.run != nil {
+		r.conn.cancelOnServer(r.nextURI)
+		r.nextURI = ""
+		r.run.setNextURI("")
+	}
+	r.finish(io.EOF)
+	return nil
+}
+
+// settled reports whether enough of the results of a statement being drained have been
+// read to know its outcome.
+func (r *rows) settled() bool {
+	switch {
+	case r.counted, r.stats.State == "FINISHED":
+		return true
+	case r.updateType == "" && r.pageLen() > 0:
+		// Rows are being returned by a query that changes nothing
+		return r.run != nil && isReadOnly(r.run.query)
+	}
+	return false
+}
+
+// UpdateTypeReporter is implemented by the driver.Rows and driver.Result returned by the
+// driver, allowing callers with access to them, such as through the driver connection given
+// by the Raw method of sql.Conn, to tell what kind of statement the server ran. Generic SQL
+// runners can use it to decide whether to show rows or a count of those changed.
+type UpdateTypeReporter interface {
+	// UpdateType returns the kind of statement run as reported by the server, such as
+	// "INSERT", "CREATE TABLE" or "SET SESSION", or "" for a query returning rows. It is
+	// known once the first page of results has been received.
+	UpdateType() string
+}
+
+var (
+	_ UpdateTypeReporter = &rows{}
+	_ UpdateTypeReporter = &result{}
+)
+
+// UpdateType returns the kind of statement run as reported by the server.
+func (r *rows) UpdateType() string {
+	return r.updateType
+}
+
+// result is the driver.Result of statements run with Exec.
+type result struct {
+	rowsAffected int64  // rows changed by the statements, as reported by the server
+	updateType   string // kind of the last statement run, as reported by the server
+}
+
+// UpdateType returns the kind of the last statement run, as reported by the server.
+func (r *result) UpdateType() string {
+	return r.updateType
+}
+
+// LastInsertId returns ErrNotSupported, since Presto tables have no generated IDs.
+func (r *result) LastInsertId() (int64, error) {
+	return 0, ErrNotSupported
+}
+
+// RowsAffected returns the number of rows the statements changed, such as those written by
+// an INSERT. It is zero for statements that report no count, such as CREATE TABLE.
+func (r *result) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
@@ -0,0 +1,310 @@
+package prestgo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStmtExecDDL(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/v1/statement" {
+			body, _ := ioutil.ReadAll(r.Body)
+			requests = append(requests, string(body))
+			fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%s/v1/query/abcd/1", "stats": {"state": "QUEUED"}}`, r.Host)
+			return
+		}
+		requests = append(requests, r.URL.Path)
+		var page int
+		fmt.Sscanf(r.URL.Path, "/v1/query/abcd/%d", &page)
+		if page < 3 {
+			fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%s/v1/query/abcd/%d", "updateType": "CREATE TABLE", "stats": {"state": "RUNNING"}}`, r.Host, page+1)
+			return
+		}
+		fmt.Fprint(w, `{"id": "abcd", "updateType": "CREATE TABLE", "stats": {"state": "FINISHED"}}`)
+	}))
+	defer ts.Close()
+
+	cn := &conn{client: http.DefaultClient, addr: ts.Listener.Addr().String()}
+	s := &stmt{conn: cn, query: "CREATE TABLE t (col0 bigint)"}
+	res, err := s.ExecContext(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 0 {
+		t.Errorf("got %d rows affected with error %v, wanted 0", n, err)
+	}
+	if typ := res.(UpdateTypeReporter).UpdateType(); typ != "CREATE TABLE" {
+		t.Errorf("got update type %q, wanted CREATE TABLE", typ)
+	}
+	if _, err := res.LastInsertId(); err != ErrNotSupported {
+		t.Errorf("got error %v from LastInsertId, wanted %v", err, ErrNotSupported)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{"CREATE TABLE t (col0 bigint)", "/v1/query/abcd/1", "/v1/query/abcd/2", "/v1/query/abcd/3"}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Errorf("got requests\n%s\nwanted\n%s", strings.Join(requests, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestStmtExecFailed(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/statement" {
+			fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%s/v1/query/abcd/1", "stats": {"state": "QUEUED"}}`, r.Host)
+			return
+		}
+		fmt.Fprint(w, `{
+		  "id": "abcd",
+		  "stats": {"state": "FAILED"},
+		  "error": {
+		    "message": "line 1:1: Table 'hive.default.t' already exists",
+		    "errorCode": 22,
+		    "errorName": "ALREADY_EXISTS",
+		    "errorType": "USER_ERROR"
+		  }
+		}`)
+	}))
+	defer ts.Close()
+
+	cn := &conn{client: http.DefaultClient, addr: ts.Listener.Addr().String()}
+	s := &stmt{conn: cn, query: "CREATE TABLE t (col0 bigint)"}
+	_, err := s.Exec(nil)
+	perr, ok := err.(*Error)
+	if !ok || perr.ErrorName != "ALREADY_EXISTS" {
+		t.Errorf("got error %v, wanted ALREADY_EXISTS", err)
+	}
+}
+
+func TestExecUnknownType(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/statement" {
+			fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%s/v1/query/abcd/1", "stats": {"state": "QUEUED"}}`, r.Host)
+			return
+		}
+		fmt.Fprint(w, `{
+		  "id": "abcd",
+		  "columns": [ { "name": "shape", "type": "geometry", "typeSignature": { "rawType": "geometry", "arguments": [] } } ],
+		  "data": [ [ "POINT (1 2)" ] ],
+		  "stats": {"state": "FINISHED"}
+		}`)
+	}))
+	defer ts.Close()
+
+	db, err := sql.Open(DriverName, "presto://"+ts.Listener.Addr().String()+"/hive/default?unknown_types=error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// The rows are discarded without being converted, so the type needs no converter
+	if _, err := db.Exec("SELECT ST_Point(1, 2) AS shape"); err != nil {
+		t.Errorf("got error %v from Exec, wanted none", err)
+	}
+	// Reading the rows still fails on the unsupported type
+	if err := db.QueryRow("SELECT ST_Point(1, 2) AS shape").Scan(new(string)); err == nil {
+		t.Errorf("got no error from Query, wanted the unsupported type")
+	}
+}
+
+func TestExecStopsOnceSettled(t *testing.T) {
+	testCases := []struct {
+		name     string
+		query    string
+		page     string // sent for every page, followed by the URI of the next
+		affected int64
+		expected []string
+	}{
+		{
+			name:     "update count",
+			query:    "INSERT INTO t SELECT * FROM s",
+			page:     `"updateType": "INSERT", "updateCount": 7, "stats": {"state": "RUNNING"}`,
+			affected: 7,
+			expected: []string{"GET /v1/query/abcd/1", "GET /v1/query/abcd/2", "DELETE /v1/query/abcd/3"},
+		},
+		{
+			name:     "finished",
+			query:    "CREATE TABLE t (col0 bigint)",
+			page:     `"updateType": "CREATE TABLE", "stats": {"state": "FINISHED"}`,
+			expected: []string{"GET /v1/query/abcd/1", "GET /v1/query/abcd/2", "DELETE /v1/query/abcd/3"},
+		},
+		{
+			name:     "read-only rows",
+			query:    "SELECT * FROM t",
+			page:     `"columns": [ { "name": "col0", "type": "bigint", "typeSignature": { "rawType": "bigint", "arguments": [] } } ], "data": [ [ 1 ], [ 2 ] ], "stats": {"state": "RUNNING"}`,
+			expected: []string{"GET /v1/query/abcd/1", "GET /v1/query/abcd/2", "DELETE /v1/query/abcd/3"},
+		},
+	}
+
+	for _, tc := range testCases {
+		var mu sync.Mutex
+		var requests []string
+		deleted := make(chan struct{})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v1/statement" {
+				fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%s/v1/query/abcd/1", "stats": {"state": "QUEUED"}}`, r.Host)
+				return
+			}
+			mu.Lock()
+			requests = append(requests, r.Method+" "+r.URL.Path)
+			mu.Unlock()
+			if r.Method == "DELETE" {
+				close(deleted)
+				return
+			}
+			var page int
+			fmt.Sscanf(r.URL.Path, "/v1/query/abcd/%d", &page)
+			if page == 1 {
+				// The first page leads to the statement's results
+				fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%s/v1/query/abcd/2", "stats": {"state": "RUNNING"}}`, r.Host)
+				return
+			}
+			fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%s/v1/query/abcd/%d", %s}`, r.Host, page+1, tc.page)
+		}))
+
+		cn := &conn{client: http.DefaultClient, addr: ts.Listener.Addr().String()}
+		s := &stmt{conn: cn, query: tc.query}
+		res, err := s.ExecContext(context.Background(), nil)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		} else if n, _ := res.RowsAffected(); n != tc.affected {
+			t.Errorf("%s: got %d rows affected, wanted %d", tc.name, n, tc.affected)
+		}
+		select {
+		case <-deleted:
+		case <-time.After(time.Second):
+			t.Errorf("%s: query not canceled", tc.name)
+		}
+		ts.Close()
+
+		mu.Lock()
+		if !reflect.DeepEqual(requests, tc.expected) {
+			t.Errorf("%s: got requests %q, wanted %q", tc.name, requests, tc.expected)
+		}
+		mu.Unlock()
+	}
+}
+
+func TestExecInsertRowsAffected(t *testing.T) {
+	var mu sync.Mutex
+	statements := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/v1/statement" {
+			statements++
+			fmt.Fprintf(w, `{"id": "q%d", "nextUri": "http://%s/v1/query/q%[1]d/1", "stats": {"state": "QUEUED"}}`, statements, r.Host)
+			return
+		}
+		var n, page int
+		fmt.Sscanf(r.URL.Path, "/v1/query/q%d/%d", &n, &page)
+		if page == 1 {
+			fmt.Fprintf(w, `{
+			  "id": "q%d",
+			  "nextUri": "http://%s/v1/query/q%[1]d/2",
+			  "columns": [ { "name": "rows", "type": "bigint", "typeSignature": { "rawType": "bigint", "arguments": [] } } ],
+			  "data": [ [ %[1]d ] ],
+			  "updateType": "INSERT",
+			  "updateCount": %[1]d,
+			  "stats": {"state": "RUNNING"}
+			}`, n, r.Host)
+			return
+		}
+		fmt.Fprintf(w, `{
+		  "id": "q%d",
+		  "columns": [ { "name": "rows", "type": "bigint", "typeSignature": { "rawType": "bigint", "arguments": [] } } ],
+		  "updateType": "INSERT",
+		  "updateCount": %[1]d,
+		  "stats": {"state": "FINISHED"}
+		}`, n)
+	}))
+	defer ts.Close()
+
+	db, err := sql.Open(DriverName, "presto://"+ts.Listener.Addr().String()+"/hive/default?multi_statement=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	res, err := db.Exec("INSERT INTO t VALUES 1; INSERT INTO t VALUES 2, 3;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 3 {
+		t.Errorf("got %d rows affected with error %v, wanted 3", n, err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if statements != 2 {
+		t.Errorf("got %d statements, wanted 2", statements)
+	}
+}
+
+func TestRowsUpdateType(t *testing.T) {
+	testCases := []struct {
+		body     string
+		expected string
+	}{
+		{
+			body: `{
+			  "id": "abcd",
+			  "columns": [ { "name": "col0", "type": "bigint", "typeSignature": { "rawType": "bigint", "arguments": [] } } ],
+			  "data": [ [ 1 ] ],
+			  "stats": {"state": "FINISHED"}
+			}`,
+			expected: "",
+		},
+		{
+			body: `{
+			  "id": "abcd",
+			  "columns": [ { "name": "rows", "type": "bigint", "typeSignature": { "rawType": "bigint", "arguments": [] } } ],
+			  "data": [ [ 1 ] ],
+			  "updateType": "INSERT",
+			  "updateCount": 1,
+			  "stats": {"state": "FINISHED"}
+			}`,
+			expected: "INSERT",
+		},
+		{
+			body:     `{"id": "abcd", "updateType": "SET SESSION", "stats": {"state": "FINISHED"}}`,
+			expected: "SET SESSION",
+		},
+	}
+
+	for _, tc := range testCases {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v1/statement" {
+				fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%s/v1/query/abcd/1", "stats": {"state": "QUEUED"}}`, r.Host)
+				return
+			}
+			fmt.Fprint(w, tc.body)
+		}))
+
+		cn := &conn{client: http.DefaultClient, addr: ts.Listener.Addr().String()}
+		s := &stmt{conn: cn, query: "SELECT 1"}
+		r, err := s.QueryContext(context.Background(), nil)
+		if err != nil {
+			ts.Close()
+			t.Fatal(err)
+		}
+		r.Columns()
+		if typ := r.(UpdateTypeReporter).UpdateType(); typ != tc.expected {
+			t.Errorf("got update type %q, wanted %q", typ, tc.expected)
+		}
+		r.Close()
+		ts.Close()
+	}
+}
@@ -0,0 +1,278 @@
+package prestgo
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ExplainType selects the plan returned by Explain.
+type ExplainType int
+
+const (
+	// ExplainLogical is the logical plan of the query, as a single tree of nodes.
+	ExplainLogical ExplainType = iota
+
+	// ExplainDistributed is the plan of the query split into the fragments run by the
+	// stages of the cluster.
+	ExplainDistributed
+
+	// ExplainAnalyze runs the query and returns its distributed plan with the cost of each
+	// node, on servers supporting EXPLAIN ANALYZE in JSON format.
+	ExplainAnalyze
+)
+
+// explainStatements gives the statement that explains a query for each ExplainType.
+var explainStatements = map[ExplainType]string{
+	ExplainLogical:     "EXPLAIN (TYPE LOGICAL, FORMAT JSON) ",
+	ExplainDistributed: "EXPLAIN (TYPE DISTRIBUTED, FORMAT JSON) ",
+	ExplainAnalyze:     "EXPLAIN ANALYZE (FORMAT JSON) ",
+}
+
+// Plan is the plan of a query returned by Explain.
+type Plan struct {
+	// Root is the root of the plan, or of the fragment producing the query's results for a
+	// distributed plan.
+	Root *PlanNode
+
+	// Fragments holds the root of each fragment of a distributed plan by fragment ID. It is
+	// nil for a logical plan.
+	Fragments map[string]*PlanNode
+}
+
+// PlanNode is a node of a query plan. Presto describes the arguments of a node in
+// Identifier and Trino in Descriptor, so which is set depends on the server.
+type PlanNode struct {
+	ID            string
+	Name          string            // Kind of node, e.g. TableScan, Aggregate or InnerJoin.
+	Identifier    string            // Arguments of the node, e.g. the table scanned.
+	Descriptor    map[string]string // Arguments of the node by name.
+	Details       []string          // Lines describing the node's expressions and layout.
+	Outputs       []PlanOutput      // Symbols produced by the node.
+	Estimates     []PlanEstimate    // Estimated size and cost of the node's output.
+	RemoteSources []string          // IDs of the fragments a remote source reads.
+	Children      []*PlanNode
+}
+
+// PlanOutput is a symbol produced by a PlanNode.
+type PlanOutput struct {
+	Symbol string
+	Type   string
+}
+
+// PlanEstimate is the estimated size and cost of the output of a PlanNode. Values the
+// optimizer could not estimate are NaN.
+type PlanEstimate struct {
+	OutputRowCount    float64
+	OutputSizeInBytes float64
+	CPUCost           float64
+	MemoryCost        float64
+	NetworkCost       float64
+}
+
+// Walk calls fn with each node of the plan, depth first and fragment by fragment in order of
+// their IDs, until fn returns false. Guard-rails such as rejecting queries that scan whole
+// tables can be built on it.
+func (p *Plan) Walk(fn func(*PlanNode) bool) {
+	if p.Fragments == nil {
+		p.Root.walk(fn)
+		return
+	}
+	ids := make([]string, 0, len(p.Fragments))
+	for id := range p.Fragments {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		// Fragment IDs are numbers, so order shorter IDs first
+		if len(ids[i]) != len(ids[j]) {
+			return len(ids[i]) < len(ids[j])
+		}
+		return ids[i] < ids[j]
+	})
+	for _, id := range ids {
+		if !p.Fragments[id].walk(fn) {
+			return
+		}
+	}
+}
+
+// walk calls fn with n and its descendants, reporting whether fn returned true for all.
+func (n *PlanNode) walk(fn func(*PlanNode) bool) bool {
+	if n == nil {
+		return true
+	}
+	if !fn(n) {
+		return false
+	}
+	for _, c := range n.Children {
+		if !c.walk(fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// ExplainConn is implemented by the connections of the driver, allowing client tooling to
+// inspect the plans of queries and check them without running them. Callers using
+// database/sql reach it through sql.Conn.
+type ExplainConn interface {
+	// Explain returns the plan of the given type for query, which should not end with a
+	// semicolon. The query is only run for ExplainAnalyze.
+	Explain(ctx context.Context, query string, typ ExplainType) (*Plan, error)
+
+	// Validate checks that query is valid without running it, returning the server's
+	// failure if it is not, such as a syntax error, a missing table or column or a lack of
+	// privileges.
+	Validate(ctx context.Context, query string) error
+}
+
+var _ ExplainConn = &conn{}
+
+// Explain returns the plan of the given type for query.
+func (c *conn) Explain(ctx context.Context, query string, typ ExplainType) (*Plan, error) {
+	prefix, ok := explainStatements[typ]
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported explain type %d", DriverName, typ)
+	}
+	v, err := c.queryValue(ctx, prefix+query)
+	if err != nil {
+		return nil, err
+	}
+	text, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("%s: unexpected %T plan", DriverName, v)
+	}
+	return parsePlan(text)
+}
+
+// Validate checks that query is valid without running it, by running EXPLAIN (TYPE
+// VALIDATE), which the server fails for an invalid query.
+func (c *conn) Validate(ctx context.Context, query string) error {
+	v, err := c.queryValue(ctx, "EXPLAIN (TYPE VALIDATE) "+query)
+	if err != nil {
+		return err
+	}
+	if valid, ok := v.(bool); !ok || !valid {
+		return fmt.Errorf("%s: query not valid, got %v", DriverName, v)
+	}
+	return nil
+}
+
+// queryValue runs query, returning the value of the single column of its single row, such
+// as the output of an EXPLAIN statement.
+func (c *conn) queryValue(ctx context.Context, query string) (driver.Value, error) {
+	st := &stmt{conn: c, query: query}
+	r, err := st.run(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	values := make([]driver.Value, 1)
+	if err := r.Next(values); err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s: no result for %q", DriverName, query)
+		}
+		return nil, err
+	}
+	return values[0], nil
+}
+
+// parsePlan parses the JSON text of a plan, which is a single node for a logical plan and an
+// object holding the root of each fragment by ID for a distributed plan.
+func parsePlan(text string) (*Plan, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(text), &fields); err != nil {
+		return nil, fmt.Errorf("%s: invalid plan: %v", DriverName, err)
+	}
+	if _, ok := fields["name"]; ok {
+		var n planNode
+		if err := json.Unmarshal([]byte(text), &n); err != nil {
+			return nil, fmt.Errorf("%s: invalid plan: %v", DriverName, err)
+		}
+		return &Plan{Root: n.node()}, nil
+	}
+
+	p := &Plan{Fragments: make(map[string]*PlanNode, len(fields))}
+	for id, raw := range fields {
+		var n planNode
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return nil, fmt.Errorf("%s: invalid plan of fragment %s: %v", DriverName, id, err)
+		}
+		p.Fragments[id] = n.node()
+	}
+	p.Root = p.Fragments["0"]
+	return p, nil
+}
+
+// planNode is a node of a plan rendered as JSON by Presto or Trino.
+type planNode struct {
+	ID            string            `json:"id"`
+	Name          string            `json:"name"`
+	Identifier    string            `json:"identifier"`
+	Descriptor    map[string]string `json:"descriptor"`
+	Details       json.RawMessage   `json:"details"` // a string in Presto, an array in Trino
+	Outputs       []PlanOutput      `json:"outputs"`
+	Estimates     []planEstimate    `json:"estimates"`
+	RemoteSources []string          `json:"remoteSources"`
+	Children      []planNode        `json:"children"`
+}
+
+// planEstimate holds the estimates of a node, which are strings when not finite.
+type planEstimate struct {
+	OutputRowCount    interface{} `json:"outputRowCount"`
+	OutputSizeInBytes interface{} `json:"outputSizeInBytes"`
+	CPUCost           interface{} `json:"cpuCost"`
+	MemoryCost        interface{} `json:"memoryCost"`
+	NetworkCost       interface{} `json:"networkCost"`
+}
+
+// node returns the PlanNode described by n.
+func (n *planNode) node() *PlanNode {
+	pn := &PlanNode{
+		ID:            n.ID,
+		Name:          n.Name,
+		Identifier:    n.Identifier,
+		Descriptor:    n.Descriptor,
+		Outputs:       n.Outputs,
+		RemoteSources: n.RemoteSources,
+	}
+
+	var details string
+	if err := json.Unmarshal(n.Details, &details); err == nil {
+		if details = strings.TrimSpace(details); details != "" {
+			pn.Details = strings.Split(details, "\n")
+		}
+	} else {
+		json.Unmarshal(n.Details, &pn.Details)
+	}
+
+	for _, e := range n.Estimates {
+		pn.Estimates = append(pn.Estimates, PlanEstimate{
+			OutputRowCount:    estimate(e.OutputRowCount),
+			OutputSizeInBytes: estimate(e.OutputSizeInBytes),
+			CPUCost:           estimate(e.CPUCost),
+			MemoryCost:        estimate(e.MemoryCost),
+			NetworkCost:       estimate(e.NetworkCost),
+		})
+	}
+	for i := range n.Children {
+		pn.Children = append(pn.Children, n.Children[i].node())
+	}
+	return pn
+}
+
+// estimate converts an estimate sent as a number or as the string of a value that is not
+// finite into a float64, giving NaN for a value that is missing or not understood.
+func estimate(v interface{}) float64 {
+	f, err := doubleConverter(v)
+	if err != nil || f == nil {
+		return math.NaN()
+	}
+	return f.(float64)
+}
@@ -0,0 +1,251 @@
+package prestgo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// explainHandler answers statements with a single varchar value, recording their text.
+func explainHandler(value string, statements *[]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/statement" {
+			body, _ := ioutil.ReadAll(r.Body)
+			*statements = append(*statements, string(body))
+			fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%s/v1/query/abcd/1", "stats": {"state": "QUEUED"}}`, r.Host)
+			return
+		}
+		v, _ := json.Marshal(value)
+		fmt.Fprintf(w, `{
+		  "id": "abcd",
+		  "columns": [ { "name": "Query Plan", "type": "varchar", "typeSignature": { "rawType": "varchar", "arguments": [] } } ],
+		  "data": [ [ %s ] ],
+		  "stats": {"state": "FINISHED"}
+		}`, v)
+	}
+}
+
+const trinoLogicalPlan = `{
+  "id": "6",
+  "name": "Output",
+  "descriptor": {"columnNames": "[orderkey]"},
+  "outputs": [{"symbol": "orderkey", "type": "bigint"}],
+  "details": [],
+  "estimates": [{"outputRowCount": 15000.0, "outputSizeInBytes": 135000.0, "cpuCost": 135000.0, "memoryCost": 0.0, "networkCost": "NaN"}],
+  "children": [{
+    "id": "0",
+    "name": "TableScan",
+    "descriptor": {"table": "tpch:tiny:orders"},
+    "outputs": [{"symbol": "orderkey", "type": "bigint"}],
+    "details": ["orderkey := tpch:orderkey"],
+    "estimates": [],
+    "children": []
+  }]
+}`
+
+const prestoDistributedPlan = `{
+  "0": {
+    "id": "9",
+    "name": "Output",
+    "identifier": "[orderkey]",
+    "details": "",
+    "children": [{"id": "147", "name": "RemoteSource", "identifier": "[1]", "details": "", "children": [], "remoteSources": ["1"]}],
+    "remoteSources": []
+  },
+  "1": {
+    "id": "0",
+    "name": "TableScan",
+    "identifier": "[TableHandle {connectorId='tpch', connectorHandle='orders:sf0.01'}]",
+    "details": "LAYOUT: orders:sf0.01\norderkey := tpch:orderkey\n",
+    "children": [],
+    "remoteSources": []
+  }
+}`
+
+func TestConnExplain(t *testing.T) {
+	testCases := []struct {
+		typ       ExplainType
+		plan      string
+		statement string
+		names     []string
+	}{
+		{
+			typ:       ExplainLogical,
+			plan:      trinoLogicalPlan,
+			statement: "EXPLAIN (TYPE LOGICAL, FORMAT JSON) SELECT orderkey FROM orders",
+			names:     []string{"Output", "TableScan"},
+		},
+		{
+			typ:       ExplainDistributed,
+			plan:      prestoDistributedPlan,
+			statement: "EXPLAIN (TYPE DISTRIBUTED, FORMAT JSON) SELECT orderkey FROM orders",
+			names:     []string{"Output", "RemoteSource", "TableScan"},
+		},
+		{
+			typ:       ExplainAnalyze,
+			plan:      prestoDistributedPlan,
+			statement: "EXPLAIN ANALYZE (FORMAT JSON) SELECT orderkey FROM orders",
+			names:     []string{"Output", "RemoteSource", "TableScan"},
+		},
+	}
+
+	for _, tc := range testCases {
+		var statements []string
+		ts := httptest.NewServer(explainHandler(tc.plan, &statements))
+		cn := &conn{client: http.DefaultClient, addr: ts.Listener.Addr().String()}
+		plan, err := cn.Explain(context.Background(), "SELECT orderkey FROM orders", tc.typ)
+		ts.Close()
+		if err != nil {
+			t.Errorf("%d: %v", tc.typ, err)
+			continue
+		}
+		if len(statements) != 1 || statements[0] != tc.statement {
+			t.Errorf("%d: got statements %q, wanted %q", tc.typ, statements, tc.statement)
+		}
+
+		var names []string
+		plan.Walk(func(n *PlanNode) bool {
+			names = append(names, n.Name)
+			return true
+		})
+		if !reflect.DeepEqual(names, tc.names) {
+			t.Errorf("%d: got nodes %q, wanted %q", tc.typ, names, tc.names)
+		}
+	}
+}
+
+func TestParsePlanLogical(t *testing.T) {
+	plan, err := parsePlan(trinoLogicalPlan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Fragments != nil {
+		t.Errorf("got fragments %v for a logical plan, wanted none", plan.Fragments)
+	}
+
+	root := plan.Root
+	if root.ID != "6" || root.Name != "Output" || root.Descriptor["columnNames"] != "[orderkey]" {
+		t.Errorf("got root %+v", root)
+	}
+	if len(root.Estimates) != 1 {
+		t.Fatalf("got %d estimates, wanted 1", len(root.Estimates))
+	}
+	e := root.Estimates[0]
+	if e.OutputRowCount != 15000 || e.OutputSizeInBytes != 135000 || !math.IsNaN(e.NetworkCost) {
+		t.Errorf("got estimate %+v", e)
+	}
+
+	if len(root.Children) != 1 {
+		t.Fatalf("got %d children, wanted 1", len(root.Children))
+	}
+	scan := root.Children[0]
+	expected := &PlanNode{
+		ID:         "0",
+		Name:       "TableScan",
+		Descriptor: map[string]string{"table": "tpch:tiny:orders"},
+		Outputs:    []PlanOutput{{Symbol: "orderkey", Type: "bigint"}},
+		Details:    []string{"orderkey := tpch:orderkey"},
+	}
+	if !reflect.DeepEqual(scan, expected) {
+		t.Errorf("got scan %+v, wanted %+v", scan, expected)
+	}
+}
+
+func TestParsePlanDistributed(t *testing.T) {
+	plan, err := parsePlan(prestoDistributedPlan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Fragments) != 2 || plan.Root != plan.Fragments["0"] {
+		t.Fatalf("got fragments %v with root %v", plan.Fragments, plan.Root)
+	}
+	if remote := plan.Root.Children[0].RemoteSources; !reflect.DeepEqual(remote, []string{"1"}) {
+		t.Errorf("got remote sources %q, wanted 1", remote)
+	}
+	scan := plan.Fragments["1"]
+	if scan.Identifier != "[TableHandle {connectorId='tpch', connectorHandle='orders:sf0.01'}]" {
+		t.Errorf("got identifier %q", scan.Identifier)
+	}
+	if expected := []string{"LAYOUT: orders:sf0.01", "orderkey := tpch:orderkey"}; !reflect.DeepEqual(scan.Details, expected) {
+		t.Errorf("got details %q, wanted %q", scan.Details, expected)
+	}
+	if plan.Root.Details != nil {
+		t.Errorf("got details %q for output, wanted none", plan.Root.Details)
+	}
+}
+
+func TestPlanWalkStops(t *testing.T) {
+	plan, err := parsePlan(prestoDistributedPlan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	visited := 0
+	plan.Walk(func(n *PlanNode) bool {
+		visited++
+		return n.Name != "RemoteSource"
+	})
+	if visited != 2 {
+		t.Errorf("visited %d nodes, wanted 2", visited)
+	}
+}
+
+func TestParsePlanInvalid(t *testing.T) {
+	for _, text := range []string{"", "Output[orderkey]", `{"name": 1}`} {
+		if _, err := parsePlan(text); err == nil {
+			t.Errorf("%q: got no error", text)
+		}
+	}
+}
+
+func TestConnValidate(t *testing.T) {
+	var statements []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/statement" {
+			body, _ := ioutil.ReadAll(r.Body)
+			statements = append(statements, string(body))
+			if strings.Contains(string(body), "missing") {
+				fmt.Fprint(w, `{
+				  "id": "abcd",
+				  "stats": {"state": "FAILED"},
+				  "error": {
+				    "message": "line 1:15: Table 'hive.default.missing' does not exist",
+				    "errorCode": 46,
+				    "errorName": "TABLE_NOT_FOUND",
+				    "errorType": "USER_ERROR"
+				  }
+				}`)
+				return
+			}
+			fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%s/v1/query/abcd/1", "stats": {"state": "QUEUED"}}`, r.Host)
+			return
+		}
+		fmt.Fprint(w, `{
+		  "id": "abcd",
+		  "columns": [ { "name": "Valid", "type": "boolean", "typeSignature": { "rawType": "boolean", "arguments": [] } } ],
+		  "data": [ [ true ] ],
+		  "stats": {"state": "FINISHED"}
+		}`)
+	}))
+	defer ts.Close()
+
+	cn := &conn{client: http.DefaultClient, addr: ts.Listener.Addr().String()}
+	if err := cn.Validate(context.Background(), "SELECT * FROM orders"); err != nil {
+		t.Errorf("got error %v for a valid query", err)
+	}
+	if expected := []string{"EXPLAIN (TYPE VALIDATE) SELECT * FROM orders"}; !reflect.DeepEqual(statements, expected) {
+		t.Errorf("got statements %q, wanted %q", statements, expected)
+	}
+
+	err := cn.Validate(context.Background(), "SELECT * FROM missing")
+	perr, ok := err.(*Error)
+	if !ok || perr.ErrorName != "TABLE_NOT_FOUND" {
+		t.Errorf("got error %v for a missing table, wanted TABLE_NOT_FOUND", err)
+	}
+}
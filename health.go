@@ -0,0 +1,86 @@
+package prestgo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Points at which a connection checks that its coordinator is healthy, set with the
+// health_check data source option.
+const (
+	healthCheckNone     = iota // Not checked.
+	healthCheckOpen            // Checked when the connection is opened.
+	healthCheckFirstUse        // Checked before the first statement run on the connection.
+)
+
+// serverInfo is the response to a request for /v1/info, describing the server.
+type serverInfo struct {
+	NodeVersion struct {
+		Version string `json:"version"`
+	} `json:"nodeVersion"`
+	Environment string `json:"environment"`
+	Coordinator bool   `json:"coordinator"`
+	Starting    bool   `json:"starting"`
+}
+
+// checkHealth verifies that the connection's coordinator can run queries. When several
+// coordinators are listed or discovered, the check succeeds if any of them is healthy.
+func (c *conn) checkHealth(ctx context.Context) error {
+	addrs, err := c.coordinatorAddrs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if err = c.checkCoordinator(ctx, addr); err == nil {
+			break
+		}
+	}
+	return err
+}
+
+// checkHealthOnce checks the health of the connection's coordinator unless a check has
+// already succeeded. Statements run at once before then each make a check.
+func (c *conn) checkHealthOnce(ctx context.Context) error {
+	c.mu.Lock()
+	checked := c.healthChecked
+	c.mu.Unlock()
+	if checked {
+		return nil
+	}
+	if err := c.checkHealth(ctx); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.healthChecked = true
+	c.mu.Unlock()
+	return nil
+}
+
+// checkCoordinator requests the description of the server at addr, returning an error if
+// it cannot be reached, is not a coordinator or is still starting.
+func (c *conn) checkCoordinator(ctx context.Context, addr string) error {
+	req, _ := http.NewRequest("GET", fmt.Sprintf("http://%s/v1/info", addr), nil)
+	req = req.WithContext(ctx)
+	resp, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("%s: health check of %s failed: %v", DriverName, addr, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: health check of %s failed: %v", DriverName, addr, newHTTPError(resp))
+	}
+
+	var info serverInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return fmt.Errorf("%s: health check of %s failed: %v", DriverName, addr, err)
+	}
+	switch {
+	case !info.Coordinator:
+		return fmt.Errorf("%s: health check of %s failed: server is not a coordinator", DriverName, addr)
+	case info.Starting:
+		return fmt.Errorf("%s: health check of %s failed: server is starting", DriverName, addr)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package prestgo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// infoHandler serves info as the description of the server and statements with h.
+func infoHandler(info string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/info" {
+			fmt.Fprint(w, info)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+const healthyInfo = `{"nodeVersion":{"version":"0.190"},"environment":"test","coordinator":true,"starting":false,"uptime":"1.00d"}`
+
+func TestClientOpenHealthCheck(t *testing.T) {
+	dead := httptest.NewServer(http.NotFoundHandler())
+	deadAddr := dead.Listener.Addr().String()
+	dead.Close()
+
+	testCases := []struct {
+		info  string
+		error string
+	}{
+		{info: healthyInfo},
+		{info: `{"nodeVersion":{"version":"0.190"},"coordinator":true,"starting":true}`, error: "server is starting"},
+		{info: `{"nodeVersion":{"version":"0.190"},"coordinator":false,"starting":false}`, error: "server is not a coordinator"},
+		{info: `<html>`, error: "invalid character"},
+	}
+
+	for _, tc := range testCases {
+		ts := httptest.NewServer(infoHandler(tc.info, http.NotFoundHandler()))
+		_, err := ClientOpen(http.DefaultClient, "presto://"+ts.Listener.Addr().String()+"/hive/default?health_check=open")
+		ts.Close()
+		if tc.error == "" {
+			if err != nil {
+				t.Errorf("%s: got error %v, wanted none", tc.info, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.error) {
+			t.Errorf("%s: got error %v, wanted %q", tc.info, err, tc.error)
+		}
+	}
+
+	// Several coordinators are healthy if any one is
+	ts := httptest.NewServer(infoHandler(healthyInfo, http.NotFoundHandler()))
+	defer ts.Close()
+	if _, err := ClientOpen(http.DefaultClient, fmt.Sprintf("presto://%s,%s/hive/default?health_check=open", deadAddr, ts.Listener.Addr())); err != nil {
+		t.Errorf("got error %v, wanted none", err)
+	}
+
+	if _, err := ClientOpen(http.DefaultClient, "presto://"+deadAddr+"/hive/default?health_check=open"); err == nil {
+		t.Error("unreachable coordinator: got no error, wanted one")
+	}
+	if _, err := ClientOpen(http.DefaultClient, "presto://"+deadAddr+"/hive/default?health_check=sometimes"); err == nil {
+		t.Error("got no error for unsupported health_check, wanted one")
+	}
+}
+
+func TestStmtHealthCheckFirstUse(t *testing.T) {
+	var checks int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/info" {
+			checks++
+		}
+		infoHandler(healthyInfo, statementHandler(oneRowColResponse)).ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	cn, err := ClientOpen(http.DefaultClient, "presto://"+ts.Listener.Addr().String()+"/hive/default?health_check=first_use")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checks != 0 {
+		t.Errorf("got %d checks when opened, wanted 0", checks)
+	}
+	for i := 0; i < 2; i++ {
+		st, _ := cn.Prepare("SELECT 1")
+		r, err := st.(*stmt).QueryContext(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+	}
+	if checks != 1 {
+		t.Errorf("got %d checks, wanted 1", checks)
+	}
+}
@@ -0,0 +1,43 @@
+package prestgo
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+)
+
+// QueryHooks are called before and after every query run by the driver, allowing auditing,
+// measurement and rewriting of queries to be applied to all of them in one place. They are
+// set for the connections made by a Connector with its Hooks field.
+type QueryHooks interface {
+	// BeforeQuery is called before a query is submitted to the server, with its text and
+	// arguments. It returns the context to run the query with, which is later passed to
+	// AfterQuery, and the text to submit, which may be rewritten. An error prevents the
+	// query from running and is returned to the caller without AfterQuery being called.
+	BeforeQuery(ctx context.Context, query string, args []driver.NamedValue) (context.Context, string, error)
+
+	// AfterQuery is called once a query has ended, because all its results have been read,
+	// it failed or its rows were closed. It may be called from a goroutine other than the
+	// one that ran the query.
+	AfterQuery(ctx context.Context, event QueryEvent)
+}
+
+// QueryEvent describes the end of a query for QueryHooks.
+type QueryEvent struct {
+	Query    string              // Text submitted to the server, as returned by BeforeQuery.
+	Args     []driver.NamedValue // Arguments of the query.
+	QueryID  string              // ID the server assigned to the query, if it got that far.
+	Duration time.Duration       // Time from submitting the query until it ended.
+	Timing   QueryTiming         // Time the query spent queued, planning and running.
+	Fetches  FetchStats          // Responses received for the query's results.
+	Rows     int64               // Number of rows returned to the caller.
+
+	// Stats are the statistics last reported by the server, if the query got that far. For
+	// a query whose results were all read they are the final statistics of the whole query,
+	// giving its CPU time, peak memory and the rows and bytes it processed for accounting.
+	Stats QueryStats
+
+	// Err is nil if all the results of the query were read, context.Canceled if its rows
+	// were closed before then, and otherwise the error that ended the query.
+	Err error
+}
@@ -0,0 +1,126 @@
+package prestgo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type hookKey struct{}
+
+// recordingHooks tags queries with a comment and records the events of those that end.
+type recordingHooks struct {
+	mu     sync.Mutex
+	before []string
+	events []QueryEvent
+	ctxs   []interface{}
+	reject bool
+}
+
+func (h *recordingHooks) BeforeQuery(ctx context.Context, query string, args []driver.NamedValue) (context.Context, string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.before = append(h.before, query)
+	if h.reject {
+		return nil, "", errors.New("rejected")
+	}
+	return context.WithValue(ctx, hookKey{}, query), query + " -- audited", nil
+}
+
+func (h *recordingHooks) AfterQuery(ctx context.Context, event QueryEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, event)
+	h.ctxs = append(h.ctxs, ctx.Value(hookKey{}))
+}
+
+func TestQueryHooks(t *testing.T) {
+	var mu sync.Mutex
+	var submitted []string
+	results := statementHandler(multiPageResponse)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/statement" {
+			body, _ := ioutil.ReadAll(r.Body)
+			mu.Lock()
+			submitted = append(submitted, string(body))
+			mu.Unlock()
+		}
+		results.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	c, err := NewConnector("presto://" + ts.Listener.Addr().String() + "/hive/default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &recordingHooks{}
+	c.Hooks = h
+	db := sql.OpenDB(c)
+	defer db.Close()
+
+	rs, err := db.Query("SELECT col0 FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for rs.Next() {
+		n++
+	}
+	if err := rs.Err(); err != nil {
+		t.Fatal(err)
+	}
+	rs.Close()
+
+	if _, err := db.Query("SELECT col0 FROM t WHERE col1 = ?", 1); err != ErrNotSupported {
+		t.Errorf("got error %v, wanted %v", err, ErrNotSupported)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if fmt.Sprint(submitted) != "[SELECT col0 FROM t -- audited]" {
+		t.Errorf("got statements submitted %q, wanted the rewritten query", submitted)
+	}
+	if len(h.events) != 2 {
+		t.Fatalf("got %d events, wanted 2", len(h.events))
+	}
+
+	ev := h.events[0]
+	if ev.Query != "SELECT col0 FROM t -- audited" || ev.QueryID != "abcd" || ev.Rows != 6 || ev.Err != nil || ev.Duration <= 0 {
+		t.Errorf("got event %+v, wanted the finished query", ev)
+	}
+	if ev.Fetches.Pages != 2 || ev.Fetches.Rows != 6 {
+		t.Errorf("got fetches %+v, wanted 2 pages of 6 rows", ev.Fetches)
+	}
+	if h.ctxs[0] != "SELECT col0 FROM t" {
+		t.Errorf("got context value %v, wanted the one set by BeforeQuery", h.ctxs[0])
+	}
+
+	ev = h.events[1]
+	if ev.Err != ErrNotSupported || len(ev.Args) != 1 || ev.Args[0].Value != int64(1) {
+		t.Errorf("got event %+v, wanted the unsupported query with its argument", ev)
+	}
+}
+
+func TestQueryHooksReject(t *testing.T) {
+	h := &recordingHooks{reject: true}
+	s := &stmt{
+		conn:  &conn{client: http.DefaultClient, addr: "127.0.0.1:1", hooks: h},
+		query: "DROP TABLE t",
+	}
+	if _, err := s.QueryContext(context.Background(), nil); err == nil || !strings.Contains(err.Error(), "rejected") {
+		t.Errorf("got error %v, wanted the hook's", err)
+	}
+	if len(h.before) != 1 || len(h.events) != 0 {
+		t.Errorf("got %d calls before and %d after, wanted 1 and 0", len(h.before), len(h.events))
+	}
+}
@@ -0,0 +1,22 @@
+package prestgo
+
+// QueryInfo identifies a query run on the server, so that it can be logged or inspected.
+type QueryInfo struct {
+	ID      string // ID the server assigned to the query.
+	InfoURI string // URI of the coordinator's page describing the query, for linking users to it.
+}
+
+// InfoRows is implemented by the driver.Rows returned by the driver, allowing callers with
+// access to them to identify the query producing the results. WithQueryInfo gives the same
+// information to callers using database/sql.
+type InfoRows interface {
+	// QueryInfo returns the identity of the query.
+	QueryInfo() QueryInfo
+}
+
+var _ InfoRows = &rows{}
+
+// QueryInfo returns the identity of the query producing the rows.
+func (r *rows) QueryInfo() QueryInfo {
+	return QueryInfo{ID: r.queryID, InfoURI: r.infoURI}
+}
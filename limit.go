@@ -0,0 +1,60 @@
+package prestgo
+
+import (
+	"context"
+	"io"
+)
+
+// WithMaxRows returns a copy of ctx that limits queries run with it to returning n rows. Once
+// n rows have been read no more results are fetched, the rest of the query is canceled on
+// the server and the rows end as if the results had, protecting callers such as dashboards
+// from queries that select far more rows than they can show. Whether rows were left unread
+// is reported by the Truncated method of the rows. A limit of zero or less has no effect.
+func WithMaxRows(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, maxRowsKey, n)
+}
+
+func maxRows(ctx context.Context) int {
+	n, _ := ctx.Value(maxRowsKey).(int)
+	return n
+}
+
+// TruncatedRows is implemented by the driver.Rows returned by the driver, allowing callers
+// with access to them to tell whether the results of a query were cut short by the limit
+// set with WithMaxRows.
+type TruncatedRows interface {
+	// Truncated reports whether the query had rows beyond the limit, which were not read.
+	Truncated() bool
+}
+
+var _ TruncatedRows = &rows{}
+
+// Truncated reports whether the query had rows beyond the limit, which were not read.
+func (r *rows) Truncated() bool {
+	return r.truncated
+}
+
+// stopAtMaxRows ends the rows once the limit on the rows read has been reached, canceling
+// the query on the server if it has more rows to return.
+func (r *rows) stopAtMaxRows() error {
+	if r.done {
+		return io.EOF
+	}
+	more := r.rowindex < r.pageLen()
+	if !more && r.nextURI != "" {
+		// Whether the query has more rows is only known once the next page is received,
+		// which has usually been fetched already
+		if err := r.fetch(); err != nil {
+			return err
+		}
+		more = true
+	}
+	if more {
+		r.truncated = true
+		if r.nextURI != "" {
+			r.conn.cancelOnServer(r.nextURI)
+		}
+	}
+	r.finish(io.EOF)
+	return io.EOF
+}
@@ -0,0 +1,92 @@
+package prestgo
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWithMaxRows(t *testing.T) {
+	testCases := []struct {
+		max       int
+		expected  []int64
+		truncated bool
+	}{
+		{max: 0, expected: []int64{1, 2, 3, 4, 5, 6}},
+		{max: 3, expected: []int64{1, 2, 3}, truncated: true},
+		{max: 2, expected: []int64{1, 2}, truncated: true},
+		{max: 6, expected: []int64{1, 2, 3, 4, 5, 6}},
+		{max: 10, expected: []int64{1, 2, 3, 4, 5, 6}},
+	}
+
+	for _, tc := range testCases {
+		const pages = 3
+		var deleted int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "DELETE" {
+				atomic.AddInt32(&deleted, 1)
+				return
+			}
+			var page int
+			fmt.Sscanf(r.URL.Path, "/v1/query/abcd/%d", &page)
+			if page == 0 {
+				fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%s/v1/query/abcd/1", "stats": {"state": "QUEUED"}}`, r.Host)
+				return
+			}
+			next := ""
+			if page < pages {
+				next = fmt.Sprintf(`"nextUri": "http://%s/v1/query/abcd/%d",`, r.Host, page+1)
+			}
+			fmt.Fprintf(w, `{
+			  "id": "abcd",
+			  %s
+			  "columns": [ { "name": "col0", "type": "bigint", "typeSignature": { "rawType": "bigint", "arguments": [] } } ],
+			  "data": [ [ %d ], [ %d ] ],
+			  "stats": {"state": "RUNNING"}
+			}`, next, 2*page-1, 2*page)
+		}))
+
+		cn := &conn{client: http.DefaultClient, addr: ts.Listener.Addr().String()}
+		s := &stmt{conn: cn, query: "SELECT col0 FROM t"}
+		r, err := s.QueryContext(WithMaxRows(context.Background(), tc.max), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int64
+		values := make([]driver.Value, 1)
+		for {
+			err := r.Next(values)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%d: %v", tc.max, err)
+			}
+			got = append(got, values[0].(int64))
+		}
+		truncated := r.(TruncatedRows).Truncated()
+		r.Close()
+		cn.Close()
+		ts.Close()
+
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%d: got %v, wanted %v", tc.max, got, tc.expected)
+		}
+		if truncated != tc.truncated {
+			t.Errorf("%d: got truncated %v, wanted %v", tc.max, truncated, tc.truncated)
+		}
+		var cancellations int32
+		if tc.truncated {
+			cancellations = 1
+		}
+		if n := atomic.LoadInt32(&deleted); n != cancellations {
+			t.Errorf("%d: got %d cancellations, wanted %d", tc.max, n, cancellations)
+		}
+	}
+}
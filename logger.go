@@ -0,0 +1,70 @@
+package prestgo
+
+import (
+	"fmt"
+	"log"
+)
+
+// LogLevel is the severity of a diagnostic message logged by the driver.
+type LogLevel int
+
+const (
+	LogDebug LogLevel = iota // Detail useful when investigating the driver's behaviour.
+	LogInfo                  // Notable events in the normal running of queries.
+	LogWarn                  // Conditions that may give unexpected results, such as unsupported types.
+	LogError                 // Failures the driver cannot report to the caller.
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogDebug:
+		return "DEBUG"
+	case LogInfo:
+		return "INFO"
+	case LogWarn:
+		return "WARN"
+	case LogError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
+// Logger receives the diagnostic messages of the driver. It is set for the connections made
+// by a Connector with its Logger field; connections made by Open, or by a Connector with
+// no Logger, discard their messages. Implementations must be safe for concurrent use.
+type Logger interface {
+	// Logf logs a message at the given level, formatting its arguments in the manner of
+	// fmt.Printf.
+	Logf(level LogLevel, format string, args ...interface{})
+}
+
+// NewLogger returns a Logger that writes messages of at least level min to l, prefixed by
+// their level. If l is nil, messages are written to the standard logger of the log package.
+func NewLogger(l *log.Logger, min LogLevel) Logger {
+	return &stdLogger{l: l, min: min}
+}
+
+type stdLogger struct {
+	l   *log.Logger
+	min LogLevel
+}
+
+func (s *stdLogger) Logf(level LogLevel, format string, args ...interface{}) {
+	if level < s.min {
+		return
+	}
+	msg := level.String() + " " + fmt.Sprintf(format, args...)
+	if s.l == nil {
+		log.Print(msg)
+		return
+	}
+	s.l.Print(msg)
+}
+
+// logf logs a message to l, discarding it if l is nil.
+func logf(l Logger, level LogLevel, format string, args ...interface{}) {
+	if l == nil {
+		return
+	}
+	l.Logf(level, format, args...)
+}
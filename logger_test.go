@@ -0,0 +1,98 @@
+package prestgo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// recordingLogger records the messages logged to it.
+type recordingLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) Logf(level LogLevel, format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, level.String()+" "+fmt.Sprintf(format, args...))
+}
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogger(log.New(&buf, "", 0), LogInfo)
+
+	l.Logf(LogDebug, "hidden %d", 1)
+	l.Logf(LogInfo, "shown %d", 2)
+	l.Logf(LogError, "shown %d", 3)
+
+	expected := "INFO shown 2\nERROR shown 3\n"
+	if got := buf.String(); got != expected {
+		t.Errorf("got %q, wanted %q", got, expected)
+	}
+}
+
+func TestRowsFetchUnknownTypeLog(t *testing.T) {
+	ts := httptest.NewServer(unknownTypeResponse)
+	defer ts.Close()
+
+	testCases := []struct {
+		logger   *recordingLogger
+		expected []string
+	}{
+		{
+			logger:   &recordingLogger{},
+			expected: []string{"WARN prestgo: unsupported column type: geometry"},
+		},
+		{
+			// A nil logger discards the message
+		},
+	}
+
+	for _, tc := range testCases {
+		opts := converterOptions{unknownTypes: unknownTypesLog}
+		if tc.logger != nil {
+			opts.logger = tc.logger
+		}
+		r := &rows{
+			conn: &conn{
+				client: http.DefaultClient,
+				conv:   opts,
+			},
+			nextURI: ts.URL + "/v1/query/abcd/1",
+		}
+
+		if err := r.fetch(); err != nil {
+			t.Fatal(err)
+		}
+		if tc.logger != nil && !reflect.DeepEqual(tc.logger.messages, tc.expected) {
+			t.Errorf("got messages %q, wanted %q", tc.logger.messages, tc.expected)
+		}
+	}
+}
+
+func TestConnectorLogger(t *testing.T) {
+	c, err := NewConnector("presto://example/hive/default?unknown_types=log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &recordingLogger{}
+	c.Logger = l
+
+	cn, err := c.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cn.(*conn).logger; got != l {
+		t.Errorf("got logger %v, wanted %v", got, l)
+	}
+	if got := cn.(*conn).conv.logger; got != l {
+		t.Errorf("got converter logger %v, wanted %v", got, l)
+	}
+}
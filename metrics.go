@@ -0,0 +1,46 @@
+package prestgo
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Metrics receives measurements of the queries run by the driver, for export to a monitoring
+// system such as Prometheus. It is set for the connections made by a Connector with its
+// Metrics field. Methods may be called from background goroutines fetching results, so
+// implementations must be safe for concurrent use.
+//
+// Every query reported as started is later reported as exactly one of finished, failed or
+// canceled.
+type Metrics interface {
+	// QueryStarted is called as each statement is submitted to the server.
+	QueryStarted()
+
+	// QueryFinished is called when all the results of a query have been read, with the
+	// number of rows returned.
+	QueryFinished(rows int64)
+
+	// QueryFailed is called when a query fails, with the error returned to the caller.
+	QueryFailed(err error)
+
+	// QueryCanceled is called when a query is canceled by its context or by the server, or
+	// when its rows are closed before all the results have been read.
+	QueryCanceled()
+
+	// PageFetched is called for each response to a request for results, including those
+	// holding no rows while the query is still running, with the time taken to receive and
+	// decode it, the bytes decoded and the number of rows it holds.
+	PageFetched(latency time.Duration, bytes int64, rows int)
+}
+
+// reportQueryError reports the end of a query with err to m, as a cancellation if the query
+// was canceled and a failure otherwise.
+func reportQueryError(m Metrics, err error) {
+	var canceled *CanceledByServerError
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.As(err, &canceled) {
+		m.QueryCanceled()
+		return
+	}
+	m.QueryFailed(err)
+}
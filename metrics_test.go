@@ -0,0 +1,159 @@
+package prestgo
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingMetrics records the measurements reported to it.
+type recordingMetrics struct {
+	mu       sync.Mutex
+	started  int
+	finished []int64
+	failed   []error
+	canceled int
+	pages    int
+	rows     int
+	bytes    int64
+}
+
+func (m *recordingMetrics) QueryStarted() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.started++
+}
+
+func (m *recordingMetrics) QueryFinished(rows int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.finished = append(m.finished, rows)
+}
+
+func (m *recordingMetrics) QueryFailed(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failed = append(m.failed, err)
+}
+
+func (m *recordingMetrics) QueryCanceled() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.canceled++
+}
+
+func (m *recordingMetrics) PageFetched(latency time.Duration, bytes int64, rows int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pages++
+	m.rows += rows
+	m.bytes += bytes
+}
+
+// statementHandler answers a statement with a response whose nextUri is the first page of
+// results served by h.
+func statementHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/statement" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"id": "abcd", "infoUri": "http://%[1]s/v1/query/abcd", "nextUri": "http://%[1]s/v1/query/abcd/1", "stats": {"state": "QUEUED"}}`, r.Host)
+	})
+}
+
+func TestMetrics(t *testing.T) {
+	testCases := []struct {
+		name     string
+		handler  http.Handler
+		read     int  // rows to read before closing, or -1 for all
+		cancel   bool // whether to cancel the context before reading
+		finished []int64
+		failed   int
+		canceled int
+		pages    int // pages fetched, or -1 if it depends on the progress of prefetching
+		rows     int
+	}{
+		{name: "all", handler: multiPageResponse, read: -1, finished: []int64{6}, pages: 2, rows: 6},
+		{name: "closed early", handler: multiPageResponse, read: 1, canceled: 1, pages: -1},
+		{name: "failed", handler: failingQueryResult, read: -1, failed: 1, pages: 1},
+		{name: "context canceled", handler: multiPageResponse, read: -1, cancel: true, canceled: 1},
+	}
+
+	for _, tc := range testCases {
+		ts := httptest.NewServer(statementHandler(tc.handler))
+		m := &recordingMetrics{}
+		c := &conn{client: http.DefaultClient, addr: ts.Listener.Addr().String(), metrics: m}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		st, _ := c.Prepare("SELECT col0 FROM t")
+		rs, err := st.(*stmt).QueryContext(ctx, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if tc.cancel {
+			cancel()
+		}
+		dest := make([]driver.Value, 1)
+		for n := 0; tc.read < 0 || n < tc.read; n++ {
+			if err := rs.Next(dest); err != nil {
+				if err != io.EOF && tc.failed == 0 && tc.canceled == 0 {
+					t.Errorf("%s: unexpected error %v", tc.name, err)
+				}
+				break
+			}
+		}
+		rs.Close()
+		cancel()
+		ts.Close()
+
+		m.mu.Lock()
+		if m.started != 1 {
+			t.Errorf("%s: got %d queries started, wanted 1", tc.name, m.started)
+		}
+		if fmt.Sprint(m.finished) != fmt.Sprint(tc.finished) {
+			t.Errorf("%s: got finished %v, wanted %v", tc.name, m.finished, tc.finished)
+		}
+		if len(m.failed) != tc.failed {
+			t.Errorf("%s: got failures %v, wanted %d", tc.name, m.failed, tc.failed)
+		}
+		if m.canceled != tc.canceled {
+			t.Errorf("%s: got %d cancellations, wanted %d", tc.name, m.canceled, tc.canceled)
+		}
+		if tc.pages < 0 {
+			m.mu.Unlock()
+			continue
+		}
+		if m.pages != tc.pages || m.rows != tc.rows {
+			t.Errorf("%s: got %d pages of %d rows, wanted %d pages of %d rows", tc.name, m.pages, m.rows, tc.pages, tc.rows)
+		}
+		if (m.bytes > 0) != (tc.pages > 0) {
+			t.Errorf("%s: got %d bytes decoded for %d pages", tc.name, m.bytes, m.pages)
+		}
+		m.mu.Unlock()
+	}
+}
+
+func TestMetricsSubmitFailure(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": "abcd", "stats": {"state": "FAILED"}, "error": {"message": "line 1:1: mismatched input"}}`)
+	}))
+	defer ts.Close()
+
+	m := &recordingMetrics{}
+	c := &conn{client: http.DefaultClient, addr: ts.Listener.Addr().String(), metrics: m}
+	st, _ := c.Prepare("SELEC 1")
+	if _, err := st.(*stmt).QueryContext(context.Background(), nil); err == nil {
+		t.Fatal("got no error, wanted one")
+	}
+
+	if m.started != 1 || len(m.failed) != 1 || m.canceled != 0 {
+		t.Errorf("got %d started, %d failed and %d canceled, wanted 1, 1 and 0", m.started, len(m.failed), m.canceled)
+	}
+}
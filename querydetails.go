@@ -0,0 +1,342 @@
+package prestgo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QueryDetails describes a query as reported by the coordinator's /v1/query/{id} resource,
+// for monitoring tools to inspect queries, including those submitted elsewhere.
+type QueryDetails struct {
+	ID        string
+	State     string // e.g. QUEUED, RUNNING, FINISHED or FAILED.
+	Query     string // Text of the query.
+	User      string
+	Source    string
+	Catalog   string
+	Schema    string
+	Self      string // URI of the resource describing the query.
+	Scheduled bool   // Whether all the query's stages have been scheduled.
+	Stats     QueryDetailStats
+
+	// OutputStage is the stage producing the query's results, from which its other stages
+	// are reached through SubStages. It is nil until the query has been planned.
+	OutputStage *StageDetails
+
+	// Error is the failure of the query, if it failed.
+	Error *Error
+}
+
+// QueryDetailStats holds the statistics of a query reported with its QueryDetails.
+type QueryDetailStats struct {
+	CreateTime    time.Time
+	EndTime       time.Time // Zero while the query runs.
+	ElapsedTime   time.Duration
+	QueuedTime    time.Duration
+	ExecutionTime time.Duration
+	CPUTime       time.Duration
+
+	TotalDrivers     int
+	QueuedDrivers    int
+	RunningDrivers   int
+	CompletedDrivers int
+
+	PeakUserMemoryBytes  int64
+	PeakTotalMemoryBytes int64
+	RawInputBytes        int64
+	RawInputRows         int64
+	OutputBytes          int64
+	OutputRows           int64
+}
+
+// StageDetails describes a stage of a query reported with its QueryDetails.
+type StageDetails struct {
+	ID    string
+	State string
+	Self  string // URI of the resource describing the stage.
+	Tasks int    // Number of tasks running the stage.
+
+	TotalDrivers     int
+	CompletedDrivers int
+	CPUTime          time.Duration
+	RawInputBytes    int64
+	RawInputRows     int64
+	OutputBytes      int64
+	OutputRows       int64
+
+	SubStages []*StageDetails // Stages providing the input of this one.
+}
+
+// DescribeQuery asks the coordinator at addr, given as host:port or as a URL such as
+// https://host:port, for the details of the query with the given ID. The driver's own
+// client is used if client is nil. It returns ErrQueryNotFound if the coordinator does not
+// know the query.
+func DescribeQuery(ctx context.Context, client *http.Client, addr, queryID string) (*QueryDetails, error) {
+	if client == nil {
+		client = defaultClient
+	}
+	c := &conn{client: client}
+	return c.describeQuery(ctx, addr, queryID)
+}
+
+// DescribeQuery returns the details of the query with the given ID. When several
+// coordinators are listed or discovered, each is asked in turn until one knows the query.
+func (c *conn) DescribeQuery(ctx context.Context, queryID string) (*QueryDetails, error) {
+	addrs, err := c.coordinatorAddrs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var d *QueryDetails
+	for _, addr := range addrs {
+		if d, err = c.describeQuery(ctx, addr, queryID); err != ErrQueryNotFound {
+			break
+		}
+	}
+	return d, err
+}
+
+// describeQuery asks the coordinator at addr for the details of the query with the given ID.
+func (c *conn) describeQuery(ctx context.Context, addr, queryID string) (*QueryDetails, error) {
+	resp, err := c.admin(ctx, "GET", addr, "/v1/query/"+url.PathEscape(queryID))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusGone:
+		return nil, ErrQueryNotFound
+	default:
+		return nil, newHTTPError(resp)
+	}
+
+	var info queryInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, err
+	}
+	return info.details(), nil
+}
+
+// queryInfo is the response to a request for /v1/query/{id}.
+type queryInfo struct {
+	QueryID string `json:"queryId"`
+	Session struct {
+		User    string `json:"user"`
+		Source  string `json:"source"`
+		Catalog string `json:"catalog"`
+		Schema  string `json:"schema"`
+	} `json:"session"`
+	State      string `json:"state"`
+	Self       string `json:"self"`
+	Query      string `json:"query"`
+	Scheduled  bool   `json:"scheduled"`
+	QueryStats struct {
+		CreateTime                 time.Time       `json:"createTime"`
+		EndTime                    time.Time       `json:"endTime"`
+		ElapsedTime                airliftDuration `json:"elapsedTime"`
+		QueuedTime                 airliftDuration `json:"queuedTime"`
+		ExecutionTime              airliftDuration `json:"executionTime"`
+		TotalCPUTime               airliftDuration `json:"totalCpuTime"`
+		TotalDrivers               int             `json:"totalDrivers"`
+		QueuedDrivers              int             `json:"queuedDrivers"`
+		RunningDrivers             int             `json:"runningDrivers"`
+		CompletedDrivers           int             `json:"completedDrivers"`
+		PeakUserMemoryReservation  dataSize        `json:"peakUserMemoryReservation"`
+		PeakTotalMemoryReservation dataSize        `json:"peakTotalMemoryReservation"`
+		RawInputDataSize           dataSize        `json:"rawInputDataSize"`
+		RawInputPositions          int64           `json:"rawInputPositions"`
+		OutputDataSize             dataSize        `json:"outputDataSize"`
+		OutputPositions            int64           `json:"outputPositions"`
+	} `json:"queryStats"`
+	OutputStage *stageInfo   `json:"outputStage"`
+	ErrorType   string       `json:"errorType"`
+	ErrorCode   *errorCode   `json:"errorCode"`
+	FailureInfo *FailureInfo `json:"failureInfo"`
+}
+
+// stageInfo describes a stage in a queryInfo.
+type stageInfo struct {
+	StageID    string            `json:"stageId"`
+	State      string            `json:"state"`
+	Self       string            `json:"self"`
+	Tasks      []json.RawMessage `json:"tasks"`
+	StageStats struct {
+		TotalDrivers      int             `json:"totalDrivers"`
+		CompletedDrivers  int             `json:"completedDrivers"`
+		TotalCPUTime      airliftDuration `json:"totalCpuTime"`
+		RawInputDataSize  dataSize        `json:"rawInputDataSize"`
+		RawInputPositions int64           `json:"rawInputPositions"`
+		OutputDataSize    dataSize        `json:"outputDataSize"`
+		OutputPositions   int64           `json:"outputPositions"`
+	} `json:"stageStats"`
+	SubStages []*stageInfo `json:"subStages"`
+}
+
+// errorCode identifies the cause of a failure in a queryInfo.
+type errorCode struct {
+	Code int    `json:"code"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// details converts the query information to its exported form.
+func (info *queryInfo) details() *QueryDetails {
+	qs := info.QueryStats
+	d := &QueryDetails{
+		ID:        info.QueryID,
+		State:     info.State,
+		Query:     info.Query,
+		User:      info.Session.User,
+		Source:    info.Session.Source,
+		Catalog:   info.Session.Catalog,
+		Schema:    info.Session.Schema,
+		Self:      info.Self,
+		Scheduled: info.Scheduled,
+		Stats: QueryDetailStats{
+			CreateTime:           qs.CreateTime,
+			EndTime:              qs.EndTime,
+			ElapsedTime:          time.Duration(qs.ElapsedTime),
+			QueuedTime:           time.Duration(qs.QueuedTime),
+			ExecutionTime:        time.Duration(qs.ExecutionTime),
+			CPUTime:              time.Duration(qs.TotalCPUTime),
+			TotalDrivers:         qs.TotalDrivers,
+			QueuedDrivers:        qs.QueuedDrivers,
+			RunningDrivers:       qs.RunningDrivers,
+			CompletedDrivers:     qs.CompletedDrivers,
+			PeakUserMemoryBytes:  int64(qs.PeakUserMemoryReservation),
+			PeakTotalMemoryBytes: int64(qs.PeakTotalMemoryReservation),
+			RawInputBytes:        int64(qs.RawInputDataSize),
+			RawInputRows:         qs.RawInputPositions,
+			OutputBytes:          int64(qs.OutputDataSize),
+			OutputRows:           qs.OutputPositions,
+		},
+	}
+	if info.OutputStage != nil {
+		d.OutputStage = info.OutputStage.details()
+	}
+
+	if info.State == QueryStateFailed || info.FailureInfo != nil {
+		e := &Error{ErrorType: info.ErrorType, FailureInfo: info.FailureInfo, QueryID: info.QueryID, InfoURI: info.Self}
+		if info.ErrorCode != nil {
+			e.ErrorCode, e.ErrorName = info.ErrorCode.Code, info.ErrorCode.Name
+			if e.ErrorType == "" {
+				e.ErrorType = info.ErrorCode.Type
+			}
+		}
+		if info.FailureInfo != nil {
+			e.Message, e.ErrorLocation = info.FailureInfo.Message, info.FailureInfo.ErrorLocation
+		}
+		e.PeakMemoryBytes = d.Stats.PeakTotalMemoryBytes
+		e.CPUTime, e.ElapsedTime = d.Stats.CPUTime, d.Stats.ElapsedTime
+		d.Error = e
+	}
+	return d
+}
+
+// details converts the stage information to its exported form.
+func (s *stageInfo) details() *StageDetails {
+	ss := s.StageStats
+	d := &StageDetails{
+		ID:               s.StageID,
+		State:            s.State,
+		Self:             s.Self,
+		Tasks:            len(s.Tasks),
+		TotalDrivers:     ss.TotalDrivers,
+		CompletedDrivers: ss.CompletedDrivers,
+		CPUTime:          time.Duration(ss.TotalCPUTime),
+		RawInputBytes:    int64(ss.RawInputDataSize),
+		RawInputRows:     ss.RawInputPositions,
+		OutputBytes:      int64(ss.OutputDataSize),
+		OutputRows:       ss.OutputPositions,
+	}
+	for _, sub := range s.SubStages {
+		d.SubStages = append(d.SubStages, sub.details())
+	}
+	return d
+}
+
+// airliftDuration is a duration encoded as Presto encodes them in its REST resources, as a
+// number followed by a unit, e.g. "1.50s" or "2.00m".
+type airliftDuration time.Duration
+
+// durationUnits maps the units of an airliftDuration to their length.
+var durationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+}
+
+func (d *airliftDuration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	n, unit, err := splitUnit(s)
+	if err != nil {
+		return err
+	}
+	scale, ok := durationUnits[unit]
+	if !ok {
+		return fmt.Errorf("unknown unit in duration %q", s)
+	}
+	*d = airliftDuration(math.Round(n * float64(scale)))
+	return nil
+}
+
+// dataSize is a number of bytes encoded as Presto encodes data sizes in its REST resources,
+// as a number followed by a unit, e.g. "512B" or "1.50MB".
+type dataSize int64
+
+// dataSizeUnits maps the units of a dataSize to their size.
+var dataSizeUnits = map[string]float64{
+	"B":  1,
+	"kB": 1 << 10,
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+	"TB": 1 << 40,
+	"PB": 1 << 50,
+}
+
+func (d *dataSize) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	n, unit, err := splitUnit(s)
+	if err != nil {
+		return err
+	}
+	scale, ok := dataSizeUnits[unit]
+	if !ok {
+		return fmt.Errorf("unknown unit in data size %q", s)
+	}
+	*d = dataSize(math.Round(n * scale))
+	return nil
+}
+
+// splitUnit separates the number at the start of s from the unit that follows it.
+func splitUnit(s string) (float64, string, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i <= 0 {
+		return 0, "", fmt.Errorf("malformed quantity %q", s)
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("malformed quantity %q", s)
+	}
+	return n, strings.TrimSpace(s[i:]), nil
+}
@@ -0,0 +1,167 @@
+package prestgo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var queryDetailsResponse = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/query/20170301_120000_00001_abcde" {
+		http.NotFound(w, r)
+		return
+	}
+	fmt.Fprintf(w, `{
+	  "queryId": "20170301_120000_00001_abcde",
+	  "session": {"user": "ops", "source": "dashboard", "catalog": "hive", "schema": "web"},
+	  "state": "FAILED",
+	  "self": "http://%[1]s/v1/query/20170301_120000_00001_abcde",
+	  "query": "SELECT count(*) FROM pageviews",
+	  "scheduled": true,
+	  "queryStats": {
+	    "createTime": "2017-03-01T12:00:00.000Z",
+	    "endTime": "2017-03-01T12:01:30.500Z",
+	    "elapsedTime": "1.51m",
+	    "queuedTime": "250.00ms",
+	    "executionTime": "1.50m",
+	    "totalCpuTime": "3.00h",
+	    "totalDrivers": 100,
+	    "queuedDrivers": 0,
+	    "runningDrivers": 0,
+	    "completedDrivers": 90,
+	    "peakUserMemoryReservation": "1.50GB",
+	    "peakTotalMemoryReservation": "2GB",
+	    "rawInputDataSize": "512B",
+	    "rawInputPositions": 1000,
+	    "outputDataSize": "1.00kB",
+	    "outputPositions": 1
+	  },
+	  "outputStage": {
+	    "stageId": "20170301_120000_00001_abcde.0",
+	    "state": "FAILED",
+	    "self": "http://%[1]s/v1/stage/20170301_120000_00001_abcde.0",
+	    "tasks": [{}],
+	    "stageStats": {"totalDrivers": 1, "completedDrivers": 1, "totalCpuTime": "10.00ms", "outputDataSize": "1.00kB", "outputPositions": 1},
+	    "subStages": [{
+	      "stageId": "20170301_120000_00001_abcde.1",
+	      "state": "FAILED",
+	      "tasks": [{}, {}, {}],
+	      "stageStats": {"totalDrivers": 99, "completedDrivers": 89, "totalCpuTime": "3.00h", "rawInputDataSize": "512B", "rawInputPositions": 1000}
+	    }]
+	  },
+	  "errorType": "INSUFFICIENT_RESOURCES",
+	  "errorCode": {"code": 131079, "name": "EXCEEDED_GLOBAL_MEMORY_LIMIT", "type": "INSUFFICIENT_RESOURCES"},
+	  "failureInfo": {"type": "com.facebook.presto.ExceededMemoryLimitException", "message": "Query exceeded distributed user memory limit of 1GB"}
+	}`, r.Host)
+})
+
+func TestDescribeQuery(t *testing.T) {
+	ts := httptest.NewServer(queryDetailsResponse)
+	defer ts.Close()
+
+	d, err := DescribeQuery(context.Background(), nil, ts.Listener.Addr().String(), "20170301_120000_00001_abcde")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.ID != "20170301_120000_00001_abcde" || d.State != "FAILED" || d.User != "ops" || d.Source != "dashboard" || d.Catalog != "hive" || d.Schema != "web" || !d.Scheduled {
+		t.Errorf("got details %+v", d)
+	}
+	expected := QueryDetailStats{
+		CreateTime:           time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC),
+		EndTime:              time.Date(2017, 3, 1, 12, 1, 30, 5e8, time.UTC),
+		ElapsedTime:          90600 * time.Millisecond,
+		QueuedTime:           250 * time.Millisecond,
+		ExecutionTime:        90 * time.Second,
+		CPUTime:              3 * time.Hour,
+		TotalDrivers:         100,
+		CompletedDrivers:     90,
+		PeakUserMemoryBytes:  3 << 29,
+		PeakTotalMemoryBytes: 2 << 30,
+		RawInputBytes:        512,
+		RawInputRows:         1000,
+		OutputBytes:          1024,
+		OutputRows:           1,
+	}
+	if !reflect.DeepEqual(d.Stats, expected) {
+		t.Errorf("got stats %+v, wanted %+v", d.Stats, expected)
+	}
+
+	if s := d.OutputStage; s == nil || s.Tasks != 1 || s.CPUTime != 10*time.Millisecond || len(s.SubStages) != 1 {
+		t.Fatalf("got output stage %+v", s)
+	}
+	if s := d.OutputStage.SubStages[0]; s.ID != "20170301_120000_00001_abcde.1" || s.Tasks != 3 || s.CompletedDrivers != 89 || s.RawInputRows != 1000 {
+		t.Errorf("got sub-stage %+v", s)
+	}
+
+	if e := d.Error; e == nil || e.ErrorName != "EXCEEDED_GLOBAL_MEMORY_LIMIT" || e.ErrorCode != 131079 || e.ErrorType != "INSUFFICIENT_RESOURCES" || e.Message != "Query exceeded distributed user memory limit of 1GB" {
+		t.Errorf("got error %+v", d.Error)
+	}
+
+	if _, err := DescribeQuery(context.Background(), nil, ts.URL, "20170301_120000_00002_abcde"); err != ErrQueryNotFound {
+		t.Errorf("got error %v, wanted %v", err, ErrQueryNotFound)
+	}
+}
+
+func TestConnDescribeQuery(t *testing.T) {
+	ts := httptest.NewServer(queryDetailsResponse)
+	defer ts.Close()
+
+	cn, err := ClientOpen(http.DefaultClient, "presto://"+ts.Listener.Addr().String()+"/hive/default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := cn.(AdminConn).DescribeQuery(context.Background(), "20170301_120000_00001_abcde")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Query != "SELECT count(*) FROM pageviews" {
+		t.Errorf("got query %q", d.Query)
+	}
+}
+
+func TestAirliftQuantities(t *testing.T) {
+	durations := map[string]time.Duration{
+		`"1.50s"`:    1500 * time.Millisecond,
+		`"2.00m"`:    2 * time.Minute,
+		`"0.00ns"`:   0,
+		`"12.34us"`:  12340 * time.Nanosecond,
+		`"1.00d"`:    24 * time.Hour,
+		`"250ms"`:    250 * time.Millisecond,
+		`"3.25h"`:    195 * time.Minute,
+		`"1.5 s"`:    1500 * time.Millisecond,
+		`"100.00ms"`: 100 * time.Millisecond,
+	}
+	for in, expected := range durations {
+		var d airliftDuration
+		if err := json.Unmarshal([]byte(in), &d); err != nil || time.Duration(d) != expected {
+			t.Errorf("%s: got %v, %v, wanted %v", in, time.Duration(d), err, expected)
+		}
+	}
+
+	sizes := map[string]int64{
+		`"0B"`:     0,
+		`"512B"`:   512,
+		`"1.50kB"`: 1536,
+		`"2MB"`:    2 << 20,
+		`"1.00GB"`: 1 << 30,
+	}
+	for in, expected := range sizes {
+		var d dataSize
+		if err := json.Unmarshal([]byte(in), &d); err != nil || int64(d) != expected {
+			t.Errorf("%s: got %d, %v, wanted %d", in, d, err, expected)
+		}
+	}
+
+	for _, in := range []string{`"fast"`, `"1.5 fortnights"`, `12`} {
+		var d airliftDuration
+		if err := json.Unmarshal([]byte(in), &d); err == nil {
+			t.Errorf("%s: got no error, wanted one", in)
+		}
+	}
+}
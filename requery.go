@@ -0,0 +1,119 @@
+package prestgo
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// readOnlyStatements are the leading keywords of statements that do not change data.
+var readOnlyStatements = map[string]bool{
+	"SELECT":   true,
+	"WITH":     true,
+	"VALUES":   true,
+	"TABLE":    true,
+	"SHOW":     true,
+	"DESCRIBE": true,
+	"EXPLAIN":  true,
+}
+
+// isReadOnly reports whether query is a statement that does not change data, judged by its
+// first keyword after any comments and opening parentheses. EXPLAIN ANALYZE runs the
+// statement it explains, so is only read-only if that statement is.
+func isReadOnly(query string) bool {
+	word, rest := firstKeyword(query)
+	if word != "EXPLAIN" {
+		return readOnlyStatements[word]
+	}
+	if word, rest = firstKeyword(rest); word != "ANALYZE" {
+		return true
+	}
+	if word, after := firstKeyword(rest); word == "VERBOSE" {
+		rest = after
+	}
+	rest = strings.TrimSpace(rest)
+	if strings.HasPrefix(rest, "(") {
+		// Skip the options, such as the format
+		if i := strings.IndexByte(rest, ')'); i >= 0 {
+			rest = rest[i+1:]
+		}
+	}
+	word, _ = firstKeyword(rest)
+	return readOnlyStatements[word]
+}
+
+// firstKeyword returns the first word of query, upper cased, skipping whitespace, comments
+// and opening parentheses, and the text following it.
+func firstKeyword(query string) (string, string) {
+	i := 0
+	for i < len(query) {
+		switch c := query[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '(':
+			i++
+		case strings.HasPrefix(query[i:], "--"):
+			j := strings.IndexByte(query[i:], '\n')
+			if j < 0 {
+				return "", ""
+			}
+			i += j
+		case strings.HasPrefix(query[i:], "/*"):
+			j := strings.Index(query[i+2:], "*/")
+			if j < 0 {
+				return "", ""
+			}
+			i += j + 4
+		default:
+			j := i
+			for j < len(query) && isIdentChar(query[j]) {
+				j++
+			}
+			return strings.ToUpper(query[i:j]), query[j:]
+		}
+	}
+	return "", ""
+}
+
+// retryQuery reports whether the query of q, which failed with err before returning any
+// rows, is to be submitted again, having waited for the delay given by the connection's
+// retry policy. Queries are only retried when the retry_queries option is set, so that
+// policies written without whole queries in mind do not resubmit them unasked, and only
+// read-only queries the server failed for transient reasons are retried; failed requests
+// have already been put to the policy as they were sent.
+func (c *conn) retryQuery(q *queryRun, err error) bool {
+	var perr *Error
+	if !c.retryQueries || !isReadOnly(q.query) || !errors.As(err, &perr) || !IsRetryable(err) {
+		return false
+	}
+	policy := c.retryPolicy
+	if policy == nil {
+		policy = defaultRetryPolicy
+	}
+	q.attempts++
+	d, ok := policy.Retry(RetryAttempt{Kind: RequestQuery, Attempt: q.attempts, Elapsed: time.Since(q.start), Err: err})
+	if !ok {
+		return false
+	}
+	logf(c.logger, LogWarn, "%s: resubmitting query after %v: %v", DriverName, d, err)
+	if wait(q.ctx, d) != nil {
+		return false
+	}
+	if q.coordinator != nil {
+		// The coordinator is chosen afresh for the new attempt
+		c.balancer.release(q.coordinator)
+		q.coordinator = nil
+	}
+	return true
+}
+
+// resubmit submits the query of the rows again after it failed before any page of results
+// was received, carrying on with the results of the new query.
+func (r *rows) resubmit() error {
+	st := &stmt{conn: r.conn, query: r.run.query}
+	dr, err := st.submit(r.run)
+	if err != nil {
+		return err
+	}
+	n := dr.(*rows)
+	r.queryID, r.infoURI, r.nextURI, r.stats = n.queryID, n.infoURI, n.nextURI, n.stats
+	return nil
+}
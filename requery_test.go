@@ -0,0 +1,195 @@
+package prestgo
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIsReadOnly(t *testing.T) {
+	testCases := []struct {
+		query    string
+		expected bool
+	}{
+		{query: "SELECT 1", expected: true},
+		{query: "  select * from t", expected: true},
+		{query: "WITH x AS (SELECT 1) SELECT * FROM x", expected: true},
+		{query: "(SELECT 1) UNION (SELECT 2)", expected: true},
+		{query: "-- daily report\nSELECT 1", expected: true},
+		{query: "/* report */ SELECT 1", expected: true},
+		{query: "VALUES 1, 2", expected: true},
+		{query: "SHOW TABLES", expected: true},
+		{query: "DESCRIBE t", expected: true},
+		{query: "EXPLAIN INSERT INTO t VALUES 1", expected: true},
+		{query: "EXPLAIN (TYPE VALIDATE) DELETE FROM t", expected: true},
+		{query: "EXPLAIN ANALYZE SELECT 1", expected: true},
+		{query: "EXPLAIN ANALYZE VERBOSE (FORMAT JSON) SELECT 1", expected: true},
+		{query: "Explain Analyze Verbose SELECT 1", expected: true},
+		{query: "explain analyze Verbose insert into t values 1", expected: false},
+		{query: "EXPLAIN ANALYZE INSERT INTO t VALUES 1", expected: false},
+		{query: "INSERT INTO t SELECT * FROM s", expected: false},
+		{query: "CREATE TABLE t AS SELECT 1", expected: false},
+		{query: "DELETE FROM t", expected: false},
+		{query: "CALL system.sync_partition_metadata('s', 't', 'FULL')", expected: false},
+		{query: "-- only a comment", expected: false},
+		{query: "", expected: false},
+	}
+
+	for _, tc := range testCases {
+		if got := isReadOnly(tc.query); got != tc.expected {
+			t.Errorf("%q: got %v, wanted %v", tc.query, got, tc.expected)
+		}
+	}
+}
+
+// flakyQueryServer serves queries that fail with a transient error the first fails times
+// they are run, when failing the statement or the first page of results as early is set,
+// and then return a single row.
+func flakyQueryServer(fails int, early bool) (*httptest.Server, *[]string) {
+	var mu sync.Mutex
+	var statements []string
+	const failure = `{
+	  "id": "q%d",
+	  "stats": {"state": "FAILED"},
+	  "error": {"message": "Remote host gone", "errorCode": 65545, "errorName": "REMOTE_HOST_GONE", "errorType": "INTERNAL_ERROR"}
+	}`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/statement" {
+			body, _ := ioutil.ReadAll(r.Body)
+			mu.Lock()
+			statements = append(statements, string(body))
+			n := len(statements)
+			mu.Unlock()
+			if early && n <= fails {
+				fmt.Fprintf(w, failure, n)
+				return
+			}
+			fmt.Fprintf(w, `{"id": "q%d", "nextUri": "http://%s/v1/query/q%[1]d/1", "stats": {"state": "QUEUED"}}`, n, r.Host)
+			return
+		}
+		var n int
+		fmt.Sscanf(r.URL.Path, "/v1/query/q%d/1", &n)
+		if n <= fails {
+			fmt.Fprintf(w, failure, n)
+			return
+		}
+		fmt.Fprintf(w, `{
+		  "id": "q%d",
+		  "columns": [ { "name": "col0", "type": "bigint", "typeSignature": { "rawType": "bigint", "arguments": [] } } ],
+		  "data": [ [ %[1]d ] ],
+		  "stats": {"state": "FINISHED"}
+		}`, n)
+	}))
+	return ts, &statements
+}
+
+func TestQueryRetry(t *testing.T) {
+	retry := &StandardRetryPolicy{Delay: time.Millisecond}
+	testCases := []struct {
+		name     string
+		query    string
+		policy   RetryPolicy
+		disabled bool // retry_queries is not set
+		fails    int
+		early    bool
+		expected int64 // ID of the query returning the row, 0 if it fails
+	}{
+		{name: "statement", query: "SELECT 1", policy: retry, fails: 1, early: true, expected: 2},
+		{name: "first page", query: "SELECT 1", policy: retry, fails: 2, expected: 3},
+		{name: "attempts exhausted", query: "SELECT 1", policy: retry, fails: 5},
+		{name: "not enabled", query: "SELECT 1", policy: retry, disabled: true, fails: 1},
+		{name: "not read-only", query: "INSERT INTO t SELECT 1", policy: retry, fails: 1},
+	}
+
+	for _, tc := range testCases {
+		ts, statements := flakyQueryServer(tc.fails, tc.early)
+		cn := &conn{client: http.DefaultClient, addr: ts.Listener.Addr().String(), retryPolicy: tc.policy, retryQueries: !tc.disabled}
+		st := &stmt{conn: cn, query: tc.query}
+
+		values := make([]driver.Value, 1)
+		r, err := st.QueryContext(context.Background(), nil)
+		if err == nil {
+			err = r.Next(values)
+			r.Close()
+		}
+		ts.Close()
+
+		attempts := int(tc.expected)
+		if tc.expected == 0 {
+			if err == nil || err == io.EOF {
+				t.Errorf("%s: got error %v, wanted the query's failure", tc.name, err)
+			} else if !strings.Contains(err.Error(), "REMOTE_HOST_GONE") {
+				t.Errorf("%s: got error %v, wanted REMOTE_HOST_GONE", tc.name, err)
+			}
+			attempts = 1
+			if !tc.disabled && tc.query == "SELECT 1" {
+				attempts = 5
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		} else if values[0] != tc.expected {
+			t.Errorf("%s: got row from query %v, wanted %d", tc.name, values[0], tc.expected)
+		}
+		if len(*statements) != attempts {
+			t.Errorf("%s: got %d statements, wanted %d", tc.name, len(*statements), attempts)
+		}
+	}
+}
+
+// resubmittingPolicy resubmits failed queries at once, declining to retry requests, and
+// counts the queries it is asked about.
+type resubmittingPolicy struct {
+	mu      sync.Mutex
+	queries int
+}
+
+func (p *resubmittingPolicy) Retry(a RetryAttempt) (time.Duration, bool) {
+	if a.Kind != RequestQuery {
+		return 0, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.queries++
+	return 0, true
+}
+
+func TestQueryRetryCustomPolicy(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		ts, statements := flakyQueryServer(1, false)
+		policy := &resubmittingPolicy{}
+		cn := &conn{client: http.DefaultClient, addr: ts.Listener.Addr().String(), retryPolicy: policy, retryQueries: enabled}
+		st := &stmt{conn: cn, query: "SELECT 1"}
+		r, err := st.QueryContext(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = r.Next(make([]driver.Value, 1))
+		r.Close()
+		ts.Close()
+
+		// The policy is only asked about resubmitting the query once retry_queries is set
+		expected := 1
+		if enabled {
+			expected = 2
+			if err != nil {
+				t.Errorf("retry_queries=%v: %v", enabled, err)
+			}
+		} else if err == nil || err == io.EOF {
+			t.Errorf("retry_queries=%v: got error %v, wanted the query's failure", enabled, err)
+		}
+		if len(*statements) != expected {
+			t.Errorf("retry_queries=%v: got %d statements, wanted %d", enabled, len(*statements), expected)
+		}
+		if policy.queries != expected-1 {
+			t.Errorf("retry_queries=%v: policy asked about %d queries, wanted %d", enabled, policy.queries, expected-1)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package prestgo
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+)
+
+// ErrNotResumable is returned by Checkpoint for the rows of a query that was not run with a
+// context from WithResumable.
+var ErrNotResumable = errors.New(DriverName + ": query not resumable")
+
+// WithResumable returns a copy of ctx that causes queries run with it to return rows whose
+// position can be saved with Checkpoint and resumed with ResumeQuery. The server only
+// repeats the page of results it sent last, so these rows do not fetch pages ahead of the
+// consumer and a page is only requested once the rows of the one before have been read.
+// Closing the rows before all have been read leaves the query running, rather than
+// canceling it, so that it can be resumed until the server expires it.
+func WithResumable(ctx context.Context) context.Context {
+	return context.WithValue(ctx, resumableKey, true)
+}
+
+func isResumable(ctx context.Context) bool {
+	resumable, _ := ctx.Value(resumableKey).(bool)
+	return resumable
+}
+
+// ResumeToken is the position reached in the results of a query, from which they can be read
+// by another connection, such as one opened by a new process after the first crashed. It
+// may be saved as JSON. It holds no credentials, so the connection resuming the query must
+// be authorized with the coordinator as the one that ran it.
+type ResumeToken struct {
+	QueryID string          `json:"queryId"`           // ID the server assigned to the query.
+	URI     string          `json:"uri"`               // URI of the page of results holding the position.
+	Offset  int             `json:"offset"`            // Rows of that page read before the position.
+	Columns json.RawMessage `json:"columns,omitempty"` // Columns of the results as sent by the server.
+}
+
+// ResumableRows is implemented by the driver.Rows returned by the driver, allowing callers
+// with access to them to save the position reached in the results of a query run with a
+// context from WithResumable.
+type ResumableRows interface {
+	// Checkpoint returns the position of the next row to be read. A query resumed from it
+	// returns the rows that follow, as long as no more rows have been read since, which
+	// would ask the server for the next page.
+	Checkpoint() (*ResumeToken, error)
+}
+
+var _ ResumableRows = &rows{}
+
+// Checkpoint returns the position of the next row to be read.
+func (r *rows) Checkpoint() (*ResumeToken, error) {
+	if !r.resumable {
+		return nil, ErrNotResumable
+	}
+	t := &ResumeToken{QueryID: r.queryID, URI: r.pageURI, Offset: r.rowindex}
+	if r.pageURI == "" || r.rowindex >= r.pageLen() && r.nextURI != "" {
+		// No page has been received or the current one has been read, so the next page is
+		// where reading carries on
+		t.URI, t.Offset = r.nextURI, 0
+	}
+	if r.fetched {
+		cols, err := json.Marshal(r.rawColumns)
+		if err != nil {
+			return nil, err
+		}
+		t.Columns = cols
+	}
+	return t, nil
+}
+
+// ResumeConn is implemented by the connections of the driver, allowing the results of a
+// query to be read from a position saved with Checkpoint. Callers using database/sql reach
+// it through sql.Conn.
+type ResumeConn interface {
+	// ResumeQuery returns the rows of the query that follow the position given by token,
+	// fetching them with ctx. The rows may themselves be checkpointed.
+	ResumeQuery(ctx context.Context, token *ResumeToken) (driver.Rows, error)
+}
+
+var _ ResumeConn = &conn{}
+
+// ResumeQuery returns the rows of the query that follow the position given by token.
+func (c *conn) ResumeQuery(ctx context.Context, token *ResumeToken) (driver.Rows, error) {
+	r := &rows{
+		conn:      c,
+		ctx:       ctx,
+		queryID:   token.QueryID,
+		nextURI:   token.URI,
+		budget:    newPageBudget(c.maxBufferedBytes),
+		resumable: true,
+		skip:      token.Offset,
+		maxRows:   maxRows(ctx),
+		columnar:  isColumnar(ctx),
+	}
+	if len(token.Columns) > 0 {
+		var cols []queryColumn
+		if err := json.Unmarshal(token.Columns, &cols); err != nil {
+			return nil, err
+		}
+		if err := r.prepareColumns(cols); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
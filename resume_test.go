@@ -0,0 +1,172 @@
+package prestgo
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// resumableServer serves a query with three pages of two rows, allowing only the page last
+// requested to be repeated, as Presto does. The columns are sent with the first page only,
+// as Trino does, unless everyPage is set.
+func resumableServer(t *testing.T, everyPage bool) *httptest.Server {
+	const pages = 3
+	var mu sync.Mutex
+	last := 0
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var page int
+		if r.URL.Path != "/v1/statement" {
+			fmt.Sscanf(r.URL.Path, "/v1/query/abcd/%d", &page)
+		}
+		mu.Lock()
+		ok := page == last || page == last+1
+		if ok {
+			last = page
+		}
+		mu.Unlock()
+		if !ok {
+			t.Errorf("page %d requested after page %d", page, last)
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+
+		if page == 0 {
+			fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%s/v1/query/abcd/1", "stats": {"state": "QUEUED"}}`, r.Host)
+			return
+		}
+		next, columns := "", ""
+		if page < pages {
+			next = fmt.Sprintf(`"nextUri": "http://%s/v1/query/abcd/%d",`, r.Host, page+1)
+		}
+		if page == 1 || everyPage {
+			columns = `"columns": [ { "name": "col0", "type": "bigint", "typeSignature": { "rawType": "bigint", "arguments": [] } } ],`
+		}
+		fmt.Fprintf(w, `{
+		  "id": "abcd",
+		  %s
+		  %s
+		  "data": [ [ %d ], [ %d ] ],
+		  "stats": {"state": "RUNNING"}
+		}`, next, columns, 2*page-1, 2*page)
+	}))
+}
+
+func TestResumeQuery(t *testing.T) {
+	testResumeQuery(t, true)
+}
+
+// The token must hold the columns of the first page once later pages have been decoded
+// into the response that carried them.
+func TestResumeQueryColumnsOnFirstPage(t *testing.T) {
+	testResumeQuery(t, false)
+}
+
+func testResumeQuery(t *testing.T, everyPage bool) {
+	ts := resumableServer(t, everyPage)
+	defer ts.Close()
+
+	cn := &conn{client: http.DefaultClient, addr: ts.Listener.Addr().String()}
+	s := &stmt{conn: cn, query: "SELECT col0 FROM t"}
+	r, err := s.QueryContext(WithResumable(context.Background()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make([]driver.Value, 1)
+	for i := 0; i < 3; i++ {
+		if err := r.Next(values); err != nil {
+			t.Fatal(err)
+		}
+	}
+	token, err := r.(ResumableRows).Checkpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.URI != ts.URL+"/v1/query/abcd/2" || token.Offset != 1 {
+		t.Errorf("got position %s+%d, wanted page 2+1", token.URI, token.Offset)
+	}
+
+	// The job stops without closing the rows and a new one resumes from the saved token
+	saved, err := json.Marshal(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored ResumeToken
+	if err := json.Unmarshal(saved, &restored); err != nil {
+		t.Fatal(err)
+	}
+
+	cn2 := &conn{client: http.DefaultClient, addr: ts.Listener.Addr().String()}
+	r2, err := cn2.ResumeQuery(context.Background(), &restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r2.Close()
+	if cols := r2.Columns(); !reflect.DeepEqual(cols, []string{"col0"}) {
+		t.Errorf("got columns %q, wanted col0", cols)
+	}
+
+	var got []int64
+	for {
+		err := r2.Next(values)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, values[0].(int64))
+	}
+	expected := []int64{4, 5, 6}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, wanted %v", got, expected)
+	}
+}
+
+func TestCheckpointPageBoundary(t *testing.T) {
+	ts := resumableServer(t, true)
+	defer ts.Close()
+
+	cn := &conn{client: http.DefaultClient, addr: ts.Listener.Addr().String()}
+	s := &stmt{conn: cn, query: "SELECT col0 FROM t"}
+	r, err := s.QueryContext(WithResumable(context.Background()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	token, err := r.(ResumableRows).Checkpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.URI != ts.URL+"/v1/query/abcd/1" || token.Offset != 0 || token.Columns != nil {
+		t.Errorf("got position %s+%d with columns %s before reading, wanted page 1+0 without columns", token.URI, token.Offset, token.Columns)
+	}
+
+	values := make([]driver.Value, 1)
+	for i := 0; i < 2; i++ {
+		if err := r.Next(values); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Once the page has been read the position is the start of the next page
+	if token, err = r.(ResumableRows).Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	if token.URI != ts.URL+"/v1/query/abcd/2" || token.Offset != 0 {
+		t.Errorf("got position %s+%d after the first page, wanted page 2+0", token.URI, token.Offset)
+	}
+}
+
+func TestCheckpointNotResumable(t *testing.T) {
+	r := &rows{conn: &conn{client: http.DefaultClient}, nextURI: "http://example/v1/query/abcd/1"}
+	if _, err := r.Checkpoint(); err != ErrNotResumable {
+		t.Errorf("got error %v, wanted ErrNotResumable", err)
+	}
+}
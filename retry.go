@@ -0,0 +1,139 @@
+package prestgo
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RequestKind identifies the purpose of a request to the server.
+type RequestKind int
+
+const (
+	RequestStatement RequestKind = iota // The POST submitting a statement.
+	RequestResults                      // A GET of a query's next page of results.
+	RequestInfo                         // A GET of /v1/info checking the server's health.
+	RequestQuery                        // A failed read-only query submitted again, asked only with the retry_queries option.
+)
+
+// String returns the name of the kind of request.
+func (k RequestKind) String() string {
+	switch k {
+	case RequestStatement:
+		return "statement"
+	case RequestResults:
+		return "results"
+	case RequestInfo:
+		return "info"
+	case RequestQuery:
+		return "query"
+	}
+	return "unknown"
+}
+
+// requestKind returns the kind of req.
+func requestKind(req *http.Request) RequestKind {
+	switch {
+	case req.Method == "POST":
+		return RequestStatement
+	case strings.HasSuffix(req.URL.Path, "/v1/info"):
+		return RequestInfo
+	}
+	return RequestResults
+}
+
+// RetryAttempt describes a failed attempt at a request to the server.
+type RetryAttempt struct {
+	Kind    RequestKind
+	Attempt int           // attempts made so far, starting at 1
+	Elapsed time.Duration // time since the first attempt was sent
+
+	// StatusCode and Header are those of the response, when the server responded with
+	// something other than 200 OK.
+	StatusCode int
+	Header     http.Header
+
+	// Err is the error sending the request, when no response was received, or the failure
+	// of the query for RequestQuery.
+	Err error
+}
+
+// RetryPolicy decides whether failed requests to the server are retried. Retry is called
+// after each failed attempt and returns how long to wait before the next, or false if the
+// failure is to be returned. A policy is shared by the requests of all the queries run on
+// the connections it is given to, so it must be safe for concurrent use, and may keep a
+// budget of retries across them. Coordinators that cannot be connected to are passed over
+// for the next listed before the policy is consulted. A policy is asked whether to submit
+// a failed query again, with an attempt of kind RequestQuery, only when the retry_queries
+// data source option is set.
+type RetryPolicy interface {
+	Retry(a RetryAttempt) (time.Duration, bool)
+}
+
+// StandardRetryPolicy is the RetryPolicy used when none is supplied. It retries requests
+// the server rejected with 503 Service Unavailable, which the coordinator returns when it is
+// briefly overloaded, after the delay suggested by the Retry-After header. Requests that
+// failed without a response are only retried if RetryNetworkErrors is set.
+type StandardRetryPolicy struct {
+	// MaxAttempts limits the attempts made at a request, including the first. If zero, 5
+	// attempts are made.
+	MaxAttempts int
+
+	// MaxElapsed limits the time spent retrying a request. No retry is made that would end
+	// its wait after this time has passed since the first attempt. If zero, 30 seconds.
+	MaxElapsed time.Duration
+
+	// Delay is the wait before retrying when the server does not suggest one, doubling with
+	// each attempt for requests that failed without a response. If zero, one second.
+	Delay time.Duration
+
+	// RetryNetworkErrors causes requests for results and for the server's description that
+	// failed without a response, such as when a connection was reset, to be retried with
+	// exponential backoff. The server returns the same page of results until the next is
+	// requested, so repeating a request is safe. Statements are never retried after such a
+	// failure since the coordinator may already have started the query.
+	RetryNetworkErrors bool
+}
+
+// defaultRetryPolicy is used by connections not given a RetryPolicy.
+var defaultRetryPolicy RetryPolicy = &StandardRetryPolicy{}
+
+// Retry implements RetryPolicy. Failed queries it is asked about, when the retry_queries
+// data source option is set, are submitted again with exponential backoff.
+func (p *StandardRetryPolicy) Retry(a RetryAttempt) (time.Duration, bool) {
+	maxAttempts, maxElapsed, delay := p.MaxAttempts, p.MaxElapsed, p.Delay
+	if maxAttempts == 0 {
+		maxAttempts = retryMaxAttempts
+	}
+	if maxElapsed == 0 {
+		maxElapsed = retryMaxElapsed
+	}
+	if delay == 0 {
+		delay = retryDefaultDelay
+	}
+	if a.Attempt >= maxAttempts {
+		return 0, false
+	}
+
+	var d time.Duration
+	switch {
+	case a.Kind == RequestQuery:
+		d = delay << uint(a.Attempt-1)
+	case a.Err != nil:
+		if !p.RetryNetworkErrors || a.Kind == RequestStatement {
+			return 0, false
+		}
+		d = delay << uint(a.Attempt-1)
+	case a.StatusCode == http.StatusServiceUnavailable:
+		d = delay
+		if v := a.Header.Get("Retry-After"); v != "" {
+			d = retryAfter(v, time.Now())
+		}
+	default:
+		return 0, false
+	}
+	if a.Elapsed+d > maxElapsed {
+		return 0, false
+	}
+	return d, true
+}
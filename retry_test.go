@@ -0,0 +1,91 @@
+package prestgo
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStandardRetryPolicy(t *testing.T) {
+	unavailable := http.Header{"Retry-After": {"2"}}
+	reset := errors.New("connection reset by peer")
+
+	testCases := []struct {
+		policy StandardRetryPolicy
+		a      RetryAttempt
+		delay  time.Duration
+		retry  bool
+	}{
+		{a: RetryAttempt{Kind: RequestStatement, Attempt: 1, StatusCode: 503, Header: unavailable}, delay: 2 * time.Second, retry: true},
+		{a: RetryAttempt{Kind: RequestResults, Attempt: 1, StatusCode: 503, Header: http.Header{}}, delay: time.Second, retry: true},
+		{a: RetryAttempt{Kind: RequestResults, Attempt: 5, StatusCode: 503, Header: unavailable}},
+		{a: RetryAttempt{Kind: RequestResults, Attempt: 1, Elapsed: 29 * time.Second, StatusCode: 503, Header: unavailable}},
+		{a: RetryAttempt{Kind: RequestResults, Attempt: 1, StatusCode: 500, Header: http.Header{}}},
+		{a: RetryAttempt{Kind: RequestResults, Attempt: 1, Err: reset}},
+		{policy: StandardRetryPolicy{MaxAttempts: 2}, a: RetryAttempt{Kind: RequestResults, Attempt: 2, StatusCode: 503, Header: unavailable}},
+		{policy: StandardRetryPolicy{MaxElapsed: time.Second}, a: RetryAttempt{Kind: RequestResults, Attempt: 1, StatusCode: 503, Header: unavailable}},
+		{policy: StandardRetryPolicy{RetryNetworkErrors: true}, a: RetryAttempt{Kind: RequestResults, Attempt: 3, Err: reset}, delay: 4 * time.Second, retry: true},
+		{policy: StandardRetryPolicy{RetryNetworkErrors: true, Delay: time.Millisecond}, a: RetryAttempt{Kind: RequestInfo, Attempt: 1, Err: reset}, delay: time.Millisecond, retry: true},
+		{policy: StandardRetryPolicy{RetryNetworkErrors: true}, a: RetryAttempt{Kind: RequestStatement, Attempt: 1, Err: reset}},
+		{a: RetryAttempt{Kind: RequestQuery, Attempt: 2, Err: &Error{ErrorName: "REMOTE_HOST_GONE"}}, delay: 2 * time.Second, retry: true},
+		{a: RetryAttempt{Kind: RequestQuery, Attempt: 5, Err: &Error{ErrorName: "REMOTE_HOST_GONE"}}},
+	}
+
+	for _, tc := range testCases {
+		delay, retry := tc.policy.Retry(tc.a)
+		if delay != tc.delay || retry != tc.retry {
+			t.Errorf("%+v %+v: got %v, %v, wanted %v, %v", tc.policy, tc.a, delay, retry, tc.delay, tc.retry)
+		}
+	}
+}
+
+// recordingRetryPolicy records the attempts it is asked about, declining to retry.
+type recordingRetryPolicy struct {
+	mu       sync.Mutex
+	attempts []RetryAttempt
+}
+
+func (p *recordingRetryPolicy) Retry(a RetryAttempt) (time.Duration, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.attempts = append(p.attempts, a)
+	return 0, false
+}
+
+func TestConnectorRetryPolicy(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	c, err := NewConnector("presto://" + ts.Listener.Addr().String() + "/hive/default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &recordingRetryPolicy{}
+	c.RetryPolicy = p
+	cn, err := c.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, _ := cn.Prepare("SELECT 1")
+	if _, err := st.Query(nil); err == nil {
+		t.Fatal("got no error, wanted one")
+	}
+
+	if requests != 1 {
+		t.Errorf("got %d requests, wanted 1", requests)
+	}
+	if len(p.attempts) != 1 {
+		t.Fatalf("got attempts %+v, wanted 1", p.attempts)
+	}
+	if a := p.attempts[0]; a.Kind != RequestStatement || a.Attempt != 1 || a.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("got attempt %+v, wanted first statement attempt rejected with 503", a)
+	}
+}
@@ -0,0 +1,277 @@
+package prestgo
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScanArray returns a sql.Scanner that stores the value of an array column in dest, which
+// must be a pointer to a slice such as *[]int64 or *[][]string. Elements are converted to
+// the slice's element type, so an array(integer) column may be scanned into a *[]int32. A
+// NULL value sets the slice to nil.
+//
+// The scanners are functions named ScanArray, ScanMap and ScanRow, in the manner of
+// pq.Array, rather than types named Array, Map and Row, since those names are taken by the
+// constants naming the Presto types.
+//
+//	var tags []string
+//	err := rows.Scan(prestgo.ScanArray(&tags))
+func ScanArray(dest interface{}) sql.Scanner {
+	return containerScanner{dest: dest, kind: reflect.Slice}
+}
+
+// ScanMap returns a sql.Scanner that stores the value of a map column in dest, which must be
+// a pointer to a map such as *map[string]float64 or *map[int64][]string. Keys are parsed
+// from the textual form the server sends them in and values are converted to the map's value
+// type. A NULL value sets the map to nil.
+func ScanMap(dest interface{}) sql.Scanner {
+	return containerScanner{dest: dest, kind: reflect.Map}
+}
+
+// ScanRow returns a sql.Scanner that stores the value of a row column in dest, which must be
+// a pointer to a struct. Row fields are matched to struct fields by a `presto:"name"` tag or
+// otherwise by a case insensitive comparison with the struct field name, and a tag of "-"
+// excludes a struct field. Row fields without a matching struct field are ignored. Values
+// may be scanned whichever row_format the connection uses. Timestamps are in the
+// connection's time zone, as those of timestamp columns are, the JSON objects of the json
+// row_format giving the zone with each timestamp. A NULL value sets the struct to its zero
+// value.
+//
+//	var owner struct {
+//		Name   string
+//		Joined time.Time `presto:"joined_at"`
+//	}
+//	err := rows.Scan(prestgo.ScanRow(&owner))
+func ScanRow(dest interface{}) sql.Scanner {
+	return containerScanner{dest: dest, kind: reflect.Struct}
+}
+
+// containerScanner stores container values in a destination of the given kind.
+type containerScanner struct {
+	dest interface{}
+	kind reflect.Kind
+}
+
+func (s containerScanner) Scan(src interface{}) error {
+	rv := reflect.ValueOf(s.dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != s.kind {
+		return fmt.Errorf("%s: cannot scan into %T, a non-nil pointer to a %s is required", DriverName, s.dest, s.kind)
+	}
+
+	// Rows in json format and all values in raw format arrive as json text
+	if b, ok := src.([]byte); ok {
+		src = string(b)
+	}
+	if str, ok := src.(string); ok {
+		dec := json.NewDecoder(strings.NewReader(str))
+		dec.UseNumber()
+		if err := dec.Decode(&src); err != nil {
+			return fmt.Errorf("%s: cannot scan %q into %T: %v", DriverName, str, s.dest, err)
+		}
+	}
+
+	return assignValue(rv.Elem(), src)
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// assignValue stores src, a value produced by one of the driver's converters or decoded from
+// json text, in dst, converting it to dst's type where that can be done without loss.
+func assignValue(dst reflect.Value, src interface{}) error {
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+
+	sv := reflect.ValueOf(src)
+	if sv.Type().AssignableTo(dst.Type()) {
+		dst.Set(sv)
+		return nil
+	}
+
+	if dst.Kind() == reflect.Ptr {
+		v := reflect.New(dst.Type().Elem())
+		if err := assignValue(v.Elem(), src); err != nil {
+			return err
+		}
+		dst.Set(v)
+		return nil
+	}
+
+	if dst.Type() == timeType {
+		if str, ok := src.(string); ok {
+			// Values of nested temporal types are strings when decoded from json text
+			if ts, err := timestampWithTimezoneConverter(str); err == nil {
+				dst.Set(reflect.ValueOf(ts))
+				return nil
+			}
+			if ts, err := dateConverter(str); err == nil {
+				dst.Set(reflect.ValueOf(ts))
+				return nil
+			}
+		}
+		return assignError(dst, src)
+	}
+
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		switch v := src.(type) {
+		case int64:
+			n = v
+		case json.Number:
+			var err error
+			if n, err = strconv.ParseInt(string(v), 10, 64); err != nil {
+				return assignError(dst, src)
+			}
+		default:
+			return assignError(dst, src)
+		}
+		if dst.OverflowInt(n) {
+			return assignError(dst, src)
+		}
+		dst.SetInt(n)
+		return nil
+
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		switch v := src.(type) {
+		case float64:
+			f = v
+		case int64:
+			f = float64(v)
+		case json.Number:
+			var err error
+			if f, err = strconv.ParseFloat(string(v), 64); err != nil {
+				return assignError(dst, src)
+			}
+		case string:
+			// Non-finite doubles are sent as strings
+			var err error
+			if f, err = strconv.ParseFloat(v, 64); err != nil {
+				return assignError(dst, src)
+			}
+		default:
+			return assignError(dst, src)
+		}
+		if dst.OverflowFloat(f) {
+			return assignError(dst, src)
+		}
+		dst.SetFloat(f)
+		return nil
+
+	case reflect.String:
+		str, ok := src.(string)
+		if !ok {
+			return assignError(dst, src)
+		}
+		dst.SetString(str)
+		return nil
+
+	case reflect.Bool:
+		b, ok := src.(bool)
+		if !ok {
+			return assignError(dst, src)
+		}
+		dst.SetBool(b)
+		return nil
+
+	case reflect.Slice:
+		vs, ok := src.([]interface{})
+		if !ok {
+			return assignError(dst, src)
+		}
+		s := reflect.MakeSlice(dst.Type(), len(vs), len(vs))
+		for i, ev := range vs {
+			if err := assignValue(s.Index(i), ev); err != nil {
+				return err
+			}
+		}
+		dst.Set(s)
+		return nil
+
+	case reflect.Map:
+		vs, ok := src.(map[string]interface{})
+		if !ok {
+			return assignError(dst, src)
+		}
+		m := reflect.MakeMapWithSize(dst.Type(), len(vs))
+		for k, ev := range vs {
+			kv := reflect.New(dst.Type().Key()).Elem()
+			if err := assignValue(kv, mapKey(kv, k)); err != nil {
+				return err
+			}
+			vv := reflect.New(dst.Type().Elem()).Elem()
+			if err := assignValue(vv, ev); err != nil {
+				return err
+			}
+			m.SetMapIndex(kv, vv)
+		}
+		dst.Set(m)
+		return nil
+
+	case reflect.Struct:
+		vs, ok := src.(map[string]interface{})
+		if !ok {
+			return assignError(dst, src)
+		}
+		dst.Set(reflect.Zero(dst.Type()))
+		for name, fv := range vs {
+			f, ok := structField(dst, name)
+			if !ok {
+				continue
+			}
+			if err := assignValue(f, fv); err != nil {
+				return fmt.Errorf("%s: field %s: %v", DriverName, name, err)
+			}
+		}
+		return nil
+	}
+
+	return assignError(dst, src)
+}
+
+// mapKey returns the key k, which is always a string in the json response, in a form that
+// can be assigned to the key kv.
+func mapKey(kv reflect.Value, k string) interface{} {
+	switch kv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Float32, reflect.Float64:
+		return json.Number(k)
+	case reflect.Bool:
+		if b, err := strconv.ParseBool(k); err == nil {
+			return b
+		}
+	}
+	return k
+}
+
+// structField returns the field of the struct v that the row field name is stored in.
+func structField(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			// Unexported
+			continue
+		}
+		if tag, ok := sf.Tag.Lookup("presto"); ok {
+			if tag == name {
+				return v.Field(i), true
+			}
+			continue
+		}
+		if strings.EqualFold(sf.Name, name) {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func assignError(dst reflect.Value, src interface{}) error {
+	return fmt.Errorf("%s: cannot assign %v (%T) to type %s", DriverName, src, src, dst.Type())
+}
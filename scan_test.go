@@ -0,0 +1,255 @@
+package prestgo
+
+import (
+	"database/sql/driver"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScanArray(t *testing.T) {
+	testCases := []struct {
+		src      interface{}
+		dest     interface{}
+		expected interface{}
+		err      bool
+	}{
+		{
+			src:      []interface{}{int64(1), nil, int64(3)},
+			dest:     new([]int64),
+			expected: &[]int64{1, 0, 3},
+		},
+		{
+			src:      []interface{}{int64(1), nil},
+			dest:     new([]*int32),
+			expected: &[]*int32{int32Ptr(1), nil},
+		},
+		{
+			src:      []interface{}{[]interface{}{"a"}, []interface{}{}},
+			dest:     new([][]string),
+			expected: &[][]string{{"a"}, {}},
+		},
+		{
+			src:      []interface{}{0.5, "Infinity"},
+			dest:     new([]float64),
+			expected: &[]float64{0.5, math.Inf(1)},
+		},
+		{
+			src:  []interface{}{1e300},
+			dest: new([]float32),
+			err:  true,
+		},
+		{
+			src:      []interface{}{time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)},
+			dest:     new([]time.Time),
+			expected: &[]time.Time{time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			// raw_values
+			src:      "[1,2]",
+			dest:     new([]int),
+			expected: &[]int{1, 2},
+		},
+		{
+			src:      nil,
+			dest:     &[]int64{1},
+			expected: new([]int64),
+		},
+		{
+			src:  []interface{}{int64(300)},
+			dest: new([]int8),
+			err:  true,
+		},
+		{
+			src:  []interface{}{"a"},
+			dest: new([]int64),
+			err:  true,
+		},
+		{
+			src:  []interface{}{int64(1)},
+			dest: []int64{},
+			err:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		err := ScanArray(tc.dest).Scan(tc.src)
+		if tc.err == (err == nil) {
+			t.Errorf("%v: got error %v, wanted %v", tc.src, err, tc.err)
+		}
+		if err == nil && !reflect.DeepEqual(tc.dest, tc.expected) {
+			t.Errorf("%v: got %#v, wanted %#v", tc.src, tc.dest, tc.expected)
+		}
+	}
+}
+
+func TestScanMap(t *testing.T) {
+	testCases := []struct {
+		src      interface{}
+		dest     interface{}
+		expected interface{}
+		err      bool
+	}{
+		{
+			src:      map[string]interface{}{"a": 0.5, "b": nil},
+			dest:     new(map[string]float64),
+			expected: &map[string]float64{"a": 0.5, "b": 0},
+		},
+		{
+			src:      map[string]interface{}{"1": []interface{}{"x"}, "20": []interface{}{}},
+			dest:     new(map[int64][]string),
+			expected: &map[int64][]string{1: {"x"}, 20: {}},
+		},
+		{
+			src:      map[string]interface{}{"true": int64(1)},
+			dest:     new(map[bool]int),
+			expected: &map[bool]int{true: 1},
+		},
+		{
+			src:      nil,
+			dest:     &map[string]string{"a": "b"},
+			expected: new(map[string]string),
+		},
+		{
+			src:  map[string]interface{}{"x": int64(1)},
+			dest: new(map[int64]int64),
+			err:  true,
+		},
+		{
+			src:  []interface{}{int64(1)},
+			dest: new(map[string]int64),
+			err:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		err := ScanMap(tc.dest).Scan(tc.src)
+		if tc.err == (err == nil) {
+			t.Errorf("%v: got error %v, wanted %v", tc.src, err, tc.err)
+		}
+		if err == nil && !reflect.DeepEqual(tc.dest, tc.expected) {
+			t.Errorf("%v: got %#v, wanted %#v", tc.src, tc.dest, tc.expected)
+		}
+	}
+}
+
+type scanOwner struct {
+	Name    string
+	Joined  time.Time `presto:"joined_at"`
+	Age     *int64
+	Tags    []string
+	Ignored string `presto:"-"`
+	secret  string
+}
+
+func TestScanRow(t *testing.T) {
+	joined := time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		src      interface{}
+		expected scanOwner
+		err      bool
+	}{
+		{
+			// row_format=map
+			src:      map[string]interface{}{"name": "ian", "joined_at": joined, "age": int64(40), "tags": []interface{}{"a"}, "extra": true},
+			expected: scanOwner{Name: "ian", Joined: joined, Age: int64Ptr(40), Tags: []string{"a"}},
+		},
+		{
+			// row_format=json
+			src:      `{"NAME":"ian","joined_at":"2017-03-01 10:00:00.000","age":null,"ignored":"x","secret":"y"}`,
+			expected: scanOwner{Name: "ian", Joined: joined},
+		},
+		{
+			src:      nil,
+			expected: scanOwner{},
+		},
+		{
+			src: map[string]interface{}{"age": "forty"},
+			err: true,
+		},
+		{
+			src: `{"name":`,
+			err: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		owner := scanOwner{Name: "previous"}
+		err := ScanRow(&owner).Scan(tc.src)
+		if tc.err == (err == nil) {
+			t.Errorf("%v: got error %v, wanted %v", tc.src, err, tc.err)
+		}
+		if err == nil && !reflect.DeepEqual(owner, tc.expected) {
+			t.Errorf("%v: got %#v, wanted %#v", tc.src, owner, tc.expected)
+		}
+	}
+}
+
+func TestScanRowTimeZone(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skip(err)
+	}
+	for _, loc := range []*time.Location{london, time.FixedZone("", -5*60*60)} {
+		opts := converterOptions{location: loc}
+		rc, err := newConverter(parseTypeName("row(joined_at timestamp(3), visits array(timestamp(3)))"), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := rc.ConvertValue([]interface{}{"2017-03-01 10:00:00.000", []interface{}{"2017-06-01 09:30:00.000"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got struct {
+			Joined time.Time `presto:"joined_at"`
+			Visits []time.Time
+		}
+		if err := ScanRow(&got).Scan(v); err != nil {
+			t.Fatalf("%v: %v", loc, err)
+		}
+
+		// Nested timestamps are in the session time zone, as top-level timestamps are
+		tc, _ := newConverter(parseTypeName("timestamp(3)"), opts)
+		joined, _ := tc.ConvertValue("2017-03-01 10:00:00.000")
+		visit, _ := tc.ConvertValue("2017-06-01 09:30:00.000")
+		if !got.Joined.Equal(joined.(time.Time)) || len(got.Visits) != 1 || !got.Visits[0].Equal(visit.(time.Time)) {
+			t.Errorf("%v: got %v and %v from %s, wanted %v and %v", loc, got.Joined, got.Visits, v, joined, visit)
+		}
+		if loc == london && (got.Joined.Location().String() != "Europe/London" || got.Visits[0].Location().String() != "Europe/London") {
+			t.Errorf("got times in %v and %v, wanted Europe/London", got.Joined.Location(), got.Visits[0].Location())
+		}
+	}
+}
+
+func TestScanArrayFetched(t *testing.T) {
+	ts := httptest.NewServer(nestedTypesResponse)
+	defer ts.Close()
+
+	r := &rows{
+		conn: &conn{
+			client: http.DefaultClient,
+		},
+		nextURI: ts.URL + "/v1/query/abcd/1",
+	}
+
+	values := make([]driver.Value, 2)
+	if err := r.Next(values); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	var points []struct {
+		XY int `presto:"x, y"`
+	}
+	if err := ScanArray(&points).Scan(values[0]); err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 2 || points[0].XY != 1 || points[1].XY != 2 {
+		t.Errorf("got %+v", points)
+	}
+}
+
+func int32Ptr(v int32) *int32 { return &v }
+func int64Ptr(v int64) *int64 { return &v }
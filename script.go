@@ -0,0 +1,116 @@
+package prestgo
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"strings"
+)
+
+// splitStatements splits the text of a script into its statements at the semicolons that
+// end them, ignoring those in string literals, quoted identifiers and comments. Statements
+// holding nothing but comments are dropped.
+func splitStatements(script string) []string {
+	var stmts []string
+	add := func(s string) {
+		if word, _ := firstKeyword(s); word != "" {
+			stmts = append(stmts, strings.TrimSpace(s))
+		}
+	}
+
+	start := 0
+	for i := 0; i < len(script); {
+		switch c := script[i]; {
+		case c == '\'' || c == '"':
+			// Quotes within literals and identifiers are escaped by doubling them, which
+			// reads as two adjacent quoted sections
+			j := strings.IndexByte(script[i+1:], c)
+			if j < 0 {
+				i = len(script)
+				continue
+			}
+			i += j + 2
+		case strings.HasPrefix(script[i:], "--"):
+			j := strings.IndexByte(script[i:], '\n')
+			if j < 0 {
+				i = len(script)
+				continue
+			}
+			i += j
+		case strings.HasPrefix(script[i:], "/*"):
+			j := strings.Index(script[i+2:], "*/")
+			if j < 0 {
+				i = len(script)
+				continue
+			}
+			i += j + 4
+		case c == ';':
+			add(script[start:i])
+			i++
+			start = i
+		default:
+			i++
+		}
+	}
+	add(script[start:])
+	return stmts
+}
+
+// runScript runs the statement. When the connection splits statements and the text holds
+// several, only the first is run, returning rows that run each of the others in turn as the
+// caller moves to the next result set.
+func (s *stmt) runScript(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if !s.conn.multiStatement {
+		return s.run(ctx, args)
+	}
+	stmts := splitStatements(s.query)
+	if len(stmts) == 0 {
+		return s.run(ctx, args)
+	}
+
+	first := &stmt{conn: s.conn, query: stmts[0]}
+	r, err := first.run(ctx, args)
+	if err != nil || len(stmts) == 1 {
+		return r, err
+	}
+	return &scriptRows{rows: r.(*rows), ctx: ctx, script: stmts[1:]}, nil
+}
+
+// scriptRows are the rows of a text holding several statements, each of which is run once
+// the caller has moved on to its result set. The methods of the rows of the statement being
+// read are promoted, so the optional interfaces of the driver's rows are implemented.
+type scriptRows struct {
+	*rows
+	ctx    context.Context
+	script []string // statements not yet run
+}
+
+var _ driver.RowsNextResultSet = &scriptRows{}
+
+// HasNextResultSet reports whether statements remain to be run.
+func (s *scriptRows) HasNextResultSet() bool {
+	return len(s.script) > 0
+}
+
+// NextResultSet runs the next statement, once the current one has been drained of its
+// unread rows, so that a statement changing data is never abandoned before it finishes.
+func (s *scriptRows) NextResultSet() error {
+	if len(s.script) == 0 {
+		return io.EOF
+	}
+	if err := s.rows.drain(); err != nil {
+		s.script = nil
+		return err
+	}
+	s.rows.Close()
+
+	st := &stmt{conn: s.rows.conn, query: s.script[0]}
+	s.script = s.script[1:]
+	r, err := st.run(s.ctx, nil)
+	if err != nil {
+		s.script = nil
+		return err
+	}
+	s.rows = r.(*rows)
+	return nil
+}
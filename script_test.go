@@ -0,0 +1,136 @@
+package prestgo
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	testCases := []struct {
+		script   string
+		expected []string
+	}{
+		{script: "SELECT 1", expected: []string{"SELECT 1"}},
+		{script: "SELECT 1;", expected: []string{"SELECT 1"}},
+		{script: "SELECT 1; SELECT 2", expected: []string{"SELECT 1", "SELECT 2"}},
+		{script: "SELECT 'a;b'; SELECT 'it''s;'", expected: []string{"SELECT 'a;b'", "SELECT 'it''s;'"}},
+		{script: `SELECT "x;y" FROM t; SELECT 2`, expected: []string{`SELECT "x;y" FROM t`, "SELECT 2"}},
+		{script: "SELECT 1 -- one; two\n; SELECT 2", expected: []string{"SELECT 1 -- one; two", "SELECT 2"}},
+		{script: "SELECT /* ; */ 1; SELECT 2", expected: []string{"SELECT /* ; */ 1", "SELECT 2"}},
+		{script: "SELECT 1;\n-- the end\n", expected: []string{"SELECT 1"}},
+		{script: " ; ;", expected: nil},
+	}
+
+	for _, tc := range testCases {
+		if got := splitStatements(tc.script); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%q: got %q, wanted %q", tc.script, got, tc.expected)
+		}
+	}
+}
+
+func TestClientOpenMultiStatement(t *testing.T) {
+	testCases := []struct {
+		ds       string
+		expected bool
+		error    bool
+	}{
+		{ds: "presto://example/tree/birch", expected: false},
+		{ds: "presto://example/tree/birch?multi_statement=true", expected: true},
+		{ds: "presto://example/tree/birch?multi_statement=several", error: true},
+	}
+
+	for _, tc := range testCases {
+		cn, err := ClientOpen(http.DefaultClient, tc.ds)
+		if (err != nil) != tc.error {
+			t.Errorf("%s: got error=%v, wanted error=%v", tc.ds, err, tc.error)
+			continue
+		}
+		if err == nil && cn.(*conn).multiStatement != tc.expected {
+			t.Errorf("%s: got %v, wanted %v", tc.ds, cn.(*conn).multiStatement, tc.expected)
+		}
+	}
+}
+
+func TestMultiStatementResultSets(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	statements := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/v1/statement" {
+			body, _ := ioutil.ReadAll(r.Body)
+			requests = append(requests, string(body))
+			statements++
+			fmt.Fprintf(w, `{"id": "q%d", "nextUri": "http://%s/v1/query/q%[1]d/1", "stats": {"state": "QUEUED"}}`, statements, r.Host)
+			return
+		}
+		requests = append(requests, r.URL.Path)
+		var n, page int
+		fmt.Sscanf(r.URL.Path, "/v1/query/q%d/%d", &n, &page)
+		if n == 2 && page == 1 {
+			// The insert takes a while to produce its count
+			fmt.Fprintf(w, `{"id": "q2", "nextUri": "http://%s/v1/query/q2/2", "stats": {"state": "RUNNING"}}`, r.Host)
+			return
+		}
+		fmt.Fprintf(w, `{
+		  "id": "q%d",
+		  "columns": [ { "name": "col0", "type": "bigint", "typeSignature": { "rawType": "bigint", "arguments": [] } } ],
+		  "data": [ [ %[1]d ] ],
+		  "stats": {"state": "FINISHED"}
+		}`, n)
+	}))
+	defer ts.Close()
+
+	db, err := sql.Open(DriverName, "presto://"+ts.Listener.Addr().String()+"/hive/default?multi_statement=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT 1;\nINSERT INTO t VALUES 1;\n-- last\nSELECT 3;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var got []int64
+	for {
+		for rows.Next() {
+			var v int64
+			if err := rows.Scan(&v); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, v)
+			// The rows of the insert are left unread
+			break
+		}
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int64{1, 2, 3}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, wanted %v", got, expected)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{
+		"SELECT 1", "/v1/query/q1/1",
+		"INSERT INTO t VALUES 1", "/v1/query/q2/1", "/v1/query/q2/2",
+		"-- last\nSELECT 3", "/v1/query/q3/1",
+	}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Errorf("got requests\n%s\nwanted\n%s", strings.Join(requests, "\n"), strings.Join(expected, "\n"))
+	}
+}
@@ -0,0 +1,98 @@
+package prestgo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// logSlowQuery logs a query that took d to run, returning the given number of rows before
+// it ended with err.
+func (c *conn) logSlowQuery(query, queryID string, d time.Duration, rows int64, err error) {
+	var outcome string
+	switch {
+	case err == io.EOF:
+		outcome = "finished"
+	case errors.Is(err, context.Canceled):
+		outcome = "canceled"
+	default:
+		outcome = "failed: " + err.Error()
+	}
+	if c.slowQueryRedact {
+		query = redactQuery(query)
+	}
+	if queryID == "" {
+		queryID = "unknown"
+	}
+	logf(c.logger, LogWarn, "%s: slow query %s took %v, %s after %d rows: %s", DriverName, queryID, d, outcome, rows, query)
+}
+
+// redactQuery returns query with its string and numeric literals replaced by ?, so that it
+// may be logged without revealing the values it contains. Quoted identifiers and comments
+// are kept as they are.
+func redactQuery(query string) string {
+	var b strings.Builder
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'':
+			// String literal, in which quotes are escaped by doubling them
+			j := i + 1
+			for j < len(query) {
+				if query[j] == '\'' {
+					if j+1 < len(query) && query[j+1] == '\'' {
+						j += 2
+						continue
+					}
+					j++
+					break
+				}
+				j++
+			}
+			b.WriteByte('?')
+			i = j
+		case c == '"':
+			j := strings.IndexByte(query[i+1:], '"')
+			if j < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+j+2])
+			i += j + 2
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			j := strings.IndexByte(query[i:], '\n')
+			if j < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+j])
+			i += j
+		case isDigit(c) && (i == 0 || !isIdentChar(query[i-1])):
+			j := i
+			for j < len(query) && (isIdentChar(query[j]) || query[j] == '.' || isExponentSign(query, j)) {
+				j++
+			}
+			b.WriteByte('?')
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// isExponentSign reports whether the character at i is the sign of a number's exponent.
+func isExponentSign(query string, i int) bool {
+	return (query[i] == '+' || query[i] == '-') && (query[i-1] == 'e' || query[i-1] == 'E')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isIdentChar(c byte) bool {
+	return isDigit(c) || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_'
+}
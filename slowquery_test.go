@@ -0,0 +1,107 @@
+package prestgo
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestRedactQuery(t *testing.T) {
+	testCases := []struct {
+		query    string
+		expected string
+	}{
+		{
+			query:    "SELECT name FROM users WHERE email = 'alice@example.com' AND age > 30",
+			expected: "SELECT name FROM users WHERE email = ? AND age > ?",
+		},
+		{
+			query:    "SELECT 'it''s', 1.5e-3, col2 FROM t2 LIMIT 10",
+			expected: "SELECT ?, ?, col2 FROM t2 LIMIT ?",
+		},
+		{
+			query:    `SELECT "col 1" FROM "table 2" WHERE ts > TIMESTAMP '2017-03-01 10:00:00'`,
+			expected: `SELECT "col 1" FROM "table 2" WHERE ts > TIMESTAMP ?`,
+		},
+		{
+			query:    "SELECT 1 -- secret 'kept' in comment\nFROM t",
+			expected: "SELECT ? -- secret 'kept' in comment\nFROM t",
+		},
+		{
+			query:    "SELECT 'unterminated",
+			expected: "SELECT ?",
+		},
+	}
+
+	for _, tc := range testCases {
+		if got := redactQuery(tc.query); got != tc.expected {
+			t.Errorf("%q: got %q, wanted %q", tc.query, got, tc.expected)
+		}
+	}
+}
+
+func TestSlowQueryLog(t *testing.T) {
+	ts := httptest.NewServer(statementHandler(multiPageResponse))
+	defer ts.Close()
+
+	testCases := []struct {
+		threshold time.Duration
+		redact    bool
+		read      int // rows to read before closing, or -1 for all
+		expected  *regexp.Regexp
+	}{
+		{
+			threshold: time.Nanosecond,
+			read:      -1,
+			expected:  regexp.MustCompile(`^WARN prestgo: slow query abcd took \S+, finished after 6 rows: SELECT col0 FROM t WHERE col1 = 'x'$`),
+		},
+		{
+			threshold: time.Nanosecond,
+			redact:    true,
+			read:      2,
+			expected:  regexp.MustCompile(`^WARN prestgo: slow query abcd took \S+, canceled after 2 rows: SELECT col0 FROM t WHERE col1 = \?$`),
+		},
+		{
+			// Queries faster than the threshold are not logged
+			threshold: time.Hour,
+			read:      -1,
+		},
+	}
+
+	for _, tc := range testCases {
+		l := &recordingLogger{}
+		c := &conn{
+			client:             http.DefaultClient,
+			addr:               ts.Listener.Addr().String(),
+			logger:             l,
+			slowQueryThreshold: tc.threshold,
+			slowQueryRedact:    tc.redact,
+		}
+		st, _ := c.Prepare("SELECT col0 FROM t WHERE col1 = 'x'")
+		rs, err := st.(*stmt).QueryContext(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dest := make([]driver.Value, 1)
+		for n := 0; tc.read < 0 || n < tc.read; n++ {
+			if err := rs.Next(dest); err != nil {
+				break
+			}
+		}
+		rs.Close()
+
+		l.mu.Lock()
+		if tc.expected == nil {
+			if len(l.messages) != 0 {
+				t.Errorf("threshold %v: got messages %q, wanted none", tc.threshold, l.messages)
+			}
+		} else if len(l.messages) != 1 || !tc.expected.MatchString(l.messages[0]) {
+			t.Errorf("threshold %v: got messages %q, wanted one matching %s", tc.threshold, l.messages, tc.expected)
+		}
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,333 @@
+package prestgo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// spooledDefaultDownloads is the number of spooled segments downloaded at once when the
+// spooled_downloads data source option is not given.
+const spooledDefaultDownloads = 4
+
+// Retries of the download of a spooled segment that failed without a response or with an
+// error of the storage holding it. The delay doubles with each attempt.
+const (
+	segmentMaxAttempts = 3
+	segmentRetryDelay  = 100 * time.Millisecond
+)
+
+// spooledData is the data of a response under the spooled protocol, in which the rows are
+// sent in segments that are either inline, their rows encoded in the response itself, or
+// spooled, their rows left in storage to be downloaded by the client.
+type spooledData struct {
+	Encoding string        `json:"encoding"`
+	Segments []dataSegment `json:"segments"`
+}
+
+type dataSegment struct {
+	Type     string              `json:"type"`
+	Data     []byte              `json:"data"` // rows of an inline segment
+	URI      string              `json:"uri"`  // location of the rows of a spooled segment
+	AckURI   string              `json:"ackUri"`
+	Headers  map[string][]string `json:"headers"` // sent with the requests for a spooled segment
+	Metadata segmentMetadata     `json:"metadata"`
+}
+
+type segmentMetadata struct {
+	RowOffset   int64 `json:"rowOffset"`
+	RowsCount   int64 `json:"rowsCount"`
+	SegmentSize int64 `json:"segmentSize"`
+
+	// UncompressedSize is set when the segment has been compressed as its encoding
+	// allows. Segments that would not be made smaller are sent uncompressed.
+	UncompressedSize int64 `json:"uncompressedSize"`
+}
+
+// dataEncodings returns the value of the header asking for results to be sent under the
+// spooled protocol, listing the encodings of segments the driver can read in order of
+// preference. Segments compressed with zstd can be read once a decompressor for zstd
+// has been registered.
+func dataEncodings() string {
+	decompressorsMu.RLock()
+	_, zstd := decompressors["zstd"]
+	decompressorsMu.RUnlock()
+	if zstd {
+		return "json+zstd, json"
+	}
+	return "json"
+}
+
+// decodeSpooledData reads the object describing the segments of a page of results from
+// dec, its opening brace having already been read.
+func decodeSpooledData(dec *json.Decoder) (*spooledData, error) {
+	data := new(spooledData)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := tok.(string)
+
+		switch key {
+		case "encoding":
+			err = dec.Decode(&data.Encoding)
+		case "segments":
+			err = dec.Decode(&data.Segments)
+		default:
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, err
+	}
+	if data.Encoding == "" {
+		return nil, fmt.Errorf("%s: no encoding given for spooled data", DriverName)
+	}
+	return data, nil
+}
+
+// segmentResult is a segment's rows, as downloaded or sent inline, or the failure to
+// download them.
+type segmentResult struct {
+	data []byte
+	err  error
+}
+
+// loadSegments decodes the rows of the segments of a page sent under the spooled protocol
+// into the page, returning the bytes of the segments downloaded. Up to spooledDownloads
+// spooled segments are downloaded at once while the segments are decoded in order as
+// each becomes available, so the rows reach Next in the order of the result.
+func (r *rows) loadSegments(ctx context.Context, qresp *queryResponse) (int64, error) {
+	spooled := qresp.spooled
+	qresp.spooled = nil
+	compression := ""
+	switch spooled.Encoding {
+	case "json":
+	case "json+zstd":
+		compression = "zstd"
+	default:
+		return 0, fmt.Errorf("%s: unsupported encoding %q of spooled data", DriverName, spooled.Encoding)
+	}
+
+	columns := qresp.Columns
+	if columns == nil {
+		columns = r.rawColumns
+	}
+	rowCount := 0
+	for _, seg := range spooled.Segments {
+		rowCount += int(seg.Metadata.RowsCount)
+	}
+
+	// Once the segments have been decoded, or decoding fails, any downloads still under
+	// way are abandoned
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results, sem := r.downloadSegments(ctx, spooled.Segments)
+
+	var page *pageBuffer
+	if r.columnar {
+		qresp.cols = newColumnarPage(columns, r.conn.conv)
+	} else {
+		page = newPageBuffer(rowCount, len(columns))
+	}
+	var downloaded int64
+	err := func() error {
+		for i, seg := range spooled.Segments {
+			res := <-results[i]
+			if res.err != nil {
+				return res.err
+			}
+			err := r.decodeSegment(qresp, page, res.data, compression, seg.Metadata.UncompressedSize > 0)
+			if seg.Type == "spooled" {
+				downloaded += int64(len(res.data))
+				// The download's bytes are no longer held once decoded, so the next segment
+				// may be downloaded in their place
+				<-sem
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		if page != nil {
+			page.release()
+		}
+		qresp.cols = nil
+		return downloaded, err
+	}
+	if page != nil {
+		page.sliceRows()
+		qresp.page, qresp.Data = page, page.rows
+	}
+	return downloaded, nil
+}
+
+// downloadSegments starts the download of the spooled segments of segs, returning the
+// channels on which the rows of each segment will be received and the semaphore limiting
+// the downloads. A slot of the semaphore is held for each spooled segment from the start
+// of its download until the caller has decoded it and receives from the semaphore, so no
+// more than spooledDownloads segments are downloading or waiting to be decoded at once,
+// later segments waiting for the earlier to be consumed. Each spooled segment is
+// acknowledged once downloaded, so that the server may remove it from storage.
+func (r *rows) downloadSegments(ctx context.Context, segs []dataSegment) ([]chan segmentResult, chan struct{}) {
+	results := make([]chan segmentResult, len(segs))
+	for i := range results {
+		results[i] = make(chan segmentResult, 1)
+	}
+	n := r.conn.spooledDownloads
+	if n <= 0 {
+		n = spooledDefaultDownloads
+	}
+	sem := make(chan struct{}, n)
+
+	go func() {
+		for i := range segs {
+			seg := &segs[i]
+			switch seg.Type {
+			case "inline":
+				results[i] <- segmentResult{data: seg.Data}
+				continue
+			case "spooled":
+			default:
+				results[i] <- segmentResult{err: fmt.Errorf("%s: unsupported segment type %q", DriverName, seg.Type)}
+				continue
+			}
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				results[i] <- segmentResult{err: ctx.Err()}
+				continue
+			}
+			go func(res chan<- segmentResult) {
+				data, err := r.downloadSegment(ctx, seg)
+				if err == nil && seg.AckURI != "" {
+					r.ackSegment(ctx, seg)
+				}
+				res <- segmentResult{data: data, err: err}
+			}(results[i])
+		}
+	}()
+	return results, sem
+}
+
+// downloadSegment reads the rows of a spooled segment from storage.
+func (r *rows) downloadSegment(ctx context.Context, seg *dataSegment) ([]byte, error) {
+	resp, err := r.segmentRequest(ctx, seg.URI, seg.Headers)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		err := newHTTPError(resp)
+		// The URI of a segment may carry the credentials to read it
+		if i := strings.IndexByte(err.URL, '?'); i >= 0 {
+			err.URL = err.URL[:i]
+		}
+		return nil, err
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// ackSegment tells the server that a spooled segment has been downloaded. A failure is
+// ignored since the server removes segments that are not acknowledged once they expire.
+func (r *rows) ackSegment(ctx context.Context, seg *dataSegment) {
+	resp, err := r.segmentRequest(ctx, seg.AckURI, seg.Headers)
+	if err != nil {
+		return
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+// segmentRequest sends a GET request for uri with the headers given for a segment, making
+// up to segmentMaxAttempts attempts while the request fails without a response or with a
+// server error. Segments are held in storage rather than by the coordinator, so the
+// request is sent directly with the connection's client, without the coordinator's
+// session headers, retry policy or circuit breaker. The URI may carry the credentials to
+// read the segment, so is logged without its query string.
+func (r *rows) segmentRequest(ctx context.Context, uri string, headers map[string][]string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range headers {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	req = req.WithContext(ctx)
+
+	c := r.conn
+	for attempt := 1; ; attempt++ {
+		sent := time.Now()
+		resp, err := c.client.Do(req)
+		if c.wireLog {
+			if err != nil {
+				logWireError(c.logger, req, sent, err)
+			} else {
+				logWireResponse(c.logger, req, resp, sent)
+			}
+		}
+		if err != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if attempt == segmentMaxAttempts || (err == nil && resp.StatusCode < 500) {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if err := wait(ctx, segmentRetryDelay<<uint(attempt-1)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// decodeSegment appends the rows of a segment to the page being loaded into qresp, which
+// are held in page unless the rows are decoded column by column. The rows are
+// decompressed first if compressed is set. The bytes of the decoded rows are reserved from
+// the budget for the page.
+func (r *rows) decodeSegment(qresp *queryResponse, page *pageBuffer, data []byte, compression string, compressed bool) error {
+	var rd io.Reader = bytes.NewReader(data)
+	if compressed {
+		decompressorsMu.RLock()
+		fn := decompressors[compression]
+		decompressorsMu.RUnlock()
+		if fn == nil {
+			return fmt.Errorf("%s: no decompressor registered for %s", DriverName, compression)
+		}
+		zr, err := fn(rd)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		rd = zr
+	}
+
+	br := &budgetReader{r: rd, b: r.budget, n: qresp.size}
+	defer func() { qresp.size = br.n }()
+	dec := json.NewDecoder(br)
+	dec.UseNumber()
+	if err := expectDelim(dec, '['); err != nil {
+		return err
+	}
+	if page != nil {
+		return page.decodeRows(dec)
+	}
+	return qresp.cols.decodeRows(dec)
+}
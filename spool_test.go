@@ -0,0 +1,373 @@
+package prestgo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// spooledServer serves a query whose rows are sent under the spooled protocol, in two pages
+// of segments. The first page has an inline segment followed by spooled segments, the
+// earlier of which take longer to download, and the second a single spooled segment.
+type spooledServer struct {
+	t        *testing.T
+	encoding string // expected in the request submitting the query
+	fail     int    // segment whose download fails, if not zero
+
+	mu           sync.Mutex
+	inFlight     int
+	maxInFlight  int
+	started      int // segments whose download has started
+	startedEarly int // segments started by the time the slowest, segment 3, was sent
+	acked        []string
+}
+
+func (s *spooledServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/v1/statement":
+		if got := r.Header.Get("X-Presto-Query-Data-Encoding"); got != s.encoding {
+			s.t.Errorf("got data encoding %q, wanted %q", got, s.encoding)
+		}
+		fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%s/v1/query/abcd/1", "stats": {"state": "QUEUED"}}`, r.Host)
+	case r.URL.Path == "/v1/query/abcd/1":
+		inline := base64.StdEncoding.EncodeToString([]byte(`[[1, "a"], [2, "b"]]`))
+		fmt.Fprintf(w, `{
+		  "id": "abcd",
+		  "nextUri": "http://%[1]s/v1/query/abcd/2",
+		  "columns": [
+		    { "name": "id", "type": "bigint", "typeSignature": { "rawType": "bigint", "arguments": [] } },
+		    { "name": "name", "type": "varchar", "typeSignature": { "rawType": "varchar", "arguments": [] } }
+		  ],
+		  "data": {
+		    "encoding": "json",
+		    "segments": [
+		      { "type": "inline", "data": %[2]q, "metadata": { "rowOffset": 0, "rowsCount": 2, "segmentSize": 20 } },
+		      { "type": "spooled", "uri": "http://%[1]s/segments/3?sig=secret", "ackUri": "http://%[1]s/ack/3", "headers": { "X-Segment-Key": [ "k" ] }, "metadata": { "rowOffset": 2, "rowsCount": 1 } },
+		      { "type": "spooled", "uri": "http://%[1]s/segments/4?sig=secret", "ackUri": "http://%[1]s/ack/4", "headers": { "X-Segment-Key": [ "k" ] }, "metadata": { "rowOffset": 3, "rowsCount": 1 } },
+		      { "type": "spooled", "uri": "http://%[1]s/segments/5?sig=secret", "ackUri": "http://%[1]s/ack/5", "headers": { "X-Segment-Key": [ "k" ] }, "metadata": { "rowOffset": 4, "rowsCount": 1 } }
+		    ]
+		  },
+		  "stats": {"state": "RUNNING"}
+		}`, r.Host, inline)
+	case r.URL.Path == "/v1/query/abcd/2":
+		fmt.Fprintf(w, `{
+		  "id": "abcd",
+		  "data": {
+		    "encoding": "json",
+		    "segments": [
+		      { "type": "spooled", "uri": "http://%[1]s/segments/6", "ackUri": "http://%[1]s/ack/6", "headers": { "X-Segment-Key": [ "k" ] }, "metadata": { "rowOffset": 5, "rowsCount": 1 } }
+		    ]
+		  },
+		  "stats": {"state": "FINISHED"}
+		}`, r.Host)
+	case strings.HasPrefix(r.URL.Path, "/segments/"):
+		if got := r.Header.Get("X-Segment-Key"); got != "k" {
+			s.t.Errorf("got segment header %q, wanted k", got)
+		}
+		var n int
+		fmt.Sscanf(r.URL.Path, "/segments/%d", &n)
+		if n == s.fail {
+			http.Error(w, `{"message": "gone"}`, http.StatusNotFound)
+			return
+		}
+
+		s.mu.Lock()
+		s.inFlight++
+		s.started++
+		if s.inFlight > s.maxInFlight {
+			s.maxInFlight = s.inFlight
+		}
+		s.mu.Unlock()
+		// Earlier segments are slower, so they complete after those following them
+		time.Sleep(time.Duration(7-n) * 20 * time.Millisecond)
+		s.mu.Lock()
+		s.inFlight--
+		if n == 3 {
+			s.startedEarly = s.started
+		}
+		s.mu.Unlock()
+		fmt.Fprintf(w, `[[%d, "%c"]]`, n, 'a'+n-1)
+	case strings.HasPrefix(r.URL.Path, "/ack/"):
+		s.mu.Lock()
+		s.acked = append(s.acked, r.URL.Path)
+		s.mu.Unlock()
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestSpooledSegments(t *testing.T) {
+	testCases := []struct {
+		name      string
+		downloads int
+		columnar  bool
+	}{
+		{name: "rows", downloads: 2},
+		{name: "one at a time", downloads: 1},
+		{name: "columnar", downloads: 3, columnar: true},
+	}
+
+	for _, tc := range testCases {
+		srv := &spooledServer{t: t, encoding: "json"}
+		ts := httptest.NewServer(srv)
+
+		cn := &conn{client: http.DefaultClient, addr: ts.Listener.Addr().String(), spooled: true, spooledDownloads: tc.downloads}
+		s := &stmt{conn: cn, query: "SELECT * FROM t"}
+		ctx := context.Background()
+		if tc.columnar {
+			ctx = WithColumnBatches(ctx)
+		}
+		r, err := s.QueryContext(ctx, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		var got []string
+		values := make([]driver.Value, 2)
+		for {
+			err := r.Next(values)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", tc.name, err)
+			}
+			got = append(got, fmt.Sprintf("%v:%v", values[0], values[1]))
+		}
+		r.Close()
+		ts.Close()
+
+		if expected := []string{"1:a", "2:b", "3:c", "4:d", "5:e", "6:f"}; !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: got rows %v, wanted %v", tc.name, got, expected)
+		}
+		srv.mu.Lock()
+		// The three spooled segments of the first page are downloaded together as far as
+		// allowed
+		if srv.maxInFlight != tc.downloads {
+			t.Errorf("%s: got %d segments downloaded at once, wanted %d", tc.name, srv.maxInFlight, tc.downloads)
+		}
+		// Segments downloaded while an earlier one is outstanding are held until it is
+		// decoded, so count against the limit until then
+		if srv.startedEarly != tc.downloads {
+			t.Errorf("%s: got %d segments started before the first was decoded, wanted %d", tc.name, srv.startedEarly, tc.downloads)
+		}
+		sort.Strings(srv.acked)
+		if expected := []string{"/ack/3", "/ack/4", "/ack/5", "/ack/6"}; !reflect.DeepEqual(srv.acked, expected) {
+			t.Errorf("%s: got acknowledgements %v, wanted %v", tc.name, srv.acked, expected)
+		}
+		srv.mu.Unlock()
+	}
+}
+
+func TestSpooledSegmentFailed(t *testing.T) {
+	srv := &spooledServer{t: t, encoding: "json", fail: 4}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	cn := &conn{client: http.DefaultClient, addr: ts.Listener.Addr().String(), spooled: true}
+	s := &stmt{conn: cn, query: "SELECT * FROM t"}
+	r, err := s.QueryContext(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	err = r.Next(make([]driver.Value, 2))
+	var herr *HTTPError
+	if !errors.As(err, &herr) || herr.StatusCode != http.StatusNotFound {
+		t.Fatalf("got error %v, wanted the failed download of the segment", err)
+	}
+	if strings.Contains(herr.Error(), "secret") {
+		t.Errorf("got error %v, wanted the segment's URI without its query string", err)
+	}
+}
+
+func TestSpooledSegmentRetried(t *testing.T) {
+	var attempts int
+	var mu sync.Mutex
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/statement":
+			fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%s/v1/query/abcd/1", "stats": {"state": "QUEUED"}}`, r.Host)
+		case "/v1/query/abcd/1":
+			fmt.Fprintf(w, `{
+			  "id": "abcd",
+			  "columns": [ { "name": "id", "type": "bigint", "typeSignature": { "rawType": "bigint", "arguments": [] } } ],
+			  "data": {
+			    "encoding": "json",
+			    "segments": [ { "type": "spooled", "uri": "http://%s/segments/1", "metadata": { "rowOffset": 0, "rowsCount": 1 } } ]
+			  },
+			  "stats": {"state": "FINISHED"}
+			}`, r.Host)
+		case "/segments/1":
+			mu.Lock()
+			attempts++
+			n := attempts
+			mu.Unlock()
+			if n < segmentMaxAttempts {
+				http.Error(w, "slow down", http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, `[[1]]`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	cn := &conn{client: http.DefaultClient, addr: ts.Listener.Addr().String(), spooled: true}
+	s := &stmt{conn: cn, query: "SELECT id FROM t"}
+	r, err := s.QueryContext(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	values := make([]driver.Value, 1)
+	if err := r.Next(values); err != nil {
+		t.Fatal(err)
+	}
+	if values[0] != int64(1) {
+		t.Errorf("got %v, wanted 1", values[0])
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != segmentMaxAttempts {
+		t.Errorf("got %d attempts at the segment, wanted %d", attempts, segmentMaxAttempts)
+	}
+}
+
+func TestSpooledSegmentsWireLog(t *testing.T) {
+	srv := &spooledServer{t: t, encoding: "json"}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	l := &recordingLogger{}
+	cn := &conn{client: http.DefaultClient, addr: ts.Listener.Addr().String(), spooled: true, wireLog: true, logger: l}
+	s := &stmt{conn: cn, query: "SELECT * FROM t"}
+	r, err := s.QueryContext(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make([]driver.Value, 2)
+	for {
+		err := r.Next(values)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.Close()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var segments int
+	for _, m := range l.messages {
+		if strings.Contains(m, "/segments/") {
+			segments++
+		}
+		if strings.Contains(m, "sig=") || strings.Contains(m, "secret") {
+			t.Errorf("got message %q, wanted the segment's URI without its query string", m)
+		}
+	}
+	if segments != 4 {
+		t.Errorf("got %d messages logging segment downloads, wanted 4", segments)
+	}
+}
+
+func TestSpooledCompressedSegments(t *testing.T) {
+	// gzip stands in for zstd, the encoding of segments being decompressed by whichever
+	// decompressor is registered for it
+	RegisterDecompressor("zstd", newGzipReader)
+	defer RegisterDecompressor("zstd", nil)
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte(`[[1], [2]]`))
+	zw.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/statement" {
+			if got, expected := r.Header.Get("X-Presto-Query-Data-Encoding"), "json+zstd, json"; got != expected {
+				t.Errorf("got data encoding %q, wanted %q", got, expected)
+			}
+			fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%s/v1/query/abcd/1", "stats": {"state": "QUEUED"}}`, r.Host)
+			return
+		}
+		// Segments are compressed only when that makes them smaller
+		fmt.Fprintf(w, `{
+		  "id": "abcd",
+		  "columns": [ { "name": "id", "type": "bigint", "typeSignature": { "rawType": "bigint", "arguments": [] } } ],
+		  "data": {
+		    "encoding": "json+zstd",
+		    "segments": [
+		      { "type": "inline", "data": %q, "metadata": { "rowOffset": 0, "rowsCount": 2, "uncompressedSize": 10 } },
+		      { "type": "inline", "data": %q, "metadata": { "rowOffset": 2, "rowsCount": 1 } }
+		    ]
+		  },
+		  "stats": {"state": "FINISHED"}
+		}`, base64.StdEncoding.EncodeToString(compressed.Bytes()), base64.StdEncoding.EncodeToString([]byte(`[[3]]`)))
+	}))
+	defer ts.Close()
+
+	cn := &conn{client: http.DefaultClient, addr: ts.Listener.Addr().String(), spooled: true}
+	s := &stmt{conn: cn, query: "SELECT id FROM t"}
+	r, err := s.QueryContext(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var got []int64
+	values := make([]driver.Value, 1)
+	for {
+		err := r.Next(values)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, values[0].(int64))
+	}
+	if expected := []int64{1, 2, 3}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, wanted %v", got, expected)
+	}
+}
+
+func TestDecodeSpooledData(t *testing.T) {
+	qresp, err := decodeQueryResponse(strings.NewReader(`{
+	  "data": {
+	    "encoding": "json",
+	    "segments": [ { "type": "inline", "data": "W1sxXV0=", "metadata": { "rowOffset": 0, "rowsCount": 1, "segmentSize": 5 } } ]
+	  }
+	}`), false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &spooledData{
+		Encoding: "json",
+		Segments: []dataSegment{{Type: "inline", Data: []byte("[[1]]"), Metadata: segmentMetadata{RowsCount: 1, SegmentSize: 5}}},
+	}
+	if !reflect.DeepEqual(qresp.spooled, expected) {
+		t.Errorf("got %+v, wanted %+v", qresp.spooled, expected)
+	}
+	if qresp.Data != nil {
+		t.Errorf("got data %v, wanted none until the segments are loaded", qresp.Data)
+	}
+
+	if _, err := decodeQueryResponse(strings.NewReader(`{"data": {"segments": []}}`), false, nil); err == nil {
+		t.Errorf("got no error for spooled data without an encoding")
+	}
+}
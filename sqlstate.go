@@ -0,0 +1,72 @@
+package prestgo
+
+// sqlStates maps the errorName of a failure to the SQLSTATE code of the closest standard
+// condition. Where the standard leaves a condition implementation defined, the code used by
+// PostgreSQL is chosen since it is the one most tools recognise.
+var sqlStates = map[string]string{
+	// Syntax and access rule violations
+	"SYNTAX_ERROR":          "42601",
+	"PERMISSION_DENIED":     "42501",
+	"TABLE_NOT_FOUND":       "42P01",
+	"MISSING_TABLE":         "42P01",
+	"COLUMN_NOT_FOUND":      "42703",
+	"MISSING_COLUMN_NAME":   "42703",
+	"MISSING_ATTRIBUTE":     "42703",
+	"SCHEMA_NOT_FOUND":      "3F000",
+	"MISSING_SCHEMA_NAME":   "3F000",
+	"CATALOG_NOT_FOUND":     "3D000",
+	"MISSING_CATALOG_NAME":  "3D000",
+	"FUNCTION_NOT_FOUND":    "42883",
+	"TYPE_NOT_FOUND":        "42704",
+	"TYPE_MISMATCH":         "42804",
+	"AMBIGUOUS_NAME":        "42702",
+	"AMBIGUOUS_ATTRIBUTE":   "42702",
+	"TABLE_ALREADY_EXISTS":  "42P07",
+	"COLUMN_ALREADY_EXISTS": "42701",
+	"SCHEMA_ALREADY_EXISTS": "42P06",
+
+	// Data exceptions
+	"DIVISION_BY_ZERO":           "22012",
+	"NUMERIC_VALUE_OUT_OF_RANGE": "22003",
+	"INVALID_CAST_ARGUMENT":      "22018",
+	"INVALID_FUNCTION_ARGUMENT":  "22023",
+	"INVALID_SESSION_PROPERTY":   "22023",
+	"CONSTRAINT_VIOLATION":       "23000",
+
+	// Features and operator intervention
+	"NOT_SUPPORTED":           "0A000",
+	"USER_CANCELED":           "57014",
+	"EXCEEDED_TIME_LIMIT":     "57014",
+	"ADMINISTRATIVELY_KILLED": "57000",
+	"SERVER_SHUTTING_DOWN":    "57P01",
+	"SERVER_STARTING_UP":      "57P03",
+
+	// Insufficient resources
+	"EXCEEDED_MEMORY_LIMIT":        "53200",
+	"EXCEEDED_LOCAL_MEMORY_LIMIT":  "53200",
+	"EXCEEDED_GLOBAL_MEMORY_LIMIT": "53200",
+	"CLUSTER_OUT_OF_MEMORY":        "53200",
+	"QUERY_QUEUE_FULL":             "53000",
+}
+
+// sqlStateClasses maps the errorType of a failure to the SQLSTATE code used when its
+// errorName has no more specific code.
+var sqlStateClasses = map[string]string{
+	"USER_ERROR":             "42000",
+	"INSUFFICIENT_RESOURCES": "53000",
+	"INTERNAL_ERROR":         "XX000",
+	"EXTERNAL":               "58000",
+}
+
+// SQLState returns the five character SQLSTATE code corresponding to the failure, for use
+// with tools that classify errors that way. Failures without a more specific code are given
+// the code of their error type's class, or HY000 for a general error.
+func (e *Error) SQLState() string {
+	if code, ok := sqlStates[e.ErrorName]; ok {
+		return code
+	}
+	if code, ok := sqlStateClasses[e.ErrorType]; ok {
+		return code
+	}
+	return "HY000"
+}
@@ -0,0 +1,27 @@
+package prestgo
+
+import "testing"
+
+func TestErrorSQLState(t *testing.T) {
+	testCases := []struct {
+		err      *Error
+		expected string
+	}{
+		{err: &Error{ErrorName: "SYNTAX_ERROR", ErrorType: "USER_ERROR"}, expected: "42601"},
+		{err: &Error{ErrorName: "PERMISSION_DENIED", ErrorType: "USER_ERROR"}, expected: "42501"},
+		{err: &Error{ErrorName: "TABLE_NOT_FOUND", ErrorType: "USER_ERROR"}, expected: "42P01"},
+		{err: &Error{ErrorName: "MISSING_TABLE", ErrorType: "USER_ERROR"}, expected: "42P01"},
+		{err: &Error{ErrorName: "DIVISION_BY_ZERO", ErrorType: "USER_ERROR"}, expected: "22012"},
+		{err: &Error{ErrorName: "EXCEEDED_GLOBAL_MEMORY_LIMIT", ErrorType: "INSUFFICIENT_RESOURCES"}, expected: "53200"},
+		{err: &Error{ErrorName: "INVALID_VIEW", ErrorType: "USER_ERROR"}, expected: "42000"},
+		{err: &Error{ErrorName: "GENERIC_INTERNAL_ERROR", ErrorType: "INTERNAL_ERROR"}, expected: "XX000"},
+		{err: &Error{ErrorName: "HIVE_METASTORE_ERROR", ErrorType: "EXTERNAL"}, expected: "58000"},
+		{err: &Error{Message: "no code"}, expected: "HY000"},
+	}
+
+	for _, tc := range testCases {
+		if code := tc.err.SQLState(); code != tc.expected {
+			t.Errorf("%s %s: got %q, wanted %q", tc.err.ErrorName, tc.err.ErrorType, code, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package prestgo
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// srvScheme is the scheme of data source names that name SRV records listing the
+// coordinators, such as presto+srv://_presto._tcp.example.com/hive.
+const srvScheme = "presto+srv"
+
+// srvRefreshInterval is how long the coordinators found in SRV records are used before the
+// records are looked up again.
+const srvRefreshInterval = 30 * time.Second
+
+// lookupSRV looks up SRV records. It is a variable so that tests can replace it.
+var lookupSRV = net.DefaultResolver.LookupSRV
+
+// srvBalancerFor returns the balancer for the coordinators listed by the SRV records of
+// name using policy.
+func srvBalancerFor(name string, policy int) *balancer {
+	return registerBalancer(srvScheme+":"+name, policy, func(b *balancer) {
+		b.srv = name
+	})
+}
+
+// discover ensures that the coordinators of a balancer created from SRV records are known.
+// The first lookup is waited for. Once the records are older than srvRefreshInterval they
+// are looked up again in the background, the coordinators already found being used
+// meanwhile.
+func (b *balancer) discover(ctx context.Context) error {
+	b.mu.Lock()
+	if len(b.coords) > 0 {
+		if !b.refreshing && time.Since(b.refreshed) >= srvRefreshInterval {
+			b.refreshing = true
+			go b.refresh(context.Background())
+		}
+		b.mu.Unlock()
+		return nil
+	}
+	b.mu.Unlock()
+	return b.refresh(ctx)
+}
+
+// refresh looks up the SRV records of the balancer, replacing its coordinators with those
+// they list. Coordinators still listed keep their count of outstanding queries. If the
+// lookup fails the coordinators already found continue to be used until the next refresh.
+func (b *balancer) refresh(ctx context.Context) error {
+	_, srvs, err := lookupSRV(ctx, "", "", b.srv)
+	if err == nil && len(srvs) == 0 {
+		err = fmt.Errorf("no records found")
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refreshing = false
+	b.refreshed = time.Now()
+	if err != nil {
+		return fmt.Errorf("%s: looking up coordinators for %s: %v", DriverName, b.srv, err)
+	}
+
+	// Records are ordered by priority and weight, so coordinators preferred by the records
+	// are tried first
+	coords := make([]*coordinator, 0, len(srvs))
+	for _, srv := range srvs {
+		addr := net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port)))
+		c := b.find(addr)
+		if c == nil {
+			c = &coordinator{addr: addr}
+		}
+		coords = append(coords, c)
+	}
+	b.coords = coords
+	return nil
+}
+
+// find returns the coordinator of the balancer at addr, or nil if there is none.
+func (b *balancer) find(addr string) *coordinator {
+	for _, c := range b.coords {
+		if c.addr == addr {
+			return c
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package prestgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// srvRecord returns an SRV record for the server at addr.
+func srvRecord(t *testing.T, addr string) *net.SRV {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _ := strconv.Atoi(port)
+	return &net.SRV{Target: host + ".", Port: uint16(n)}
+}
+
+func TestClientOpenSRV(t *testing.T) {
+	counts := make([]int, 2)
+	servers := make([]*httptest.Server, 2)
+	for i := range servers {
+		i := i
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v1/statement" {
+				counts[i]++
+			}
+			statementHandler(oneRowColResponse).ServeHTTP(w, r)
+		}))
+		defer servers[i].Close()
+	}
+
+	// Balancers outlive the test, so a name is used that no earlier run has looked up
+	name := fmt.Sprintf("_presto._tcp.srv%d.test", time.Now().UnixNano())
+	records := []*net.SRV{srvRecord(t, servers[0].Listener.Addr().String())}
+	lookups := make(chan string, 10)
+	defer func(fn func(context.Context, string, string, string) (string, []*net.SRV, error)) { lookupSRV = fn }(lookupSRV)
+	lookupSRV = func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		lookups <- name
+		return "", records, nil
+	}
+
+	query := func() {
+		t.Helper()
+		cn, err := ClientOpen(http.DefaultClient, "presto+srv://"+name+"/hive/default")
+		if err != nil {
+			t.Fatal(err)
+		}
+		st, _ := cn.Prepare("SELECT 1")
+		r, err := st.(*stmt).QueryContext(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+	}
+
+	query()
+	query()
+	if got := <-lookups; got != name {
+		t.Errorf("got lookup of %q, wanted %q", got, name)
+	}
+	if !reflect.DeepEqual(counts, []int{2, 0}) {
+		t.Errorf("got statements %v, wanted all on the first coordinator", counts)
+	}
+
+	// Once the records are stale they are looked up again in the background
+	b := srvBalancerFor(name, balanceRoundRobin)
+	b.mu.Lock()
+	records = []*net.SRV{srvRecord(t, servers[1].Listener.Addr().String())}
+	b.refreshed = time.Now().Add(-srvRefreshInterval)
+	b.mu.Unlock()
+	query()
+	<-lookups
+	for i := 0; ; i++ {
+		b.mu.Lock()
+		refreshing := b.refreshing
+		b.mu.Unlock()
+		if !refreshing {
+			break
+		}
+		if i == 100 {
+			t.Fatal("records were not looked up again")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	query()
+	if !reflect.DeepEqual(counts, []int{3, 1}) {
+		t.Errorf("got statements %v, wanted the last on the second coordinator", counts)
+	}
+}
+
+func TestStmtSRVLookupFailure(t *testing.T) {
+	defer func(fn func(context.Context, string, string, string) (string, []*net.SRV, error)) { lookupSRV = fn }(lookupSRV)
+	lookupSRV = func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		return "", nil, errors.New("no such host")
+	}
+
+	cn, err := ClientOpen(http.DefaultClient, "presto+srv://_presto._tcp.missing.test/hive/default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, _ := cn.Prepare("SELECT 1")
+	if _, err := st.(*stmt).QueryContext(context.Background(), nil); err == nil {
+		t.Error("got no error, wanted lookup failure")
+	}
+}
@@ -0,0 +1,133 @@
+package prestgo
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// QueryStats describes the progress and cost of a query, as last reported by the server.
+type QueryStats struct {
+	State           string        // State of the query, e.g. QueryStateRunning or QueryStateFinished.
+	Scheduled       bool          // Whether the query's tasks have all been scheduled.
+	Nodes           int           // Number of nodes running the query.
+	TotalSplits     int           // Number of splits the query has been divided into so far.
+	QueuedSplits    int           // Number of splits waiting to run.
+	RunningSplits   int           // Number of splits running.
+	CompletedSplits int           // Number of splits completed.
+	ProcessedRows   int64         // Rows read from the query's sources.
+	ProcessedBytes  int64         // Bytes read from the query's sources.
+	PeakMemoryBytes int64         // Most memory used by the query at any time.
+	CPUTime         time.Duration // CPU time used by the query's tasks.
+	WallTime        time.Duration // Wall time spent running the query's tasks, summed over them.
+	ElapsedTime     time.Duration // Time since the query was created.
+	QueuedTime      time.Duration // Time the query spent queued, as measured by the server.
+}
+
+// StatsRows is implemented by the driver.Rows returned by the driver, allowing callers with
+// access to them, such as by querying the driver connection given by the Raw method of
+// sql.Conn, to report the cost of a query.
+type StatsRows interface {
+	// Stats returns the statistics sent with the page of results last received. Once all
+	// the results have been read they describe the whole of the query, giving the wall and
+	// CPU time, peak memory and rows and bytes processed for accounting of its cost. They
+	// remain available after the rows are closed.
+	Stats() QueryStats
+
+	// Timing returns the time the query has spent queued, planning and running, which
+	// shows whether it is slow because the cluster is busy or because of the work it does.
+	Timing() QueryTiming
+
+	// Fetches summarises the responses received for the query's results so far.
+	Fetches() FetchStats
+}
+
+var _ StatsRows = &rows{}
+
+// Stats returns the statistics sent with the page of results last received.
+func (r *rows) Stats() QueryStats {
+	if r.rawStats != nil {
+		// Only the state was decoded when the page was received
+		var stats stmtStats
+		if err := json.Unmarshal(r.rawStats, &stats); err == nil {
+			r.stats = stats
+		}
+		r.rawStats = nil
+	}
+	return newQueryStats(r.stats)
+}
+
+// Timing returns the time the query has spent in each phase, as observed by the driver.
+func (r *rows) Timing() QueryTiming {
+	if r.run == nil {
+		return QueryTiming{}
+	}
+	return r.run.timer.timing(time.Now())
+}
+
+// Fetches summarises the responses received for the query's results so far.
+func (r *rows) Fetches() FetchStats {
+	if r.run == nil {
+		return FetchStats{}
+	}
+	return r.run.fetches.stats()
+}
+
+// FetchStats summarises the responses received for a query's results. Comparing the time
+// spent waiting for the server with the time spent transferring and decoding responses shows
+// whether a slow query is held up producing results or delivering them.
+type FetchStats struct {
+	Pages        int           // Responses received, including polls answered without rows.
+	Rows         int64         // Rows received.
+	Bytes        int64         // Bytes of the responses decoded, after decompression.
+	WaitTime     time.Duration // Time spent waiting for the server to respond.
+	TransferTime time.Duration // Time spent reading and decoding responses.
+	MaxLatency   time.Duration // Longest time taken by a single response.
+}
+
+// fetchRecorder accumulates FetchStats. It may be updated by a goroutine fetching results in
+// the background while the consumer reads the stats.
+type fetchRecorder struct {
+	mu sync.Mutex
+	s  FetchStats
+}
+
+// record adds a response holding the given number of rows to the stats. Time spent waiting
+// for a response requested ahead of time is not known, so is left out.
+func (f *fetchRecorder) record(wait, transfer time.Duration, bytes int64, rows int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.s.Pages++
+	f.s.Rows += int64(rows)
+	f.s.Bytes += bytes
+	f.s.WaitTime += wait
+	f.s.TransferTime += transfer
+	if d := wait + transfer; d > f.s.MaxLatency {
+		f.s.MaxLatency = d
+	}
+}
+
+func (f *fetchRecorder) stats() FetchStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.s
+}
+
+func newQueryStats(s stmtStats) QueryStats {
+	return QueryStats{
+		State:           s.State,
+		Scheduled:       s.Scheduled,
+		Nodes:           s.Nodes,
+		TotalSplits:     s.TotalSplits,
+		QueuedSplits:    s.QueuesSplits,
+		RunningSplits:   s.RunningSplits,
+		CompletedSplits: s.CompletedSplits,
+		ProcessedRows:   int64(s.ProcessedRows),
+		ProcessedBytes:  int64(s.ProcessedBytes),
+		PeakMemoryBytes: s.PeakMemoryBytes,
+		CPUTime:         time.Duration(s.CPUTimeMillis) * time.Millisecond,
+		WallTime:        time.Duration(s.WallTimeMillis) * time.Millisecond,
+		ElapsedTime:     time.Duration(s.ElapsedMillis) * time.Millisecond,
+		QueuedTime:      time.Duration(s.QueuedTimeMillis) * time.Millisecond,
+	}
+}
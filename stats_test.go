@@ -0,0 +1,151 @@
+package prestgo
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var statsResponse = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/v1/query/abcd/1":
+		fmt.Fprintln(w, fmt.Sprintf(`{
+		  "id": "abcd",
+		  "infoUri": "http://%[1]s/v1/query/abcd",
+		  "columns": [
+		    { "name": "col0", "type": "varchar", "typeSignature": { "rawType": "varchar", "arguments": [] } }
+		  ],
+		  "data": [
+		    [ "c0r0" ]
+		  ],
+		  "stats": {
+		    "state": "FINISHED", "scheduled": true, "nodes": 3,
+		    "totalSplits": 40, "queuedSplits": 1, "runningSplits": 2, "completedSplits": 37,
+		    "cpuTimeMillis": 1500, "wallTimeMillis": 4000, "elapsedTimeMillis": 2500, "queuedTimeMillis": 300,
+		    "processedRows": 1200000, "processedBytes": 73400320, "peakMemoryBytes": 1048576
+		  }
+		}`, r.Host))
+	default:
+		http.NotFound(w, r)
+	}
+})
+
+func TestRowsStats(t *testing.T) {
+	ts := httptest.NewServer(statsResponse)
+	defer ts.Close()
+
+	expected := QueryStats{
+		State:           QueryStateFinished,
+		Scheduled:       true,
+		Nodes:           3,
+		TotalSplits:     40,
+		QueuedSplits:    1,
+		RunningSplits:   2,
+		CompletedSplits: 37,
+		ProcessedRows:   1200000,
+		ProcessedBytes:  73400320,
+		PeakMemoryBytes: 1048576,
+		CPUTime:         1500 * time.Millisecond,
+		WallTime:        4 * time.Second,
+		ElapsedTime:     2500 * time.Millisecond,
+		QueuedTime:      300 * time.Millisecond,
+	}
+
+	for _, skipStats := range []bool{false, true} {
+		r := &rows{
+			conn: &conn{
+				client:    http.DefaultClient,
+				skipStats: skipStats,
+			},
+			nextURI: ts.URL + "/v1/query/abcd/1",
+		}
+		if err := r.fetch(); err != nil {
+			t.Fatal(err)
+		}
+
+		var sr StatsRows = r
+		if got := sr.Stats(); got != expected {
+			t.Errorf("skip_stats=%v: got %+v, wanted %+v", skipStats, got, expected)
+		}
+	}
+}
+
+func TestRowsFetches(t *testing.T) {
+	ts := httptest.NewServer(statementHandler(multiPageResponse))
+	defer ts.Close()
+
+	s := &stmt{
+		conn:  &conn{client: http.DefaultClient, addr: ts.Listener.Addr().String()},
+		query: "SELECT col0 FROM t",
+	}
+	r, err := s.QueryContext(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	values := make([]driver.Value, 1)
+	for r.Next(values) == nil {
+	}
+
+	f := r.(StatsRows).Fetches()
+	if f.Pages != 2 || f.Rows != 6 {
+		t.Errorf("got %d pages of %d rows, wanted 2 pages of 6 rows", f.Pages, f.Rows)
+	}
+	if f.Bytes <= 0 || f.TransferTime <= 0 || f.MaxLatency <= 0 || f.MaxLatency > f.WaitTime+f.TransferTime {
+		t.Errorf("got %+v, wanted bytes and times recorded", f)
+	}
+}
+
+var finalStatsResponse = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	const columns = `"columns": [{ "name": "col0", "type": "varchar", "typeSignature": { "rawType": "varchar", "arguments": [] } }]`
+	switch r.URL.Path {
+	case "/v1/query/abcd/1":
+		fmt.Fprintf(w, `{"id": "abcd", "nextUri": "http://%[1]s/v1/query/abcd/2", %[2]s, "data": [["c0r0"], ["c0r1"]], "stats": {"state": "RUNNING", "processedRows": 2}}`, r.Host, columns)
+	case "/v1/query/abcd/2":
+		fmt.Fprintf(w, `{"id": "abcd", %s, "data": [["c0r2"]], "stats": {
+		  "state": "FINISHED", "processedRows": 6, "processedBytes": 120, "peakMemoryBytes": 4096,
+		  "cpuTimeMillis": 20, "wallTimeMillis": 30, "elapsedTimeMillis": 40
+		}}`, columns)
+	default:
+		http.NotFound(w, r)
+	}
+})
+
+func TestRowsStatsAfterClose(t *testing.T) {
+	ts := httptest.NewServer(statementHandler(finalStatsResponse))
+	defer ts.Close()
+
+	h := &recordingHooks{}
+	s := &stmt{
+		conn:  &conn{client: http.DefaultClient, addr: ts.Listener.Addr().String(), hooks: h, skipStats: true},
+		query: "SELECT col0 FROM t",
+	}
+	r, err := s.QueryContext(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make([]driver.Value, 1)
+	for r.Next(values) == nil {
+	}
+	r.Close()
+
+	expected := QueryStats{
+		State:           QueryStateFinished,
+		ProcessedRows:   6,
+		ProcessedBytes:  120,
+		PeakMemoryBytes: 4096,
+		CPUTime:         20 * time.Millisecond,
+		WallTime:        30 * time.Millisecond,
+		ElapsedTime:     40 * time.Millisecond,
+	}
+	if got := r.(StatsRows).Stats(); got != expected {
+		t.Errorf("got %+v, wanted %+v", got, expected)
+	}
+	if len(h.events) != 1 || h.events[0].Stats != expected {
+		t.Errorf("got events %+v, wanted one with stats %+v", h.events, expected)
+	}
+}
@@ -0,0 +1,95 @@
+package prestgo
+
+import (
+	"sync"
+	"time"
+)
+
+// QueryTiming breaks down the time a query has taken into the phases it passed through, as
+// observed by the driver from the states reported by the server. Since states are only seen
+// when the server is polled, each boundary is accurate to within the polling interval. The
+// phase a query is still in is timed up to the present.
+type QueryTiming struct {
+	Queued    time.Duration // Time from submission until the query left the queue.
+	Planning  time.Duration // Time spent planning the query and starting its tasks.
+	Execution time.Duration // Time from the query starting to run until it ended.
+}
+
+// Phases of a query, in the order a query passes through them.
+const (
+	phaseQueued = iota
+	phasePlanning
+	phaseRunning
+	phaseEnded
+)
+
+// queryPhases gives the phase of each query state. States not listed do not mark a change
+// of phase.
+var queryPhases = map[string]int{
+	QueryStateQueued:        phaseQueued,
+	"WAITING_FOR_RESOURCES": phaseQueued,
+	"DISPATCHING":           phaseQueued,
+	QueryStatePlanning:      phasePlanning,
+	QueryStateStarting:      phasePlanning,
+	QueryStateRunning:       phaseRunning,
+	"FINISHING":             phaseRunning,
+	QueryStateFinished:      phaseEnded,
+	QueryStateFailed:        phaseEnded,
+	QueryStateCanceled:      phaseEnded,
+}
+
+// isQueued reports whether a query with stats s is waiting in the cluster's queue.
+func isQueued(s stmtStats) bool {
+	phase, ok := queryPhases[s.State]
+	return s.Queued || ok && phase == phaseQueued
+}
+
+// queryTimer records when a query was seen to enter each phase. It may be updated by a
+// goroutine fetching results in the background while the consumer reads the timing.
+type queryTimer struct {
+	mu      sync.Mutex
+	phase   int
+	entered [phaseEnded + 1]time.Time
+}
+
+func newQueryTimer(start time.Time) *queryTimer {
+	t := &queryTimer{}
+	t.entered[phaseQueued] = start
+	return t
+}
+
+// observe records that the query was seen in the given state at now. Phases skipped between
+// polls are taken to have been entered and left at the same time.
+func (t *queryTimer) observe(state string, now time.Time) {
+	if t == nil {
+		return
+	}
+	phase, ok := queryPhases[state]
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	for ; t.phase < phase; t.phase++ {
+		t.entered[t.phase+1] = now
+	}
+	t.mu.Unlock()
+}
+
+// timing returns the time spent in each phase up to now.
+func (t *queryTimer) timing(now time.Time) QueryTiming {
+	if t == nil {
+		return QueryTiming{}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var d [phaseEnded]time.Duration
+	for p := phaseQueued; p < phaseEnded && p <= t.phase; p++ {
+		end := now
+		if p < t.phase {
+			end = t.entered[p+1]
+		}
+		d[p] = end.Sub(t.entered[p])
+	}
+	return QueryTiming{Queued: d[phaseQueued], Planning: d[phasePlanning], Execution: d[phaseRunning]}
+}
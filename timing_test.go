@@ -0,0 +1,59 @@
+package prestgo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueryTimer(t *testing.T) {
+	start := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(secs int) time.Time { return start.Add(time.Duration(secs) * time.Second) }
+
+	testCases := []struct {
+		name     string
+		states   []string // state observed at each second from 1
+		now      int
+		expected QueryTiming
+	}{
+		{
+			name:     "all phases",
+			states:   []string{"QUEUED", "QUEUED", "PLANNING", "STARTING", "RUNNING", "RUNNING", "RUNNING", "FINISHED"},
+			now:      20,
+			expected: QueryTiming{Queued: 3 * time.Second, Planning: 2 * time.Second, Execution: 3 * time.Second},
+		},
+		{
+			name:     "still queued",
+			states:   []string{"QUEUED", "WAITING_FOR_RESOURCES"},
+			now:      5,
+			expected: QueryTiming{Queued: 5 * time.Second},
+		},
+		{
+			name:     "still running",
+			states:   []string{"PLANNING", "RUNNING"},
+			now:      6,
+			expected: QueryTiming{Queued: time.Second, Planning: time.Second, Execution: 4 * time.Second},
+		},
+		{
+			name:     "planning skipped between polls",
+			states:   []string{"QUEUED", "RUNNING", "FINISHED"},
+			now:      10,
+			expected: QueryTiming{Queued: 2 * time.Second, Execution: time.Second},
+		},
+		{
+			name:     "states out of order and unknown",
+			states:   []string{"RUNNING", "PLANNING", "UNKNOWN", "FAILED"},
+			now:      10,
+			expected: QueryTiming{Queued: time.Second, Execution: 3 * time.Second},
+		},
+	}
+
+	for _, tc := range testCases {
+		timer := newQueryTimer(start)
+		for i, state := range tc.states {
+			timer.observe(state, at(i+1))
+		}
+		if got := timer.timing(at(tc.now)); got != tc.expected {
+			t.Errorf("%s: got %+v, wanted %+v", tc.name, got, tc.expected)
+		}
+	}
+}
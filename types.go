@@ -1,5 +1,14 @@
 package prestgo
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"unicode/utf8"
+)
+
 const (
 	// This type captures boolean values true and false
 	Boolean = "boolean"
@@ -58,52 +67,84 @@ const (
 
 	// Prefix for row data type - used for unflattened structs
 	Row = "row"
-)
 
-type stmtResponse struct {
-	ID      string    `json:"id"`
-	InfoURI string    `json:"infoUri"`
-	NextURI string    `json:"nextUri"`
-	Stats   stmtStats `json:"stats"`
-	Error   stmtError `json:"error"`
-}
+	// Prefix for array data type.
+	// Example: ARRAY[1, 2, 3]
+	Array = "array"
 
-type stmtStats struct {
-	State           string    `json:"state"`
-	Scheduled       bool      `json:"scheduled"`
-	Nodes           int       `json:"nodes"`
-	TotalSplits     int       `json:"totalSplits"`
-	QueuesSplits    int       `json:"queuedSplits"`
-	RunningSplits   int       `json:"runningSplits"`
-	CompletedSplits int       `json:"completedSplits"`
-	UserTimeMillis  int       `json:"userTimeMillis"`
-	CPUTimeMillis   int       `json:"cpuTimeMillis"`
-	WallTimeMillis  int       `json:"wallTimeMillis"`
-	ProcessedRows   int       `json:"processedRows"`
-	ProcessedBytes  int       `json:"processedBytes"`
-	RootStage       stmtStage `json:"rootStage"`
-}
+	// Prefix for map data type.
+	// Example: MAP(ARRAY['foo', 'bar'], ARRAY[1, 2])
+	Map = "map"
 
-type stmtError struct {
-	Message       string               `json:"message"`
-	ErrorCode     int                  `json:"errorCode"`
-	ErrorLocation stmtErrorLocation    `json:"errorLocation"`
-	FailureInfo   stmtErrorFailureInfo `json:"failureInfo"`
-	// Other fields omitted
-}
+	// A universally unique identifier.
+	// Example: UUID '12151fd2-7586-11e9-8f9e-2a86e4085a59'
+	UUID = "uuid"
+
+	// An IPv4 or IPv6 address.
+	// Example: IPADDRESS '10.0.0.1'
+	IPAddress = "ipaddress"
+
+	// Span of days, hours, minutes, seconds and milliseconds.
+	// Example: INTERVAL '2' DAY
+	IntervalDayToSecond = "interval day to second"
 
-type stmtErrorLocation struct {
-	LineNumber   int `json:"lineNumber"`
-	ColumnNumber int `json:"columnNumber"`
+	// Span of years and months.
+	// Example: INTERVAL '3' MONTH
+	IntervalYearToMonth = "interval year to month"
+
+	// Sketch computed by approx_set for estimating distinct counts.
+	HyperLogLog = "HyperLogLog"
+
+	// Dense variant of HyperLogLog.
+	P4HyperLogLog = "P4HyperLogLog"
+
+	// Sketch computed by make_set_digest for estimating set similarity.
+	SetDigest = "SetDigest"
+
+	// Quantile digest computed by qdigest_agg for estimating percentiles.
+	// Example: qdigest(bigint)
+	QDigest = "qdigest"
+
+	// T-digest computed by tdigest_agg for estimating percentiles.
+	// Example: tdigest(double)
+	TDigest = "tdigest"
+)
+
+type stmtResponse struct {
+	ID       string         `json:"id"`
+	InfoURI  string         `json:"infoUri"`
+	NextURI  string         `json:"nextUri"`
+	Stats    stmtStats      `json:"stats"`
+	Error    *Error         `json:"error"`
+	Warnings []queryWarning `json:"warnings"`
 }
 
-type stmtErrorFailureInfo struct {
-	Type string `json:"type"`
-	// Other fields omitted
+type queryWarning struct {
+	WarningCode struct {
+		Code int    `json:"code"`
+		Name string `json:"name"`
+	} `json:"warningCode"`
+	Message string `json:"message"`
 }
 
-func (e stmtError) Error() string {
-	return e.FailureInfo.Type + ": " + e.Message
+type stmtStats struct {
+	State            string    `json:"state"`
+	Queued           bool      `json:"queued"`
+	Scheduled        bool      `json:"scheduled"`
+	Nodes            int       `json:"nodes"`
+	TotalSplits      int       `json:"totalSplits"`
+	QueuesSplits     int       `json:"queuedSplits"`
+	RunningSplits    int       `json:"runningSplits"`
+	CompletedSplits  int       `json:"completedSplits"`
+	UserTimeMillis   int       `json:"userTimeMillis"`
+	CPUTimeMillis    int       `json:"cpuTimeMillis"`
+	WallTimeMillis   int       `json:"wallTimeMillis"`
+	ProcessedRows    int       `json:"processedRows"`
+	ProcessedBytes   int       `json:"processedBytes"`
+	PeakMemoryBytes  int64     `json:"peakMemoryBytes"`
+	ElapsedMillis    int       `json:"elapsedTimeMillis"`
+	QueuedTimeMillis int       `json:"queuedTimeMillis"`
+	RootStage        stmtStage `json:"rootStage"`
 }
 
 type stmtStage struct {
@@ -124,14 +165,25 @@ type stmtStage struct {
 }
 
 type queryResponse struct {
-	ID               string        `json:"id"`
-	InfoURI          string        `json:"infoUri"`
-	PartialCancelURI string        `json:"partialCancelUri"`
-	NextURI          string        `json:"nextUri"`
-	Columns          []queryColumn `json:"columns"`
-	Data             []queryData   `json:"data"`
-	Stats            stmtStats     `json:"stats"`
-	Error            stmtError     `json:"error"`
+	ID               string         `json:"id"`
+	InfoURI          string         `json:"infoUri"`
+	PartialCancelURI string         `json:"partialCancelUri"`
+	NextURI          string         `json:"nextUri"`
+	Columns          []queryColumn  `json:"columns"`
+	Data             []queryData    `json:"data"`
+	Stats            stmtStats      `json:"stats"`
+	Error            *Error         `json:"error"`
+	Warnings         []queryWarning `json:"warnings"`
+	UpdateType       string         `json:"updateType"`
+	UpdateCount      *int64         `json:"updateCount"`
+
+	uri      string          // URI the response was requested from
+	page     *pageBuffer     // holds Data, when decoded by decodeQueryResponse
+	cols     *columnarPage   // holds the data column by column, when decoded by decodeColumnarResponse
+	spooled  *spooledData    // segments holding the data, under the spooled protocol, until loaded
+	size     int64           // bytes of the page budget reserved for the response
+	rawStats json.RawMessage // holds Stats when only the state was decoded
+	rowsHint int             // rows expected in Data, from the previous page decoded into the response
 }
 
 type queryColumn struct {
@@ -142,10 +194,409 @@ type queryColumn struct {
 
 type queryData []interface{}
 
+// decodeQueryResponse reads a page of query results from r. The data array is decoded a
+// row at a time rather than as part of the whole document, so the decoder only buffers
+// the JSON text of a single row and large pages are not held in memory twice over. The
+// rows are held in a pooled buffer which should be released once they have been consumed.
+// If lazyStats is set only the state of the query is decoded from its stats. If reuse is
+// not nil the response is decoded into it, sizing the buffer for the rows from the page
+// previously decoded into it.
+func decodeQueryResponse(r io.Reader, lazyStats bool, reuse *queryResponse) (*queryResponse, error) {
+	return decodeResponse(r, lazyStats, reuse, func(dec *json.Decoder, qresp *queryResponse) error {
+		qresp.release()
+		page, err := decodeData(dec, qresp.rowsHint, len(qresp.Columns))
+		if page != nil {
+			qresp.page, qresp.Data = page, page.rows
+		}
+		return err
+	})
+}
+
+// decodeResponse reads a page of query results from r, calling data to decode the data
+// array when it is reached. If lazyStats is set the stats object is kept undecoded apart
+// from the state of the query, sparing the cost of decoding the statistics of every stage
+// for clients that do not use them. decodeStats decodes the rest when it is needed. The
+// response is decoded into reuse if it is not nil.
+func decodeResponse(r io.Reader, lazyStats bool, reuse *queryResponse, data func(dec *json.Decoder, qresp *queryResponse) error) (*queryResponse, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, err
+	}
+
+	qresp := reuse
+	if qresp == nil {
+		qresp = new(queryResponse)
+	} else {
+		qresp.reset()
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := tok.(string)
+
+		switch key {
+		case "id":
+			err = dec.Decode(&qresp.ID)
+		case "infoUri":
+			err = dec.Decode(&qresp.InfoURI)
+		case "partialCancelUri":
+			err = dec.Decode(&qresp.PartialCancelURI)
+		case "nextUri":
+			err = dec.Decode(&qresp.NextURI)
+		case "columns":
+			err = dec.Decode(&qresp.Columns)
+		case "data":
+			err = decodeDataField(dec, qresp, data)
+		case "stats":
+			if lazyStats {
+				err = decodeState(dec, qresp)
+			} else {
+				err = dec.Decode(&qresp.Stats)
+			}
+		case "error":
+			err = dec.Decode(&qresp.Error)
+		case "warnings":
+			err = dec.Decode(&qresp.Warnings)
+		case "updateType":
+			err = dec.Decode(&qresp.UpdateType)
+		case "updateCount":
+			err = dec.Decode(&qresp.UpdateCount)
+		default:
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			qresp.release()
+			return nil, err
+		}
+	}
+
+	if err := expectDelim(dec, '}'); err != nil {
+		qresp.release()
+		return nil, err
+	}
+	return qresp, nil
+}
+
+// pageBuffer holds the rows of a page of results. The values of all rows share a single
+// slice, and buffers are pooled so that reading a large result reuses the storage of pages
+// that have already been consumed rather than allocating it afresh for every page.
+type pageBuffer struct {
+	values []interface{}
+	ends   []int // index in values of the end of each row
+	rows   []queryData
+	text   json.RawMessage // scratch space for the text of a row
+}
+
+// maxPooledValues limits the size of the buffers kept for reuse, so that one unusually
+// large page does not pin its memory for the life of the process.
+const maxPooledValues = 1 << 20
+
+var pagePool = sync.Pool{
+	New: func() interface{} { return new(pageBuffer) },
+}
+
+// release clears the values held by the buffer and returns it to the pool. The rows it
+// holds must no longer be used.
+func (b *pageBuffer) release() {
+	if cap(b.values) > maxPooledValues {
+		return
+	}
+	for i := range b.values {
+		b.values[i] = nil
+	}
+	for i := range b.rows {
+		b.rows[i] = nil
+	}
+	b.values, b.ends, b.rows = b.values[:0], b.ends[:0], b.rows[:0]
+	pagePool.Put(b)
+}
+
+// decodeDataField reads the data of a response from dec. An array of rows is decoded by
+// data, which is called once the opening bracket has been read. Under the spooled protocol
+// the data is instead an object listing the segments that hold the rows, which is kept in
+// spooled for the rows to be loaded from.
+func decodeDataField(dec *json.Decoder, qresp *queryResponse, data func(dec *json.Decoder, qresp *queryResponse) error) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch tok {
+	case nil:
+		return nil
+	case json.Delim('['):
+		return data(dec, qresp)
+	case json.Delim('{'):
+		qresp.spooled, err = decodeSpooledData(dec)
+		return err
+	}
+	return fmt.Errorf("%s: unexpected %v in data, wanted array", DriverName, tok)
+}
+
+// newPageBuffer returns a buffer taken from the pool, sized for rowsHint rows of width
+// values when it does not already have room for them.
+func newPageBuffer(rowsHint, width int) *pageBuffer {
+	b := pagePool.Get().(*pageBuffer)
+	if cap(b.rows) < rowsHint {
+		b.rows = make([]queryData, 0, rowsHint)
+		b.ends = make([]int, 0, rowsHint)
+	}
+	if n := rowsHint * width; cap(b.values) < n && n <= maxPooledValues {
+		b.values = make([]interface{}, 0, n)
+	}
+	return b
+}
+
+// decodeData decodes the rows of a data array from dec, a row at a time, into a buffer
+// taken from the pool, the opening bracket of the array having already been read. The
+// buffer is sized for rowsHint rows of width values.
+func decodeData(dec *json.Decoder, rowsHint, width int) (*pageBuffer, error) {
+	b := newPageBuffer(rowsHint, width)
+	if err := b.decodeRows(dec); err != nil {
+		b.release()
+		return nil, err
+	}
+	b.sliceRows()
+	return b, nil
+}
+
+// decodeRows appends the values of the rows of an array to the buffer, reading up to and
+// including its closing bracket. The rows of a page may be decoded from several arrays
+// before they are sliced by sliceRows.
+func (b *pageBuffer) decodeRows(dec *json.Decoder) error {
+	for dec.More() {
+		// The decoder only finds the end of the row, its text being read into a reused
+		// slice, and the values are parsed from the text by appendRow. This is much cheaper
+		// than having the decoder box each value through reflection.
+		if err := dec.Decode(&b.text); err != nil {
+			return err
+		}
+		var err error
+		if b.values, err = appendRow(b.values, b.text); err != nil {
+			return err
+		}
+		b.ends = append(b.ends, len(b.values))
+	}
+	return expectDelim(dec, ']')
+}
+
+// appendRow appends the values of the row whose text is given to values, decoded as a
+// json.Decoder using numbers would decode them. The text must be valid JSON, as checked
+// by the decoder it was read by. Strings without escapes and numbers are converted
+// directly, while arrays, objects and strings needing more care are left to the json
+// package.
+func appendRow(values []interface{}, text []byte) ([]interface{}, error) {
+	i := skipSpace(text, 0)
+	switch {
+	case text[i] == 'n':
+		// A null row has no values
+		return values, nil
+	case text[i] != '[':
+		return values, fmt.Errorf("%s: unexpected %s in data, wanted a row array", DriverName, text)
+	}
+	i = skipSpace(text, i+1)
+	if text[i] == ']' {
+		return values, nil
+	}
+	for {
+		end := valueEnd(text, i)
+		v, err := parseValue(text[i:end])
+		if err != nil {
+			return values, err
+		}
+		values = append(values, v)
+
+		i = skipSpace(text, end)
+		if text[i] == ']' {
+			return values, nil
+		}
+		// The values are separated by commas
+		i = skipSpace(text, i+1)
+	}
+}
+
+// parseValue decodes the text of a single JSON value.
+func parseValue(text []byte) (interface{}, error) {
+	switch text[0] {
+	case 'n':
+		return nil, nil
+	case 't':
+		return true, nil
+	case 'f':
+		return false, nil
+	case '"':
+		s := text[1 : len(text)-1]
+		if simpleString(s) {
+			return string(s), nil
+		}
+	case '[', '{':
+	default:
+		return json.Number(text), nil
+	}
+
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(text))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// simpleString reports whether the contents of a JSON string are the string itself, with no
+// escapes or invalid UTF-8 for the json package to replace.
+func simpleString(s []byte) bool {
+	ascii := true
+	for _, c := range s {
+		if c == '\\' {
+			return false
+		}
+		if c >= utf8.RuneSelf {
+			ascii = false
+		}
+	}
+	return ascii || utf8.Valid(s)
+}
+
+// skipSpace returns the index of the first byte of text from i that is not white space.
+func skipSpace(text []byte, i int) int {
+	for i < len(text) && (text[i] == ' ' || text[i] == '\t' || text[i] == '\n' || text[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+// valueEnd returns the index just past the end of the valid JSON value starting at i.
+func valueEnd(text []byte, i int) int {
+	depth := 0
+	for ; i < len(text); i++ {
+		switch text[i] {
+		case '"':
+			for i++; text[i] != '"'; i++ {
+				if text[i] == '\\' {
+					i++
+				}
+			}
+			if depth == 0 {
+				return i + 1
+			}
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+			if depth < 0 {
+				return i
+			}
+		case ',', ' ', '\t', '\n', '\r':
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return i
+}
+
+// sliceRows sets the rows of the buffer once all of its values are decoded, since
+// appending them may have moved those already decoded.
+func (b *pageBuffer) sliceRows() {
+	start := 0
+	for _, end := range b.ends {
+		b.rows = append(b.rows, queryData(b.values[start:end:end]))
+		start = end
+	}
+}
+
+// reset clears the response so that another can be decoded into it. The slice of columns
+// is kept for reuse and the number of rows in Data is kept as a hint for the next page.
+func (q *queryResponse) reset() {
+	q.release()
+	columns := q.Columns[:0]
+	for i := range q.Columns {
+		q.Columns[i] = queryColumn{}
+	}
+	rowsHint := q.rowsHint
+	*q = queryResponse{Columns: columns, rowsHint: rowsHint}
+}
+
+// recycle detaches the data of a response whose rows have been taken by the caller, noting
+// the number of rows so that the next page decoded into the response is sized for them.
+func (q *queryResponse) recycle() {
+	q.rowsHint = len(q.Data)
+	q.Data, q.page, q.cols, q.spooled, q.size = nil, nil, nil, nil, 0
+}
+
+// rowCount returns the number of rows of data in the response.
+func (q *queryResponse) rowCount() int {
+	if q.cols != nil {
+		return q.cols.rows
+	}
+	return len(q.Data)
+}
+
+// decodeState reads the stats object of a response from dec, decoding only the state.
+func decodeState(dec *json.Decoder, qresp *queryResponse) error {
+	if err := dec.Decode(&qresp.rawStats); err != nil {
+		return err
+	}
+	var state struct {
+		State string `json:"state"`
+	}
+	if err := json.Unmarshal(qresp.rawStats, &state); err != nil {
+		return err
+	}
+	qresp.Stats = stmtStats{State: state.State}
+	return nil
+}
+
+// decodeStats decodes the whole of a stats object kept undecoded by decodeResponse.
+func (q *queryResponse) decodeStats() {
+	if q.rawStats == nil {
+		return
+	}
+	var stats stmtStats
+	if err := json.Unmarshal(q.rawStats, &stats); err == nil {
+		q.Stats = stats
+	}
+	q.rawStats = nil
+}
+
+// release returns the buffer holding the response's data to the pool.
+func (q *queryResponse) release() {
+	if q.page != nil {
+		q.page.release()
+		q.page, q.Data = nil, nil
+	}
+}
+
+// expectDelim reads the next token from dec, failing unless it is the delimiter d.
+func expectDelim(dec *json.Decoder, d json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != d {
+		return fmt.Errorf("%s: unexpected %v in query response, wanted %v", DriverName, tok, d)
+	}
+	return nil
+}
+
 type typeSignature struct {
-	RawType          string        `json:"rawType"`
-	TypeArguments    []interface{} `json:"typeArguments"`
-	LiteralArguments []interface{} `json:"literalArguments"`
+	RawType          string             `json:"rawType"`
+	Arguments        []typeSignatureArg `json:"arguments"`
+	TypeArguments    []typeSignature    `json:"typeArguments"`    // Superseded by Arguments
+	LiteralArguments []interface{}      `json:"literalArguments"` // Superseded by Arguments
+}
+
+type typeSignatureArg struct {
+	Kind  string          `json:"kind"`
+	Value json.RawMessage `json:"value"`
 }
 
 type infoResponse struct {
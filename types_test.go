@@ -0,0 +1,295 @@
+package prestgo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeQueryResponse(t *testing.T) {
+	testCases := []struct {
+		name string
+		body string
+		err  bool
+	}{
+		{
+			name: "data",
+			body: `{
+			  "id": "abcd",
+			  "infoUri": "http://example/ui/query.html?abcd",
+			  "nextUri": "http://example/v1/query/abcd/2",
+			  "columns": [
+			    { "name": "col0", "type": "bigint", "typeSignature": { "rawType": "bigint", "arguments": [] } },
+			    { "name": "col1", "type": "array(map(varchar,double))", "typeSignature": { "rawType": "array", "arguments": [] } }
+			  ],
+			  "data": [ [ 9007199254740993, [ {"a": 1.5}, null ] ], [ null, [] ] ],
+			  "stats": { "state": "RUNNING", "processedRows": 2 },
+			  "warnings": [ { "message": "ignored" } ]
+			}`,
+		},
+		{
+			name: "data before columns",
+			body: `{"data": [ [ "x", 1 ] ], "columns": [ { "name": "col0", "type": "varchar" } ]}`,
+		},
+		{
+			name: "no data",
+			body: `{"id": "abcd", "nextUri": "http://example/v1/query/abcd/2", "stats": {"state": "QUEUED"}}`,
+		},
+		{
+			name: "update",
+			body: `{"id": "abcd", "updateType": "INSERT", "updateCount": 3, "stats": {"state": "FINISHED"}}`,
+		},
+		{
+			name: "null data",
+			body: `{"id": "abcd", "data": null}`,
+		},
+		{
+			name: "error",
+			body: `{"id": "abcd", "stats": {"state": "FAILED"}, "error": {"message": "bad", "errorName": "SYNTAX_ERROR"}}`,
+		},
+		{
+			name: "not an object",
+			body: `[]`,
+			err:  true,
+		},
+		{
+			name: "data not an array",
+			body: `{"data": {}}`,
+			err:  true,
+		},
+		{
+			name: "row not an array",
+			body: `{"data": [ 1 ]}`,
+			err:  true,
+		},
+		{
+			name: "truncated",
+			body: `{"id": "abcd", "data": [ [ 1, 2 ], [ 3`,
+			err:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		qresp, err := decodeQueryResponse(strings.NewReader(tc.body), false, nil)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: got no error, wanted one", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+			continue
+		}
+
+		// The result must match decoding the whole document at once
+		var expected queryResponse
+		dec := json.NewDecoder(strings.NewReader(tc.body))
+		dec.UseNumber()
+		if err := dec.Decode(&expected); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if len(qresp.Data) != len(expected.Data) {
+			t.Errorf("%s: got %d rows, wanted %d", tc.name, len(qresp.Data), len(expected.Data))
+			continue
+		}
+		for i := range qresp.Data {
+			// Capacity of rows differs, compare contents
+			if !reflect.DeepEqual(qresp.Data[i], expected.Data[i]) {
+				t.Errorf("%s: row %d got %#v, wanted %#v", tc.name, i, qresp.Data[i], expected.Data[i])
+			}
+		}
+		qresp.release()
+		expected.Data = nil
+		if !reflect.DeepEqual(*qresp, expected) {
+			t.Errorf("%s: got %+v, wanted %+v", tc.name, *qresp, expected)
+		}
+	}
+}
+
+func TestDecodeQueryResponseReusesPages(t *testing.T) {
+	first, err := decodeQueryResponse(strings.NewReader(`{"data": [ [ "a", 1 ], [ "b", 2 ], [ "c", 3 ] ]}`), false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := first.page
+	values := page.values[:cap(page.values)]
+	first.release()
+
+	// Released pages hold no references to the values they were decoded into
+	for i, v := range values {
+		if v != nil {
+			t.Errorf("value %d not cleared: %v", i, v)
+		}
+	}
+
+	second, err := decodeQueryResponse(strings.NewReader(`{"data": [ [ "d" ], [ "e", 5, null ] ]}`), false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.release()
+
+	expected := []queryData{{"d"}, {"e", json.Number("5"), nil}}
+	if !reflect.DeepEqual(second.Data, expected) {
+		t.Errorf("got %#v, wanted %#v", second.Data, expected)
+	}
+	// Appending to a row must not overwrite the next one
+	_ = append(second.Data[0], "x")
+	if second.Data[1][0] != "e" {
+		t.Errorf("rows share capacity: %#v", second.Data)
+	}
+}
+
+func TestDecodeQueryResponseLazyStats(t *testing.T) {
+	body := `{
+	  "id": "abcd",
+	  "stats": { "state": "FAILED", "peakMemoryBytes": 1024, "elapsedTimeMillis": 5, "rootStage": { "stageId": "0", "subStages": [ { "stageId": "1" } ] } },
+	  "data": [ [ 1 ] ]
+	}`
+
+	qresp, err := decodeQueryResponse(strings.NewReader(body), true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qresp.release()
+	if qresp.Stats.State != QueryStateFailed || qresp.Stats.PeakMemoryBytes != 0 || qresp.Stats.RootStage.StageID != "" {
+		t.Errorf("got stats %+v, wanted only the state", qresp.Stats)
+	}
+	if len(qresp.Data) != 1 {
+		t.Errorf("got %d rows, wanted 1", len(qresp.Data))
+	}
+
+	qresp.decodeStats()
+	if qresp.Stats.State != QueryStateFailed || qresp.Stats.PeakMemoryBytes != 1024 || qresp.Stats.ElapsedMillis != 5 || len(qresp.Stats.RootStage.SubStages) != 1 {
+		t.Errorf("got stats %+v after decoding, wanted all", qresp.Stats)
+	}
+
+	if _, err := decodeQueryResponse(strings.NewReader(`{"stats": {"state": 1}}`), true, nil); err == nil {
+		t.Error("got no error for malformed state, wanted one")
+	}
+}
+
+// widePage returns a page of results with rows of cols varchar columns.
+func widePage(rows, cols int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`{"id": "abcd", "columns": [`)
+	for c := 0; c < cols; c++ {
+		if c > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(&buf, `{"name": "col%d", "type": "varchar", "typeSignature": {"rawType": "varchar", "arguments": []}}`, c)
+	}
+	buf.WriteString(`], "data": [`)
+	for r := 0; r < rows; r++ {
+		if r > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('[')
+		for c := 0; c < cols; c++ {
+			if c > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(&buf, `"value %d of row %d"`, c, r)
+		}
+		buf.WriteByte(']')
+	}
+	buf.WriteString(`], "stats": {"state": "FINISHED"}}`)
+	return buf.Bytes()
+}
+
+func BenchmarkDecodeQueryResponseWideVarchar(b *testing.B) {
+	page := widePage(1000, 50)
+	b.SetBytes(int64(len(page)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		qresp, err := decodeQueryResponse(bytes.NewReader(page), false, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		qresp.release()
+	}
+}
+
+func TestDecodeQueryResponseReuse(t *testing.T) {
+	first, err := decodeQueryResponse(strings.NewReader(`{
+	  "id": "abcd",
+	  "nextUri": "http://example/v1/query/abcd/2",
+	  "columns": [ { "name": "col0", "type": "bigint" }, { "name": "col1", "type": "varchar" } ],
+	  "data": [ [ 1, "a" ], [ 2, "b" ], [ 3, "c" ] ],
+	  "stats": { "state": "RUNNING" },
+	  "error": { "message": "stale" }
+	}`), false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := first.Data
+	first.recycle()
+	if first.Data != nil || first.page != nil {
+		t.Errorf("got data %v left in recycled response", first.Data)
+	}
+
+	second, err := decodeQueryResponse(strings.NewReader(`{"id": "abcd", "data": [ [ 4, "d" ] ], "stats": { "state": "FINISHED" }}`), false, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.release()
+	if second != first {
+		t.Error("response was not decoded into the one supplied")
+	}
+	if second.NextURI != "" || len(second.Columns) != 0 || second.Error != nil || second.Stats.State != QueryStateFinished {
+		t.Errorf("got fields of the previous page: %+v", second)
+	}
+	if !reflect.DeepEqual(second.Data, []queryData{{json.Number("4"), "d"}}) {
+		t.Errorf("got data %#v", second.Data)
+	}
+	// The buffer is sized for as many rows as the previous page
+	if cap(second.page.rows) < 3 {
+		t.Errorf("got room for %d rows, wanted at least 3", cap(second.page.rows))
+	}
+	// Rows taken from the first page are unaffected
+	if !reflect.DeepEqual(rows[2], queryData{json.Number("3"), "c"}) {
+		t.Errorf("got first page row %#v", rows[2])
+	}
+}
+
+func TestAppendRow(t *testing.T) {
+	testCases := []string{
+		`[]`,
+		` [ ] `,
+		`null`,
+		`[ "a", "", "b c" ]`,
+		`[ "line\nbreak", "quote \" and \\ slash", "é😀", "é" ]`,
+		"[ \"bad \xff byte\" ]",
+		`[ 1, -2.5, 1e300, 9007199254740993, 0 ]`,
+		`[ true, false, null ]`,
+		`[ [ 1, "a,]" ], { "k": [ "}" ], "n": null }, [], {} ]`,
+		"[\n\t1 ,\r\n \"x\" ,[ 2 ] ]",
+	}
+
+	for _, tc := range testCases {
+		var expected []interface{}
+		dec := json.NewDecoder(strings.NewReader(tc))
+		dec.UseNumber()
+		if err := dec.Decode(&expected); err != nil {
+			t.Fatalf("%s: %v", tc, err)
+		}
+		got, err := appendRow([]interface{}{"before"}, []byte(tc))
+		if err != nil {
+			t.Errorf("%s: %v", tc, err)
+			continue
+		}
+		if !reflect.DeepEqual(got[1:], expected) && !(len(got) == 1 && len(expected) == 0) {
+			t.Errorf("%s: got %#v, wanted %#v", tc, got[1:], expected)
+		}
+	}
+
+	for _, tc := range []string{`1`, `"row"`, `{}`} {
+		if _, err := appendRow(nil, []byte(tc)); err == nil {
+			t.Errorf("%s: got no error, wanted one for a row that is not an array", tc)
+		}
+	}
+}
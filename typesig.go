@@ -0,0 +1,332 @@
+package prestgo
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// prestoType is a parsed Presto type, built from the typeSignature of a result column.
+type prestoType struct {
+	name     string       // lower cased raw type name, e.g. "array" or "timestamp with time zone"
+	literals []int64      // numeric parameters such as a varchar length or decimal precision and scale
+	args     []prestoType // type parameters such as the element type of an array
+	fields   []string     // field names of a row type, parallel to args, empty when anonymous
+}
+
+// fieldName returns the name of the ith field of a row type. Anonymous fields are named
+// field0, field1 and so on by position.
+func (t prestoType) fieldName(i int) string {
+	if i < len(t.fields) && t.fields[i] != "" {
+		return t.fields[i]
+	}
+	return fmt.Sprintf("field%d", i)
+}
+
+// String renders the type the way Presto displays it, e.g. "map(varchar, array(bigint))".
+func (t prestoType) String() string {
+	if len(t.literals) == 0 && len(t.args) == 0 {
+		return t.name
+	}
+
+	params := make([]string, 0, len(t.literals)+len(t.args))
+	for _, l := range t.literals {
+		params = append(params, strconv.FormatInt(l, 10))
+	}
+	for i, a := range t.args {
+		if i < len(t.fields) && t.fields[i] != "" {
+			params = append(params, t.fields[i]+" "+a.String())
+			continue
+		}
+		params = append(params, a.String())
+	}
+
+	const withTimeZone = " with time zone"
+	if strings.HasSuffix(t.name, withTimeZone) {
+		return strings.TrimSuffix(t.name, withTimeZone) + "(" + strings.Join(params, ", ") + ")" + withTimeZone
+	}
+	return t.name + "(" + strings.Join(params, ", ") + ")"
+}
+
+// databaseTypeName renders the type in upper case without its length, precision or scale
+// parameters, e.g. "ARRAY(DECIMAL)" or "TIMESTAMP WITH TIME ZONE". Row field names are kept
+// as they are, delimited when they are not plain identifiers.
+func (t prestoType) databaseTypeName() string {
+	name := strings.ToUpper(t.name)
+	if len(t.args) == 0 {
+		return name
+	}
+
+	params := make([]string, len(t.args))
+	for i, a := range t.args {
+		params[i] = a.databaseTypeName()
+		if i < len(t.fields) && t.fields[i] != "" {
+			params[i] = quoteFieldName(t.fields[i]) + " " + params[i]
+		}
+	}
+	return name + "(" + strings.Join(params, ", ") + ")"
+}
+
+// quoteFieldName delimits a row field name with double quotes unless it is a plain identifier.
+func quoteFieldName(name string) string {
+	for _, r := range name {
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+		}
+	}
+	return name
+}
+
+// precisionScale returns the declared precision and scale of a decimal type, or the
+// fractional second precision of a time or timestamp type along with a zero scale.
+func (t prestoType) precisionScale() (precision, scale int64, ok bool) {
+	switch t.name {
+	case Decimal:
+		if len(t.literals) == 2 {
+			return t.literals[0], t.literals[1], true
+		}
+	case Timestamp, TimestampWithTimezone, Time, TimeWithTimezone:
+		if len(t.literals) == 1 {
+			return t.literals[0], 0, true
+		}
+	}
+	return 0, 0, false
+}
+
+// unboundedVarcharLength is the length older servers declare for a varchar with no limit.
+const unboundedVarcharLength = math.MaxInt32
+
+// length returns the declared length of a character or binary type, or math.MaxInt64
+// when it is unbounded.
+func (t prestoType) length() (length int64, ok bool) {
+	switch t.name {
+	case VarChar:
+		if len(t.literals) == 0 || t.literals[0] == unboundedVarcharLength {
+			return math.MaxInt64, true
+		}
+		return t.literals[0], true
+	case Char:
+		if len(t.literals) == 0 {
+			// char with no length is char(1)
+			return 1, true
+		}
+		return t.literals[0], true
+	case VarBinary:
+		return math.MaxInt64, true
+	}
+	return 0, false
+}
+
+// parseColumnType returns the type of a result column, preferring its structured type
+// signature and falling back to parsing its display type name.
+func parseColumnType(col queryColumn) prestoType {
+	if col.TypeSignature.RawType != "" {
+		if t, err := parseTypeSignature(col.TypeSignature); err == nil {
+			return t
+		}
+	}
+	return parseTypeName(col.Type)
+}
+
+// parseTypeSignature converts a type signature into a prestoType. Both the arguments list
+// sent by current servers and the typeArguments and literalArguments lists sent by older
+// ones are understood.
+func parseTypeSignature(sig typeSignature) (prestoType, error) {
+	t := prestoType{name: strings.ToLower(sig.RawType)}
+
+	if len(sig.Arguments) == 0 {
+		for _, ta := range sig.TypeArguments {
+			at, err := parseTypeSignature(ta)
+			if err != nil {
+				return t, err
+			}
+			t.args = append(t.args, at)
+		}
+		for _, la := range sig.LiteralArguments {
+			switch v := la.(type) {
+			case string:
+				t.fields = append(t.fields, v)
+			case float64:
+				t.literals = append(t.literals, int64(v))
+			}
+		}
+		return t, nil
+	}
+
+	for _, arg := range sig.Arguments {
+		switch arg.Kind {
+		case "TYPE", "TYPE_SIGNATURE":
+			at, err := parseTypeValue(arg.Value)
+			if err != nil {
+				return t, err
+			}
+			t.args = append(t.args, at)
+			t.fields = append(t.fields, "")
+		case "NAMED_TYPE", "NAMED_TYPE_SIGNATURE":
+			var named struct {
+				FieldName *struct {
+					Name string `json:"name"`
+				} `json:"fieldName"`
+				TypeSignature json.RawMessage `json:"typeSignature"`
+			}
+			if err := json.Unmarshal(arg.Value, &named); err != nil {
+				return t, err
+			}
+			at, err := parseTypeValue(named.TypeSignature)
+			if err != nil {
+				return t, err
+			}
+			t.args = append(t.args, at)
+			if named.FieldName != nil {
+				t.fields = append(t.fields, named.FieldName.Name)
+			} else {
+				t.fields = append(t.fields, "")
+			}
+		case "LONG", "LONG_LITERAL":
+			var n int64
+			if err := json.Unmarshal(arg.Value, &n); err != nil {
+				return t, err
+			}
+			t.literals = append(t.literals, n)
+		}
+	}
+	if t.name != Row {
+		t.fields = nil
+	}
+	return t, nil
+}
+
+// parseTypeValue parses a type argument, which is either a nested type signature object or,
+// for some servers, the display name of the type.
+func parseTypeValue(v json.RawMessage) (prestoType, error) {
+	var name string
+	if err := json.Unmarshal(v, &name); err == nil {
+		return parseTypeName(name), nil
+	}
+	var sig typeSignature
+	if err := json.Unmarshal(v, &sig); err != nil {
+		return prestoType{}, err
+	}
+	return parseTypeSignature(sig)
+}
+
+// parseTypeName parses the display name of a type such as "row(a bigint, b array(varchar))".
+func parseTypeName(typ string) prestoType {
+	typ = strings.TrimSpace(typ)
+	name, params := splitType(typ)
+
+	// Precision is given before the suffix of time zone types, e.g. timestamp(3) with time zone
+	if open := strings.IndexRune(typ, '('); open != -1 && !strings.HasSuffix(typ, ")") {
+		if close := strings.IndexRune(typ, ')'); close > open {
+			name, params = typ[:open]+typ[close+1:], strings.Split(typ[open+1:close], ",")
+		}
+	}
+
+	t := prestoType{name: strings.ToLower(name)}
+	if t.name == Row {
+		for _, f := range parseRowFields(typ) {
+			t.fields = append(t.fields, f.name)
+			t.args = append(t.args, parseTypeName(f.typ))
+		}
+		return t
+	}
+	for _, p := range params {
+		if n, err := strconv.ParseInt(strings.TrimSpace(p), 10, 64); err == nil {
+			t.literals = append(t.literals, n)
+			continue
+		}
+		t.args = append(t.args, parseTypeName(p))
+	}
+	return t
+}
+
+// splitType splits a parameterized type such as "map(varchar, array(bigint))" into its base
+// name and its top level parameters, "map" and ["varchar", "array(bigint)"].
+func splitType(typ string) (string, []string) {
+	open := strings.IndexRune(typ, '(')
+	if open == -1 || !strings.HasSuffix(typ, ")") {
+		return strings.TrimSpace(typ), nil
+	}
+
+	var args []string
+	depth, start := 0, open+1
+	inner := typ[:len(typ)-1]
+	for i := start; i < len(inner); i++ {
+		switch inner[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, strings.TrimSpace(inner[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	args = append(args, strings.TrimSpace(inner[start:]))
+	return strings.TrimSpace(typ[:open]), args
+}
+
+// rowField is a single field of a row type given by name.
+type rowField struct {
+	name string
+	typ  string
+}
+
+// multiWordTypes are the types whose names contain spaces, which would otherwise be mistaken
+// for a field name followed by a type when they appear as an anonymous row field.
+var multiWordTypes = []string{TimestampWithTimezone, TimeWithTimezone, IntervalDayToSecond, IntervalYearToMonth}
+
+// parseRowFields parses the fields of a row type such as "row(id varchar, "my field" bigint)".
+// The names of anonymous fields are left empty.
+func parseRowFields(typ string) []rowField {
+	_, args := splitType(typ)
+	fields := make([]rowField, len(args))
+	for i, arg := range args {
+		fields[i] = rowField{typ: arg}
+
+		if strings.HasPrefix(arg, `"`) {
+			// Delimited field name, with embedded quotes doubled
+			for j := 1; j < len(arg); j++ {
+				if arg[j] != '"' {
+					continue
+				}
+				if j+1 < len(arg) && arg[j+1] == '"' {
+					j++
+					continue
+				}
+				fields[i].name = strings.Replace(arg[1:j], `""`, `"`, -1)
+				fields[i].typ = strings.TrimSpace(arg[j+1:])
+				break
+			}
+			continue
+		}
+
+		sp := strings.IndexRune(arg, ' ')
+		if sp == -1 || isMultiWordType(arg) {
+			continue
+		}
+		fields[i].name = arg[:sp]
+		fields[i].typ = strings.TrimSpace(arg[sp+1:])
+	}
+	return fields
+}
+
+func isMultiWordType(typ string) bool {
+	// Strip any precision, e.g. timestamp(3) with time zone
+	if open := strings.IndexRune(typ, '('); open != -1 {
+		if close := strings.IndexRune(typ, ')'); close > open {
+			typ = typ[:open] + typ[close+1:]
+		}
+	}
+	for _, t := range multiWordTypes {
+		if typ == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,232 @@
+package prestgo
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestSplitType(t *testing.T) {
+	testCases := []struct {
+		typ  string
+		name string
+		args []string
+	}{
+		{typ: "bigint", name: "bigint", args: nil},
+		{typ: "varchar(10)", name: "varchar", args: []string{"10"}},
+		{typ: "array(bigint)", name: "array", args: []string{"bigint"}},
+		{typ: "decimal(10,2)", name: "decimal", args: []string{"10", "2"}},
+		{typ: "map(varchar, array(decimal(10,2)))", name: "map", args: []string{"varchar", "array(decimal(10,2))"}},
+		{typ: "row(a bigint, b map(varchar, bigint))", name: "row", args: []string{"a bigint", "b map(varchar, bigint)"}},
+	}
+
+	for _, tc := range testCases {
+		name, args := splitType(tc.typ)
+		if name != tc.name {
+			t.Errorf("%s: got name %q, wanted %q", tc.typ, name, tc.name)
+		}
+		if !reflect.DeepEqual(args, tc.args) {
+			t.Errorf("%s: got args %#v, wanted %#v", tc.typ, args, tc.args)
+		}
+	}
+}
+
+func TestParseRowFields(t *testing.T) {
+	testCases := []struct {
+		typ      string
+		expected []rowField
+	}{
+		{
+			typ:      "row(_id varchar, created double, open boolean)",
+			expected: []rowField{{"_id", "varchar"}, {"created", "double"}, {"open", "boolean"}},
+		},
+		{
+			typ:      `row("first name" varchar, "say ""hi""" bigint)`,
+			expected: []rowField{{"first name", "varchar"}, {`say "hi"`, "bigint"}},
+		},
+		{
+			typ:      "row(bigint, timestamp with time zone, a map(varchar, row(x bigint)))",
+			expected: []rowField{{"", "bigint"}, {"", "timestamp with time zone"}, {"a", "map(varchar, row(x bigint))"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		fields := parseRowFields(tc.typ)
+		if !reflect.DeepEqual(fields, tc.expected) {
+			t.Errorf("%s: got %#v, wanted %#v", tc.typ, fields, tc.expected)
+		}
+	}
+}
+
+func TestParseTypeName(t *testing.T) {
+	testCases := []struct {
+		typ      string
+		expected prestoType
+	}{
+		{
+			typ:      "bigint",
+			expected: prestoType{name: "bigint"},
+		},
+		{
+			typ:      "varchar(10)",
+			expected: prestoType{name: "varchar", literals: []int64{10}},
+		},
+		{
+			typ:      "decimal(10, 2)",
+			expected: prestoType{name: "decimal", literals: []int64{10, 2}},
+		},
+		{
+			typ:      "timestamp(6) with time zone",
+			expected: prestoType{name: "timestamp with time zone", literals: []int64{6}},
+		},
+		{
+			typ: "map(varchar, array(row(x bigint, double)))",
+			expected: prestoType{name: "map", args: []prestoType{
+				{name: "varchar"},
+				{name: "array", args: []prestoType{
+					{name: "row", fields: []string{"x", ""}, args: []prestoType{{name: "bigint"}, {name: "double"}}},
+				}},
+			}},
+		},
+	}
+
+	for _, tc := range testCases {
+		typ := parseTypeName(tc.typ)
+		if !reflect.DeepEqual(typ, tc.expected) {
+			t.Errorf("%s: got %#v, wanted %#v", tc.typ, typ, tc.expected)
+		}
+		if typ.String() != tc.typ {
+			t.Errorf("%s: got string %q", tc.typ, typ.String())
+		}
+	}
+}
+
+func TestParseTypeSignature(t *testing.T) {
+	rowType := prestoType{name: "row", fields: []string{"id", "tags"}, args: []prestoType{
+		{name: "bigint"},
+		{name: "array", args: []prestoType{{name: "varchar", literals: []int64{5}}}},
+	}}
+
+	testCases := []struct {
+		sig      string
+		expected prestoType
+	}{
+		{
+			// Current Trino servers
+			sig: `{"rawType": "row", "arguments": [
+			  {"kind": "NAMED_TYPE", "value": {"fieldName": {"name": "id"}, "typeSignature": {"rawType": "bigint", "arguments": []}}},
+			  {"kind": "NAMED_TYPE", "value": {"fieldName": {"name": "tags"}, "typeSignature": {"rawType": "array", "arguments": [
+			    {"kind": "TYPE", "value": {"rawType": "varchar", "arguments": [{"kind": "LONG", "value": 5}]}}
+			  ]}}}
+			]}`,
+			expected: rowType,
+		},
+		{
+			// Presto servers that send nested signatures as names
+			sig: `{"rawType": "row", "arguments": [
+			  {"kind": "NAMED_TYPE_SIGNATURE", "value": {"fieldName": {"name": "id", "delimited": false}, "typeSignature": "bigint"}},
+			  {"kind": "NAMED_TYPE_SIGNATURE", "value": {"fieldName": {"name": "tags", "delimited": false}, "typeSignature": "array(varchar(5))"}}
+			]}`,
+			expected: rowType,
+		},
+		{
+			// Older Presto servers
+			sig: `{"rawType": "row", "typeArguments": [
+			  {"rawType": "bigint", "typeArguments": [], "literalArguments": []},
+			  {"rawType": "array", "typeArguments": [{"rawType": "varchar", "typeArguments": [], "literalArguments": [5]}], "literalArguments": []}
+			], "literalArguments": ["id", "tags"]}`,
+			expected: rowType,
+		},
+		{
+			sig:      `{"rawType": "timestamp with time zone", "arguments": [{"kind": "LONG_LITERAL", "value": 3}]}`,
+			expected: prestoType{name: "timestamp with time zone", literals: []int64{3}},
+		},
+	}
+
+	for _, tc := range testCases {
+		var sig typeSignature
+		if err := json.Unmarshal([]byte(tc.sig), &sig); err != nil {
+			t.Fatal(err)
+		}
+		typ, err := parseTypeSignature(sig)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tc.sig, err)
+			continue
+		}
+		if !reflect.DeepEqual(typ, tc.expected) {
+			t.Errorf("%s: got %#v, wanted %#v", tc.sig, typ, tc.expected)
+		}
+	}
+}
+
+func TestDatabaseTypeName(t *testing.T) {
+	testCases := []struct {
+		typ      string
+		expected string
+	}{
+		{typ: "varchar(10)", expected: "VARCHAR"},
+		{typ: "bigint", expected: "BIGINT"},
+		{typ: "decimal(10, 2)", expected: "DECIMAL"},
+		{typ: "timestamp(6) with time zone", expected: "TIMESTAMP WITH TIME ZONE"},
+		{typ: "array(integer)", expected: "ARRAY(INTEGER)"},
+		{typ: "map(varchar(5), array(bigint))", expected: "MAP(VARCHAR, ARRAY(BIGINT))"},
+		{typ: `row(id bigint, "my ""field""" varchar, double)`, expected: `ROW(id BIGINT, "my ""field""" VARCHAR, DOUBLE)`},
+	}
+
+	for _, tc := range testCases {
+		name := parseTypeName(tc.typ).databaseTypeName()
+		if name != tc.expected {
+			t.Errorf("%s: got %q, wanted %q", tc.typ, name, tc.expected)
+		}
+	}
+}
+
+func TestPrecisionScale(t *testing.T) {
+	testCases := []struct {
+		typ       string
+		precision int64
+		scale     int64
+		ok        bool
+	}{
+		{typ: "decimal(10, 2)", precision: 10, scale: 2, ok: true},
+		{typ: "decimal(38,0)", precision: 38, scale: 0, ok: true},
+		{typ: "timestamp(6)", precision: 6, ok: true},
+		{typ: "timestamp(3) with time zone", precision: 3, ok: true},
+		{typ: "time(9)", precision: 9, ok: true},
+		{typ: "timestamp"},
+		{typ: "varchar(10)"},
+		{typ: "bigint"},
+	}
+
+	for _, tc := range testCases {
+		precision, scale, ok := parseTypeName(tc.typ).precisionScale()
+		if precision != tc.precision || scale != tc.scale || ok != tc.ok {
+			t.Errorf("%s: got %d, %d, %v, wanted %d, %d, %v", tc.typ, precision, scale, ok, tc.precision, tc.scale, tc.ok)
+		}
+	}
+}
+
+func TestLength(t *testing.T) {
+	testCases := []struct {
+		typ    string
+		length int64
+		ok     bool
+	}{
+		{typ: "varchar(10)", length: 10, ok: true},
+		{typ: "varchar", length: math.MaxInt64, ok: true},
+		{typ: "varchar(2147483647)", length: math.MaxInt64, ok: true},
+		{typ: "char(3)", length: 3, ok: true},
+		{typ: "char", length: 1, ok: true},
+		{typ: "varbinary", length: math.MaxInt64, ok: true},
+		{typ: "bigint"},
+		{typ: "decimal(10, 2)"},
+	}
+
+	for _, tc := range testCases {
+		length, ok := parseTypeName(tc.typ).length()
+		if length != tc.length || ok != tc.ok {
+			t.Errorf("%s: got %d, %v, wanted %d, %v", tc.typ, length, ok, tc.length, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package prestgo
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// wireLogBody reads a response body, logging the exchange that produced it when it is
+// closed so that the bytes received can be reported along with the status and latency.
+type wireLogBody struct {
+	io.ReadCloser
+	logger  Logger
+	req     *http.Request
+	status  string
+	start   time.Time
+	headers time.Duration // time taken to receive the response headers
+	n       int64         // bytes read from the body
+	closed  bool
+}
+
+// logWireResponse arranges for the exchange of req, sent at start, and resp to be logged
+// when the response body is closed.
+func logWireResponse(l Logger, req *http.Request, resp *http.Response, start time.Time) {
+	resp.Body = &wireLogBody{
+		ReadCloser: resp.Body,
+		logger:     l,
+		req:        req,
+		status:     resp.Status,
+		start:      start,
+		headers:    time.Since(start),
+	}
+}
+
+// logWireError logs the failure of req, sent at start, to receive a response.
+func logWireError(l Logger, req *http.Request, start time.Time, err error) {
+	logf(l, LogDebug, "%s: %s %s failed after %v: %v", DriverName, req.Method, redactURL(req.URL), time.Since(start), err)
+}
+
+func (b *wireLogBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+func (b *wireLogBody) Close() error {
+	err := b.ReadCloser.Close()
+	if !b.closed {
+		b.closed = true
+		sent := b.req.ContentLength
+		if sent < 0 {
+			sent = 0
+		}
+		logf(b.logger, LogDebug, "%s: %s %s %s in %v, %d bytes sent, %d bytes received in %v", DriverName,
+			b.req.Method, redactURL(b.req.URL), b.status, b.headers, sent, b.n, time.Since(b.start))
+	}
+	return err
+}
+
+// redactURL returns u as a string with any password it contains replaced and its query
+// string removed, so that it may be logged without revealing credentials. The URIs of
+// spooled segments are presigned, carrying the credentials to read them in their query.
+func redactURL(u *url.URL) string {
+	redacted := *u
+	redacted.RawQuery = ""
+	redacted.ForceQuery = false
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			redacted.User = url.UserPassword(u.User.Username(), "xxxxx")
+		}
+	}
+	return redacted.String()
+}